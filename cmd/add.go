@@ -18,7 +18,6 @@ package cmd
 
 import (
 	"os"
-	"path/filepath"
 
 	"github.com/greytabby/mygit/git"
 	"github.com/spf13/cobra"
@@ -36,19 +35,13 @@ func NewAddCommand() *cobra.Command {
 }
 
 func cmdAdd(cmd *cobra.Command, args []string) {
-	worktree, _ := cmd.Flags().GetString("d")
-	if worktree == "" {
-		worktree = "./"
-	}
-	gitDir, err := git.FindRepo(worktree)
+	repo, err := openRepo(cmd)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
-	dir := filepath.Dir(gitDir)
-	repo, err := git.NewGitRepository(dir)
-	if err != nil {
-		cmd.Println(err)
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
 		return
 	}
 
@@ -0,0 +1,140 @@
+package cmd
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewBlameCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "blame [-L RANGE] [-w] [-M] [-C] [-l] [-s] [-e] [-f] [--porcelain|--line-porcelain] [--ignore-rev REV] [REV] [--] FILE",
+		Short: "show what revision and author last modified each line of a file",
+		Long: `annotate each line of FILE with the commit which introduced it, walking history from REV, or from the worktree if REV is omitted.
+revisions listed in the file of blame.ignoreRevsFile, or .git-blame-ignore-revs at the top of the worktree if it is not set, are ignored.`,
+		Run: cmdBlame,
+	}
+	cmd.Flags().StringArrayP("L", "L", nil, `annotate only the line range "N,M", "N,+K", "N,-K" or "/REGEX/,M".`)
+	cmd.Flags().BoolP("w", "w", false, "ignore whitespace when comparing lines.")
+	cmd.Flags().BoolP("M", "M", false, "detect lines moved or copied within the file.")
+	cmd.Flags().CountP("C", "C", "detect lines moved or copied from other files modified in the same commit, or from any file if given twice.")
+	cmd.Flags().BoolP("l", "l", false, "show full object names.")
+	cmd.Flags().BoolP("s", "s", false, "suppress the author name and timestamp.")
+	cmd.Flags().BoolP("show-email", "e", false, "show the author email instead of the name.")
+	cmd.Flags().BoolP("show-name", "f", false, "show the filename in the original commit.")
+	cmd.Flags().BoolP("porcelain", "p", false, "show in a format designed for machine consumption.")
+	cmd.Flags().Bool("line-porcelain", false, "show the porcelain format with commit information for each line.")
+	cmd.Flags().StringArray("ignore-rev", nil, "ignore changes made by the revision.")
+	cmd.Flags().StringArray("ignore-revs-file", nil, `ignore revisions listed in the file. an empty name clears files read before.`)
+	return cmd
+}
+
+func cmdBlame(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var opts git.BlameOptions
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		if dash > 1 || len(args) != dash+1 {
+			cmd.Println(cmd.Usage())
+			return
+		}
+		if dash == 1 {
+			opts.Rev = args[0]
+		}
+	} else if len(args) == 2 {
+		opts.Rev = args[0]
+	} else if len(args) != 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	if opts.Rev == "" && repo.Bare {
+		opts.Rev = "HEAD"
+	}
+	paths, err := repoPathspecs(repo, args[len(args)-1:])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	opts.Path = paths[0]
+	opts.IgnoreWhitespace, _ = cmd.Flags().GetBool("w")
+	opts.Moves, _ = cmd.Flags().GetBool("M")
+	opts.Copies, _ = cmd.Flags().GetCount("C")
+	if opts.IgnoreRevs, err = blameIgnoreRevs(cmd, repo); err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	lines, err := git.Blame(repo, opts)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var format git.BlameFormat
+	for _, line := range lines {
+		// filenames are shown if some lines come from other paths
+		format.ShowName = format.ShowName || line.Path != opts.Path
+	}
+	ranges, _ := cmd.Flags().GetStringArray("L")
+	if lines, err = git.SelectBlameLines(lines, opts.Path, ranges); err != nil {
+		cmd.Println(err)
+		return
+	}
+	format.Porcelain, _ = cmd.Flags().GetBool("porcelain")
+	format.LinePorcelain, _ = cmd.Flags().GetBool("line-porcelain")
+	format.LongSha, _ = cmd.Flags().GetBool("l")
+	format.NoAuthor, _ = cmd.Flags().GetBool("s")
+	format.ShowEmail, _ = cmd.Flags().GetBool("show-email")
+	if showName, _ := cmd.Flags().GetBool("show-name"); showName {
+		format.ShowName = true
+	}
+	if err := git.WriteBlame(cmd.OutOrStdout(), lines, format); err != nil {
+		cmd.Println(err)
+	}
+}
+
+// blameIgnoreRevs return revisions to be ignored, from blame.ignoreRevsFile or .git-blame-ignore-revs,
+// --ignore-revs-file and --ignore-rev in this order.
+func blameIgnoreRevs(cmd *cobra.Command, repo *git.GitRepository) ([]string, error) {
+	cfg, err := git.LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	if file, ok := cfg.GetPath("blame.ignoreRevsFile"); ok {
+		if file != "" && !filepath.IsAbs(file) && !repo.Bare {
+			file = filepath.Join(repo.Worktree, file)
+		}
+		files = append(files, file)
+	} else if !repo.Bare {
+		file := filepath.Join(repo.Worktree, ".git-blame-ignore-revs")
+		if _, err := os.Stat(file); err == nil {
+			files = append(files, file)
+		}
+	}
+	flagFiles, _ := cmd.Flags().GetStringArray("ignore-revs-file")
+	for _, file := range flagFiles {
+		if file == "" {
+			files = nil
+			continue
+		}
+		files = append(files, file)
+	}
+	var revs []string
+	for _, file := range files {
+		if file == "" {
+			continue
+		}
+		listed, err := git.ReadBlameIgnoreRevs(file)
+		if err != nil {
+			return nil, err
+		}
+		revs = append(revs, listed...)
+	}
+	flagRevs, _ := cmd.Flags().GetStringArray("ignore-rev")
+	return append(revs, flagRevs...), nil
+}
@@ -0,0 +1,279 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+var (
+	errBranchArgs   = errors.New("too many or too few branch names")
+	errDetachedHead = errors.New("HEAD is not on any branch")
+)
+
+func NewBranchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "branch [BRANCH [START POINT]]",
+		Short: "list, create, rename or delete branches",
+		Long:  `list, create, rename or delete branches`,
+		Run:   cmdBranch,
+	}
+	cmd.Flags().BoolP("verbose", "v", false, "show hash and subject of each branch.")
+	cmd.Flags().BoolP("remotes", "r", false, "list remote-tracking branches.")
+	cmd.Flags().BoolP("all", "a", false, "list both local and remote-tracking branches.")
+	cmd.Flags().String("merged", "", "list only branches merged into the commit.")
+	cmd.Flags().Lookup("merged").NoOptDefVal = "HEAD"
+	cmd.Flags().String("no-merged", "", "list only branches not merged into the commit.")
+	cmd.Flags().Lookup("no-merged").NoOptDefVal = "HEAD"
+	cmd.Flags().String("contains", "", "list only branches which contain the commit.")
+	cmd.Flags().Lookup("contains").NoOptDefVal = "HEAD"
+	cmd.Flags().Bool("delete", false, "delete fully merged branches.")
+	cmd.Flags().BoolP("D", "D", false, "delete branches even if not merged.")
+	cmd.Flags().BoolP("move", "m", false, "rename branch.")
+	cmd.Flags().BoolP("M", "M", false, "rename branch even if new branch name exists.")
+	cmd.Flags().BoolP("force", "f", false, "reset branch to start point even if branch exists.")
+	cmd.Flags().StringP("set-upstream-to", "u", "", "set upstream of the branch.")
+	cmd.Flags().Bool("unset-upstream", false, "remove upstream of the branch.")
+	return cmd
+}
+
+func cmdBranch(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	force, _ := cmd.Flags().GetBool("force")
+	deleteMerged, _ := cmd.Flags().GetBool("delete")
+	deleteForce, _ := cmd.Flags().GetBool("D")
+	move, _ := cmd.Flags().GetBool("move")
+	moveForce, _ := cmd.Flags().GetBool("M")
+	upstream, _ := cmd.Flags().GetString("set-upstream-to")
+	unsetUpstream, _ := cmd.Flags().GetBool("unset-upstream")
+
+	switch {
+	case deleteMerged || deleteForce:
+		if len(args) == 0 {
+			cmd.Println("branch name required")
+			return
+		}
+		for _, name := range args {
+			sha, _ := git.ResolveRef(repo, git.BranchRef(name))
+			if err := git.DeleteBranch(repo, name, deleteForce || force); err != nil {
+				cmd.Println(err)
+				continue
+			}
+			cmd.Printf("Deleted branch %s (was %s).\n", name, abbrev(sha))
+		}
+	case move || moveForce:
+		oldName, newName, err := branchPair(repo, args)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if err := git.RenameBranch(repo, oldName, newName, moveForce || force); err != nil {
+			cmd.Println(err)
+		}
+	case upstream != "":
+		branch, err := branchOrCurrent(repo, args)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if err := git.SetUpstream(repo, branch, upstream); err != nil {
+			cmd.Println(err)
+			return
+		}
+		cmd.Printf("branch '%s' set up to track '%s'.\n", branch, upstream)
+	case unsetUpstream:
+		branch, err := branchOrCurrent(repo, args)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if err := git.UnsetUpstream(repo, branch); err != nil {
+			cmd.Println(err)
+		}
+	case len(args) > 0 && !branchFilterChanged(cmd):
+		start := "HEAD"
+		if len(args) > 1 {
+			start = args[1]
+		}
+		sha, err := git.ResolveCommit(repo, start)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if err := git.CreateBranch(repo, args[0], sha, start, force); err != nil {
+			cmd.Println(err)
+		}
+	default:
+		listBranches(cmd, repo, args)
+	}
+}
+
+var branchFilterFlags = []string{"merged", "no-merged", "contains"}
+
+func branchFilterChanged(cmd *cobra.Command) bool {
+	for _, name := range branchFilterFlags {
+		if cmd.Flags().Changed(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func listBranches(cmd *cobra.Command, repo *git.GitRepository, args []string) {
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	remotes, _ := cmd.Flags().GetBool("remotes")
+	all, _ := cmd.Flags().GetBool("all")
+
+	filters := map[string]string{}
+	for _, name := range branchFilterFlags {
+		if !cmd.Flags().Changed(name) {
+			continue
+		}
+		// "--merged <commit>" is parsed as a flag without value and a positional argument.
+		rev, _ := cmd.Flags().GetString(name)
+		if rev == "HEAD" && len(args) > 0 {
+			rev, args = args[0], args[1:]
+		}
+		sha, err := git.ResolveCommit(repo, rev)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		filters[name] = sha
+	}
+
+	var refs []*git.GitRef
+	if !remotes || all {
+		branches, err := git.ListBranches(repo)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		refs = append(refs, branches...)
+	}
+	if remotes || all {
+		remoteRefs, err := git.ListRefs(repo, "refs/remotes/")
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		refs = append(refs, remoteRefs...)
+	}
+
+	current, _ := git.CurrentBranch(repo)
+	var shown []*git.GitRef
+	width := 0
+	for _, ref := range refs {
+		ok, err := matchBranchFilters(repo, ref.Sha, filters)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if !ok {
+			continue
+		}
+		shown = append(shown, ref)
+		if n := len(branchDisplayName(ref.Name, all)); n > width {
+			width = n
+		}
+	}
+
+	for _, ref := range shown {
+		mark := "  "
+		if ref.Name == current {
+			mark = "* "
+		}
+		name := branchDisplayName(ref.Name, all)
+		if ref.IsSymbolic() {
+			cmd.Printf("%s%s -> %s\n", mark, name, git.ShortRefName(ref.Target))
+			continue
+		}
+		if !verbose {
+			cmd.Printf("%s%s\n", mark, name)
+			continue
+		}
+		subject := ""
+		if commit, err := git.ReadCommit(repo, ref.Sha); err == nil {
+			subject = commit.Subject()
+		}
+		cmd.Printf("%s%-*s %s %s\n", mark, width, name, abbrev(ref.Sha), subject)
+	}
+}
+
+func matchBranchFilters(repo *git.GitRepository, sha string, filters map[string]string) (bool, error) {
+	if sha == "" {
+		return false, nil
+	}
+	if target, ok := filters["merged"]; ok {
+		merged, err := git.IsAncestor(repo, sha, target)
+		if err != nil || !merged {
+			return false, err
+		}
+	}
+	if target, ok := filters["no-merged"]; ok {
+		merged, err := git.IsAncestor(repo, sha, target)
+		if err != nil || merged {
+			return false, err
+		}
+	}
+	if target, ok := filters["contains"]; ok {
+		contains, err := git.IsAncestor(repo, target, sha)
+		if err != nil || !contains {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+func branchDisplayName(name string, all bool) string {
+	if all && strings.HasPrefix(name, "refs/remotes/") {
+		return "remotes/" + git.ShortRefName(name)
+	}
+	return git.ShortRefName(name)
+}
+
+// branchPair return (old, new) branch name. old is current branch if omitted.
+func branchPair(repo *git.GitRepository, args []string) (string, string, error) {
+	switch len(args) {
+	case 1:
+		current, err := currentBranchName(repo)
+		return current, args[0], err
+	case 2:
+		return args[0], args[1], nil
+	default:
+		return "", "", errBranchArgs
+	}
+}
+
+func branchOrCurrent(repo *git.GitRepository, args []string) (string, error) {
+	if len(args) > 0 {
+		return args[0], nil
+	}
+	return currentBranchName(repo)
+}
+
+func currentBranchName(repo *git.GitRepository) (string, error) {
+	current, err := git.CurrentBranch(repo)
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
+		return "", errDetachedHead
+	}
+	return strings.TrimPrefix(current, "refs/heads/"), nil
+}
+
+// abbrev return abbreviated object hash.
+func abbrev(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
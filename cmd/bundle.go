@@ -0,0 +1,174 @@
+package cmd
+
+import (
+	"bytes"
+	"io/ioutil"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewBundleCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "bundle",
+		Short: "move objects and refs by archive",
+		Long: `move objects and refs by archive. a bundle file can be cloned and fetched like a remote repository,
+for example "mygit clone repo.bundle" or "mygit fetch repo.bundle master".`,
+	}
+	create := &cobra.Command{
+		Use:   "create [--version N] FILE [--all|--branches|--tags|--remotes] [REV-LIST-ARGS...]",
+		Short: "create a bundle",
+		Long: `create a bundle of refs given by REV-LIST-ARGS, which are --all, --branches, --tags, --remotes,
+REF, ^REV and REV..REF. commits reachable from REV are omitted, and they are required to unbundle.
+the bundle is written to stdout if FILE is "-".`,
+		Run: cmdBundleCreate,
+	}
+	create.Flags().Int("version", 2, "bundle format version. 2 or 3.")
+	create.Flags().Bool("all", false, "include HEAD and all refs.")
+	create.Flags().Bool("branches", false, "include all branches.")
+	create.Flags().Bool("tags", false, "include all tags.")
+	create.Flags().Bool("remotes", false, "include all remote-tracking branches.")
+	cmd.AddCommand(create)
+	verify := &cobra.Command{
+		Use:   "verify [-q] FILE",
+		Short: "check that a bundle is valid and can be applied to the repository",
+		Long:  `check that a bundle is valid and the repository has its prerequisite commits.`,
+		Run:   cmdBundleVerify,
+	}
+	verify.Flags().BoolP("quiet", "q", false, "print only errors.")
+	cmd.AddCommand(verify)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "list-heads FILE [REFNAME...]",
+		Short: "list refs in a bundle",
+		Long:  `list refs in a bundle. only REFNAMEs are listed if they are given.`,
+		Run:   cmdBundleListHeads,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "unbundle FILE [REFNAME...]",
+		Short: "store objects of a bundle into the repository",
+		Long:  `store objects of a bundle into the repository and print its refs. refs are not updated.`,
+		Run:   cmdBundleUnbundle,
+	})
+	return cmd
+}
+
+func cmdBundleCreate(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	revs := args[1:]
+	for _, flag := range []string{"all", "branches", "tags", "remotes"} {
+		if set, _ := cmd.Flags().GetBool(flag); set {
+			revs = append(revs, "--"+flag)
+		}
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	version, _ := cmd.Flags().GetInt("version")
+	var b bytes.Buffer
+	if _, err := git.CreateBundle(repo, &b, revs, version); err != nil {
+		cmd.Println(err)
+		return
+	}
+	if args[0] == "-" {
+		cmd.OutOrStdout().Write(b.Bytes())
+		return
+	}
+	if err := ioutil.WriteFile(args[0], b.Bytes(), 0644); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdBundleVerify(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	// a bundle without prerequisites can be verified outside of repository
+	repo, _ := openRepo(cmd)
+	b, err := git.VerifyBundle(repo, args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if quiet, _ := cmd.Flags().GetBool("quiet"); quiet {
+		return
+	}
+	printBundleRefs(cmd, "The bundle contains this ref:", "The bundle contains these %d refs:", b.Refs)
+	if len(b.Prerequisites) == 0 {
+		cmd.Println("The bundle records a complete history.")
+	} else {
+		printBundleRefs(cmd, "The bundle requires this ref:", "The bundle requires these %d refs:", b.Prerequisites)
+	}
+	cmd.Printf("The bundle uses this hash algorithm: sha1\n")
+	if b.Filter != "" {
+		cmd.Printf("The bundle uses this filter: %s\n", b.Filter)
+	}
+	cmd.PrintErrf("%s is okay\n", args[0])
+}
+
+func printBundleRefs(cmd *cobra.Command, one, many string, refs []*git.BundleRef) {
+	if len(refs) == 1 {
+		cmd.Println(one)
+	} else {
+		cmd.Printf(many+"\n", len(refs))
+	}
+	for _, ref := range refs {
+		cmd.Printf("%s %s\n", ref.Sha, ref.Name)
+	}
+}
+
+func cmdBundleListHeads(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	b, err := git.ReadBundle(args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	printBundleHeads(cmd, b, args[1:])
+}
+
+func cmdBundleUnbundle(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	b, err := git.Unbundle(repo, args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	printBundleHeads(cmd, b, args[1:])
+}
+
+// printBundleHeads print refs of the bundle. only refs in names are printed if names are given.
+func printBundleHeads(cmd *cobra.Command, b *git.Bundle, names []string) {
+	for _, ref := range b.Refs {
+		if len(names) > 0 && !matchBundleRef(ref.Name, names) {
+			continue
+		}
+		cmd.Printf("%s %s\n", ref.Sha, ref.Name)
+	}
+}
+
+// matchBundleRef return true if ref is one of names. names may be short like "master".
+func matchBundleRef(ref string, names []string) bool {
+	for _, name := range names {
+		if ref == name || git.ShortRefName(ref) == name {
+			return true
+		}
+	}
+	return false
+}
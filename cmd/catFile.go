@@ -16,8 +16,6 @@ limitations under the License.
 package cmd
 
 import (
-	"path/filepath"
-
 	"github.com/greytabby/mygit/git"
 	"github.com/spf13/cobra"
 )
@@ -39,19 +37,8 @@ func cmdCatFile(cmd *cobra.Command, args []string) {
 		cmd.Println(cmd.Usage())
 		return
 	}
-	worktree, _ := cmd.Flags().GetString("d")
-	if worktree == "" {
-		worktree = "./"
-	}
-	gitDir, err := git.FindRepo(worktree)
-	if err != nil {
-		cmd.Println(err)
-		return
-	}
-	dir := filepath.Dir(gitDir)
-
 	objType, _ := cmd.Flags().GetString("type")
-	repo, err := git.NewGitRepository(dir)
+	repo, err := openRepo(cmd)
 	if err != nil {
 		cmd.Println(err)
 		return
@@ -0,0 +1,71 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewCherryPickCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "cherry-pick [-n] [-x] [-m PARENT] COMMIT... | --continue | --skip | --abort",
+		Short: "apply the changes introduced by some existing commits",
+		Long: `apply the changes introduced by each COMMIT on HEAD, and record a new commit for each.
+COMMIT may be a range "A..B", which picks commits reachable from B but not from A, from older ones.
+the operation stops at conflicts, and is resumed by --continue or --skip, or cancelled by --abort.`,
+		Run: cmdCherryPick,
+	}
+	addSequencerFlags(cmd)
+	cmd.Flags().BoolP("x", "x", false, `append "(cherry picked from commit ...)" to the commit message.`)
+	return cmd
+}
+
+func addSequencerFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("no-commit", "n", false, "apply the changes to the index and worktree without committing.")
+	cmd.Flags().IntP("mainline", "m", 0, "the parent number of merge commits to compare with.")
+	cmd.Flags().Bool("continue", false, "continue the operation after resolving conflicts.")
+	cmd.Flags().Bool("skip", false, "skip the current commit and continue the operation.")
+	cmd.Flags().Bool("abort", false, "cancel the operation and restore the state before it.")
+}
+
+func cmdCherryPick(cmd *cobra.Command, args []string) {
+	runSequencer(cmd, args, false)
+}
+
+// runSequencer run cherry-pick or revert.
+func runSequencer(cmd *cobra.Command, args []string, revert bool) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	out := cmd.OutOrStdout()
+	if cont, _ := cmd.Flags().GetBool("continue"); cont {
+		err = git.ContinueSequencer(repo, out)
+	} else if skip, _ := cmd.Flags().GetBool("skip"); skip {
+		err = git.SkipSequencer(repo, out)
+	} else if abort, _ := cmd.Flags().GetBool("abort"); abort {
+		err = git.AbortSequencer(repo)
+	} else {
+		if len(args) == 0 {
+			cmd.Println(cmd.Usage())
+			return
+		}
+		opts := git.SequencerOptions{Revert: revert}
+		opts.NoCommit, _ = cmd.Flags().GetBool("no-commit")
+		opts.Mainline, _ = cmd.Flags().GetInt("mainline")
+		if !revert {
+			opts.RecordOrigin, _ = cmd.Flags().GetBool("x")
+		}
+		var commits []string
+		if commits, err = git.SequencerCommits(repo, args, revert); err == nil {
+			err = git.StartSequencer(repo, out, commits, opts)
+		}
+	}
+	if err != nil {
+		cmd.Println(err)
+	}
+}
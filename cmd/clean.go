@@ -0,0 +1,218 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewCleanCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clean [-d] [-f] [-i] [-n] [-q] [-e PATTERN] [-x|-X] [--] [PATHSPEC...]",
+		Short: "remove untracked files from the working tree",
+		Long: `remove files which are not tracked in the index, except files ignored by the standard ignore rules.
+nested repositories are not removed unless -f is given twice. -f is required unless clean.requireForce is false.
+
+-d      remove untracked directories too. it takes the place of -d for the repository directory.
+-x      do not use the standard ignore rules, removing ignored files too.
+-X      remove only files ignored by the standard ignore rules.`,
+		Run: cmdClean,
+	}
+	cmd.Flags().BoolP("d", "d", false, "remove untracked directories too.")
+	cmd.Flags().CountP("force", "f", "remove files, and nested repositories if given twice.")
+	cmd.Flags().BoolP("interactive", "i", false, "show what would be done and clean files interactively.")
+	cmd.Flags().BoolP("dry-run", "n", false, "only show what would be removed.")
+	cmd.Flags().BoolP("quiet", "q", false, "only report errors.")
+	cmd.Flags().StringArrayP("exclude", "e", nil, "use the ignore pattern in addition to the standard ignore rules.")
+	cmd.Flags().BoolP("x", "x", false, "do not use the standard ignore rules, removing ignored files too.")
+	cmd.Flags().BoolP("X", "X", false, "remove only files ignored by the standard ignore rules.")
+	shortOnly(cmd, "d", "x", "X")
+	return cmd
+}
+
+func cmdClean(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	force, _ := cmd.Flags().GetCount("force")
+	interactive, _ := cmd.Flags().GetBool("interactive")
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	cfg, err := git.LoadConfig(repo)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	requireForce, err := cfg.GetBool("clean.requireForce", true)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if requireForce && force == 0 && !interactive && !dryRun {
+		cmd.Println("clean.requireForce defaults to true and neither -i, -n, nor -f given; refusing to clean")
+		return
+	}
+
+	var opts git.CleanOptions
+	opts.Directories, _ = cmd.Flags().GetBool("d")
+	opts.Nested = force > 1
+	opts.NoIgnore, _ = cmd.Flags().GetBool("x")
+	opts.OnlyIgnored, _ = cmd.Flags().GetBool("X")
+	if opts.NoIgnore && opts.OnlyIgnored {
+		cmd.Println("-x and -X cannot be used together")
+		return
+	}
+	opts.Excludes, _ = cmd.Flags().GetStringArray("exclude")
+	if opts.Pathspecs, err = repoPathspecs(repo, args); err != nil {
+		cmd.Println(err)
+		return
+	}
+	candidates, err := git.CleanCandidates(repo, opts)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	out := cmd.OutOrStdout()
+	if interactive && !dryRun {
+		if candidates = selectCleanCandidates(cmd.InOrStdin(), out, candidates); len(candidates) == 0 {
+			return
+		}
+	}
+
+	for _, name := range candidates {
+		if dryRun {
+			fmt.Fprintf(out, "Would remove %s\n", name)
+			continue
+		}
+		if !quiet {
+			fmt.Fprintf(out, "Removing %s\n", name)
+		}
+		if err := git.RemoveUntracked(repo, name); err != nil {
+			cmd.Println(err)
+		}
+	}
+}
+
+const cleanHelp = `clean               - start cleaning
+filter by pattern   - exclude items from deletion
+select by numbers   - select items to be deleted by numbers
+ask each            - confirm each deletion (like "rm -i")
+quit                - stop cleaning
+help                - this screen
+`
+
+// selectCleanCandidates let the user choose candidates to be removed interactively.
+func selectCleanCandidates(in io.Reader, out io.Writer, candidates []string) []string {
+	scanner := bufio.NewScanner(in)
+	prompt := func(s string) (string, bool) {
+		fmt.Fprint(out, s)
+		if !scanner.Scan() {
+			return "", false
+		}
+		return strings.TrimSpace(scanner.Text()), true
+	}
+	for len(candidates) > 0 {
+		if len(candidates) == 1 {
+			fmt.Fprintln(out, "Would remove the following item:")
+		} else {
+			fmt.Fprintln(out, "Would remove the following items:")
+		}
+		for _, name := range candidates {
+			fmt.Fprintf(out, "  %s\n", name)
+		}
+		fmt.Fprint(out, `*** Commands ***
+    1: clean                2: filter by pattern    3: select by numbers
+    4: ask each             5: quit                 6: help
+`)
+		choice, ok := prompt("What now> ")
+		if !ok {
+			return nil
+		}
+		switch choice {
+		case "1", "c", "clean":
+			return candidates
+		case "2", "f", "filter by pattern":
+			for {
+				line, ok := prompt("Input ignore patterns>> ")
+				if !ok || line == "" {
+					break
+				}
+				candidates = git.FilterCleanCandidates(candidates, strings.Fields(line))
+			}
+		case "3", "s", "select by numbers":
+			for i, name := range candidates {
+				fmt.Fprintf(out, "  %2d: %s\n", i+1, name)
+			}
+			line, ok := prompt("Select items to delete>> ")
+			if ok && line != "" {
+				candidates = selectByNumbers(candidates, line)
+			}
+		case "4", "a", "ask each":
+			var selected []string
+			for _, name := range candidates {
+				answer, ok := prompt(fmt.Sprintf("Remove %s [y/N]? ", name))
+				if !ok {
+					break
+				}
+				if strings.HasPrefix(strings.ToLower(answer), "y") {
+					selected = append(selected, name)
+				}
+			}
+			return selected
+		case "5", "q", "quit":
+			fmt.Fprintln(out, "Bye.")
+			return nil
+		case "6", "h", "help", "?":
+			fmt.Fprint(out, cleanHelp)
+		default:
+			fmt.Fprintf(out, "Huh (%s)?\n", choice)
+		}
+	}
+	fmt.Fprintln(out, "No more files to clean, exiting.")
+	return nil
+}
+
+// selectByNumbers return candidates chosen by numbers like "1 3-5", or "*" for all.
+func selectByNumbers(candidates []string, line string) []string {
+	selected := make([]bool, len(candidates))
+	for _, field := range strings.FieldsFunc(line, func(r rune) bool { return r == ' ' || r == ',' }) {
+		if field == "*" {
+			return candidates
+		}
+		lo, hi := field, field
+		if i := strings.Index(field, "-"); i >= 0 {
+			lo, hi = field[:i], field[i+1:]
+		}
+		from, err1 := strconv.Atoi(lo)
+		to, err2 := strconv.Atoi(hi)
+		if hi == "" {
+			to, err2 = len(candidates), nil
+		}
+		if err1 != nil || err2 != nil {
+			continue
+		}
+		for n := from; n <= to; n++ {
+			if n >= 1 && n <= len(candidates) {
+				selected[n-1] = true
+			}
+		}
+	}
+	var chosen []string
+	for i, name := range candidates {
+		if selected[i] {
+			chosen = append(chosen, name)
+		}
+	}
+	return chosen
+}
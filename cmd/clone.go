@@ -0,0 +1,110 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewCloneCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "clone [OPTIONS] URL [DIRECTORY]",
+		Short: "clone a repository into a new directory",
+		Long:  `clone a repository into a new directory`,
+		Run:   cmdClone,
+	}
+	cmd.Flags().Bool("bare", false, "make a bare repository.")
+	cmd.Flags().StringP("branch", "b", "", "checkout the branch or tag instead of remote HEAD.")
+	cmd.Flags().StringP("origin", "o", "origin", "use the name instead of origin for the remote.")
+	cmd.Flags().BoolP("no-checkout", "n", false, "do not checkout HEAD after clone.")
+	cmd.Flags().BoolP("quiet", "q", false, "do not print progress.")
+	cmd.Flags().String("filter", "", "make a partial clone which omits objects by filter. (blob:none, blob:limit=<n>, tree:<depth>)")
+	addShallowFlags(cmd)
+	return cmd
+}
+
+// addShallowFlags add flags which limit history of fetch and clone.
+func addShallowFlags(cmd *cobra.Command) {
+	cmd.Flags().Int("depth", 0, "limit history to the number of commits from the tip of each ref.")
+	cmd.Flags().String("shallow-since", "", "limit history to commits after the date.")
+	cmd.Flags().StringArray("shallow-exclude", nil, "exclude commits reachable from the remote branch or tag.")
+}
+
+// shallowOptions return options given by flags of addShallowFlags.
+func shallowOptions(cmd *cobra.Command) (git.ShallowOptions, error) {
+	var opts git.ShallowOptions
+	opts.Depth, _ = cmd.Flags().GetInt("depth")
+	opts.ShallowExclude, _ = cmd.Flags().GetStringArray("shallow-exclude")
+	if opts.Depth < 0 {
+		return opts, fmt.Errorf("depth %d is not a positive number", opts.Depth)
+	}
+	if since, _ := cmd.Flags().GetString("shallow-since"); since != "" {
+		t, err := git.ParseDate(since, time.Now())
+		if err != nil {
+			return opts, err
+		}
+		opts.ShallowSince = t
+	}
+	return opts, nil
+}
+
+func cmdClone(cmd *cobra.Command, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	var opts git.CloneOptions
+	opts.Bare, _ = cmd.Flags().GetBool("bare")
+	opts.Branch, _ = cmd.Flags().GetString("branch")
+	opts.Origin, _ = cmd.Flags().GetString("origin")
+	opts.NoCheckout, _ = cmd.Flags().GetBool("no-checkout")
+	opts.Filter, _ = cmd.Flags().GetString("filter")
+	shallow, err := shallowOptions(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	opts.ShallowOptions = shallow
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	if !quiet {
+		opts.Progress = cmd.ErrOrStderr()
+	}
+
+	url := args[0]
+	dir := cloneDirectory(url, opts.Bare)
+	if len(args) == 2 {
+		dir = args[1]
+	}
+	if !quiet {
+		if opts.Bare {
+			cmd.PrintErrf("Cloning into bare repository '%s'...\n", dir)
+		} else {
+			cmd.PrintErrf("Cloning into '%s'...\n", dir)
+		}
+	}
+	if _, err := git.Clone(url, dir, opts); err != nil {
+		if errors.Is(err, git.ErrEmptyRepository) || errors.Is(err, git.ErrNoRemoteHead) {
+			cmd.PrintErrf("warning: %s\n", err)
+			return
+		}
+		cmd.Println(err)
+	}
+}
+
+// cloneDirectory return directory name guessed from URL. ex) "https://host/foo.git", "host:foo.git", "foo.bundle" -> "foo"
+func cloneDirectory(url string, bare bool) string {
+	name := path.Base(strings.TrimSuffix(strings.TrimSuffix(url, "/"), "/.git"))
+	if colon := strings.LastIndexByte(name, ':'); colon >= 0 {
+		name = name[colon+1:]
+	}
+	name = strings.TrimSuffix(strings.TrimSuffix(name, ".git"), ".bundle")
+	if bare {
+		name += ".git"
+	}
+	return name
+}
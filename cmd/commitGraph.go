@@ -0,0 +1,69 @@
+package cmd
+
+import (
+	"bufio"
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewCommitGraphCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "commit-graph",
+		Short: "write and verify commit-graph file",
+		Long: `write and verify .git/objects/info/commit-graph, which records parents, generation numbers
+and commit dates of commits to walk history without reading commit objects.`,
+	}
+	write := &cobra.Command{
+		Use:   "write [--reachable|--stdin-commits] [--changed-paths]",
+		Short: "write commit-graph file",
+		Long: `write commit-graph file of commits in packfiles and their ancestors.
+with --reachable, commits reachable from refs are written, and with --stdin-commits, commits read from stdin.`,
+		Run: cmdCommitGraphWrite,
+	}
+	write.Flags().Bool("reachable", false, "walk commits from all refs.")
+	write.Flags().Bool("stdin-commits", false, "walk commits listed in stdin.")
+	write.Flags().Bool("changed-paths", false, "write changed-path Bloom filters.")
+	cmd.AddCommand(write)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "verify commit-graph file",
+		Long:  `check that commit-graph file is not corrupt and matches commit objects.`,
+		Run:   cmdCommitGraphVerify,
+	})
+	return cmd
+}
+
+func cmdCommitGraphWrite(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var opts git.CommitGraphOptions
+	opts.Reachable, _ = cmd.Flags().GetBool("reachable")
+	opts.ChangedPaths, _ = cmd.Flags().GetBool("changed-paths")
+	if stdin, _ := cmd.Flags().GetBool("stdin-commits"); stdin {
+		scanner := bufio.NewScanner(cmd.InOrStdin())
+		for scanner.Scan() {
+			if line := strings.TrimSpace(scanner.Text()); line != "" {
+				opts.Commits = append(opts.Commits, line)
+			}
+		}
+	}
+	if err := git.WriteCommitGraph(repo, opts); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdCommitGraphVerify(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if _, err := git.VerifyCommitGraph(repo); err != nil {
+		cmd.Println(err)
+	}
+}
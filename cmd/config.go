@@ -0,0 +1,278 @@
+package cmd
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewConfigCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "config [OPTIONS] [KEY [VALUE]]",
+		Short: "get and set repository or global options",
+		Long:  `get and set repository or global options`,
+		Run:   cmdConfig,
+	}
+	cmd.Flags().Bool("system", false, "use system config file.")
+	cmd.Flags().Bool("global", false, "use global config file.")
+	cmd.Flags().Bool("local", false, "use repository config file.")
+	cmd.Flags().Bool("worktree", false, "use per-worktree config file.")
+	cmd.Flags().StringP("file", "f", "", "use given config file.")
+	cmd.Flags().Bool("get", false, "get value: KEY")
+	cmd.Flags().Bool("get-all", false, "get all values: KEY")
+	cmd.Flags().Bool("set", false, "set value: KEY VALUE")
+	cmd.Flags().Bool("add", false, "add a new value: KEY VALUE")
+	cmd.Flags().Bool("unset", false, "remove a value: KEY")
+	cmd.Flags().Bool("unset-all", false, "remove all values: KEY")
+	cmd.Flags().Bool("remove-section", false, "remove a section: NAME")
+	cmd.Flags().Bool("rename-section", false, "rename a section: OLD NEW")
+	cmd.Flags().BoolP("list", "l", false, "list all variables.")
+	cmd.Flags().Bool("show-origin", false, "show origin of config (file or command line).")
+	cmd.Flags().Bool("show-scope", false, "show scope of config.")
+	cmd.Flags().String("type", "", "value is given this type. bool, int or path.")
+	cmd.Flags().String("default", "", "with --get, use default value when missing entry.")
+	return cmd
+}
+
+func cmdConfig(cmd *cobra.Command, args []string) {
+	// config can be used outside of repository
+	repo, err := openRepo(cmd)
+	if err != nil && !errors.Is(err, git.ErrRepositoryNotFound) {
+		cmd.Println(err)
+		return
+	}
+
+	flag := func(name string) bool {
+		b, _ := cmd.Flags().GetBool(name)
+		return b
+	}
+
+	switch {
+	case flag("list"):
+		cs, err := loadConfigForRead(cmd, repo)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		for _, v := range cs.Values {
+			cmd.Printf("%s%s=%s\n", configValuePrefix(cmd, v), v.Key, v.Value)
+		}
+	case flag("get"), flag("get-all"), len(args) == 1 && !isConfigWrite(cmd):
+		if len(args) != 1 {
+			cmd.Println(cmd.Usage())
+			return
+		}
+		cs, err := loadConfigForRead(cmd, repo)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		values := cs.LookupAll(args[0])
+		if len(values) == 0 {
+			if cmd.Flags().Changed("default") {
+				def, _ := cmd.Flags().GetString("default")
+				values = append(values, git.ConfigValue{Key: args[0], Value: def})
+			} else {
+				return
+			}
+		}
+		if !flag("get-all") {
+			values = values[len(values)-1:]
+		}
+		for _, v := range values {
+			value, err := typedConfigValue(cmd, v.Value)
+			if err != nil {
+				cmd.Println(err)
+				return
+			}
+			cmd.Printf("%s%s\n", configValuePrefix(cmd, v), value)
+		}
+	default:
+		if err := writeConfig(cmd, repo, args); err != nil {
+			cmd.Println(err)
+		}
+	}
+}
+
+func isConfigWrite(cmd *cobra.Command) bool {
+	for _, name := range []string{"set", "add", "unset", "unset-all", "remove-section", "rename-section"} {
+		if b, _ := cmd.Flags().GetBool(name); b {
+			return true
+		}
+	}
+	return false
+}
+
+func writeConfig(cmd *cobra.Command, repo *git.GitRepository, args []string) error {
+	path, err := configFilePath(cmd, repo, git.ScopeLocal)
+	if err != nil {
+		return err
+	}
+	cfg, err := git.ReadConfigFile(path)
+	if err != nil {
+		return err
+	}
+
+	flag := func(name string) bool {
+		b, _ := cmd.Flags().GetBool(name)
+		return b
+	}
+	nargs := 2
+	if flag("unset") || flag("unset-all") || flag("remove-section") {
+		nargs = 1
+	}
+	if len(args) != nargs {
+		return errors.New(cmd.UsageString())
+	}
+
+	if flag("remove-section") || flag("rename-section") {
+		section, sub := splitSectionName(args[0])
+		if flag("remove-section") {
+			cfg.RemoveSection(section, sub)
+		} else {
+			newSection, newSub := splitSectionName(args[1])
+			if newSection != section {
+				return errors.New("renaming section name is not supported, only subsection")
+			}
+			cfg.RenameSection(section, sub, newSub)
+		}
+		return git.WriteConfigFile(path, cfg)
+	}
+
+	section, sub, key, err := git.SplitConfigKey(args[0])
+	if err != nil {
+		return err
+	}
+	switch {
+	case flag("unset"):
+		if len(cfg.GetAll(section, sub, key)) > 1 {
+			return errors.New("key has multiple values, use --unset-all")
+		}
+		fallthrough
+	case flag("unset-all"):
+		if !cfg.Unset(section, sub, key) {
+			return fmt.Errorf("key does not exist: %s", args[0])
+		}
+	case flag("add"):
+		value, err := typedConfigValue(cmd, args[1])
+		if err != nil {
+			return err
+		}
+		cfg.Add(section, sub, key, value)
+	default:
+		value, err := typedConfigValue(cmd, args[1])
+		if err != nil {
+			return err
+		}
+		if len(cfg.GetAll(section, sub, key)) > 1 {
+			return errors.New("cannot overwrite multiple values with a single value")
+		}
+		cfg.Set(section, sub, key, value)
+	}
+	return git.WriteConfigFile(path, cfg)
+}
+
+// loadConfigForRead load config of selected scope, or all scopes if not specified.
+func loadConfigForRead(cmd *cobra.Command, repo *git.GitRepository) (*git.ConfigSet, error) {
+	scope, selected := selectedConfigScope(cmd)
+	if !selected {
+		return git.LoadConfig(repo)
+	}
+	path, err := configFilePath(cmd, repo, scope)
+	if err != nil {
+		return nil, err
+	}
+	if scope == git.ScopeGlobal {
+		if file, _ := cmd.Flags().GetString("file"); file == "" {
+			cs := &git.ConfigSet{}
+			for _, p := range git.GlobalConfigPaths() {
+				global, err := git.LoadConfigFile(repo, p, scope)
+				if err != nil {
+					return nil, err
+				}
+				cs.Values = append(cs.Values, global.Values...)
+			}
+			return cs, nil
+		}
+	}
+	return git.LoadConfigFile(repo, path, scope)
+}
+
+func selectedConfigScope(cmd *cobra.Command) (git.ConfigScope, bool) {
+	for name, scope := range map[string]git.ConfigScope{
+		"system":   git.ScopeSystem,
+		"global":   git.ScopeGlobal,
+		"local":    git.ScopeLocal,
+		"worktree": git.ScopeWorktree,
+	} {
+		if b, _ := cmd.Flags().GetBool(name); b {
+			return scope, true
+		}
+	}
+	if file, _ := cmd.Flags().GetString("file"); file != "" {
+		return git.ScopeCommand, true
+	}
+	return git.ScopeLocal, false
+}
+
+func configFilePath(cmd *cobra.Command, repo *git.GitRepository, def git.ConfigScope) (string, error) {
+	if file, _ := cmd.Flags().GetString("file"); file != "" {
+		return file, nil
+	}
+	scope, selected := selectedConfigScope(cmd)
+	if !selected {
+		scope = def
+	}
+	return git.ConfigPath(repo, scope)
+}
+
+func configValuePrefix(cmd *cobra.Command, v git.ConfigValue) string {
+	prefix := ""
+	if b, _ := cmd.Flags().GetBool("show-scope"); b {
+		prefix += v.Scope.String() + "\t"
+	}
+	if b, _ := cmd.Flags().GetBool("show-origin"); b {
+		if v.Origin == "" {
+			prefix += "command line:\t"
+		} else {
+			prefix += "file:" + v.Origin + "\t"
+		}
+	}
+	return prefix
+}
+
+// typedConfigValue canonicalize value by --type.
+func typedConfigValue(cmd *cobra.Command, value string) (string, error) {
+	typ, _ := cmd.Flags().GetString("type")
+	switch typ {
+	case "":
+		return value, nil
+	case "bool":
+		b, err := git.ParseConfigBool(value)
+		if err != nil {
+			return "", fmt.Errorf("bad boolean config value '%s'", value)
+		}
+		return strconv.FormatBool(b), nil
+	case "int":
+		n, err := git.ParseConfigInt(value)
+		if err != nil {
+			return "", fmt.Errorf("bad numeric config value '%s'", value)
+		}
+		return strconv.FormatInt(n, 10), nil
+	case "path":
+		return git.ExpandConfigPath(value), nil
+	}
+	return "", errors.New("unrecognized --type argument: " + typ)
+}
+
+// splitSectionName split "section.subsection" into its parts.
+func splitSectionName(name string) (string, string) {
+	if dot := strings.IndexByte(name, '.'); dot >= 0 {
+		return strings.ToLower(name[:dot]), name[dot+1:]
+	}
+	return strings.ToLower(name), ""
+}
@@ -0,0 +1,95 @@
+package cmd
+
+import (
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewFetchCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "fetch [REMOTE [REFSPEC...]]",
+		Short: "download objects and refs from another repository",
+		Long: `download objects and refs from another repository. REMOTE is a remote name or URL, default is origin.
+REFSPEC like "+refs/heads/*:refs/remotes/origin/*" is used instead of remote.<name>.fetch config.`,
+		Run: cmdFetch,
+	}
+	cmd.Flags().BoolP("quiet", "q", false, "do not print progress and updated refs.")
+	cmd.Flags().BoolP("prune", "p", false, "delete remote-tracking refs which no longer exist on remote.")
+	cmd.Flags().Bool("unshallow", false, "fetch all history of a shallow repository.")
+	cmd.Flags().String("filter", "", "omit objects by filter. default is the filter of partial clone.")
+	addShallowFlags(cmd)
+	return cmd
+}
+
+func cmdFetch(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	remote := "origin"
+	if len(args) > 0 {
+		remote = args[0]
+	}
+	_, url, err := git.ResolveRemote(repo, remote)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	var opts git.FetchOptions
+	if len(args) > 1 {
+		opts.Refspecs = args[1:]
+	}
+	opts.Prune, _ = cmd.Flags().GetBool("prune")
+	opts.Unshallow, _ = cmd.Flags().GetBool("unshallow")
+	opts.Filter, _ = cmd.Flags().GetString("filter")
+	if opts.ShallowOptions, err = shallowOptions(cmd); err != nil {
+		cmd.Println(err)
+		return
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	if !quiet {
+		opts.Progress = cmd.ErrOrStderr()
+	}
+	updates, err := git.Fetch(repo, remote, opts)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if quiet {
+		return
+	}
+
+	header := false
+	for _, u := range updates {
+		if u.IsUpToDate() {
+			continue
+		}
+		if !header {
+			cmd.PrintErrf("From %s\n", git.AnonymizeURL(url))
+			header = true
+		}
+		kind := "branch"
+		if strings.HasPrefix(u.Remote, "refs/tags/") {
+			kind = "tag"
+		}
+		from, to := git.ShortRefName(u.Remote), git.ShortRefName(u.Local)
+		switch {
+		case u.IsPruned():
+			cmd.PrintErrf(" - %-17s %-10s -> %s\n", "[deleted]", "(none)", to)
+		case u.Local == "":
+			cmd.PrintErrf(" * %-17s %-10s -> FETCH_HEAD\n", kind, from)
+		case u.Rejected:
+			cmd.PrintErrf(" ! %-17s %-10s -> %s  (non-fast-forward)\n", "[rejected]", from, to)
+		case u.IsNew():
+			cmd.PrintErrf(" * %-17s %-10s -> %s\n", "[new "+kind+"]", from, to)
+		case u.Forced:
+			cmd.PrintErrf(" + %-17s %-10s -> %s  (forced update)\n", abbrev(u.Old)+"..."+abbrev(u.New), from, to)
+		default:
+			cmd.PrintErrf("   %-17s %-10s -> %s\n", abbrev(u.Old)+".."+abbrev(u.New), from, to)
+		}
+	}
+}
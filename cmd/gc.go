@@ -0,0 +1,55 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewGCCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "gc [--auto] [--prune=DATE|--no-prune] [--force] [-q]",
+		Short: "clean up unnecessary files and optimize the repository",
+		Long: `clean up unnecessary files and optimize the repository. refs are packed into packed-refs,
+reflogs are expired, reachable objects are repacked into one packfile, and unreachable loose objects
+older than the grace period (gc.pruneExpire, default "2.weeks.ago") are removed.`,
+		Run: cmdGC,
+	}
+	cmd.Flags().Bool("auto", false, "run only if there are too many loose objects (gc.auto) or packs (gc.autoPackLimit).")
+	cmd.Flags().String("prune", "", "prune unreachable loose objects older than the date.")
+	cmd.Flags().Bool("no-prune", false, "do not prune any unreachable objects.")
+	cmd.Flags().Bool("force", false, "run even if another gc seems to be running.")
+	cmd.Flags().BoolP("quiet", "q", false, "suppress all progress reports.")
+	return cmd
+}
+
+func cmdGC(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	if auto, _ := cmd.Flags().GetBool("auto"); auto {
+		needed, err := git.NeedsAutoGC(repo)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if !needed {
+			return
+		}
+		if !quiet {
+			cmd.PrintErrln("Auto packing the repository for optimum performance.")
+		}
+	}
+
+	opts := git.GCOptions{}
+	opts.PruneExpire, _ = cmd.Flags().GetString("prune")
+	if noPrune, _ := cmd.Flags().GetBool("no-prune"); noPrune {
+		opts.PruneExpire = "never"
+	}
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	if err := git.GC(repo, opts); err != nil {
+		cmd.Println(err)
+	}
+}
@@ -17,7 +17,6 @@ package cmd
 
 import (
 	"io/ioutil"
-	"path/filepath"
 
 	"github.com/greytabby/mygit/git"
 	"github.com/spf13/cobra"
@@ -41,19 +40,8 @@ func cmdHashObject(cmd *cobra.Command, args []string) {
 		cmd.Println(cmd.Usage())
 		return
 	}
-	worktree, _ := cmd.Flags().GetString("d")
-	if worktree == "" {
-		worktree = "./"
-	}
-	gitDir, err := git.FindRepo(worktree)
-	if err != nil {
-		cmd.Println(err)
-		return
-	}
-	dir := filepath.Dir(gitDir)
-
 	objType, _ := cmd.Flags().GetString("type")
-	repo, err := git.NewGitRepository(dir)
+	repo, err := openRepo(cmd)
 	if err != nil {
 		cmd.Println(err)
 		return
@@ -17,6 +17,8 @@ limitations under the License.
 package cmd
 
 import (
+	"os"
+
 	"github.com/spf13/cobra"
 
 	"github.com/greytabby/mygit/git"
@@ -24,11 +26,16 @@ import (
 
 func NewInitCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "init",
+		Use:   "init [DIRECTORY]",
 		Short: "mygit init",
 		Long:  `initialize mygit repository`,
 		Run:   cmdInit,
 	}
+	cmd.Flags().Bool("bare", false, "create a bare repository.")
+	cmd.Flags().StringP("initial-branch", "b", "", "name of the initial branch.")
+	cmd.Flags().String("template", "", "directory from which templates will be used.")
+	cmd.Flags().String("separate-git-dir", "", "create git directory at this path, and put gitfile in the worktree.")
+	cmd.Flags().BoolP("quiet", "q", false, "only print error messages.")
 	return cmd
 }
 
@@ -37,11 +44,34 @@ func cmdInit(cmd *cobra.Command, args []string) {
 	if worktree == "" {
 		worktree = "./"
 	}
+	if len(args) > 0 {
+		worktree = args[0]
+	}
+	if err := os.MkdirAll(worktree, 0755); err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	var opts git.InitOptions
+	opts.Bare, _ = cmd.Flags().GetBool("bare")
+	opts.InitialBranch, _ = cmd.Flags().GetString("initial-branch")
+	opts.Template, _ = cmd.Flags().GetString("template")
+	opts.SeparateGitDir, _ = cmd.Flags().GetString("separate-git-dir")
 
-	repo, err := git.CreateAndInitializeRepo(worktree)
+	_, err := git.NewGitRepository(worktree)
+	reinit := err == nil
+
+	repo, err := git.InitRepository(worktree, opts)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
+	if quiet, _ := cmd.Flags().GetBool("quiet"); quiet {
+		return
+	}
+	if reinit {
+		cmd.Printf("reinitialized existing repository: %s\n", repo.RepoPath("."))
+		return
+	}
 	cmd.Printf("initialized empty repository: %s\n", repo.RepoPath("."))
 }
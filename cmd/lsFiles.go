@@ -17,7 +17,7 @@ limitations under the License.
 package cmd
 
 import (
-	"path/filepath"
+	"fmt"
 
 	"github.com/greytabby/mygit/git"
 	"github.com/spf13/cobra"
@@ -26,39 +26,97 @@ import (
 // catFileCmd represents the catFile command
 func NewLsFilesCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "ls-files",
+		Use:   "ls-files [--cached] [--deleted] [-m] [-o] [-i] [-s] [-u] [-x PATTERN] [-X FILE] [--exclude-standard] [--debug] [-z] [--format FORMAT] [--] [PATHSPEC...]",
 		Short: "print list of files in index",
-		Long:  `print list of files in index`,
-		Run:   cmdLsFiles,
+		Long: `print files in the index and the worktree. cached files are shown if none of --deleted, -m and -o are given.
+--cached and --deleted have no short options since -c and -d are options of mygit.
+untracked files are shown first, then cached, deleted and modified files for each index entry, so a file can be shown more than once.
+FORMAT has placeholders %(objectmode), %(objectname), %(objecttype), %(objectsize), %(objectsize:padded), %(stage) and %(path).`,
+		Run: cmdLsFiles,
 	}
+	cmd.Flags().Bool("cached", false, "show cached files.")
+	cmd.Flags().Bool("deleted", false, "show files deleted from the worktree.")
+	cmd.Flags().BoolP("modified", "m", false, "show files modified or deleted in the worktree.")
+	cmd.Flags().BoolP("others", "o", false, "show untracked files.")
+	cmd.Flags().BoolP("ignored", "i", false, "show only ignored files, with -o or --cached.")
+	cmd.Flags().BoolP("stage", "s", false, "show the mode, object name and stage of files.")
+	cmd.Flags().BoolP("unmerged", "u", false, "show only unmerged files, like --stage.")
+	cmd.Flags().StringArrayP("exclude", "x", nil, "skip untracked files matching the pattern.")
+	cmd.Flags().StringArrayP("exclude-from", "X", nil, "read exclude patterns from the file.")
+	cmd.Flags().Bool("exclude-standard", false, "use .gitignore, info/exclude and core.excludesFile.")
+	cmd.Flags().Bool("debug", false, "show the stat information of the index entry after each file.")
+	cmd.Flags().BoolP("z", "z", false, "terminate paths with NUL and do not quote them.")
+	cmd.Flags().String("format", "", "show index entries in the format.")
 	return cmd
 }
 
 func cmdLsFiles(cmd *cobra.Command, args []string) {
-	worktree, _ := cmd.Flags().GetString("d")
-	if worktree == "" {
-		worktree = "./"
-	}
-	gitDir, err := git.FindRepo(worktree)
+	repo, err := openRepo(cmd)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
-	dir := filepath.Dir(gitDir)
-	repo, err := git.NewGitRepository(dir)
-	if err != nil {
+	var opts git.LsFilesOptions
+	opts.Cached, _ = cmd.Flags().GetBool("cached")
+	opts.Deleted, _ = cmd.Flags().GetBool("deleted")
+	opts.Modified, _ = cmd.Flags().GetBool("modified")
+	opts.Others, _ = cmd.Flags().GetBool("others")
+	opts.Ignored, _ = cmd.Flags().GetBool("ignored")
+	opts.Unmerged, _ = cmd.Flags().GetBool("unmerged")
+	stage, _ := cmd.Flags().GetBool("stage")
+	format, _ := cmd.Flags().GetString("format")
+	if opts.Ignored && !opts.Others && !opts.Cached {
+		cmd.Println("ls-files -i must be used with either -o or -c")
+		return
+	}
+	if cmd.Flags().Changed("format") && (stage || opts.Others) {
+		cmd.Println("--format cannot be used with -s, -o")
+		return
+	}
+	if stage || opts.Unmerged {
+		format = "%(objectmode) %(objectname) %(stage)\t%(path)"
+	}
+	if stage || opts.Unmerged || !opts.Deleted && !opts.Modified && !opts.Others {
+		opts.Cached = true
+	}
+	opts.Excludes, _ = cmd.Flags().GetStringArray("exclude")
+	opts.ExcludeFiles, _ = cmd.Flags().GetStringArray("exclude-from")
+	opts.ExcludeStandard, _ = cmd.Flags().GetBool("exclude-standard")
+	if opts.Pathspecs, err = repoPathspecs(repo, args); err != nil {
 		cmd.Println(err)
 		return
 	}
-
-	index, err := git.ReadIndex(repo)
+	files, err := git.ListFiles(repo, opts)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
 
-	for _, entry := range index.Entries {
-		stage := (entry.Flags >> 12) & 3
-		cmd.Printf("%s %s %d\t%s\n", entry.Mode.Perm().String(), entry.ObjectID, int(stage), entry.FilePath)
+	debug, _ := cmd.Flags().GetBool("debug")
+	nul, _ := cmd.Flags().GetBool("z")
+	term := "\n"
+	if nul {
+		term = "\x00"
+	}
+	out := cmd.OutOrStdout()
+	for _, f := range files {
+		name := f.Path
+		if !nul {
+			name = git.QuotePath(name)
+		}
+		e := f.Entry
+		if e == nil || !cmd.Flags().Changed("format") && !stage && !opts.Unmerged {
+			fmt.Fprint(out, name+term)
+		} else {
+			line, err := git.FormatLsFile(repo, format, e, !nul)
+			if err != nil {
+				cmd.Println(err)
+				return
+			}
+			fmt.Fprint(out, line+term)
+		}
+		if debug && e != nil {
+			fmt.Fprint(out, git.FormatIndexEntryStat(e))
+		}
 	}
 }
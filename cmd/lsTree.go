@@ -16,7 +16,8 @@ limitations under the License.
 package cmd
 
 import (
-	"path/filepath"
+	"fmt"
+	"io"
 
 	"github.com/greytabby/mygit/git"
 	"github.com/spf13/cobra"
@@ -25,49 +26,85 @@ import (
 // catFileCmd represents the catFile command
 func NewLsTreeCommand() *cobra.Command {
 	cmd := &cobra.Command{
-		Use:   "ls-tree [TREE OBJECT]",
+		Use:   "ls-tree [-r] [-t] [-d] [-l] [--name-only] [--abbrev[=N]] [-z] TREE-ISH [PATH...]",
 		Short: "listing tree object entries",
-		Long:  `listing tree object entries`,
-		Run:   cmdLsTree,
+		Long: `list entries of TREE-ISH, which is a tree, or a commit, tag or "REV:PATH" pointing to a tree.
+PATH limits entries to the path, files under it, or trees containing it, without wildcards. PATH ending with "/" lists the contents of the tree.
+paths are shown from the top of TREE-ISH.`,
+		Run: cmdLsTree,
 	}
+	cmd.Flags().BoolP("r", "r", false, "recurse into subtrees.")
+	cmd.Flags().BoolP("t", "t", false, "show trees walked into, even when recursing.")
+	cmd.Flags().BoolP("d", "d", false, "show only trees.")
+	cmd.Flags().BoolP("long", "l", false, "show sizes of blobs.")
+	cmd.Flags().Bool("name-only", false, "show only paths.")
+	cmd.Flags().Bool("name-status", false, "same as --name-only.")
+	cmd.Flags().Int("abbrev", 40, "abbreviate object names to N hex digits, 7 if N is omitted.")
+	cmd.Flags().Lookup("abbrev").NoOptDefVal = "7"
+	cmd.Flags().BoolP("z", "z", false, "terminate entries with NUL and do not quote paths.")
 	return cmd
 }
 
 func cmdLsTree(cmd *cobra.Command, args []string) {
-	if len(args) != 1 {
+	if len(args) < 1 {
 		cmd.Println(cmd.Usage())
 		return
 	}
-	worktree, _ := cmd.Flags().GetString("d")
-	if worktree == "" {
-		worktree = "./"
-	}
-	gitDir, err := git.FindRepo(worktree)
+	repo, err := openRepo(cmd)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
-	dir := filepath.Dir(gitDir)
-
-	repo, err := git.NewGitRepository(dir)
+	var opts git.LsTreeOptions
+	opts.Recursive, _ = cmd.Flags().GetBool("r")
+	opts.ShowTrees, _ = cmd.Flags().GetBool("t")
+	opts.OnlyTrees, _ = cmd.Flags().GetBool("d")
+	opts.Pathspecs = args[1:]
+	entries, err := git.ListTree(repo, args[0], opts)
 	if err != nil {
 		cmd.Println(err)
 		return
 	}
-
-	obj, err := git.ReadObject(repo, args[0])
-	if err != nil {
+	if err := writeLsTree(cmd, repo, cmd.OutOrStdout(), entries); err != nil {
 		cmd.Println(err)
-		return
 	}
+}
 
-	for _, entry := range obj.(*git.GitTree).Entries {
-		mode := entry.Mode.Perm().String()
-		obj, err := git.ReadObject(repo, entry.Sha)
-		if err != nil {
-			cmd.Println(err)
-			return
+func writeLsTree(cmd *cobra.Command, repo *git.GitRepository, w io.Writer, entries []*git.GitTreeEntry) error {
+	long, _ := cmd.Flags().GetBool("long")
+	nameOnly, _ := cmd.Flags().GetBool("name-only")
+	nameStatus, _ := cmd.Flags().GetBool("name-status")
+	abbrev, _ := cmd.Flags().GetInt("abbrev")
+	if abbrev < 4 {
+		abbrev = 4
+	}
+	nul, _ := cmd.Flags().GetBool("z")
+	for _, e := range entries {
+		name, term := git.QuotePath(e.Path), "\n"
+		if nul {
+			name, term = e.Path, "\x00"
+		}
+		if nameOnly || nameStatus {
+			fmt.Fprint(w, name+term)
+			continue
+		}
+		sha := e.Sha
+		if abbrev < len(sha) {
+			sha = sha[:abbrev]
+		}
+		if !long {
+			fmt.Fprintf(w, "%06o %s %s\t%s%s", uint32(e.Mode), e.ObjectType(), sha, name, term)
+			continue
+		}
+		size := "-"
+		if e.ObjectType() == "blob" {
+			_, data, err := git.ReadObjectData(repo, e.Sha)
+			if err != nil {
+				return err
+			}
+			size = fmt.Sprint(len(data))
 		}
-		cmd.Printf("%s %s %s\t%s\n", mode, string(obj.Type()), entry.Sha, entry.Path)
+		fmt.Fprintf(w, "%06o %s %s %7s\t%s%s", uint32(e.Mode), e.ObjectType(), sha, size, name, term)
 	}
+	return nil
 }
@@ -0,0 +1,63 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewMergeBaseCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "merge-base [-a] COMMIT COMMIT",
+		Short: "find a best common ancestor of two commits",
+		Long: `find a best common ancestor of two commits.
+with --is-ancestor, exit with status 0 if the first commit is an ancestor of the second, or 1 if not.`,
+		Run: cmdMergeBase,
+	}
+	cmd.Flags().BoolP("all", "a", false, "print all best common ancestors.")
+	cmd.Flags().Bool("is-ancestor", false, "check if the first commit is an ancestor of the second.")
+	return cmd
+}
+
+func cmdMergeBase(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var commits [2]string
+	for i, arg := range args {
+		if commits[i], err = git.ResolveCommit(repo, arg); err != nil {
+			cmd.Println(err)
+			return
+		}
+	}
+
+	if isAncestor, _ := cmd.Flags().GetBool("is-ancestor"); isAncestor {
+		ok, err := git.IsAncestor(repo, commits[0], commits[1])
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if !ok {
+			os.Exit(1)
+		}
+		return
+	}
+	bases, err := git.MergeBases(repo, commits[0], commits[1])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if all, _ := cmd.Flags().GetBool("all"); !all && len(bases) > 1 {
+		bases = bases[:1]
+	}
+	for _, sha := range bases {
+		cmd.Println(sha)
+	}
+}
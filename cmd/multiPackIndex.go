@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewMultiPackIndexCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "multi-pack-index",
+		Short: "write and verify multi-pack-index",
+		Long: `write and verify .git/objects/pack/multi-pack-index, which indexes objects in all packfiles
+so that an object is found by one lookup.`,
+	}
+	write := &cobra.Command{
+		Use:   "write [--preferred-pack=PACK]",
+		Short: "write multi-pack-index of all packfiles",
+		Long:  `write multi-pack-index of all packfiles. objects in several packs are taken from the preferred pack, or the newest one.`,
+		Run:   cmdMultiPackIndexWrite,
+	}
+	write.Flags().String("preferred-pack", "", "take duplicated objects from the pack.")
+	cmd.AddCommand(write)
+	cmd.AddCommand(&cobra.Command{
+		Use:   "verify",
+		Short: "verify multi-pack-index",
+		Long:  `check that multi-pack-index is not corrupt and matches pack indexes.`,
+		Run:   cmdMultiPackIndexVerify,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "expire",
+		Short: "remove packfiles which no objects in multi-pack-index refer",
+		Long:  `remove packfiles in multi-pack-index whose objects are all taken from other packs, and rewrite multi-pack-index.`,
+		Run:   cmdMultiPackIndexExpire,
+	})
+	repack := &cobra.Command{
+		Use:   "repack [--batch-size=SIZE]",
+		Short: "pack objects in small packfiles into a new packfile",
+		Long: `pack objects in packfiles smaller than SIZE into a new packfile, until their total size reaches SIZE.
+all packfiles are repacked if SIZE is 0. old packfiles are removed by "multi-pack-index expire".`,
+		Run: cmdMultiPackIndexRepack,
+	}
+	repack.Flags().String("batch-size", "0", "size of the new packfile. suffixes k, m and g are allowed.")
+	cmd.AddCommand(repack)
+	return cmd
+}
+
+func cmdMultiPackIndexWrite(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	preferred, _ := cmd.Flags().GetString("preferred-pack")
+	if err := git.WriteMultiPackIndex(repo, preferred); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdMultiPackIndexVerify(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if _, err := git.VerifyMultiPackIndex(repo); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdMultiPackIndexExpire(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if _, err := git.ExpireMultiPackIndex(repo); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdMultiPackIndexRepack(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	value, _ := cmd.Flags().GetString("batch-size")
+	batchSize, err := git.ParseConfigInt(value)
+	if err != nil {
+		cmd.Printf("invalid batch size: %s\n", value)
+		return
+	}
+	if _, err := git.RepackMultiPackIndex(repo, batchSize); err != nil {
+		cmd.Println(err)
+	}
+}
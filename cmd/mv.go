@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewMvCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "mv [-f] [-k] [-n] [-v] SOURCE... DESTINATION",
+		Short: "move or rename a file, a directory, or a symlink",
+		Long: `rename SOURCE to DESTINATION, or move SOURCEs into the existing directory DESTINATION.
+the index is updated after the files are moved in the worktree. a directory is moved with all tracked files under it.`,
+		Run: cmdMv,
+	}
+	cmd.Flags().BoolP("force", "f", false, "force renaming even if the destination exists.")
+	cmd.Flags().BoolP("k", "k", false, "skip move or rename actions which would lead to an error.")
+	cmd.Flags().BoolP("dry-run", "n", false, "only show what would happen.")
+	cmd.Flags().BoolP("verbose", "v", false, "report the names of files as they are moved.")
+	return cmd
+}
+
+func cmdMv(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	if len(args) < 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	paths, err := repoPathspecs(repo, args)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var opts git.MoveOptions
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	opts.SkipErrors, _ = cmd.Flags().GetBool("k")
+	opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+
+	moves, err := git.MoveFiles(repo, paths[:len(paths)-1], paths[len(paths)-1], opts)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if !verbose && !opts.DryRun {
+		return
+	}
+	for _, m := range moves {
+		fmt.Fprintf(cmd.OutOrStdout(), "Renaming %s to %s\n", m.From, m.To)
+	}
+}
@@ -0,0 +1,135 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewPushCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "push [REMOTE [REFSPEC...]]",
+		Short: "update remote refs along with associated objects",
+		Long: `update remote refs along with associated objects.
+REFSPEC is [+]<src>[:<dst>]. the current branch is pushed if REFSPEC is omitted.`,
+		Run: cmdPush,
+	}
+	cmd.Flags().BoolP("force", "f", false, "allow updates which are not fast-forward.")
+	cmd.Flags().Bool("delete", false, "delete the listed refs from the remote repository.")
+	cmd.Flags().BoolP("set-upstream", "u", false, "set upstream of pushed branches.")
+	cmd.Flags().BoolP("quiet", "q", false, "do not print progress and updated refs.")
+	return cmd
+}
+
+func cmdPush(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	remote := "origin"
+	if len(args) > 0 {
+		remote = args[0]
+	}
+	refspecs := []string{}
+	if len(args) > 1 {
+		refspecs = args[1:]
+	}
+	if del, _ := cmd.Flags().GetBool("delete"); del {
+		if len(refspecs) == 0 {
+			cmd.Println("--delete requires refs to delete")
+			return
+		}
+		for i, ref := range refspecs {
+			refspecs[i] = ":" + ref
+		}
+	}
+	name, url, err := git.ResolveRemote(repo, remote)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	var opts git.PushOptions
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	if !quiet {
+		opts.Progress = cmd.ErrOrStderr()
+	}
+	updates, err := git.Push(repo, remote, refspecs, opts)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	upToDate := true
+	rejected := false
+	for _, u := range updates {
+		if u.Status != git.PushUpToDate {
+			upToDate = false
+		}
+		if u.Status == git.PushRejected || u.Status == git.PushRemoteRejected {
+			rejected = true
+		}
+	}
+	if upToDate {
+		cmd.PrintErrln("Everything up-to-date")
+		return
+	}
+	if !quiet || rejected {
+		cmd.PrintErrf("To %s\n", git.AnonymizeURL(url))
+		for _, u := range updates {
+			printPushUpdate(cmd, u)
+		}
+	}
+	if rejected {
+		cmd.PrintErrf("error: failed to push some refs to '%s'\n", git.AnonymizeURL(url))
+	}
+
+	if setUpstream, _ := cmd.Flags().GetBool("set-upstream"); setUpstream && name != "" {
+		for _, u := range updates {
+			if u.Status != git.PushOK && u.Status != git.PushUpToDate || u.IsDelete() {
+				continue
+			}
+			branch := git.ShortRefName(u.Src)
+			if u.Src != git.BranchRef(branch) {
+				continue
+			}
+			if err := git.SetUpstream(repo, branch, "refs/remotes/"+name+"/"+git.ShortRefName(u.Dst)); err != nil {
+				cmd.Println(err)
+				return
+			}
+			cmd.Printf("branch '%s' set up to track '%s/%s'.\n", branch, name, git.ShortRefName(u.Dst))
+		}
+	}
+}
+
+func printPushUpdate(cmd *cobra.Command, u *git.PushUpdate) {
+	src, dst := git.ShortRefName(u.Src), git.ShortRefName(u.Dst)
+	ref := src + " -> " + dst
+	if u.IsDelete() {
+		ref = dst
+	}
+	switch {
+	case u.Status == git.PushUpToDate:
+		return
+	case u.Status == git.PushRejected:
+		cmd.PrintErrf(" ! %-17s %s (%s)\n", "[rejected]", ref, u.Reason)
+	case u.Status == git.PushRemoteRejected:
+		cmd.PrintErrf(" ! %-17s %s (%s)\n", "[remote rejected]", ref, u.Reason)
+	case u.IsDelete():
+		cmd.PrintErrf(" - %-17s %s\n", "[deleted]", dst)
+	case u.IsNew():
+		kind := "[new branch]"
+		if u.Dst != git.BranchRef(dst) {
+			kind = "[new reference]"
+			if u.Dst == "refs/tags/"+dst {
+				kind = "[new tag]"
+			}
+		}
+		cmd.PrintErrf(" * %-17s %s -> %s\n", kind, src, dst)
+	case u.Forced:
+		cmd.PrintErrf(" + %-17s %s -> %s (forced update)\n", abbrev(u.Old)+"..."+abbrev(u.New), src, dst)
+	default:
+		cmd.PrintErrf("   %-17s %s -> %s\n", abbrev(u.Old)+".."+abbrev(u.New), src, dst)
+	}
+}
@@ -0,0 +1,96 @@
+package cmd
+
+import (
+	"errors"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewRebaseCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rebase [-i] [--autosquash] [--onto NEWBASE] [UPSTREAM [BRANCH]] | --continue | --skip | --abort",
+		Short: "reapply commits on top of another base",
+		Long: `replay commits of the current branch which are not in UPSTREAM on top of NEWBASE, or UPSTREAM.
+BRANCH is checked out first if it is given, and UPSTREAM defaults to the upstream of the current branch.
+with -i, the list of commits is edited with GIT_SEQUENCE_EDITOR before rebasing.
+the rebase stops at conflicts, and is resumed by --continue or --skip, or cancelled by --abort.`,
+		Run: cmdRebase,
+	}
+	cmd.Flags().BoolP("interactive", "i", false, "edit the list of commits to be rebased.")
+	cmd.Flags().Bool("autosquash", false, "move fixup! and squash! commits after the commits they fix.")
+	cmd.Flags().Bool("no-autosquash", false, "do not move fixup! and squash! commits, overriding rebase.autoSquash.")
+	cmd.Flags().String("onto", "", "the starting point of the new commits.")
+	cmd.Flags().Bool("continue", false, "continue the rebase after resolving conflicts.")
+	cmd.Flags().Bool("skip", false, "skip the current commit and continue the rebase.")
+	cmd.Flags().Bool("abort", false, "abort the rebase and restore the original branch.")
+	return cmd
+}
+
+func cmdRebase(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	out := cmd.ErrOrStderr()
+	if cont, _ := cmd.Flags().GetBool("continue"); cont {
+		err = git.ContinueRebase(repo, out)
+	} else if skip, _ := cmd.Flags().GetBool("skip"); skip {
+		err = git.SkipRebase(repo, out)
+	} else if abort, _ := cmd.Flags().GetBool("abort"); abort {
+		err = git.AbortRebase(repo)
+	} else {
+		err = startRebase(cmd, repo, args)
+	}
+	if err != nil {
+		cmd.Println(err)
+	}
+}
+
+func startRebase(cmd *cobra.Command, repo *git.GitRepository, args []string) error {
+	if len(args) > 2 {
+		return cmd.Usage()
+	}
+	cfg, err := git.LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	opts := git.RebaseOptions{}
+	opts.Interactive, _ = cmd.Flags().GetBool("interactive")
+	opts.Onto, _ = cmd.Flags().GetString("onto")
+	if opts.Autosquash, err = cfg.GetBool("rebase.autoSquash", false); err != nil {
+		return err
+	}
+	if autosquash, _ := cmd.Flags().GetBool("autosquash"); autosquash {
+		opts.Autosquash = true
+	}
+	if noAutosquash, _ := cmd.Flags().GetBool("no-autosquash"); noAutosquash {
+		opts.Autosquash = false
+	}
+	if len(args) > 0 {
+		opts.Upstream = args[0]
+	}
+	if len(args) > 1 {
+		opts.Branch = args[1]
+	}
+	if opts.Upstream == "" {
+		branch, err := git.CurrentBranch(repo)
+		if err != nil {
+			return err
+		}
+		if branch == "" {
+			return errors.New("You are not currently on a branch.\nPlease specify which branch you want to rebase against.")
+		}
+		upstream, err := git.Upstream(repo, git.ShortRefName(branch))
+		if err != nil {
+			return errors.New("There is no tracking information for the current branch.\nPlease specify which branch you want to rebase against.")
+		}
+		opts.Upstream = upstream
+	}
+	return git.StartRebase(repo, cmd.ErrOrStderr(), opts)
+}
@@ -0,0 +1,40 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewReceivePackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "receive-pack [OPTIONS] DIRECTORY",
+		Short: "receive what is pushed into the repository",
+		Long:  `receive what is pushed into the repository. it talks with the client by stdin and stdout.`,
+		Run:   cmdReceivePack,
+	}
+	cmd.Flags().Bool("stateless-rpc", false, "handle one request without ref advertisement.")
+	cmd.Flags().Bool("advertise-refs", false, "write only ref advertisement.")
+	cmd.Flags().Bool("http-backend-info-refs", false, "same as --advertise-refs.")
+	return cmd
+}
+
+func cmdReceivePack(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := git.EnterRepository(args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var opts git.ReceivePackOptions
+	opts.StatelessRPC, _ = cmd.Flags().GetBool("stateless-rpc")
+	opts.AdvertiseRefs, _ = cmd.Flags().GetBool("advertise-refs")
+	if infoRefs, _ := cmd.Flags().GetBool("http-backend-info-refs"); infoRefs {
+		opts.AdvertiseRefs = true
+	}
+	if err := git.ReceivePack(repo, cmd.InOrStdin(), cmd.OutOrStdout(), opts); err != nil {
+		cmd.Println(err)
+	}
+}
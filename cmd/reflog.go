@@ -0,0 +1,187 @@
+package cmd
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewReflogCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reflog [show|expire|delete] [REF]",
+		Short: "manage reflog information",
+		Long:  `manage reflog information`,
+		Run:   cmdReflogShow,
+	}
+	show := &cobra.Command{
+		Use:   "show [REF]",
+		Short: "show the log of the reference",
+		Long:  `show the log of the reference. HEAD is used if REF is omitted.`,
+		Run:   cmdReflogShow,
+	}
+	expire := &cobra.Command{
+		Use:   "expire [--all] [REF...]",
+		Short: "prune older reflog entries",
+		Long:  `prune reflog entries older than --expire, and unreachable entries older than --expire-unreachable.`,
+		Run:   cmdReflogExpire,
+	}
+	expire.Flags().String("expire", "", "prune entries older than the time. default is gc.reflogExpire or 90 days.")
+	expire.Flags().String("expire-unreachable", "", "prune unreachable entries older than the time. default is gc.reflogExpireUnreachable or 30 days.")
+	expire.Flags().Bool("all", false, "process the reflogs of all references.")
+	expire.Flags().BoolP("dry-run", "n", false, "do not actually prune any entries.")
+	expire.Flags().Bool("verbose", false, "print extra information.")
+	del := &cobra.Command{
+		Use:   "delete REF@{N}...",
+		Short: "delete single entries from the reflog",
+		Long:  `delete single entries from the reflog`,
+		Run:   cmdReflogDelete,
+	}
+	cmd.AddCommand(show, expire, del)
+	return cmd
+}
+
+func cmdReflogShow(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	name := "HEAD"
+	if len(args) > 0 {
+		name = args[0]
+	}
+	full, err := reflogRefName(repo, name)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	entries, err := git.ReadReflog(repo, full)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	short := git.ShortRefName(full)
+	for i := len(entries) - 1; i >= 0; i-- {
+		e := entries[i]
+		cmd.Printf("%s %s@{%d}: %s\n", abbrev(e.New), short, len(entries)-1-i, e.Message)
+	}
+}
+
+func cmdReflogExpire(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	cfg, err := git.LoadConfig(repo)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	now := time.Now()
+	expire, err := reflogExpireTime(cmd, "expire", cfg.GetString("gc.reflogexpire", "90.days.ago"), now)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	expireUnreachable, err := reflogExpireTime(cmd, "expire-unreachable", cfg.GetString("gc.reflogexpireunreachable", "30.days.ago"), now)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	var names []string
+	if all, _ := cmd.Flags().GetBool("all"); all {
+		if names, err = git.ListReflogs(repo); err != nil {
+			cmd.Println(err)
+			return
+		}
+	}
+	for _, arg := range args {
+		full, err := reflogRefName(repo, arg)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		names = append(names, full)
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	for _, name := range names {
+		removed, err := git.ExpireReflog(repo, name, expire, expireUnreachable, dryRun)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if verbose || dryRun {
+			cmd.Printf("%s: pruned %d entries\n", name, removed)
+		}
+	}
+}
+
+func cmdReflogDelete(cmd *cobra.Command, args []string) {
+	if len(args) < 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+
+	indexes := map[string][]int{}
+	for _, arg := range args {
+		at := strings.Index(arg, "@{")
+		if at < 0 || !strings.HasSuffix(arg, "}") {
+			cmd.Printf("not a reflog: %s\n", arg)
+			return
+		}
+		n, err := strconv.Atoi(arg[at+2 : len(arg)-1])
+		if err != nil {
+			cmd.Printf("invalid reflog: %s\n", arg)
+			return
+		}
+		full, err := reflogRefName(repo, arg[:at])
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		indexes[full] = append(indexes[full], n)
+	}
+	for name, ns := range indexes {
+		if err := git.DeleteReflogEntries(repo, name, ns...); err != nil {
+			cmd.Println(err)
+			return
+		}
+	}
+}
+
+// reflogRefName return full ref name which has reflog.
+func reflogRefName(repo *git.GitRepository, name string) (string, error) {
+	if name == "" || name == "HEAD" {
+		return "HEAD", nil
+	}
+	if git.HasReflog(repo, name) {
+		return name, nil
+	}
+	full, ok := git.DwimRef(repo, name)
+	if !ok {
+		return "", fmt.Errorf("unknown ref: %s", name)
+	}
+	return full, nil
+}
+
+func reflogExpireTime(cmd *cobra.Command, flag, def string, now time.Time) (time.Time, error) {
+	value, _ := cmd.Flags().GetString(flag)
+	if value == "" {
+		value = def
+	}
+	return git.ParseExpiry(value, now)
+}
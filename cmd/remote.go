@@ -0,0 +1,179 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewRemoteCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "remote [-v]",
+		Short: "manage set of tracked repositories",
+		Long:  `manage set of tracked repositories. remote names are listed without subcommand.`,
+		Run:   cmdRemote,
+	}
+	cmd.Flags().BoolP("verbose", "v", false, "show remote url after name.")
+	cmd.AddCommand(&cobra.Command{
+		Use:   "add NAME URL",
+		Short: "add a remote",
+		Long:  `add a remote named NAME for the repository at URL. its branches are fetched to refs/remotes/NAME/.`,
+		Run:   cmdRemoteAdd,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:     "remove NAME",
+		Aliases: []string{"rm"},
+		Short:   "remove a remote",
+		Long:    `remove a remote. its remote-tracking branches and upstream config of branches are removed.`,
+		Run:     cmdRemoteRemove,
+	})
+	cmd.AddCommand(&cobra.Command{
+		Use:   "rename OLD NEW",
+		Short: "rename a remote",
+		Long:  `rename a remote. its remote-tracking branches and upstream config of branches are updated.`,
+		Run:   cmdRemoteRename,
+	})
+	setURL := &cobra.Command{
+		Use:   "set-url [--push] NAME NEWURL",
+		Short: "change URL of a remote",
+		Long:  `change URL of a remote.`,
+		Run:   cmdRemoteSetURL,
+	}
+	setURL.Flags().Bool("push", false, "change push URL instead of URL.")
+	cmd.AddCommand(setURL)
+	prune := &cobra.Command{
+		Use:   "prune NAME...",
+		Short: "delete stale remote-tracking branches",
+		Long:  `delete remote-tracking branches whose branch no longer exists on the remote.`,
+		Run:   cmdRemotePrune,
+	}
+	prune.Flags().BoolP("dry-run", "n", false, "only report what would be pruned.")
+	cmd.AddCommand(prune)
+	return cmd
+}
+
+func cmdRemote(cmd *cobra.Command, args []string) {
+	if len(args) != 0 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	remotes, err := git.ListRemotes(repo)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	verbose, _ := cmd.Flags().GetBool("verbose")
+	for _, r := range remotes {
+		if !verbose {
+			cmd.Println(r.Name)
+			continue
+		}
+		pushURL := r.URL
+		if r.PushURL != "" {
+			pushURL = r.PushURL
+		}
+		cmd.Printf("%s\t%s (fetch)\n", r.Name, r.URL)
+		cmd.Printf("%s\t%s (push)\n", r.Name, pushURL)
+	}
+}
+
+func cmdRemoteAdd(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if err := git.AddRemote(repo, args[0], args[1]); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdRemoteRemove(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if err := git.RemoveRemote(repo, args[0]); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdRemoteRename(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if err := git.RenameRemote(repo, args[0], args[1]); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdRemoteSetURL(cmd *cobra.Command, args []string) {
+	if len(args) != 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	push, _ := cmd.Flags().GetBool("push")
+	if err := git.SetRemoteURL(repo, args[0], args[1], push); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdRemotePrune(cmd *cobra.Command, args []string) {
+	if len(args) == 0 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	for _, name := range args {
+		remote, err := git.GetRemote(repo, name)
+		if err != nil {
+			cmd.Println(err)
+			continue
+		}
+		pruned, err := git.PruneRemote(repo, name, dryRun)
+		if err != nil {
+			cmd.Println(err)
+			continue
+		}
+		if len(pruned) == 0 {
+			continue
+		}
+		cmd.Printf("Pruning %s\nURL: %s\n", name, remote.URL)
+		for _, ref := range pruned {
+			if dryRun {
+				cmd.Printf(" * [would prune] %s\n", git.ShortRefName(ref.Name))
+			} else {
+				cmd.Printf(" * [pruned] %s\n", git.ShortRefName(ref.Name))
+			}
+		}
+	}
+}
@@ -0,0 +1,157 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewResetCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "reset [--soft|--mixed|--hard|--merge|--keep] [-q] [COMMIT] | [COMMIT] [--] PATHSPEC...",
+		Short: "reset current HEAD to the specified state",
+		Long: `point the current branch, or HEAD if detached, to COMMIT (HEAD by default), and update the index and worktree by the mode.
+--mixed (default) resets the index, --soft leaves it, and --hard resets the index and worktree discarding local changes.
+--merge and --keep reset the index and update files which differ between HEAD and COMMIT, keeping local changes of other files.
+with PATHSPEC, the index entries of matching paths are reset to COMMIT, without moving HEAD.`,
+		Run: cmdReset,
+	}
+	cmd.Flags().Bool("soft", false, "only move HEAD.")
+	cmd.Flags().Bool("mixed", false, "move HEAD and reset the index.")
+	cmd.Flags().Bool("hard", false, "move HEAD, and reset the index and worktree.")
+	cmd.Flags().Bool("merge", false, "move HEAD, reset the index and update files changed between HEAD and COMMIT.")
+	cmd.Flags().Bool("keep", false, "like --merge, but refuse to reset unmerged entries.")
+	cmd.Flags().BoolP("quiet", "q", false, "only report errors.")
+	return cmd
+}
+
+func cmdReset(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	mode, modeName, err := resetMode(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	rev := "HEAD"
+	var paths []string
+	if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+		if dash > 1 {
+			cmd.Println(cmd.Usage())
+			return
+		}
+		if dash == 1 {
+			rev = args[0]
+		}
+		paths = args[dash:]
+	} else if len(args) > 0 {
+		// the first argument is a commit if it resolves to one, otherwise all arguments are paths
+		if _, err := git.ResolveCommit(repo, args[0]); err == nil {
+			rev, paths = args[0], args[1:]
+		} else {
+			paths = args
+		}
+	}
+
+	if len(paths) > 0 {
+		if modeName != "" && mode != git.ResetMixed {
+			cmd.Printf("Cannot do %s reset with paths.\n", mode)
+			return
+		}
+		if repo.Bare {
+			cmd.Println(errNoWorktree)
+			return
+		}
+		specs, err := repoPathspecs(repo, paths)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if err := git.ResetPaths(repo, rev, specs); err != nil {
+			cmd.Println(err)
+			return
+		}
+	} else if err := git.Reset(repo, rev, mode); err != nil {
+		cmd.Println(err)
+		return
+	}
+	if quiet {
+		return
+	}
+
+	switch {
+	case len(paths) > 0 || mode == git.ResetMixed:
+		printUnstagedChanges(cmd, repo)
+	case mode == git.ResetHard:
+		head, err := git.ResolveRef(repo, "HEAD")
+		if err != nil {
+			return
+		}
+		commit, err := git.ReadCommit(repo, head)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		fmt.Fprintf(cmd.OutOrStdout(), "HEAD is now at %s %s\n", head[:7], commit.Subject())
+	}
+}
+
+// resetMode return the mode selected by the flags, and its flag name if given.
+func resetMode(cmd *cobra.Command) (git.ResetMode, string, error) {
+	modes := []struct {
+		name string
+		mode git.ResetMode
+	}{
+		{"soft", git.ResetSoft},
+		{"mixed", git.ResetMixed},
+		{"hard", git.ResetHard},
+		{"merge", git.ResetMerge},
+		{"keep", git.ResetKeep},
+	}
+	mode, selected := git.ResetMixed, ""
+	for _, m := range modes {
+		if on, _ := cmd.Flags().GetBool(m.name); !on {
+			continue
+		}
+		if selected != "" {
+			return mode, "", fmt.Errorf("--%s and --%s are incompatible", selected, m.name)
+		}
+		mode, selected = m.mode, m.name
+	}
+	return mode, selected, nil
+}
+
+// printUnstagedChanges print files which have changes not staged in the index.
+func printUnstagedChanges(cmd *cobra.Command, repo *git.GitRepository) {
+	if repo.Bare {
+		return
+	}
+	index, err := git.ReadIndexOrEmpty(repo)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	changes, err := git.WorktreeChanges(repo, index)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if len(changes) == 0 {
+		return
+	}
+	out := cmd.OutOrStdout()
+	fmt.Fprintln(out, "Unstaged changes after reset:")
+	for _, c := range changes {
+		status := "M"
+		if c.Deleted {
+			status = "D"
+		}
+		fmt.Fprintf(out, "%s\t%s\n", status, c.Path)
+	}
+}
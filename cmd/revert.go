@@ -0,0 +1,22 @@
+package cmd
+
+import (
+	"github.com/spf13/cobra"
+)
+
+func NewRevertCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "revert [-n] [-m PARENT] COMMIT... | --continue | --skip | --abort",
+		Short: "revert some existing commits",
+		Long: `apply the reverse of the changes introduced by each COMMIT on HEAD, and record a new commit for each.
+COMMIT may be a range "A..B", which reverts commits reachable from B but not from A, from newer ones.
+the operation stops at conflicts, and is resumed by --continue or --skip, or cancelled by --abort.`,
+		Run: cmdRevert,
+	}
+	addSequencerFlags(cmd)
+	return cmd
+}
+
+func cmdRevert(cmd *cobra.Command, args []string) {
+	runSequencer(cmd, args, true)
+}
@@ -0,0 +1,65 @@
+package cmd
+
+import (
+	"fmt"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewRmCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "rm [--cached] [-r] [-f] [-n] [-q] [--ignore-unmatch] [--] PATHSPEC...",
+		Short: "remove files from the working tree and from the index",
+		Long: `remove files matching PATHSPEC from the index, and from the worktree unless --cached.
+files whose changes would be lost, staged in the index or modified in the worktree, are refused unless -f.`,
+		Run: cmdRm,
+	}
+	cmd.Flags().Bool("cached", false, "remove only from the index, keeping files in the worktree.")
+	cmd.Flags().BoolP("recursive", "r", false, "allow recursive removal when a leading directory name is given.")
+	cmd.Flags().BoolP("force", "f", false, "override the up-to-date check.")
+	cmd.Flags().BoolP("dry-run", "n", false, "only show the files which would be removed.")
+	cmd.Flags().BoolP("quiet", "q", false, "do not output a line for each removed file.")
+	cmd.Flags().Bool("ignore-unmatch", false, "exit successfully even if no files matched.")
+	return cmd
+}
+
+func cmdRm(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	if len(args) == 0 {
+		cmd.Println("No pathspec was given. Which files should I remove?")
+		return
+	}
+	specs, err := repoPathspecs(repo, args)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var opts git.RemoveOptions
+	opts.Cached, _ = cmd.Flags().GetBool("cached")
+	opts.Recursive, _ = cmd.Flags().GetBool("recursive")
+	opts.Force, _ = cmd.Flags().GetBool("force")
+	opts.DryRun, _ = cmd.Flags().GetBool("dry-run")
+	opts.IgnoreUnmatch, _ = cmd.Flags().GetBool("ignore-unmatch")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	removed, err := git.RemoveFiles(repo, specs, opts)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if quiet {
+		return
+	}
+	for _, name := range removed {
+		fmt.Fprintf(cmd.OutOrStdout(), "rm '%s'\n", name)
+	}
+}
@@ -1,9 +1,12 @@
 package cmd
 
 import (
+	"errors"
 	"fmt"
 	"os"
+	"strings"
 
+	"github.com/greytabby/mygit/git"
 	"github.com/spf13/cobra"
 )
 
@@ -15,6 +18,7 @@ func NewMygitCommand() *cobra.Command {
 		Run: func(cmd *cobra.Command, args []string) {
 
 		},
+		PersistentPreRun: setConfigParameters,
 	}
 	cmd.AddCommand(versionCmd)
 	cmd.AddCommand(NewInitCommand())
@@ -23,6 +27,31 @@ func NewMygitCommand() *cobra.Command {
 	cmd.AddCommand(NewLsTreeCommand())
 	cmd.AddCommand(NewLsFilesCommand())
 	cmd.AddCommand(NewAddCommand())
+	cmd.AddCommand(NewBranchCommand())
+	cmd.AddCommand(NewConfigCommand())
+	cmd.AddCommand(NewReflogCommand())
+	cmd.AddCommand(NewCloneCommand())
+	cmd.AddCommand(NewFetchCommand())
+	cmd.AddCommand(NewRemoteCommand())
+	cmd.AddCommand(NewPushCommand())
+	cmd.AddCommand(NewUploadPackCommand())
+	cmd.AddCommand(NewReceivePackCommand())
+	cmd.AddCommand(NewServeCommand())
+	cmd.AddCommand(NewBundleCommand())
+	cmd.AddCommand(NewGCCommand())
+	cmd.AddCommand(NewCommitGraphCommand())
+	cmd.AddCommand(NewMergeBaseCommand())
+	cmd.AddCommand(NewMultiPackIndexCommand())
+	cmd.AddCommand(NewStashCommand())
+	cmd.AddCommand(NewRebaseCommand())
+	cmd.AddCommand(NewCherryPickCommand())
+	cmd.AddCommand(NewRevertCommand())
+	cmd.AddCommand(NewResetCommand())
+	cmd.AddCommand(NewRmCommand())
+	cmd.AddCommand(NewMvCommand())
+	cmd.AddCommand(NewCleanCommand())
+	cmd.AddCommand(NewBlameCommand())
+	cmd.AddCommand(NewShowCommand())
 	return cmd
 }
 
@@ -35,6 +64,109 @@ var versionCmd = &cobra.Command{
 	},
 }
 
+var errNoWorktree = errors.New("this operation must be run in a work tree")
+
+// openRepo discover the repository which contains the directory given by -d flag.
+func openRepo(cmd *cobra.Command) (*git.GitRepository, error) {
+	dir, _ := cmd.Flags().GetString("d")
+	if dir == "" {
+		dir = "./"
+	}
+	return git.DiscoverRepository(dir)
+}
+
+// repoPathspecs convert paths relative to the current directory into pathspecs relative to worktree.
+func repoPathspecs(repo *git.GitRepository, args []string) ([]string, error) {
+	cwd, err := os.Getwd()
+	if err != nil {
+		return nil, err
+	}
+	var specs []string
+	for _, arg := range args {
+		spec, err := git.RepoRelativePath(repo, cwd, arg)
+		if err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(arg, "/") && spec != "." {
+			spec += "/"
+		}
+		specs = append(specs, spec)
+	}
+	return specs, nil
+}
+
+// setConfigParameters pass "-c name=value" to config reader through GIT_CONFIG_PARAMETERS.
+func setConfigParameters(cmd *cobra.Command, args []string) {
+	params, _ := cmd.Flags().GetStringArray("config")
+	if len(params) == 0 {
+		return
+	}
+	var quoted []string
+	if env := os.Getenv("GIT_CONFIG_PARAMETERS"); env != "" {
+		quoted = append(quoted, env)
+	}
+	for _, p := range params {
+		quoted = append(quoted, git.QuoteConfigParameter(p))
+	}
+	os.Setenv("GIT_CONFIG_PARAMETERS", strings.Join(quoted, " "))
+}
+
+// shortOnlyAnnotation marks flags which git has only as short options, like -x of clean.
+// pflag gives every flag a long name, so their long forms are rejected by checkShortOnly.
+const shortOnlyAnnotation = "mygit_short_only"
+
+// shortOnly mark flags of the command as short options only.
+// they are hidden from the flag list, which would show their long forms, so Long of the command describes them.
+func shortOnly(cmd *cobra.Command, names ...string) {
+	for _, name := range names {
+		_ = cmd.Flags().SetAnnotation(name, shortOnlyAnnotation, []string{"true"})
+		_ = cmd.Flags().MarkHidden(name)
+	}
+}
+
+// checkShortOnly return an error if args use the long form of a short only flag of the command.
+// values of flags are skipped, so "-e --x" is a pattern rather than a flag.
+func checkShortOnly(cmd *cobra.Command, args []string) error {
+	inherited := cmd.InheritedFlags()
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch {
+		case arg == "--":
+			return nil
+		case strings.HasPrefix(arg, "--"):
+			name := strings.SplitN(arg[2:], "=", 2)[0]
+			f := cmd.Flags().Lookup(name)
+			if f == nil {
+				if f = inherited.Lookup(name); f == nil {
+					continue
+				}
+			}
+			if _, ok := f.Annotations[shortOnlyAnnotation]; ok {
+				return fmt.Errorf("unknown flag: --%s", name)
+			}
+			if f.NoOptDefVal == "" && !strings.Contains(arg, "=") {
+				i++
+			}
+		case strings.HasPrefix(arg, "-") && len(arg) > 1:
+			for j := 1; j < len(arg); j++ {
+				f := cmd.Flags().ShorthandLookup(arg[j : j+1])
+				if f == nil {
+					f = inherited.ShorthandLookup(arg[j : j+1])
+				}
+				if f == nil || f.NoOptDefVal != "" {
+					continue
+				}
+				// the rest of the argument or the next one is the value
+				if j == len(arg)-1 {
+					i++
+				}
+				break
+			}
+		}
+	}
+	return nil
+}
+
 func Execute() {
 	mygit := NewMygitCommand()
 	dir, err := os.Getwd()
@@ -43,6 +175,13 @@ func Execute() {
 		return
 	}
 	mygit.PersistentFlags().StringP("d", "d", dir, "git repo directory")
+	mygit.PersistentFlags().StringArrayP("config", "c", nil, "pass a configuration parameter. <name>=<value>")
+	if cmd, _, err := mygit.Find(os.Args[1:]); err == nil {
+		if err := checkShortOnly(cmd, os.Args[1:]); err != nil {
+			cmd.Println("Error:", err)
+			os.Exit(1)
+		}
+	}
 	if err := mygit.Execute(); err != nil {
 		fmt.Println(err)
 		os.Exit(1)
@@ -0,0 +1,61 @@
+package cmd
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewServeCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "serve --http ADDRESS DIRECTORY",
+		Short: "serve repositories by smart HTTP protocol",
+		Long: `serve repositories under DIRECTORY by smart HTTP protocol.
+anyone can fetch and authenticated users can push by default.
+http.uploadpack, http.receivepack and http.user config of each repository change it.`,
+		Run: cmdServe,
+	}
+	cmd.Flags().String("http", "", "address to listen, like :8080.")
+	cmd.Flags().StringArray("user", nil, "user of basic authentication as NAME:PASSWORD.")
+	cmd.Flags().String("auth-file", "", "file which has NAME:PASSWORD lines of users.")
+	return cmd
+}
+
+func cmdServe(cmd *cobra.Command, args []string) {
+	addr, _ := cmd.Flags().GetString("http")
+	if len(args) != 1 || addr == "" {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	server := &git.HTTPServer{
+		Root:   args[0],
+		Users:  map[string]string{},
+		Logger: log.New(os.Stderr, "", log.LstdFlags),
+	}
+	if file, _ := cmd.Flags().GetString("auth-file"); file != "" {
+		users, err := git.LoadHTTPUsers(file)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		server.Users = users
+	}
+	users, _ := cmd.Flags().GetStringArray("user")
+	for _, user := range users {
+		colon := strings.IndexByte(user, ':')
+		if colon <= 0 {
+			cmd.Printf("Invalid user '%s'\n", user)
+			return
+		}
+		server.Users[user[:colon]] = user[colon+1:]
+	}
+
+	server.Logger.Printf("serving %s on %s", args[0], addr)
+	if err := http.ListenAndServe(addr, server); err != nil {
+		cmd.Println(err)
+	}
+}
@@ -0,0 +1,57 @@
+package cmd
+
+import (
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewShowCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "show [--format FORMAT] [--oneline] [--abbrev-commit] [-s] [--stat] [OBJECT...]",
+		Short: "show various types of objects",
+		Long: `show objects named by OBJECT (HEAD by default), which may be "REV:PATH" or ":PATH" for files in a tree or the index.
+commits are shown with the log message and the patch against the parent, annotated tags with the message and the tagged object,
+trees as the list of their entries, and blobs as their contents.
+FORMAT is oneline, short, medium (default), full, fuller, raw, reference, "format:STRING" or "tformat:STRING"
+where STRING has placeholders like %H, %h, %s, %an and %ad.`,
+		Run: cmdShow,
+	}
+	cmd.Flags().String("format", "", "pretty-print commits in the format.")
+	cmd.Flags().String("pretty", "", "same as --format.")
+	cmd.Flags().Bool("oneline", false, `shorthand for "--format=oneline --abbrev-commit".`)
+	cmd.Flags().Bool("abbrev-commit", false, "show abbreviated commit hashes.")
+	cmd.Flags().BoolP("no-patch", "s", false, "suppress the patch.")
+	cmd.Flags().Bool("stat", false, "show the diffstat instead of the patch.")
+	return cmd
+}
+
+func cmdShow(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	name, _ := cmd.Flags().GetString("format")
+	if cmd.Flags().Changed("pretty") {
+		name, _ = cmd.Flags().GetString("pretty")
+	}
+	oneline, _ := cmd.Flags().GetBool("oneline")
+	if oneline {
+		name = "oneline"
+	}
+	var opts git.ShowOptions
+	if opts.Format, err = git.ParsePrettyFormat(name); err != nil {
+		cmd.Println(err)
+		return
+	}
+	abbrev, _ := cmd.Flags().GetBool("abbrev-commit")
+	opts.Format.AbbrevCommit = abbrev || oneline
+	opts.NoPatch, _ = cmd.Flags().GetBool("no-patch")
+	opts.Stat, _ = cmd.Flags().GetBool("stat")
+	if len(args) == 0 {
+		args = []string{"HEAD"}
+	}
+	if err := git.ShowObjects(repo, cmd.OutOrStdout(), args, opts); err != nil {
+		cmd.Println(err)
+	}
+}
@@ -0,0 +1,415 @@
+package cmd
+
+import (
+	"errors"
+	"strings"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewStashCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "stash [push|save|list|show|apply|pop|drop|clear|branch|create|store]",
+		Short: "stash the changes in a dirty working directory away",
+		Long:  `save local modifications to a new stash entry and roll them back to HEAD. "stash" without a subcommand is "stash push".`,
+		Run:   cmdStashPush,
+	}
+	addStashPushFlags(cmd)
+	push := &cobra.Command{
+		Use:   "push [-k] [-u|-a] [-q] [-m MESSAGE] [--] [PATHSPEC...]",
+		Short: "save local modifications to a new stash entry",
+		Long:  `save local modifications to a new stash entry and roll them back to HEAD, only in PATHSPEC if given.`,
+		Run:   cmdStashPush,
+	}
+	addStashPushFlags(push)
+	save := &cobra.Command{
+		Use:   "save [-k] [-u|-a] [-q] [MESSAGE]",
+		Short: "save local modifications to a new stash entry with a message",
+		Long:  `save local modifications to a new stash entry. deprecated in favour of "stash push -m".`,
+		Run:   cmdStashSave,
+	}
+	addStashPushFlags(save)
+	list := &cobra.Command{
+		Use:   "list",
+		Short: "list the stash entries",
+		Long:  `list the stash entries. the newest one is stash@{0}.`,
+		Run:   cmdStashList,
+	}
+	show := &cobra.Command{
+		Use:   "show [-p] [--stat] [-u|--only-untracked] [STASH]",
+		Short: "show the changes recorded in the stash entry",
+		Long:  `show the changes recorded in the stash entry as a diff between the stashed contents and the commit where the stash was made.`,
+		Run:   cmdStashShow,
+	}
+	show.Flags().BoolP("patch", "p", false, "show the changes as a patch.")
+	show.Flags().Bool("stat", false, "show the diffstat.")
+	show.Flags().BoolP("include-untracked", "u", false, "show untracked files too.")
+	show.Flags().Bool("only-untracked", false, "show only untracked files.")
+	apply := &cobra.Command{
+		Use:   "apply [--index] [-q] [STASH]",
+		Short: "apply the stash on top of the current worktree",
+		Long:  `apply the stash on top of the current worktree. the stash is kept in the stash list.`,
+		Run:   cmdStashApply,
+	}
+	apply.Flags().Bool("index", false, "reinstate the changes of the index too.")
+	apply.Flags().BoolP("quiet", "q", false, "suppress feedback messages.")
+	pop := &cobra.Command{
+		Use:   "pop [--index] [-q] [STASH]",
+		Short: "apply the stash and remove it from the stash list",
+		Long:  `apply the stash on top of the current worktree, and remove it from the stash list if it is applied without conflicts.`,
+		Run:   cmdStashApply,
+	}
+	pop.Flags().Bool("index", false, "reinstate the changes of the index too.")
+	pop.Flags().BoolP("quiet", "q", false, "suppress feedback messages.")
+	drop := &cobra.Command{
+		Use:   "drop [-q] [STASH]",
+		Short: "remove a stash entry from the stash list",
+		Long:  `remove a stash entry from the stash list. the latest one is removed if STASH is omitted.`,
+		Run:   cmdStashDrop,
+	}
+	drop.Flags().BoolP("quiet", "q", false, "suppress feedback messages.")
+	clear := &cobra.Command{
+		Use:   "clear",
+		Short: "remove all the stash entries",
+		Long:  `remove all the stash entries.`,
+		Run:   cmdStashClear,
+	}
+	branch := &cobra.Command{
+		Use:   "branch BRANCH [STASH]",
+		Short: "create a branch from the commit where the stash was made, and apply the stash",
+		Long:  `create and check out BRANCH at the commit where the stash was made, apply the stash with its index, and drop it if it is applied.`,
+		Run:   cmdStashBranch,
+	}
+	create := &cobra.Command{
+		Use:   "create [MESSAGE]",
+		Short: "create a stash commit and print its object name",
+		Long:  `create a stash commit of local changes without updating refs and worktree, and print its object name.`,
+		Run:   cmdStashCreate,
+	}
+	store := &cobra.Command{
+		Use:   "store [-m MESSAGE] [-q] COMMIT",
+		Short: "store a stash commit in the stash list",
+		Long:  `store a stash commit created by "stash create" in the stash list.`,
+		Run:   cmdStashStore,
+	}
+	store.Flags().StringP("message", "m", "", "the message of the stash entry.")
+	store.Flags().BoolP("quiet", "q", false, "suppress feedback messages.")
+	cmd.AddCommand(push, save, list, show, apply, pop, drop, clear, branch, create, store)
+	return cmd
+}
+
+func addStashPushFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolP("keep-index", "k", false, "keep the changes of the index in the index and worktree.")
+	cmd.Flags().BoolP("include-untracked", "u", false, "stash untracked files too, and clean them.")
+	cmd.Flags().BoolP("all", "a", false, "stash ignored and untracked files too, and clean them.")
+	cmd.Flags().BoolP("quiet", "q", false, "suppress feedback messages.")
+	if cmd.Name() != "save" {
+		cmd.Flags().StringP("message", "m", "", "the description of the stash entry.")
+	}
+}
+
+func cmdStashPush(cmd *cobra.Command, args []string) {
+	pushStash(cmd, args, "")
+}
+
+func cmdStashSave(cmd *cobra.Command, args []string) {
+	pushStash(cmd, nil, strings.Join(args, " "))
+}
+
+func pushStash(cmd *cobra.Command, args []string, message string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	opts := git.StashOptions{Message: message}
+	if opts.Message == "" {
+		opts.Message, _ = cmd.Flags().GetString("message")
+	}
+	opts.KeepIndex, _ = cmd.Flags().GetBool("keep-index")
+	opts.IncludeUntracked, _ = cmd.Flags().GetBool("include-untracked")
+	opts.All, _ = cmd.Flags().GetBool("all")
+	if opts.IncludeUntracked && opts.All {
+		cmd.Println("Can't use --include-untracked and --all at the same time")
+		return
+	}
+	if opts.Pathspecs, err = repoPathspecs(repo, args); err != nil {
+		cmd.Println(err)
+		return
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	message, err = git.PushStash(repo, opts)
+	if errors.Is(err, git.ErrNoLocalChanges) {
+		if !quiet {
+			cmd.Println(err)
+		}
+		return
+	}
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if !quiet {
+		cmd.Printf("Saved working directory and index state %s\n", message)
+	}
+}
+
+func cmdStashList(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	entries, err := git.ListStashes(repo)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	for i, e := range entries {
+		cmd.Printf("stash@{%d}: %s\n", i, e.Message)
+	}
+}
+
+func cmdStashShow(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	stash, err := git.ResolveStash(repo, stashArg(args))
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	cfg, err := git.LoadConfig(repo)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	patch, _ := cmd.Flags().GetBool("patch")
+	stat, _ := cmd.Flags().GetBool("stat")
+	if !patch && !stat {
+		if stat, err = cfg.GetBool("stash.showStat", true); err != nil {
+			cmd.Println(err)
+			return
+		}
+		if patch, err = cfg.GetBool("stash.showPatch", false); err != nil {
+			cmd.Println(err)
+			return
+		}
+	}
+	untracked, _ := cmd.Flags().GetBool("include-untracked")
+	onlyUntracked, _ := cmd.Flags().GetBool("only-untracked")
+	if !untracked && !onlyUntracked {
+		untracked, _ = cfg.GetBool("stash.showIncludeUntracked", false)
+	}
+
+	changes, err := git.StashChanges(repo, stash, untracked || onlyUntracked, onlyUntracked)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	out := cmd.OutOrStdout()
+	if stat {
+		stats, err := git.DiffStats(repo, changes)
+		if err != nil {
+			cmd.Println(err)
+			return
+		}
+		if err := git.WriteDiffStat(out, stats); err != nil {
+			cmd.Println(err)
+			return
+		}
+	}
+	if patch {
+		if err := git.WritePatch(repo, out, changes); err != nil {
+			cmd.Println(err)
+		}
+	}
+}
+
+func cmdStashApply(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	rev := stashArg(args)
+	pop := cmd.Name() == "pop"
+	n, isRef := git.ParseStashIndex(rev)
+	if pop && !isRef {
+		cmd.Printf("'%s' is not a stash reference\n", rev)
+		return
+	}
+	stash, err := git.ResolveStash(repo, rev)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	index, _ := cmd.Flags().GetBool("index")
+	quiet, _ := cmd.Flags().GetBool("quiet")
+
+	result, err := git.ApplyStash(repo, stash, index)
+	if result != nil {
+		for _, msg := range result.Messages {
+			cmd.Println(msg)
+		}
+	}
+	if err != nil {
+		if result == nil {
+			cmd.Println(err)
+			return
+		}
+		if index {
+			cmd.Println("Index was not unstashed.")
+		}
+		if pop {
+			cmd.Println("The stash entry is kept in case you need it again.")
+		}
+		return
+	}
+	if pop {
+		dropStash(cmd, repo, rev, n, quiet)
+	}
+}
+
+func cmdStashDrop(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	rev := stashArg(args)
+	n, ok := git.ParseStashIndex(rev)
+	if !ok {
+		cmd.Printf("'%s' is not a stash reference\n", rev)
+		return
+	}
+	quiet, _ := cmd.Flags().GetBool("quiet")
+	dropStash(cmd, repo, rev, n, quiet)
+}
+
+// dropStash drop n-th stash and report it by the name given by user.
+func dropStash(cmd *cobra.Command, repo *git.GitRepository, rev string, n int, quiet bool) {
+	sha, err := git.DropStash(repo, n)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if rev == "" {
+		rev = "refs/stash@{0}"
+	}
+	if !quiet {
+		cmd.Printf("Dropped %s (%s)\n", rev, sha)
+	}
+}
+
+func cmdStashClear(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if err := git.ClearStash(repo); err != nil {
+		cmd.Println(err)
+	}
+}
+
+func cmdStashBranch(cmd *cobra.Command, args []string) {
+	if len(args) < 1 || len(args) > 2 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	if repo.Bare {
+		cmd.Println(errNoWorktree)
+		return
+	}
+	rev := stashArg(args[1:])
+	stash, err := git.ResolveStash(repo, rev)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	result, err := git.StashBranch(repo, args[0], stash)
+	if result != nil {
+		for _, msg := range result.Messages {
+			cmd.Println(msg)
+		}
+	}
+	if err != nil {
+		if result == nil {
+			cmd.Println(err)
+		}
+		return
+	}
+	cmd.Printf("Switched to a new branch '%s'\n", args[0])
+	if n, ok := git.ParseStashIndex(rev); ok {
+		dropStash(cmd, repo, rev, n, false)
+	}
+}
+
+func cmdStashCreate(cmd *cobra.Command, args []string) {
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	sha, err := git.CreateStash(repo, git.StashOptions{Message: strings.Join(args, " ")})
+	if errors.Is(err, git.ErrNoLocalChanges) {
+		return
+	}
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	cmd.Println(sha)
+}
+
+func cmdStashStore(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := openRepo(cmd)
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	sha, err := git.ResolveCommit(repo, args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	message, _ := cmd.Flags().GetString("message")
+	if message == "" {
+		message = "Created via \"git stash store\"."
+	}
+	if err := git.StoreStash(repo, sha, message); err != nil {
+		if quiet, _ := cmd.Flags().GetBool("quiet"); !quiet {
+			cmd.Println(err)
+		}
+	}
+}
+
+// stashArg return the stash given as the first argument, or empty string for the latest stash.
+func stashArg(args []string) string {
+	if len(args) == 0 {
+		return ""
+	}
+	return args[0]
+}
@@ -0,0 +1,44 @@
+package cmd
+
+import (
+	"os"
+
+	"github.com/greytabby/mygit/git"
+	"github.com/spf13/cobra"
+)
+
+func NewUploadPackCommand() *cobra.Command {
+	cmd := &cobra.Command{
+		Use:   "upload-pack [OPTIONS] DIRECTORY",
+		Short: "send objects packed back to git-fetch-pack",
+		Long: `send objects packed back to git-fetch-pack. it talks with the client by stdin and stdout.
+protocol version 2 is used if GIT_PROTOCOL requests it.`,
+		Run: cmdUploadPack,
+	}
+	cmd.Flags().Bool("stateless-rpc", false, "handle one request without ref advertisement.")
+	cmd.Flags().Bool("advertise-refs", false, "write only ref advertisement.")
+	cmd.Flags().Bool("http-backend-info-refs", false, "same as --advertise-refs.")
+	return cmd
+}
+
+func cmdUploadPack(cmd *cobra.Command, args []string) {
+	if len(args) != 1 {
+		cmd.Println(cmd.Usage())
+		return
+	}
+	repo, err := git.EnterRepository(args[0])
+	if err != nil {
+		cmd.Println(err)
+		return
+	}
+	var opts git.UploadPackOptions
+	opts.Version = git.ParseProtocolVersion(os.Getenv("GIT_PROTOCOL"))
+	opts.StatelessRPC, _ = cmd.Flags().GetBool("stateless-rpc")
+	opts.AdvertiseRefs, _ = cmd.Flags().GetBool("advertise-refs")
+	if infoRefs, _ := cmd.Flags().GetBool("http-backend-info-refs"); infoRefs {
+		opts.AdvertiseRefs = true
+	}
+	if err := git.UploadPack(repo, cmd.InOrStdin(), cmd.OutOrStdout(), opts); err != nil {
+		cmd.Println(err)
+	}
+}
@@ -0,0 +1,754 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// scores of alphanumeric characters which moved or copied lines need to be detected, like git.
+const (
+	blameMoveScore = 20
+	blameCopyScore = 40
+)
+
+// BlameOptions is options of Blame.
+type BlameOptions struct {
+	// Rev is the commit to start from. empty Rev blames the file in worktree,
+	// whose lines not committed yet are attributed to the null commit.
+	Rev  string
+	Path string
+	// IgnoreWhitespace compares lines ignoring whitespaces.
+	IgnoreWhitespace bool
+	// Moves detects lines moved within the file.
+	Moves bool
+	// Copies detects lines moved or copied from other files modified in the same commit,
+	// or from any file of the parent if it is 2 or more. it implies Moves.
+	Copies int
+	// IgnoreRevs are commits whose changes are attributed to their parents as far as possible.
+	IgnoreRevs []string
+}
+
+// BlameCommit is a commit which lines are attributed to.
+type BlameCommit struct {
+	Sha       string
+	Author    GitUser
+	Committer GitUser
+	Summary   string
+	// Boundary is true if the commit has no parents.
+	Boundary bool
+	// Previous is the parent which the file is compared with, and PreviousPath is the path in it.
+	Previous     string
+	PreviousPath string
+}
+
+// BlameLine is a line of the blamed file and its origin. line numbers are 1-based.
+type BlameLine struct {
+	Commit *BlameCommit
+	// Path is the path of the file in the commit.
+	Path     string
+	OrigLine int
+	Line     int
+	Content  string
+}
+
+// blameOrigin is a version of a file in a commit.
+type blameOrigin struct {
+	commit string
+	path   string
+	blob   string
+	lines  []string
+}
+
+// blameEntry is a line of the final file whose origin is being searched. line numbers are 0-based.
+type blameEntry struct {
+	final int
+	orig  int
+}
+
+// blameSuspect is lines of the final file which come from the origin or its ancestors.
+type blameSuspect struct {
+	origin  *blameOrigin
+	entries []*blameEntry
+	time    int64
+}
+
+type blamer struct {
+	repo     *GitRepository
+	opts     BlameOptions
+	commits  map[string]*GitCommit
+	infos    map[string]*BlameCommit
+	ignored  map[string]bool
+	suspects map[string]*blameSuspect
+	final    []string
+	lines    []*BlameLine
+}
+
+// Blame attribute each line of the file to the commit which introduced it.
+// history is walked from newer commits, and lines which are unchanged from a parent are passed to it.
+func Blame(repo *GitRepository, opts BlameOptions) ([]*BlameLine, error) {
+	b := &blamer{
+		repo:     repo,
+		opts:     opts,
+		commits:  map[string]*GitCommit{},
+		infos:    map[string]*BlameCommit{},
+		ignored:  map[string]bool{},
+		suspects: map[string]*blameSuspect{},
+	}
+	for _, rev := range opts.IgnoreRevs {
+		sha, err := ResolveCommit(repo, rev)
+		if err != nil {
+			return nil, fmt.Errorf("cannot find revision %s to ignore", rev)
+		}
+		b.ignored[sha] = true
+	}
+	final, err := b.finalOrigin()
+	if err != nil {
+		return nil, err
+	}
+	b.final = final.lines
+	b.lines = make([]*BlameLine, len(final.lines))
+	entries := make([]*blameEntry, len(final.lines))
+	for i := range entries {
+		entries[i] = &blameEntry{final: i, orig: i}
+	}
+	if err := b.addSuspect(final, entries); err != nil {
+		return nil, err
+	}
+	for len(b.suspects) > 0 {
+		if err := b.pass(b.nextSuspect()); err != nil {
+			return nil, err
+		}
+	}
+	return b.lines, nil
+}
+
+// finalOrigin return the version of the file to be blamed.
+func (b *blamer) finalOrigin() (*blameOrigin, error) {
+	if b.opts.Rev != "" {
+		sha, err := ResolveCommit(b.repo, b.opts.Rev)
+		if err != nil {
+			return nil, err
+		}
+		commit, err := b.commit(sha)
+		if err != nil {
+			return nil, err
+		}
+		o, err := b.origin(sha, commit.Tree, b.opts.Path)
+		if err == nil && o == nil {
+			err = fmt.Errorf("no such path %s in %s", b.opts.Path, b.opts.Rev)
+		}
+		return o, err
+	}
+
+	var parents []string
+	if head, err := ResolveRef(b.repo, "HEAD"); err == nil {
+		tree, err := CommitTree(b.repo, head)
+		if err != nil {
+			return nil, err
+		}
+		e, err := lookupTreePath(b.repo, tree, b.opts.Path)
+		if err != nil {
+			return nil, err
+		}
+		if e == nil {
+			return nil, fmt.Errorf("no such path '%s' in HEAD", b.opts.Path)
+		}
+		parents = []string{head}
+	}
+	data, err := ioutil.ReadFile(worktreeFile(b.repo, b.opts.Path))
+	if err != nil {
+		return nil, fmt.Errorf("cannot stat path '%s': %v", b.opts.Path, err)
+	}
+	now := time.Now()
+	ident := GitUser{Name: "Not Committed Yet", Email: "not.committed.yet", Time: fmt.Sprintf("%d %s", now.Unix(), now.Format("-0700"))}
+	b.commits[zeroSha] = &GitCommit{
+		Parents:   parents,
+		Author:    ident,
+		Committer: ident,
+		Message:   fmt.Sprintf("Version of %s from %s\n", b.opts.Path, b.opts.Path),
+	}
+	return &blameOrigin{commit: zeroSha, path: b.opts.Path, lines: splitLines(data)}, nil
+}
+
+func (b *blamer) commit(sha string) (*GitCommit, error) {
+	if commit, ok := b.commits[sha]; ok {
+		return commit, nil
+	}
+	commit, err := ReadCommit(b.repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	b.commits[sha] = commit
+	return commit, nil
+}
+
+// origin return the file at the path in the tree of the commit, or nil if it is not a file.
+func (b *blamer) origin(sha, tree, path string) (*blameOrigin, error) {
+	e, err := lookupTreePath(b.repo, tree, path)
+	if err != nil || e == nil || e.IsTree() || e.IsGitlink() {
+		return nil, err
+	}
+	return b.blobOrigin(sha, path, e.Sha)
+}
+
+func (b *blamer) blobOrigin(sha, path, blob string) (*blameOrigin, error) {
+	obj, err := ReadObject(b.repo, blob)
+	if err != nil {
+		return nil, err
+	}
+	data, ok := obj.(*GitBlob)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a blob", blob)
+	}
+	return &blameOrigin{commit: sha, path: path, blob: blob, lines: splitLines(data.Data)}, nil
+}
+
+// addSuspect let entries be searched in the origin.
+func (b *blamer) addSuspect(o *blameOrigin, entries []*blameEntry) error {
+	if len(entries) == 0 {
+		return nil
+	}
+	key := o.commit + "\x00" + o.path
+	if s, ok := b.suspects[key]; ok {
+		s.entries = append(s.entries, entries...)
+		return nil
+	}
+	commit, err := b.commit(o.commit)
+	if err != nil {
+		return err
+	}
+	when, _ := commit.Committer.When()
+	b.suspects[key] = &blameSuspect{origin: o, entries: entries, time: when.Unix()}
+	return nil
+}
+
+// nextSuspect remove and return the suspect of the newest commit.
+func (b *blamer) nextSuspect() *blameSuspect {
+	var key string
+	var next *blameSuspect
+	for k, s := range b.suspects {
+		if next == nil || s.time > next.time || s.time == next.time && k < key {
+			key, next = k, s
+		}
+	}
+	delete(b.suspects, key)
+	return next
+}
+
+// pass pass lines of the suspect which come from parents to them, and attribute the rest to the commit.
+func (b *blamer) pass(s *blameSuspect) error {
+	sha := s.origin.commit
+	commit, err := b.commit(sha)
+	if err != nil {
+		return err
+	}
+	info, ok := b.infos[sha]
+	if !ok {
+		info = &BlameCommit{
+			Sha:       sha,
+			Author:    commit.Author,
+			Committer: commit.Committer,
+			Summary:   commit.Subject(),
+			Boundary:  len(commit.Parents) == 0,
+		}
+		b.infos[sha] = info
+	}
+
+	var parents []*blameOrigin
+	for _, parent := range commit.Parents {
+		o, err := b.parentOrigin(s.origin, commit, parent)
+		if err != nil {
+			return err
+		}
+		if o != nil {
+			parents = append(parents, o)
+		}
+	}
+	if len(parents) > 0 && info.Previous == "" {
+		info.Previous, info.PreviousPath = parents[0].commit, parents[0].path
+	}
+
+	remaining := s.entries
+	for _, o := range parents {
+		if o.blob == s.origin.blob {
+			return b.addSuspect(o, remaining)
+		}
+		if remaining, err = b.passByDiff(s.origin, o, remaining, b.ignored[sha]); err != nil {
+			return err
+		}
+	}
+	if b.opts.Moves || b.opts.Copies > 0 {
+		for _, o := range parents {
+			if remaining, err = b.passCopies(s.origin, o, remaining, blameMoveScore); err != nil {
+				return err
+			}
+		}
+	}
+	if b.opts.Copies > 0 && len(remaining) > 0 {
+		for _, parent := range commit.Parents {
+			if remaining, err = b.passCopiesFromFiles(s.origin, commit, parent, remaining); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, e := range remaining {
+		b.lines[e.final] = &BlameLine{
+			Commit:   info,
+			Path:     s.origin.path,
+			OrigLine: e.orig + 1,
+			Line:     e.final + 1,
+			Content:  b.final[e.final],
+		}
+	}
+	return nil
+}
+
+// parentOrigin return the file in the parent which the file of the commit comes from.
+// if the path does not exist in the parent, a file removed by the commit with similar contents is a rename source.
+func (b *blamer) parentOrigin(o *blameOrigin, commit *GitCommit, parent string) (*blameOrigin, error) {
+	pc, err := b.commit(parent)
+	if err != nil {
+		return nil, err
+	}
+	po, err := b.origin(parent, pc.Tree, o.path)
+	if err != nil || po != nil || commit.Tree == "" {
+		return po, err
+	}
+	changes, err := DiffTrees(b.repo, pc.Tree, commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	var best *blameOrigin
+	bestScore := 0
+	for _, c := range changes {
+		if c.New != nil || c.Old.IsGitlink() {
+			continue
+		}
+		candidate, err := b.blobOrigin(parent, c.Path, c.Old.Sha)
+		if err != nil {
+			return nil, err
+		}
+		score := len(diffLines(candidate.lines, o.lines))
+		size := len(candidate.lines)
+		if len(o.lines) > size {
+			size = len(o.lines)
+		}
+		if score*2 >= size && score > bestScore {
+			best, bestScore = candidate, score
+		}
+	}
+	return best, nil
+}
+
+// normalize return lines to be compared.
+func (b *blamer) normalize(lines []string) []string {
+	if !b.opts.IgnoreWhitespace {
+		return lines
+	}
+	normalized := make([]string, len(lines))
+	for i, line := range lines {
+		normalized[i] = strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)
+	}
+	return normalized
+}
+
+// passByDiff pass entries of lines which are unchanged from the parent, and return the rest.
+// for an ignored commit, changed lines are passed to lines at the same offsets in the hunks of the parent.
+func (b *blamer) passByDiff(o, parent *blameOrigin, entries []*blameEntry, ignored bool) ([]*blameEntry, error) {
+	matches := diffLines(b.normalize(parent.lines), b.normalize(o.lines))
+	toParent := map[int]int{}
+	for _, m := range matches {
+		toParent[m[1]] = m[0]
+	}
+	if ignored {
+		prev := [2]int{-1, -1}
+		for _, m := range append(matches, [2]int{len(parent.lines), len(o.lines)}) {
+			for i := 1; prev[0]+i < m[0] && prev[1]+i < m[1]; i++ {
+				toParent[prev[1]+i] = prev[0] + i
+			}
+			prev = m
+		}
+	}
+	var passed, remaining []*blameEntry
+	for _, e := range entries {
+		if line, ok := toParent[e.orig]; ok {
+			passed = append(passed, &blameEntry{final: e.final, orig: line})
+		} else {
+			remaining = append(remaining, e)
+		}
+	}
+	return remaining, b.addSuspect(parent, passed)
+}
+
+// passCopies pass entries of blocks of lines which are found in the file of the parent,
+// if the blocks have alphanumeric characters as many as score. the rest is returned.
+func (b *blamer) passCopies(o, parent *blameOrigin, entries []*blameEntry, score int) ([]*blameEntry, error) {
+	if len(entries) == 0 {
+		return nil, nil
+	}
+	entries = append([]*blameEntry(nil), entries...)
+	sort.Slice(entries, func(i, j int) bool { return entries[i].orig < entries[j].orig })
+	lines, targets := b.normalize(o.lines), b.normalize(parent.lines)
+	positions := map[string][]int{}
+	for i, line := range targets {
+		positions[line] = append(positions[line], i)
+	}
+
+	var passed, remaining []*blameEntry
+	for i := 0; i < len(entries); {
+		bestLen, bestPos := 0, 0
+		for _, pos := range positions[lines[entries[i].orig]] {
+			n := 1
+			for i+n < len(entries) && pos+n < len(targets) &&
+				entries[i+n].orig == entries[i+n-1].orig+1 && lines[entries[i+n].orig] == targets[pos+n] {
+				n++
+			}
+			if n > bestLen {
+				bestLen, bestPos = n, pos
+			}
+		}
+		alnum := 0
+		for k := 0; k < bestLen; k++ {
+			for _, r := range o.lines[entries[i+k].orig] {
+				if unicode.IsLetter(r) || unicode.IsDigit(r) {
+					alnum++
+				}
+			}
+		}
+		if bestLen == 0 || alnum < score {
+			remaining = append(remaining, entries[i])
+			i++
+			continue
+		}
+		for k := 0; k < bestLen; k++ {
+			passed = append(passed, &blameEntry{final: entries[i+k].final, orig: bestPos + k})
+		}
+		i += bestLen
+	}
+	return remaining, b.addSuspect(parent, passed)
+}
+
+// passCopiesFromFiles pass entries of lines copied from other files of the parent.
+// the files are ones modified by the commit, or all files if Copies is 2 or more.
+func (b *blamer) passCopiesFromFiles(o *blameOrigin, commit *GitCommit, parent string, entries []*blameEntry) ([]*blameEntry, error) {
+	pc, err := b.commit(parent)
+	if err != nil {
+		return nil, err
+	}
+	var files []*GitTreeEntry
+	if b.opts.Copies > 1 {
+		if files, err = ReadTreeFiles(b.repo, pc.Tree); err != nil {
+			return nil, err
+		}
+	} else if commit.Tree != "" {
+		changes, err := DiffTrees(b.repo, pc.Tree, commit.Tree)
+		if err != nil {
+			return nil, err
+		}
+		for _, c := range changes {
+			if c.Old != nil {
+				files = append(files, &GitTreeEntry{Mode: c.Old.Mode, Path: c.Path, Sha: c.Old.Sha})
+			}
+		}
+	}
+	for _, f := range files {
+		if len(entries) == 0 {
+			break
+		}
+		if f.Path == o.path || f.IsGitlink() {
+			continue
+		}
+		candidate, err := b.blobOrigin(parent, f.Path, f.Sha)
+		if err != nil {
+			return nil, err
+		}
+		if entries, err = b.passCopies(o, candidate, entries, blameCopyScore); err != nil {
+			return nil, err
+		}
+	}
+	return entries, nil
+}
+
+// ReadBlameIgnoreRevs read revisions to be ignored by blame from the file like .git-blame-ignore-revs.
+// each line has a revision, and "#" begins a comment.
+func ReadBlameIgnoreRevs(file string) ([]string, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("could not open object name list: %s", file)
+	}
+	var revs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		if line = strings.TrimSpace(line); line != "" {
+			revs = append(revs, line)
+		}
+	}
+	return revs, nil
+}
+
+// SelectBlameLines return lines in ranges of -L like "N,M", "N,+K", "N,-K", "/REGEX/,M" or "N". ranges may overlap.
+func SelectBlameLines(lines []*BlameLine, path string, ranges []string) ([]*BlameLine, error) {
+	if len(ranges) == 0 {
+		return lines, nil
+	}
+	selected := make([]bool, len(lines))
+	for _, spec := range ranges {
+		start, end, err := parseBlameRange(lines, path, spec)
+		if err != nil {
+			return nil, err
+		}
+		for i := start; i < end; i++ {
+			selected[i] = true
+		}
+	}
+	var result []*BlameLine
+	for i, line := range lines {
+		if selected[i] {
+			result = append(result, line)
+		}
+	}
+	return result, nil
+}
+
+// parseBlameRange return the range of 0-based line indexes, whose end is exclusive.
+func parseBlameRange(lines []*BlameLine, path, spec string) (int, int, error) {
+	startSpec, endSpec := spec, ""
+	if i := blameRangeSeparator(spec); i >= 0 {
+		startSpec, endSpec = spec[:i], spec[i+1:]
+	}
+	start := 1
+	if startSpec != "" {
+		n, err := blameRangeLine(lines, startSpec, 1)
+		if err != nil {
+			return 0, 0, err
+		}
+		start = n
+	}
+	if start > len(lines) {
+		return 0, 0, fmt.Errorf("file %s has only %d line%s", path, len(lines), plural(len(lines)))
+	}
+	end := len(lines)
+	switch {
+	case endSpec == "":
+	case strings.HasPrefix(endSpec, "+") || strings.HasPrefix(endSpec, "-"):
+		n, err := strconv.Atoi(endSpec[1:])
+		if err != nil {
+			return 0, 0, fmt.Errorf("-L parameter '%s': invalid offset", spec)
+		}
+		if endSpec[0] == '+' {
+			end = start + n - 1
+		} else {
+			start, end = start-n+1, start
+		}
+		if n == 0 {
+			end = start
+		}
+	default:
+		n, err := blameRangeLine(lines, endSpec, start)
+		if err != nil {
+			return 0, 0, err
+		}
+		end = n
+	}
+	if end < start {
+		start, end = end, start
+	}
+	if start < 1 {
+		start = 1
+	}
+	if end > len(lines) {
+		end = len(lines)
+	}
+	return start - 1, end, nil
+}
+
+// blameRangeSeparator return the index of "," which is not in a regex.
+func blameRangeSeparator(spec string) int {
+	inRegex := false
+	for i := 0; i < len(spec); i++ {
+		switch {
+		case spec[i] == '\\' && inRegex:
+			i++
+		case spec[i] == '/':
+			inRegex = !inRegex
+		case spec[i] == ',' && !inRegex:
+			return i
+		}
+	}
+	return -1
+}
+
+// blameRangeLine return the 1-based line number of a number or "/REGEX/" which is searched from the line from.
+func blameRangeLine(lines []*BlameLine, spec string, from int) (int, error) {
+	if strings.HasPrefix(spec, "/") {
+		pattern := strings.TrimSuffix(spec[1:], "/")
+		re, err := regexp.Compile(pattern)
+		if err != nil {
+			return 0, fmt.Errorf("-L parameter '%s': %v", pattern, err)
+		}
+		for i := from - 1; i < len(lines); i++ {
+			if re.MatchString(lines[i].Content) {
+				return i + 1, nil
+			}
+		}
+		return 0, fmt.Errorf("-L parameter '%s': no match", pattern)
+	}
+	n, err := strconv.Atoi(spec)
+	if err != nil || n < 1 {
+		return 0, fmt.Errorf("-L invalid line number: %s", spec)
+	}
+	return n, nil
+}
+
+func plural(n int) string {
+	if n == 1 {
+		return ""
+	}
+	return "s"
+}
+
+// BlameFormat is the output format of WriteBlame.
+type BlameFormat struct {
+	// Porcelain shows information of each commit only at its first line,
+	// and LinePorcelain shows it at every line, which are for machine consumption.
+	Porcelain     bool
+	LinePorcelain bool
+	// LongSha shows full hashes instead of abbreviated ones.
+	LongSha bool
+	// NoAuthor suppresses the author name and the time.
+	NoAuthor bool
+	// ShowEmail shows the author email instead of the name.
+	ShowEmail bool
+	// ShowName shows the path in the origin commit.
+	ShowName bool
+}
+
+// WriteBlame write blamed lines in the format of git blame.
+func WriteBlame(w io.Writer, lines []*BlameLine, format BlameFormat) error {
+	if format.Porcelain || format.LinePorcelain {
+		return writeBlamePorcelain(w, lines, format.LinePorcelain)
+	}
+	nameWidth, authorWidth, lineWidth := 0, 0, 0
+	for _, line := range lines {
+		if n := len(line.Path); n > nameWidth {
+			nameWidth = n
+		}
+		if n := utf8.RuneCountInString(blameAuthor(line, format)); n > authorWidth {
+			authorWidth = n
+		}
+		if n := len(strconv.Itoa(line.Line)); n > lineWidth {
+			lineWidth = n
+		}
+	}
+	for _, line := range lines {
+		var b strings.Builder
+		sha := line.Commit.Sha
+		if !format.LongSha {
+			sha = sha[:8]
+		}
+		if line.Commit.Boundary {
+			sha = "^" + sha[:len(sha)-1]
+		}
+		b.WriteString(sha)
+		if format.ShowName {
+			fmt.Fprintf(&b, " %-*s", nameWidth, line.Path)
+		}
+		if format.NoAuthor {
+			fmt.Fprintf(&b, " %*d) ", lineWidth, line.Line)
+		} else {
+			author := blameAuthor(line, format)
+			date := ""
+			if when, err := line.Commit.Author.When(); err == nil {
+				date = when.Format("2006-01-02 15:04:05 -0700")
+			}
+			pad := authorWidth - utf8.RuneCountInString(author)
+			fmt.Fprintf(&b, " (%s%*s %10s %*d) ", author, pad, "", date, lineWidth, line.Line)
+		}
+		b.WriteString(line.Content)
+		if !strings.HasSuffix(line.Content, "\n") {
+			b.WriteString("\n")
+		}
+		if _, err := io.WriteString(w, b.String()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func blameAuthor(line *BlameLine, format BlameFormat) string {
+	if format.ShowEmail {
+		return "<" + line.Commit.Author.Email + ">"
+	}
+	return line.Commit.Author.Name
+}
+
+// writeBlamePorcelain write lines in the porcelain format. consecutive lines from the same commit are grouped.
+func writeBlamePorcelain(w io.Writer, lines []*BlameLine, everyLine bool) error {
+	shown := map[string]bool{}
+	var b strings.Builder
+	for i, line := range lines {
+		c := line.Commit
+		group := 0
+		if i == 0 || !sameBlameGroup(lines[i-1], line) {
+			group = 1
+			for group < len(lines)-i && sameBlameGroup(lines[i+group-1], lines[i+group]) {
+				group++
+			}
+		}
+		if group > 0 {
+			fmt.Fprintf(&b, "%s %d %d %d\n", c.Sha, line.OrigLine, line.Line, group)
+		} else {
+			fmt.Fprintf(&b, "%s %d %d\n", c.Sha, line.OrigLine, line.Line)
+		}
+		if everyLine || !shown[c.Sha] {
+			shown[c.Sha] = true
+			for _, who := range []struct {
+				role string
+				user GitUser
+			}{{"author", c.Author}, {"committer", c.Committer}} {
+				fields := strings.Fields(who.user.Time)
+				for len(fields) < 2 {
+					fields = append(fields, "")
+				}
+				fmt.Fprintf(&b, "%s %s\n%s-mail <%s>\n%s-time %s\n%s-tz %s\n",
+					who.role, who.user.Name, who.role, who.user.Email, who.role, fields[0], who.role, fields[1])
+			}
+			fmt.Fprintf(&b, "summary %s\n", c.Summary)
+			if c.Boundary {
+				b.WriteString("boundary\n")
+			}
+			if c.Previous != "" {
+				fmt.Fprintf(&b, "previous %s %s\n", c.Previous, c.PreviousPath)
+			}
+			fmt.Fprintf(&b, "filename %s\n", line.Path)
+		}
+		fmt.Fprintf(&b, "\t%s", line.Content)
+		if !strings.HasSuffix(line.Content, "\n") {
+			b.WriteString("\n")
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// sameBlameGroup return true if next is the line following prev in the same origin.
+func sameBlameGroup(prev, next *BlameLine) bool {
+	return prev.Commit == next.Commit && prev.Path == next.Path &&
+		prev.OrigLine+1 == next.OrigLine && prev.Line+1 == next.Line
+}
@@ -0,0 +1,87 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlame(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	first := commitTestFiles(t, repo, "first", map[string]string{"a": "one\ntwo\nthree\n"})
+	second := commitTestFiles(t, repo, "second", map[string]string{"a": "one\nTWO\nthree\nfour\n"})
+	third := commitTestFiles(t, repo, "rename", map[string]string{"b": "one\nTWO  \nthree\nfour\n"})
+
+	commits := func(lines []*BlameLine) []string {
+		var shas []string
+		for _, line := range lines {
+			shas = append(shas, line.Commit.Sha)
+		}
+		return shas
+	}
+	lines, err := Blame(repo, BlameOptions{Rev: "HEAD", Path: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first, third, first, second}, commits(lines))
+	assert.Equal(t, "a", lines[0].Path)
+	assert.Equal(t, "TWO  \n", lines[1].Content)
+	assert.True(t, lines[0].Commit.Boundary)
+	assert.Equal(t, second, lines[1].Commit.Previous)
+	assert.Equal(t, "a", lines[1].Commit.PreviousPath)
+
+	// whitespace changes and ignored revisions are attributed to parents
+	lines, err = Blame(repo, BlameOptions{Rev: "HEAD", Path: "b", IgnoreWhitespace: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first, second, first, second}, commits(lines))
+	lines, err = Blame(repo, BlameOptions{Rev: "HEAD", Path: "b", IgnoreRevs: []string{third}})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first, second, first, second}, commits(lines))
+
+	// uncommitted lines in worktree
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "b"), []byte("one\nTWO  \nthree\nfour\nfive\n"), 0644))
+	lines, err = Blame(repo, BlameOptions{Path: "b"})
+	assert.NoError(t, err)
+	assert.Equal(t, zeroSha, lines[4].Commit.Sha)
+	assert.Equal(t, "Not Committed Yet", lines[4].Commit.Author.Name)
+
+	selected, err := SelectBlameLines(lines, "b", []string{"2,+2", "/five/"})
+	assert.NoError(t, err)
+	assert.Equal(t, 3, len(selected))
+	assert.Equal(t, 2, selected[0].Line)
+	assert.Equal(t, 5, selected[2].Line)
+	_, err = SelectBlameLines(lines, "b", []string{"9"})
+	assert.EqualError(t, err, "file b has only 5 lines")
+
+	_, err = Blame(repo, BlameOptions{Rev: "HEAD", Path: "nothing"})
+	assert.EqualError(t, err, "no such path nothing in HEAD")
+}
+
+func TestBlameMoves(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	alpha := "func alpha() {\n\treturn compute(alphaValue)\n}\n"
+	beta := "func beta() {\n\treturn compute(betaValue)\n}\n"
+	first := commitTestFiles(t, repo, "first", map[string]string{"m": alpha + "\n" + beta})
+	second := commitTestFiles(t, repo, "move", map[string]string{"m": beta + "\n" + alpha})
+
+	lines, err := Blame(repo, BlameOptions{Rev: "HEAD", Path: "m"})
+	assert.NoError(t, err)
+	assert.Equal(t, second, lines[4].Commit.Sha)
+	lines, err = Blame(repo, BlameOptions{Rev: "HEAD", Path: "m", Moves: true})
+	assert.NoError(t, err)
+	assert.Equal(t, first, lines[4].Commit.Sha)
+	assert.Equal(t, 1, lines[4].OrigLine)
+
+	var out bytes.Buffer
+	assert.NoError(t, WriteBlame(&out, lines[4:6], BlameFormat{Porcelain: true}))
+	assert.Contains(t, out.String(), first+" 1 5 2\nauthor ")
+	assert.Contains(t, out.String(), "summary first\nboundary\nfilename m\n\tfunc alpha() {\n"+first+" 2 6\n\t\treturn")
+}
@@ -0,0 +1,120 @@
+package git
+
+import (
+	"encoding/binary"
+	"math/bits"
+	"strings"
+)
+
+// settings of changed-path Bloom filters, which are the same as git.
+const (
+	bloomHashVersion     = 1
+	bloomNumHashes       = 7
+	bloomBitsPerEntry    = 10
+	bloomMaxChangedPaths = 512
+)
+
+// bloomFilter is a changed-path Bloom filter of a commit.
+// it contains paths changed from the first parent and their leading directories.
+type bloomFilter []byte
+
+// newBloomFilter return a filter containing paths and their leading directories.
+// too many paths make a filter of one byte whose all bits are set, which matches any path.
+func newBloomFilter(paths []string) bloomFilter {
+	keys := map[string]bool{}
+	for _, path := range paths {
+		for path != "" {
+			keys[path] = true
+			slash := strings.LastIndexByte(path, '/')
+			if slash < 0 {
+				break
+			}
+			path = path[:slash]
+		}
+	}
+	if len(paths) > bloomMaxChangedPaths || len(keys) > bloomMaxChangedPaths {
+		return bloomFilter{0xff}
+	}
+	size := (len(keys)*bloomBitsPerEntry + 7) / 8
+	if size == 0 {
+		size = 1
+	}
+	filter := make(bloomFilter, size)
+	for key := range keys {
+		for _, h := range bloomHashes(key) {
+			pos := uint64(h) % uint64(len(filter)*8)
+			filter[pos/8] |= 1 << (pos % 8)
+		}
+	}
+	return filter
+}
+
+// mayContain return false if path is definitely not in the filter.
+func (f bloomFilter) mayContain(path string) bool {
+	if len(f) == 0 {
+		return true
+	}
+	for _, h := range bloomHashes(path) {
+		pos := uint64(h) % uint64(len(f)*8)
+		if f[pos/8]&(1<<(pos%8)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHashes return positions of the key by double hashing of two murmur3 hashes.
+func bloomHashes(key string) [bloomNumHashes]uint32 {
+	h0 := murmur3([]byte(key), 0x293ae76f)
+	h1 := murmur3([]byte(key), 0x7e646e2c)
+	var hashes [bloomNumHashes]uint32
+	for i := range hashes {
+		hashes[i] = h0 + uint32(i)*h1
+	}
+	return hashes
+}
+
+// murmur3 return 32-bit murmur3 hash of data.
+// tail bytes are sign-extended like version 1 of git's changed-path filters.
+func murmur3(data []byte, seed uint32) uint32 {
+	const (
+		c1 = 0xcc9e2d51
+		c2 = 0x1b873593
+	)
+	h := seed
+	n := len(data) / 4
+	for i := 0; i < n; i++ {
+		k := binary.LittleEndian.Uint32(data[i*4:])
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+		h = bits.RotateLeft32(h, 13)
+		h = h*5 + 0xe6546b64
+	}
+
+	tail := data[n*4:]
+	var k uint32
+	switch len(tail) {
+	case 3:
+		k ^= uint32(int32(int8(tail[2]))) << 16
+		fallthrough
+	case 2:
+		k ^= uint32(int32(int8(tail[1]))) << 8
+		fallthrough
+	case 1:
+		k ^= uint32(int32(int8(tail[0])))
+		k *= c1
+		k = bits.RotateLeft32(k, 15)
+		k *= c2
+		h ^= k
+	}
+
+	h ^= uint32(len(data))
+	h ^= h >> 16
+	h *= 0x85ebca6b
+	h ^= h >> 13
+	h *= 0xc2b2ae35
+	h ^= h >> 16
+	return h
+}
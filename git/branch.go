@@ -0,0 +1,197 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+const branchPrefix = "refs/heads/"
+
+// BranchRef return full ref name of branch.
+func BranchRef(name string) string {
+	return branchPrefix + name
+}
+
+// ListBranches return local branches.
+func ListBranches(repo *GitRepository) ([]*GitRef, error) {
+	return ListRefs(repo, branchPrefix)
+}
+
+// CreateBranch create branch which points to sha.
+// existing branch is overwritten only if force is true.
+// start is the revision of sha which is used for reflog message.
+func CreateBranch(repo *GitRepository, name, sha, start string, force bool) error {
+	if !IsValidRefName(BranchRef(name)) {
+		return fmt.Errorf("'%s' is not a valid branch name.", name)
+	}
+	if _, err := ReadRef(repo, BranchRef(name)); err == nil && !force {
+		return fmt.Errorf("A branch named '%s' already exists.", name)
+	}
+	if current, _ := CurrentBranch(repo); force && current == BranchRef(name) {
+		return fmt.Errorf("Cannot force update the current branch.")
+	}
+	msg := "branch: Created from " + start
+	if _, err := ReadRef(repo, BranchRef(name)); err == nil {
+		msg = "branch: Reset to " + start
+	}
+	return UpdateRef(repo, BranchRef(name), sha, msg)
+}
+
+// RenameBranch rename branch with its reflog and config.
+// HEAD follows the branch if it is current branch.
+func RenameBranch(repo *GitRepository, oldName, newName string, force bool) error {
+	if !IsValidRefName(BranchRef(newName)) {
+		return fmt.Errorf("'%s' is not a valid branch name.", newName)
+	}
+	if _, err := ReadRef(repo, BranchRef(oldName)); err != nil {
+		return fmt.Errorf("No branch named '%s'.", oldName)
+	}
+	if oldName == newName {
+		return nil
+	}
+	if _, err := ReadRef(repo, BranchRef(newName)); err == nil {
+		if !force {
+			return fmt.Errorf("A branch named '%s' already exists.", newName)
+		}
+		if err := DeleteRef(repo, BranchRef(newName)); err != nil {
+			return err
+		}
+	}
+	if err := RenameRef(repo, BranchRef(oldName), BranchRef(newName)); err != nil {
+		return err
+	}
+
+	current, err := CurrentBranch(repo)
+	if err != nil {
+		return err
+	}
+	if current == BranchRef(oldName) {
+		if err := SetSymbolicRef(repo, "HEAD", BranchRef(newName), ""); err != nil {
+			return err
+		}
+	}
+
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	cfg.RemoveSection("branch", newName)
+	cfg.RenameSection("branch", oldName, newName)
+	return WriteConfig(repo, cfg)
+}
+
+// DeleteBranch delete branch and its config.
+// unless force, branch must be merged into its upstream, or HEAD if upstream is not set.
+func DeleteBranch(repo *GitRepository, name string, force bool) error {
+	sha, err := ResolveRef(repo, BranchRef(name))
+	if err != nil {
+		return fmt.Errorf("branch '%s' not found.", name)
+	}
+	current, err := CurrentBranch(repo)
+	if err != nil {
+		return err
+	}
+	if current == BranchRef(name) {
+		return fmt.Errorf("Cannot delete branch '%s' checked out", name)
+	}
+
+	if !force {
+		// the branch is merged into its upstream, or HEAD if it has no upstream, which may be unborn
+		baseSha := ""
+		if upstream, err := Upstream(repo, name); err == nil {
+			if upstreamSha, err := ResolveCommit(repo, upstream); err == nil {
+				baseSha = upstreamSha
+			}
+		}
+		if baseSha == "" {
+			if baseSha, err = ResolveCommit(repo, "HEAD"); err != nil {
+				return err
+			}
+		}
+		merged, err := IsAncestor(repo, sha, baseSha)
+		if err != nil {
+			return err
+		}
+		if !merged {
+			return fmt.Errorf("The branch '%s' is not fully merged.\nIf you are sure you want to delete it, run 'mygit branch -D %s'.", name, name)
+		}
+	}
+
+	if err := DeleteRef(repo, BranchRef(name)); err != nil {
+		return err
+	}
+
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	cfg.RemoveSection("branch", name)
+	return WriteConfig(repo, cfg)
+}
+
+// SetUpstream set upstream of branch to remote-tracking branch or local branch.
+// upstream is a short name. ex) "origin/master", "master"
+func SetUpstream(repo *GitRepository, branch, upstream string) error {
+	if _, err := ReadRef(repo, BranchRef(branch)); err != nil {
+		return fmt.Errorf("branch '%s' does not exist", branch)
+	}
+	full, ok := DwimRef(repo, upstream)
+	if !ok {
+		return fmt.Errorf("the requested upstream branch '%s' does not exist", upstream)
+	}
+
+	var remote, merge string
+	switch {
+	case strings.HasPrefix(full, branchPrefix):
+		remote, merge = ".", full
+	case strings.HasPrefix(full, "refs/remotes/"):
+		rest := strings.TrimPrefix(full, "refs/remotes/")
+		slash := strings.IndexByte(rest, '/')
+		if slash < 0 {
+			return fmt.Errorf("Cannot setup tracking information; '%s' is not a branch", upstream)
+		}
+		remote, merge = rest[:slash], BranchRef(rest[slash+1:])
+	default:
+		return fmt.Errorf("Cannot setup tracking information; '%s' is not a branch", upstream)
+	}
+
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	cfg.Set("branch", branch, "remote", remote)
+	cfg.Set("branch", branch, "merge", merge)
+	return WriteConfig(repo, cfg)
+}
+
+// UnsetUpstream remove upstream config of branch.
+func UnsetUpstream(repo *GitRepository, branch string) error {
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Get("branch", branch, "merge"); !ok {
+		return fmt.Errorf("Branch '%s' has no upstream information", branch)
+	}
+	cfg.Unset("branch", branch, "remote")
+	cfg.Unset("branch", branch, "merge")
+	return WriteConfig(repo, cfg)
+}
+
+// Upstream return full ref name of the upstream of branch.
+func Upstream(repo *GitRepository, branch string) (string, error) {
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return "", err
+	}
+	remote, ok1 := cfg.Get("branch", branch, "remote")
+	merge, ok2 := cfg.Get("branch", branch, "merge")
+	if !ok1 || !ok2 {
+		return "", errors.New("no upstream configured for branch " + branch)
+	}
+	if remote == "." {
+		return merge, nil
+	}
+	return "refs/remotes/" + remote + "/" + strings.TrimPrefix(merge, branchPrefix), nil
+}
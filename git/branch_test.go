@@ -0,0 +1,101 @@
+package git
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateBranch(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "HEAD", second, "test"))
+
+	assert.NoError(t, CreateBranch(repo, "topic", first, first, false))
+	assert.Error(t, CreateBranch(repo, "topic", second, second, false))
+	assert.NoError(t, CreateBranch(repo, "topic", second, second, true))
+	assert.Error(t, CreateBranch(repo, "master", first, first, true))
+	assert.Error(t, CreateBranch(repo, "bad..name", first, first, false))
+
+	branches, err := ListBranches(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(branches))
+	assert.Equal(t, second, branches[1].Sha)
+}
+
+func TestRenameBranch(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "HEAD", first, "test"))
+	assert.NoError(t, CreateBranch(repo, "topic", first, first, false))
+	assert.NoError(t, SetUpstream(repo, "master", "topic"))
+	assert.NoError(t, repo.SaveRepoFile("logs/refs/heads/master", []byte("log\n")))
+
+	assert.Error(t, RenameBranch(repo, "master", "topic", false))
+	assert.NoError(t, RenameBranch(repo, "master", "main", false))
+
+	current, err := CurrentBranch(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/main", current)
+	assert.FileExists(t, repo.RepoPath("logs/refs/heads/main"))
+	upstream, err := Upstream(repo, "main")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/topic", upstream)
+	_, err = Upstream(repo, "master")
+	assert.Error(t, err)
+}
+
+func TestDeleteBranch(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	side := writeTestCommit(t, repo, "side", first)
+	assert.NoError(t, UpdateRef(repo, "HEAD", first, "test"))
+	assert.NoError(t, CreateBranch(repo, "merged", first, first, false))
+	assert.NoError(t, CreateBranch(repo, "side", side, side, false))
+
+	assert.Error(t, DeleteBranch(repo, "master", true))
+	assert.NoError(t, DeleteBranch(repo, "merged", false))
+	assert.Error(t, DeleteBranch(repo, "side", false))
+
+	// merged into upstream
+	assert.NoError(t, CreateBranch(repo, "upstream", side, side, false))
+	assert.NoError(t, SetUpstream(repo, "side", "upstream"))
+	assert.NoError(t, DeleteBranch(repo, "side", false))
+	_, err := Upstream(repo, "side")
+	assert.Error(t, err)
+
+	// HEAD is not needed for a branch with upstream
+	assert.NoError(t, CreateBranch(repo, "side", side, side, false))
+	assert.NoError(t, SetUpstream(repo, "side", "upstream"))
+	assert.NoError(t, SetSymbolicRef(repo, "HEAD", "refs/heads/orphan", "test"))
+	assert.NoError(t, DeleteBranch(repo, "side", false))
+	assert.Error(t, DeleteBranch(repo, "upstream", false))
+}
+
+func TestSetUpstream(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "HEAD", first, "test"))
+	assert.NoError(t, UpdateRef(repo, "refs/remotes/origin/feature/x", first, "test"))
+
+	assert.NoError(t, SetUpstream(repo, "master", "origin/feature/x"))
+	cfg, err := ReadConfig(repo)
+	assert.NoError(t, err)
+	remote, _ := cfg.Get("branch", "master", "remote")
+	merge, _ := cfg.Get("branch", "master", "merge")
+	assert.Equal(t, "origin", remote)
+	assert.Equal(t, "refs/heads/feature/x", merge)
+	upstream, err := Upstream(repo, "master")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/remotes/origin/feature/x", upstream)
+
+	assert.Error(t, SetUpstream(repo, "master", "nothing"))
+	assert.NoError(t, UnsetUpstream(repo, "master"))
+	assert.Error(t, UnsetUpstream(repo, "master"))
+}
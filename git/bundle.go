@@ -0,0 +1,426 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+const (
+	bundleSignatureV2 = "# v2 git bundle"
+	bundleSignatureV3 = "# v3 git bundle"
+)
+
+// Bundle is the header of a bundle file, which is followed by a packfile.
+// Prerequisites are commits which the packfile needs but does not contain.
+type Bundle struct {
+	Version int
+	// Filter is the filter spec of objects omitted from the packfile. (version 3 only)
+	Filter        string
+	Prerequisites []*BundleRef
+	Refs          []*BundleRef
+}
+
+// BundleRef is a ref or a prerequisite of bundle. Name is a comment for prerequisites.
+type BundleRef struct {
+	Sha  string
+	Name string
+}
+
+// IsBundle return true if the file at path begins with a bundle signature.
+func IsBundle(path string) bool {
+	f, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer f.Close()
+	line, _ := bufio.NewReader(f).ReadString('\n')
+	line = strings.TrimSuffix(line, "\n")
+	return line == bundleSignatureV2 || line == bundleSignatureV3
+}
+
+// ReadBundle read the header of the bundle file.
+func ReadBundle(path string) (*Bundle, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	return readBundleHeader(bufio.NewReader(f), path)
+}
+
+// openBundle return the header of the bundle file and reader of its packfile.
+func openBundle(path string) (*Bundle, io.ReadCloser, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	r := bufio.NewReader(f)
+	b, err := readBundleHeader(r, path)
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return b, readCloser{r, f}, nil
+}
+
+// readBundleHeader read lines of header until an empty line.
+func readBundleHeader(r *bufio.Reader, path string) (*Bundle, error) {
+	readLine := func() (string, error) {
+		line, err := r.ReadString('\n')
+		if err == io.EOF {
+			return "", fmt.Errorf("'%s' is truncated bundle", path)
+		}
+		return strings.TrimSuffix(line, "\n"), err
+	}
+
+	b := &Bundle{}
+	line, err := readLine()
+	if err != nil {
+		return nil, err
+	}
+	switch line {
+	case bundleSignatureV2:
+		b.Version = 2
+	case bundleSignatureV3:
+		b.Version = 3
+	default:
+		return nil, fmt.Errorf("'%s' does not look like a v2 or v3 bundle file", path)
+	}
+	for {
+		if line, err = readLine(); err != nil {
+			return nil, err
+		}
+		if line == "" {
+			return b, nil
+		}
+		if b.Version == 3 && strings.HasPrefix(line, "@") {
+			key, value := splitBundleCapability(line[1:])
+			switch key {
+			case "object-format":
+				if value != "sha1" {
+					return nil, fmt.Errorf("unsupported object format '%s' in bundle", value)
+				}
+			case "filter":
+				b.Filter = value
+			default:
+				return nil, fmt.Errorf("unknown capability '%s' in bundle", line[1:])
+			}
+			continue
+		}
+
+		prerequisite := strings.HasPrefix(line, "-")
+		line = strings.TrimPrefix(line, "-")
+		ref := &BundleRef{Sha: line}
+		if sp := strings.IndexByte(line, ' '); sp >= 0 {
+			ref.Sha, ref.Name = line[:sp], line[sp+1:]
+		}
+		if !isHexSha(ref.Sha) {
+			return nil, fmt.Errorf("unrecognized header in bundle '%s': %s", path, line)
+		}
+		if prerequisite {
+			b.Prerequisites = append(b.Prerequisites, ref)
+		} else {
+			b.Refs = append(b.Refs, ref)
+		}
+	}
+}
+
+func splitBundleCapability(s string) (string, string) {
+	if eq := strings.IndexByte(s, '='); eq >= 0 {
+		return s[:eq], s[eq+1:]
+	}
+	return s, ""
+}
+
+// writeBundleHeader write the header of bundle. version 3 has object-format capability.
+func writeBundleHeader(w io.Writer, b *Bundle) error {
+	var buf bytes.Buffer
+	switch b.Version {
+	case 2:
+		buf.WriteString(bundleSignatureV2 + "\n")
+	case 3:
+		buf.WriteString(bundleSignatureV3 + "\n")
+		buf.WriteString("@object-format=sha1\n")
+		if b.Filter != "" {
+			buf.WriteString("@filter=" + b.Filter + "\n")
+		}
+	default:
+		return fmt.Errorf("unsupported bundle version %d", b.Version)
+	}
+	for _, ref := range b.Prerequisites {
+		fmt.Fprintf(&buf, "-%s %s\n", ref.Sha, ref.Name)
+	}
+	for _, ref := range b.Refs {
+		fmt.Fprintf(&buf, "%s %s\n", ref.Sha, ref.Name)
+	}
+	buf.WriteString("\n")
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// CreateBundle write a bundle of refs given by rev-list arguments to w.
+// "--all", "--branches", "--tags", "--remotes", "<ref>", "^<rev>" and "<rev>..<ref>" are accepted.
+// only refs are recorded to the bundle, and commits reachable from negative revisions are omitted.
+// version is 2 or 3.
+func CreateBundle(repo *GitRepository, w io.Writer, args []string, version int) (*Bundle, error) {
+	b := &Bundle{Version: version}
+	if version != 2 && version != 3 {
+		return nil, fmt.Errorf("unsupported bundle version %d", version)
+	}
+	var negatives []string
+	added := map[string]bool{}
+	addRef := func(name, sha string) {
+		if !added[name] {
+			added[name] = true
+			b.Refs = append(b.Refs, &BundleRef{Sha: sha, Name: name})
+		}
+	}
+	addRefs := func(prefix string) error {
+		refs, err := ListRefs(repo, prefix)
+		if err != nil {
+			return err
+		}
+		for _, ref := range refs {
+			if ref.Sha != "" {
+				addRef(ref.Name, ref.Sha)
+			}
+		}
+		return nil
+	}
+	addPositive := func(rev string) error {
+		if rev == "HEAD" {
+			sha, err := ResolveRef(repo, "HEAD")
+			if err != nil {
+				return err
+			}
+			addRef("HEAD", sha)
+			return nil
+		}
+		// revisions which are not refs are not recorded
+		if full, ok := DwimRef(repo, rev); ok {
+			sha, err := ResolveRef(repo, full)
+			if err != nil {
+				return err
+			}
+			addRef(full, sha)
+		} else if _, err := ResolveRevision(repo, rev); err != nil {
+			return err
+		}
+		return nil
+	}
+	addNegative := func(rev string) error {
+		sha, err := ResolveRevision(repo, rev)
+		if err != nil {
+			return err
+		}
+		negatives = append(negatives, sha)
+		return nil
+	}
+
+	for _, arg := range args {
+		var err error
+		switch {
+		case arg == "--all":
+			if err = addPositive("HEAD"); err == nil {
+				err = addRefs("refs/")
+			}
+		case arg == "--branches":
+			err = addRefs(branchPrefix)
+		case arg == "--tags":
+			err = addRefs("refs/tags/")
+		case arg == "--remotes":
+			err = addRefs("refs/remotes/")
+		case strings.HasPrefix(arg, "^"):
+			err = addNegative(arg[1:])
+		case strings.Contains(arg, ".."):
+			parts := strings.SplitN(arg, "..", 2)
+			for i := range parts {
+				if parts[i] == "" {
+					parts[i] = "HEAD"
+				}
+			}
+			if err = addNegative(parts[0]); err == nil {
+				err = addPositive(parts[1])
+			}
+		default:
+			err = addPositive(arg)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+	if len(b.Refs) == 0 {
+		return nil, errors.New("Refusing to create empty bundle.")
+	}
+
+	var wants []string
+	for _, ref := range b.Refs {
+		wants = append(wants, ref.Sha)
+	}
+	prerequisites, err := bundlePrerequisites(repo, wants, negatives)
+	if err != nil {
+		return nil, err
+	}
+	b.Prerequisites = prerequisites
+	objects, err := ListObjects(repo, wants, negatives)
+	if err != nil {
+		return nil, err
+	}
+	if len(objects) == 0 {
+		return nil, errors.New("Refusing to create empty bundle.")
+	}
+	if err := writeBundleHeader(w, b); err != nil {
+		return nil, err
+	}
+	return b, WritePack(repo, w, objects)
+}
+
+// bundlePrerequisites return commits excluded by negatives whose children are in the bundle.
+// the subject of commit is used as the comment.
+func bundlePrerequisites(repo *GitRepository, wants, negatives []string) ([]*BundleRef, error) {
+	excluded := map[string]bool{}
+	for _, sha := range negatives {
+		commit, err := PeelObject(repo, sha, "commit")
+		if err != nil {
+			continue
+		}
+		if err := markCommits(repo, commit, excluded); err != nil {
+			return nil, err
+		}
+	}
+
+	found := map[string]bool{}
+	seen := map[string]bool{}
+	var queue []string
+	for _, sha := range wants {
+		if commit, err := PeelObject(repo, sha, "commit"); err == nil {
+			queue = append(queue, commit)
+		}
+	}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		if seen[sha] || excluded[sha] {
+			continue
+		}
+		seen[sha] = true
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		for _, parent := range commit.Parents {
+			if excluded[parent] {
+				found[parent] = true
+			} else {
+				queue = append(queue, parent)
+			}
+		}
+	}
+
+	var prerequisites []*BundleRef
+	for sha := range found {
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		subject := strings.SplitN(commit.Message, "\n", 2)[0]
+		prerequisites = append(prerequisites, &BundleRef{Sha: sha, Name: subject})
+	}
+	sort.Slice(prerequisites, func(i, j int) bool { return prerequisites[i].Sha < prerequisites[j].Sha })
+	return prerequisites, nil
+}
+
+// VerifyBundle return the header of bundle if repo has all prerequisites of the bundle.
+// repo may be nil if the bundle has no prerequisites.
+func VerifyBundle(repo *GitRepository, path string) (*Bundle, error) {
+	b, err := ReadBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBundlePrerequisites(repo, b); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+func checkBundlePrerequisites(repo *GitRepository, b *Bundle) error {
+	var missing []string
+	for _, ref := range b.Prerequisites {
+		if repo == nil || !HasObject(repo, ref.Sha) {
+			missing = append(missing, ref.Sha+" "+ref.Name)
+		}
+	}
+	if len(missing) > 0 {
+		return fmt.Errorf("Repository lacks these prerequisite commits:\n%s", strings.Join(missing, "\n"))
+	}
+	return nil
+}
+
+// Unbundle store objects of the bundle into repo and return refs in the bundle. refs are not updated.
+func Unbundle(repo *GitRepository, path string) (*Bundle, error) {
+	b, pack, err := openBundle(path)
+	if err != nil {
+		return nil, err
+	}
+	defer pack.Close()
+	if err := checkBundlePrerequisites(repo, b); err != nil {
+		return nil, err
+	}
+	if _, err := IndexPack(repo, pack, true); err != nil {
+		return nil, err
+	}
+	return b, nil
+}
+
+// bundleTransport fetch from a bundle file as if it is a remote repository.
+type bundleTransport struct {
+	path string
+	// repo is used to verify prerequisites of the bundle.
+	repo *GitRepository
+}
+
+func (t *bundleTransport) FetchRefs() (*RefAdvertisement, error) {
+	b, err := ReadBundle(t.path)
+	if err != nil {
+		return nil, err
+	}
+	adv := &RefAdvertisement{}
+	for _, ref := range b.Refs {
+		adv.Refs = append(adv.Refs, &RemoteRef{Name: ref.Name, Sha: ref.Sha})
+	}
+	return adv, nil
+}
+
+// FetchPack return the packfile of bundle, which has all objects of the bundle regardless of wants.
+func (t *bundleTransport) FetchPack(adv *RefAdvertisement, req *FetchRequest) (*FetchResponse, error) {
+	if req.deepen() {
+		return nil, errors.New("Shallow fetch from a bundle is not supported")
+	}
+	b, pack, err := openBundle(t.path)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkBundlePrerequisites(t.repo, b); err != nil {
+		pack.Close()
+		return nil, err
+	}
+	return &FetchResponse{ReadCloser: pack}, nil
+}
+
+func (t *bundleTransport) PushRefs() (*RefAdvertisement, error) {
+	return nil, errors.New("Pushing to a bundle is not supported")
+}
+
+func (t *bundleTransport) SendPack(adv *RefAdvertisement, cmds []*RefUpdateCommand, pack io.Reader) (*PushReport, error) {
+	return nil, errors.New("Pushing to a bundle is not supported")
+}
+
+func (t *bundleTransport) Close() error {
+	return nil
+}
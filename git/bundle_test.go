@@ -0,0 +1,69 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBundle(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	first := writeTestCommit(t, src, "first")
+	second := writeTestCommit(t, src, "second", first)
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", first, ""))
+	assert.NoError(t, UpdateRef(src, "refs/tags/v1", first, ""))
+
+	dir := newTempDir(t)
+	defer os.RemoveAll(dir)
+	full := filepath.Join(dir, "full.bundle")
+	var b bytes.Buffer
+	_, err := CreateBundle(src, &b, []string{"--all"}, 2)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(full, b.Bytes(), 0644))
+	assert.True(t, IsBundle(full))
+	bundle, err := ReadBundle(full)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, bundle.Version)
+	assert.Empty(t, bundle.Prerequisites)
+	assert.Equal(t, []*BundleRef{{first, "HEAD"}, {first, "refs/heads/master"}, {first, "refs/tags/v1"}}, bundle.Refs)
+
+	repo, err := Clone(full, filepath.Join(dir, "clone"), CloneOptions{})
+	assert.NoError(t, err)
+	if err != nil {
+		return
+	}
+	head, _ := ResolveRef(repo, "HEAD")
+	assert.Equal(t, first, head)
+	tag, _ := ResolveRef(repo, "refs/tags/v1")
+	assert.Equal(t, first, tag)
+
+	// incremental bundle requires the first commit
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", second, ""))
+	incremental := filepath.Join(dir, "incremental.bundle")
+	b.Reset()
+	_, err = CreateBundle(src, &b, []string{"v1..master"}, 3)
+	assert.NoError(t, err)
+	assert.NoError(t, ioutil.WriteFile(incremental, b.Bytes(), 0644))
+	bundle, err = VerifyBundle(repo, incremental)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, bundle.Version)
+	assert.Equal(t, []*BundleRef{{first, "first"}}, bundle.Prerequisites)
+	assert.Equal(t, []*BundleRef{{second, "refs/heads/master"}}, bundle.Refs)
+	_, err = VerifyBundle(nil, incremental)
+	assert.Error(t, err)
+
+	_, err = Fetch(repo, incremental, FetchOptions{Refspecs: []string{"master:refs/remotes/origin/master"}})
+	assert.NoError(t, err)
+	tracking, _ := ResolveRef(repo, "refs/remotes/origin/master")
+	assert.Equal(t, second, tracking)
+
+	_, err = CreateBundle(src, &b, []string{"master..master"}, 2)
+	assert.Error(t, err)
+	_, err = CreateBundle(src, &b, []string{"^master"}, 2)
+	assert.Error(t, err)
+}
@@ -0,0 +1,88 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+)
+
+// CheckoutTree write files of tree to worktree and replace index with them.
+// existing files which are not in the tree are left untouched.
+func CheckoutTree(repo *GitRepository, treeSha string) error {
+	if repo.Bare {
+		return fmt.Errorf("Cannot checkout in bare repository")
+	}
+	var entries []*IndexEntry
+	if err := checkoutTree(repo, treeSha, "", &entries); err != nil {
+		return err
+	}
+	sort.Slice(entries, func(i, j int) bool { return entries[i].FilePath < entries[j].FilePath })
+	return WriteIndex(repo, &GitIndex{Entries: entries})
+}
+
+func checkoutTree(repo *GitRepository, treeSha, prefix string, entries *[]*IndexEntry) error {
+	obj, err := ReadObject(repo, treeSha)
+	if err != nil {
+		return err
+	}
+	tree, ok := obj.(*GitTree)
+	if !ok {
+		return fmt.Errorf("%s is not a tree", treeSha)
+	}
+
+	for _, entry := range tree.Entries {
+		name := path.Join(prefix, entry.Path)
+		file := filepath.Join(repo.Worktree, filepath.FromSlash(name))
+		switch {
+		case entry.IsTree():
+			if err := os.MkdirAll(file, repoDirPerm()); err != nil {
+				return err
+			}
+			if err := checkoutTree(repo, entry.Sha, name, entries); err != nil {
+				return err
+			}
+			continue
+		case entry.IsGitlink():
+			// submodule is not cloned. only its directory is made.
+			if err := os.MkdirAll(file, repoDirPerm()); err != nil {
+				return err
+			}
+		default:
+			if err := checkoutFile(repo, entry, file); err != nil {
+				return err
+			}
+		}
+
+		info, err := os.Lstat(file)
+		if err != nil {
+			return err
+		}
+		ie := NewIndexEntry(info, name, entry.Sha)
+		ie.Mode = entry.Mode
+		*entries = append(*entries, ie)
+	}
+	return nil
+}
+
+// checkoutFile write blob of the entry to file.
+func checkoutFile(repo *GitRepository, entry *GitTreeEntry, file string) error {
+	_, data, err := ReadObjectData(repo, entry.Sha)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(file), repoDirPerm()); err != nil {
+		return err
+	}
+	os.Remove(file)
+	if entry.Mode&modeTypeMask == ModeSymlink {
+		return os.Symlink(string(data), file)
+	}
+	perm := os.FileMode(0644)
+	if entry.Mode&0111 != 0 {
+		perm = 0755
+	}
+	return ioutil.WriteFile(file, data, perm)
+}
@@ -0,0 +1,127 @@
+package git
+
+import (
+	"os"
+	"path"
+	"strings"
+)
+
+// CleanOptions is options of CleanCandidates.
+type CleanOptions struct {
+	// Directories removes untracked directories as well as files.
+	Directories bool
+	// Nested removes untracked nested repositories too, which needs -f twice.
+	Nested bool
+	// NoIgnore removes ignored files too, ignoring the standard ignore rules.
+	NoIgnore bool
+	// OnlyIgnored removes only ignored files.
+	OnlyIgnored bool
+	// Excludes are ignore patterns given in addition to the standard ignore rules.
+	Excludes []string
+	// Pathspecs limits files to be removed.
+	Pathspecs []string
+}
+
+// CleanCandidates return untracked files to be removed by clean, sorted by path.
+// an untracked directory whose contents are all removed is returned as a path ending with "/".
+func CleanCandidates(repo *GitRepository, opts CleanOptions) ([]string, error) {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+	ignore, err := NewIgnoreMatcher(repo, opts.Excludes, !opts.NoIgnore)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ListUntracked(repo, index, ignore)
+	if err != nil {
+		return nil, err
+	}
+	trackedDirs := map[string]bool{}
+	for _, e := range index.Entries {
+		for dir := path.Dir(e.FilePath); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+	// untracked directories which the file is in, from the top
+	untrackedDirs := func(name string) []string {
+		var dirs []string
+		for dir := path.Dir(name); dir != "." && !trackedDirs[dir]; dir = path.Dir(dir) {
+			dirs = append([]string{dir}, dirs...)
+		}
+		return dirs
+	}
+	// untracked directories are walked for pathspecs or ignored files even without Directories
+	recurse := opts.Directories || opts.OnlyIgnored || len(opts.Pathspecs) > 0
+
+	removable := map[string]bool{}
+	total, removed := map[string]int{}, map[string]int{}
+	for _, f := range files {
+		ok := f.Ignored == opts.OnlyIgnored && MatchPathspec(opts.Pathspecs, f.Path)
+		if f.Dir {
+			if _, isRepo := nestedRepoHead(worktreeFile(repo, f.Path)); isRepo {
+				ok = ok && opts.Directories && opts.Nested
+			} else {
+				ok = ok && recurse
+			}
+		}
+		if ok && !recurse && len(untrackedDirs(f.Path)) > 0 {
+			ok = false
+		}
+		removable[f.Path] = ok
+		for _, dir := range untrackedDirs(f.Path) {
+			total[dir]++
+			if ok {
+				removed[dir]++
+			}
+		}
+	}
+
+	var candidates []string
+	seen := map[string]bool{}
+	for _, f := range files {
+		if !removable[f.Path] {
+			continue
+		}
+		name := f.Path
+		if f.Dir {
+			name += "/"
+		}
+		if recurse {
+			for _, dir := range untrackedDirs(f.Path) {
+				if total[dir] == removed[dir] {
+					name = dir + "/"
+					break
+				}
+			}
+		}
+		if !seen[name] {
+			seen[name] = true
+			candidates = append(candidates, name)
+		}
+	}
+	return candidates, nil
+}
+
+// RemoveUntracked remove a file or directory returned by CleanCandidates from worktree.
+func RemoveUntracked(repo *GitRepository, name string) error {
+	return os.RemoveAll(worktreeFile(repo, strings.TrimSuffix(name, "/")))
+}
+
+// FilterCleanCandidates return candidates which match none of the ignore patterns.
+func FilterCleanCandidates(candidates, patterns []string) []string {
+	var parsed []*ignorePattern
+	for _, line := range patterns {
+		if p := parseIgnorePattern(line, ""); p != nil {
+			parsed = append(parsed, p)
+		}
+	}
+	var kept []string
+	for _, name := range candidates {
+		isDir := strings.HasSuffix(name, "/")
+		if matched, _ := matchPatterns(parsed, strings.TrimSuffix(name, "/"), isDir); !matched {
+			kept = append(kept, name)
+		}
+	}
+	return kept
+}
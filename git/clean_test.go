@@ -0,0 +1,50 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCleanCandidates(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	commitTestFiles(t, repo, "first", map[string]string{"t/a": "a\n"})
+	for name, content := range map[string]string{
+		"t/x": "x\n", "u/v/y": "y\n", "w/i.log": "i\n", "w/k": "k\n", ".gitignore": "*.log\n", "top.log": "l\n",
+	} {
+		file := filepath.Join(repo.Worktree, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	_, err := CreateAndInitializeRepo(filepath.Join(repo.Worktree, "nested"))
+	assert.NoError(t, err)
+
+	tests := []struct {
+		opts CleanOptions
+		want []string
+	}{
+		{CleanOptions{}, []string{".gitignore", "t/x"}},
+		{CleanOptions{Directories: true}, []string{".gitignore", "t/x", "u/", "w/k"}},
+		{CleanOptions{Directories: true, NoIgnore: true}, []string{".gitignore", "t/x", "top.log", "u/", "w/"}},
+		{CleanOptions{OnlyIgnored: true}, []string{"top.log", "w/i.log"}},
+		{CleanOptions{Directories: true, Nested: true}, []string{".gitignore", "nested/", "t/x", "u/", "w/k"}},
+		{CleanOptions{Directories: true, Excludes: []string{"k"}}, []string{".gitignore", "t/x", "u/"}},
+		{CleanOptions{Pathspecs: []string{"u"}}, []string{"u/"}},
+	}
+	for _, test := range tests {
+		got, err := CleanCandidates(repo, test.opts)
+		assert.NoError(t, err)
+		assert.Equal(t, test.want, got, "%+v", test.opts)
+	}
+
+	assert.Equal(t, []string{"t/x"}, FilterCleanCandidates([]string{".gitignore", "t/x", "u/"}, []string{".git*", "u/"}))
+	assert.NoError(t, RemoveUntracked(repo, "u/"))
+	_, err = os.Stat(filepath.Join(repo.Worktree, "u"))
+	assert.True(t, os.IsNotExist(err))
+}
@@ -0,0 +1,194 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ErrEmptyRepository is returned by Clone when the remote repository has no commit.
+// the cloned repository is usable.
+var ErrEmptyRepository = errors.New("You appear to have cloned an empty repository.")
+
+// ErrNoRemoteHead is returned by Clone when refs are fetched but remote HEAD is unknown, such as a bundle without HEAD.
+// the cloned repository is usable, but nothing is checked out.
+var ErrNoRemoteHead = errors.New("remote HEAD refers to nonexistent ref, unable to checkout.")
+
+// CloneOptions is options of Clone.
+type CloneOptions struct {
+	// Bare make a bare repository whose branches are copied from remote.
+	Bare bool
+	// Branch is the branch or tag checked out instead of remote HEAD.
+	Branch string
+	// Origin is the name of remote. default is "origin".
+	Origin string
+	// NoCheckout skip checkout of HEAD.
+	NoCheckout bool
+	// Depth, ShallowSince and ShallowExclude make a shallow clone.
+	ShallowOptions
+	// Filter is a filter spec of partial clone. omitted objects are fetched from remote on demand.
+	Filter   string
+	Progress io.Writer
+}
+
+// Clone make a new repository at dir which is a copy of remote repository.
+// dir is removed if clone fails, unless it existed before.
+func Clone(url, dir string, opts CloneOptions) (repo *GitRepository, err error) {
+	if opts.Origin == "" {
+		opts.Origin = "origin"
+	}
+	// a local path is recorded as absolute to fetch from inside the clone
+	if r, err := parseRemoteURL(url); err == nil && r.Scheme == "file" && !strings.Contains(url, "://") {
+		if url, err = filepath.Abs(url); err != nil {
+			return nil, err
+		}
+	}
+	transport, err := newTransport(repo, url, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.Close()
+
+	files, statErr := ioutil.ReadDir(dir)
+	if statErr == nil && len(files) > 0 {
+		return nil, fmt.Errorf("destination path '%s' already exists and is not an empty directory.", dir)
+	}
+	if os.IsNotExist(statErr) {
+		defer func() {
+			if err != nil && !errors.Is(err, ErrEmptyRepository) && !errors.Is(err, ErrNoRemoteHead) {
+				os.RemoveAll(dir)
+			}
+		}()
+	}
+
+	repo, err = InitRepository(dir, InitOptions{Bare: opts.Bare})
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Set("remote", opts.Origin, "url", url)
+	if !opts.Bare {
+		cfg.Set("remote", opts.Origin, "fetch", DefaultFetchRefspec(opts.Origin))
+	}
+	if err := WriteConfig(repo, cfg); err != nil {
+		return nil, err
+	}
+	if opts.Filter != "" {
+		if _, err := ParseObjectFilter(opts.Filter); err != nil {
+			return nil, err
+		}
+		if err := setPromisorRemote(repo, opts.Origin, opts.Filter); err != nil {
+			return nil, err
+		}
+	}
+
+	adv, err := transport.FetchRefs()
+	if err != nil {
+		return nil, err
+	}
+	mapping := func(ref string) string {
+		switch {
+		case strings.HasPrefix(ref, branchPrefix) && opts.Bare:
+			return ref
+		case strings.HasPrefix(ref, branchPrefix):
+			return "refs/remotes/" + opts.Origin + "/" + strings.TrimPrefix(ref, branchPrefix)
+		case strings.HasPrefix(ref, "refs/tags/"):
+			return ref
+		}
+		return ""
+	}
+	updates := remoteRefUpdates(repo, adv, mapping)
+	if err := fetchRefs(repo, transport, adv, updates, opts.fetchRequest(opts.Filter)); err != nil {
+		return nil, err
+	}
+	msg := "clone: from " + url
+	for _, u := range updates {
+		if err := UpdateRef(repo, u.Local, u.New, msg); err != nil {
+			return nil, err
+		}
+	}
+
+	head, err := cloneHead(repo, adv, opts, msg)
+	if err != nil {
+		return nil, err
+	}
+	if head == "" {
+		if len(updates) > 0 {
+			return repo, ErrNoRemoteHead
+		}
+		return repo, ErrEmptyRepository
+	}
+	if opts.Bare || opts.NoCheckout {
+		return repo, nil
+	}
+	commit, err := ReadCommit(repo, head)
+	if err != nil {
+		return nil, err
+	}
+	if err := prefetchMissingBlobs(repo, commit.Tree); err != nil {
+		return nil, err
+	}
+	if err := CheckoutTree(repo, commit.Tree); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// cloneHead set up HEAD and the initial branch of cloned repository.
+// return commit which HEAD points, or empty string if remote is empty.
+func cloneHead(repo *GitRepository, adv *RefAdvertisement, opts CloneOptions, msg string) (string, error) {
+	branch := adv.Head()
+	if opts.Branch != "" {
+		branch = BranchRef(opts.Branch)
+		if adv.Ref(branch) == nil {
+			tag := adv.Ref("refs/tags/" + opts.Branch)
+			if tag == nil {
+				return "", fmt.Errorf("Remote branch %s not found in upstream %s", opts.Branch, opts.Origin)
+			}
+			// tag is checked out as detached HEAD
+			sha, err := PeelObject(repo, tag.Sha, "commit")
+			if err != nil {
+				return "", err
+			}
+			return sha, UpdateRef(repo, "HEAD", sha, msg)
+		}
+	}
+	ref := adv.Ref(branch)
+	if branch == "" || ref == nil {
+		// keep unborn branch of remote HEAD if it is known
+		if head := adv.Ref("HEAD"); head != nil && head.Target != "" {
+			return "", SetSymbolicRef(repo, "HEAD", head.Target, "")
+		}
+		return "", nil
+	}
+
+	if err := SetSymbolicRef(repo, "HEAD", branch, ""); err != nil {
+		return "", err
+	}
+	if opts.Bare {
+		return ref.Sha, nil
+	}
+
+	short := strings.TrimPrefix(branch, branchPrefix)
+	tracking := "refs/remotes/" + opts.Origin + "/" + short
+	if target := adv.Head(); target != "" {
+		remoteHead := "refs/remotes/" + opts.Origin + "/HEAD"
+		if err := SetSymbolicRef(repo, remoteHead, "refs/remotes/"+opts.Origin+"/"+strings.TrimPrefix(target, branchPrefix), ""); err != nil {
+			return "", err
+		}
+	}
+	if err := UpdateRef(repo, branch, ref.Sha, msg); err != nil {
+		return "", err
+	}
+	if err := SetUpstream(repo, short, tracking); err != nil {
+		return "", err
+	}
+	return ref.Sha, nil
+}
@@ -0,0 +1,75 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// NewCommit write a commit of tree with parents, whose author and committer are current identities.
+// message is written as it is.
+func NewCommit(repo *GitRepository, tree string, parents []string, message string) (string, error) {
+	author, err := AuthorIdent(repo)
+	if err != nil {
+		return "", err
+	}
+	return NewCommitAs(repo, tree, parents, author, message)
+}
+
+// NewCommitAs write a commit like NewCommit, but keeping author, which is used to replay existing commits.
+func NewCommitAs(repo *GitRepository, tree string, parents []string, author GitUser, message string) (string, error) {
+	committer, err := CommitterIdent(repo)
+	if err != nil {
+		return "", err
+	}
+	return WriteObject(repo, &GitCommit{Tree: tree, Parents: parents, Author: author, Committer: committer, Message: message})
+}
+
+// WriteCommitSummary write the branch, subject and diffstat summary of the commit on HEAD
+// like "[main 1a2b3c4] subject", followed by created and deleted files.
+// the author date is also written if showDate is true, which is used for commits replayed from others.
+func WriteCommitSummary(repo *GitRepository, w io.Writer, sha string, showDate bool) error {
+	commit, err := ReadCommit(repo, sha)
+	if err != nil {
+		return err
+	}
+	branch := "detached HEAD"
+	if current, err := CurrentBranch(repo); err == nil && current != "" {
+		branch = ShortRefName(current)
+	}
+	parentTree := ""
+	if len(commit.Parents) == 0 {
+		branch += " (root-commit)"
+	} else if parentTree, err = CommitTree(repo, commit.Parents[0]); err != nil {
+		return err
+	}
+	changes, err := DiffTrees(repo, parentTree, commit.Tree)
+	if err != nil {
+		return err
+	}
+	stats, err := DiffStats(repo, changes)
+	if err != nil {
+		return err
+	}
+	insertions, deletions := 0, 0
+	for _, s := range stats {
+		insertions += s.Added
+		deletions += s.Deleted
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "[%s %s] %s\n", branch, shortSha(sha), commit.Subject())
+	if when, err := commit.Author.When(); err == nil && showDate {
+		fmt.Fprintf(&b, " Date: %s\n", when.Format("Mon Jan 2 15:04:05 2006 -0700"))
+	}
+	b.WriteString(diffStatSummary(len(stats), insertions, deletions) + "\n")
+	for _, c := range changes {
+		switch {
+		case c.Old == nil:
+			fmt.Fprintf(&b, " create mode %o %s\n", c.New.Mode, c.Path)
+		case c.New == nil:
+			fmt.Fprintf(&b, " delete mode %o %s\n", c.Old.Mode, c.Path)
+		}
+	}
+	_, err = io.WriteString(w, b.String())
+	return err
+}
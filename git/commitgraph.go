@@ -0,0 +1,552 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// commitGraphMagic is the signature of commit-graph file.
+var commitGraphMagic = []byte("CGPH")
+
+// chunk IDs of commit-graph file.
+const (
+	chunkOIDFanout   = 0x4f494446 // "OIDF"
+	chunkOIDLookup   = 0x4f49444c // "OIDL"
+	chunkCommitData  = 0x43444154 // "CDAT"
+	chunkExtraEdges  = 0x45444745 // "EDGE"
+	chunkBloomIndex  = 0x42494458 // "BIDX"
+	chunkBloomData   = 0x42444154 // "BDAT"
+	commitDataWidth  = 20 + 16
+	bloomDataHeader  = 12
+	graphParentNone  = 0x70000000
+	graphExtraEdges  = 0x80000000
+	graphLastEdge    = 0x80000000
+	graphMaxTime     = 1<<34 - 1
+	graphGenerations = 1<<30 - 1
+)
+
+// generationInfinity is the generation number of commits which are not in commit-graph.
+const generationInfinity = 0xffffffff
+
+// commitGraph is a loaded commit-graph file.
+// commits are sorted by hash, and parents are recorded by their positions.
+type commitGraph struct {
+	path      string
+	count     int
+	modTime   time.Time
+	fanout    []byte
+	oids      []byte
+	commits   []byte
+	edges     []byte
+	bloomIdx  []byte
+	bloomData []byte
+}
+
+// graphCommit is a commit recorded in commit-graph.
+type graphCommit struct {
+	tree       string
+	parents    []string
+	generation uint32
+	time       int64
+}
+
+func commitGraphPath(repo *GitRepository) string {
+	return repo.RepoPath("objects/info/commit-graph")
+}
+
+// parseCommitGraph parse commit-graph file and check its checksum and chunks.
+func parseCommitGraph(path string, data []byte) (*commitGraph, error) {
+	if len(data) < 8+12+20 || !bytes.Equal(data[:4], commitGraphMagic) {
+		return nil, fmt.Errorf("Unsupported commit-graph: %s", path)
+	}
+	if data[4] != 1 || data[5] != 1 {
+		return nil, fmt.Errorf("Unsupported commit-graph version %d hash version %d: %s", data[4], data[5], path)
+	}
+	if sum := sha1.Sum(data[:len(data)-20]); !bytes.Equal(sum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("commit-graph checksum mismatch: %s", path)
+	}
+	chunks, err := parseChunkTable(data, 8, int(data[6]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid commit-graph %s: %w", path, err)
+	}
+
+	g := &commitGraph{
+		path:      path,
+		fanout:    chunks[chunkOIDFanout],
+		oids:      chunks[chunkOIDLookup],
+		commits:   chunks[chunkCommitData],
+		edges:     chunks[chunkExtraEdges],
+		bloomIdx:  chunks[chunkBloomIndex],
+		bloomData: chunks[chunkBloomData],
+	}
+	if len(g.fanout) != 256*4 {
+		return nil, fmt.Errorf("commit-graph is missing the OID Fanout chunk: %s", path)
+	}
+	g.count = int(binary.BigEndian.Uint32(g.fanout[255*4:]))
+	if len(g.oids) != g.count*20 {
+		return nil, fmt.Errorf("commit-graph OID Lookup chunk is the wrong size: %s", path)
+	}
+	if len(g.commits) != g.count*commitDataWidth {
+		return nil, fmt.Errorf("commit-graph Commit Data chunk is the wrong size: %s", path)
+	}
+	// changed-path filters are ignored unless they are complete
+	if len(g.bloomIdx) != g.count*4 || len(g.bloomData) < bloomDataHeader ||
+		binary.BigEndian.Uint32(g.bloomData) != bloomHashVersion ||
+		binary.BigEndian.Uint32(g.bloomData[4:]) != bloomNumHashes ||
+		binary.BigEndian.Uint32(g.bloomData[8:]) != bloomBitsPerEntry {
+		g.bloomIdx, g.bloomData = nil, nil
+	}
+	return g, nil
+}
+
+// parseChunkTable return chunks of chunk-based file format by their IDs.
+// the table has n+1 entries of 4-byte ID and 8-byte offset, terminated by ID 0.
+func parseChunkTable(data []byte, start, n int) (map[uint32][]byte, error) {
+	if start+(n+1)*12 > len(data)-20 {
+		return nil, fmt.Errorf("chunk table is truncated")
+	}
+	chunks := map[uint32][]byte{}
+	for i := 0; i < n; i++ {
+		entry := data[start+i*12:]
+		id := binary.BigEndian.Uint32(entry)
+		offset := binary.BigEndian.Uint64(entry[4:])
+		end := binary.BigEndian.Uint64(entry[16:])
+		if offset > end || end > uint64(len(data)-20) {
+			return nil, fmt.Errorf("improper chunk offset %08x", offset)
+		}
+		chunks[id] = data[offset:end]
+	}
+	return chunks, nil
+}
+
+func (g *commitGraph) shaAt(i int) []byte {
+	return g.oids[i*20 : i*20+20]
+}
+
+// find return position of the commit in commit-graph.
+func (g *commitGraph) find(sha string) (int, bool) {
+	return searchFanout(g.fanout, g.oids, sha)
+}
+
+// commitAt return the commit at position i.
+func (g *commitGraph) commitAt(i int) (*graphCommit, error) {
+	data := g.commits[i*commitDataWidth : (i+1)*commitDataWidth]
+	c := &graphCommit{tree: hex.EncodeToString(data[:20])}
+	parent := func(pos uint32) (string, error) {
+		if int(pos) >= g.count {
+			return "", fmt.Errorf("commit-graph has invalid parent position %d", pos)
+		}
+		return hex.EncodeToString(g.shaAt(int(pos))), nil
+	}
+
+	for _, pos := range []uint32{binary.BigEndian.Uint32(data[20:]), binary.BigEndian.Uint32(data[24:])} {
+		if pos == graphParentNone {
+			break
+		}
+		if pos&graphExtraEdges == 0 {
+			sha, err := parent(pos)
+			if err != nil {
+				return nil, err
+			}
+			c.parents = append(c.parents, sha)
+			continue
+		}
+		// octopus merge lists the second and later parents in extra edges
+		for j := int(pos &^ graphExtraEdges); ; j++ {
+			if (j+1)*4 > len(g.edges) {
+				return nil, fmt.Errorf("commit-graph extra edges are truncated")
+			}
+			edge := binary.BigEndian.Uint32(g.edges[j*4:])
+			sha, err := parent(edge &^ graphLastEdge)
+			if err != nil {
+				return nil, err
+			}
+			c.parents = append(c.parents, sha)
+			if edge&graphLastEdge != 0 {
+				break
+			}
+		}
+	}
+
+	genAndTime := binary.BigEndian.Uint64(data[28:])
+	c.generation = uint32(genAndTime >> 34)
+	c.time = int64(genAndTime & graphMaxTime)
+	return c, nil
+}
+
+// bloomFilterAt return changed-path filter of the commit at position i, or nil if it is not recorded.
+func (g *commitGraph) bloomFilterAt(i int) bloomFilter {
+	if g.bloomIdx == nil {
+		return nil
+	}
+	start := uint32(0)
+	if i > 0 {
+		start = binary.BigEndian.Uint32(g.bloomIdx[(i-1)*4:])
+	}
+	end := binary.BigEndian.Uint32(g.bloomIdx[i*4:])
+	if start > end || int(end) > len(g.bloomData)-bloomDataHeader {
+		return nil
+	}
+	return bloomFilter(g.bloomData[bloomDataHeader+start : bloomDataHeader+end])
+}
+
+// commitGraphCache keeps loaded commit-graph. it is reloaded when the file is modified.
+var commitGraphCache = struct {
+	sync.Mutex
+	graphs map[string]*commitGraph
+}{graphs: map[string]*commitGraph{}}
+
+// loadCommitGraph return commit-graph of the repository, or nil if it is not available.
+// commit-graph is not used if core.commitGraph is false or the repository is shallow,
+// because parents in the graph are different from those of shallow commits.
+func loadCommitGraph(repo *GitRepository) *commitGraph {
+	path := commitGraphPath(repo)
+	info, err := os.Stat(path)
+	if err != nil || IsShallowRepository(repo) {
+		return nil
+	}
+	if cfg, err := LoadConfig(repo); err == nil {
+		if enabled, err := cfg.GetBool("core.commitGraph", true); err == nil && !enabled {
+			return nil
+		}
+	}
+
+	commitGraphCache.Lock()
+	defer commitGraphCache.Unlock()
+	if g, ok := commitGraphCache.graphs[path]; ok && g.modTime.Equal(info.ModTime()) {
+		return g
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	g, err := parseCommitGraph(path, data)
+	if err != nil {
+		return nil
+	}
+	g.modTime = info.ModTime()
+	commitGraphCache.graphs[path] = g
+	return g
+}
+
+// CommitGraphOptions is options of WriteCommitGraph.
+type CommitGraphOptions struct {
+	// Reachable writes commits reachable from all refs and HEAD.
+	Reachable bool
+	// Commits writes commits reachable from them. commits in packfiles are written if both are empty.
+	Commits []string
+	// ChangedPaths writes changed-path Bloom filters.
+	ChangedPaths bool
+}
+
+// WriteCommitGraph write commits and their ancestors into objects/info/commit-graph.
+// nothing is written in shallow repository.
+func WriteCommitGraph(repo *GitRepository, opts CommitGraphOptions) error {
+	if IsShallowRepository(repo) {
+		return nil
+	}
+	starts, err := commitGraphStarts(repo, opts)
+	if err != nil {
+		return err
+	}
+	commits := map[string]*GitCommit{}
+	for len(starts) > 0 {
+		sha := starts[len(starts)-1]
+		starts = starts[:len(starts)-1]
+		if commits[sha] != nil {
+			continue
+		}
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return err
+		}
+		commits[sha] = commit
+		starts = append(starts, commit.Parents...)
+	}
+
+	shas := make([]string, 0, len(commits))
+	for sha := range commits {
+		shas = append(shas, sha)
+	}
+	sort.Strings(shas)
+	var filters []bloomFilter
+	if opts.ChangedPaths {
+		for _, sha := range shas {
+			filter, err := computeBloomFilter(repo, commits, commits[sha])
+			if err != nil {
+				return err
+			}
+			filters = append(filters, filter)
+		}
+	}
+	data, err := encodeCommitGraph(shas, commits, filters)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(repo.RepoPath("objects/info"), 0755); err != nil {
+		return err
+	}
+	path := commitGraphPath(repo)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeFileAtomic(path, data, 0444)
+}
+
+// commitGraphStarts return commits from which commits in commit-graph are walked.
+func commitGraphStarts(repo *GitRepository, opts CommitGraphOptions) ([]string, error) {
+	var starts []string
+	switch {
+	case opts.Reachable:
+		refs, err := ListRefs(repo, "refs/")
+		if err != nil {
+			return nil, err
+		}
+		var shas []string
+		for _, ref := range refs {
+			shas = append(shas, ref.Sha)
+		}
+		if head, err := ResolveRef(repo, "HEAD"); err == nil {
+			shas = append(shas, head)
+		}
+		for _, sha := range shas {
+			if peeled := peelTag(repo, sha); peeled != "" {
+				sha = peeled
+			}
+			// refs may point to other than commits, like tags of blobs
+			if objType, _, err := ReadObjectData(repo, sha); err == nil && objType == "commit" {
+				starts = append(starts, sha)
+			}
+		}
+	case len(opts.Commits) > 0:
+		for _, sha := range opts.Commits {
+			objType, _, err := ReadObjectData(repo, sha)
+			if err != nil {
+				return nil, err
+			}
+			if objType != "commit" {
+				return nil, fmt.Errorf("%s is a %s, not a commit", sha, objType)
+			}
+			starts = append(starts, sha)
+		}
+	default:
+		indexes, err := listPackIndexes(repo)
+		if err != nil {
+			return nil, err
+		}
+		for _, idx := range indexes {
+			for _, sha := range idx.objects() {
+				if objType, _, err := readPackedObject(repo, sha); err == nil && objType == "commit" {
+					starts = append(starts, sha)
+				}
+			}
+		}
+	}
+	return starts, nil
+}
+
+// computeBloomFilter return changed-path filter of paths changed from the first parent.
+func computeBloomFilter(repo *GitRepository, commits map[string]*GitCommit, commit *GitCommit) (bloomFilter, error) {
+	parentTree := ""
+	if len(commit.Parents) > 0 {
+		parentTree = commits[commit.Parents[0]].Tree
+	}
+	changes, err := DiffTrees(repo, parentTree, commit.Tree)
+	if err != nil {
+		return nil, err
+	}
+	paths := make([]string, len(changes))
+	for i, c := range changes {
+		paths[i] = c.Path
+	}
+	return newBloomFilter(paths), nil
+}
+
+// commitGenerations return topological levels of commits. root commits are 1,
+// and others are one more than the maximum of their parents.
+func commitGenerations(shas []string, commits map[string]*GitCommit) map[string]uint32 {
+	generations := map[string]uint32{}
+	for _, sha := range shas {
+		stack := []string{sha}
+		for len(stack) > 0 {
+			top := stack[len(stack)-1]
+			if generations[top] > 0 {
+				stack = stack[:len(stack)-1]
+				continue
+			}
+			gen, pending := uint32(1), false
+			for _, parent := range commits[top].Parents {
+				if generations[parent] == 0 {
+					stack = append(stack, parent)
+					pending = true
+				} else if generations[parent]+1 > gen {
+					gen = generations[parent] + 1
+				}
+			}
+			if pending {
+				continue
+			}
+			if gen > graphGenerations {
+				gen = graphGenerations
+			}
+			generations[top] = gen
+			stack = stack[:len(stack)-1]
+		}
+	}
+	return generations
+}
+
+// graphChunk is a chunk of commit-graph file.
+type graphChunk struct {
+	id   uint32
+	data []byte
+}
+
+// encodeCommitGraph make commit-graph file of sorted commits.
+// changed-path filters are written if filters is not nil.
+func encodeCommitGraph(shas []string, commits map[string]*GitCommit, filters []bloomFilter) ([]byte, error) {
+	positions := map[string]uint32{}
+	for i, sha := range shas {
+		positions[sha] = uint32(i)
+	}
+	generations := commitGenerations(shas, commits)
+
+	fanout, oids, err := encodeFanout(shas)
+	if err != nil {
+		return nil, err
+	}
+	var data, edges, bloomIdx, bloomData bytes.Buffer
+
+	for _, sha := range shas {
+		commit := commits[sha]
+		tree, err := hex.DecodeString(commit.Tree)
+		if err != nil {
+			return nil, err
+		}
+		data.Write(tree)
+		parents := [2]uint32{graphParentNone, graphParentNone}
+		for i, parent := range commit.Parents {
+			if i < 2 {
+				parents[i] = positions[parent]
+			}
+		}
+		if len(commit.Parents) > 2 {
+			parents[1] = graphExtraEdges | uint32(edges.Len()/4)
+			for i, parent := range commit.Parents[1:] {
+				edge := positions[parent]
+				if i == len(commit.Parents)-2 {
+					edge |= graphLastEdge
+				}
+				binary.Write(&edges, binary.BigEndian, edge)
+			}
+		}
+		binary.Write(&data, binary.BigEndian, parents)
+		when, _ := commit.Committer.When()
+		t := when.Unix()
+		if t < 0 || t > graphMaxTime {
+			t = 0
+		}
+		binary.Write(&data, binary.BigEndian, uint64(generations[sha])<<34|uint64(t))
+	}
+
+	chunks := []graphChunk{{chunkOIDFanout, fanout}, {chunkOIDLookup, oids}, {chunkCommitData, data.Bytes()}}
+	if edges.Len() > 0 {
+		chunks = append(chunks, graphChunk{chunkExtraEdges, edges.Bytes()})
+	}
+	if filters != nil {
+		binary.Write(&bloomData, binary.BigEndian, [3]uint32{bloomHashVersion, bloomNumHashes, bloomBitsPerEntry})
+		for _, filter := range filters {
+			bloomData.Write(filter)
+			binary.Write(&bloomIdx, binary.BigEndian, uint32(bloomData.Len()-bloomDataHeader))
+		}
+		chunks = append(chunks, graphChunk{chunkBloomIndex, bloomIdx.Bytes()}, graphChunk{chunkBloomData, bloomData.Bytes()})
+	}
+
+	var b bytes.Buffer
+	b.Write(commitGraphMagic)
+	b.Write([]byte{1, 1, byte(len(chunks)), 0})
+	encodeChunks(&b, chunks)
+	return b.Bytes(), nil
+}
+
+// VerifyCommitGraph check that commit-graph is consistent with commit objects.
+// return number of verified commits.
+func VerifyCommitGraph(repo *GitRepository) (int, error) {
+	path := commitGraphPath(repo)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	g, err := parseCommitGraph(path, data)
+	if err != nil {
+		return 0, err
+	}
+
+	for i := 0; i < 256; i++ {
+		count := 0
+		for count < g.count && int(g.shaAt(count)[0]) <= i {
+			count++
+		}
+		if fanout := int(binary.BigEndian.Uint32(g.fanout[i*4:])); fanout != count {
+			return 0, fmt.Errorf("commit-graph has incorrect fanout value: fanout[%d] = %d != %d", i, fanout, count)
+		}
+	}
+	for i := 1; i < g.count; i++ {
+		if bytes.Compare(g.shaAt(i-1), g.shaAt(i)) >= 0 {
+			return 0, fmt.Errorf("commit-graph has incorrect OID order: %x then %x", g.shaAt(i-1), g.shaAt(i))
+		}
+	}
+
+	generations := map[string]uint32{}
+	for i := 0; i < g.count; i++ {
+		sha := hex.EncodeToString(g.shaAt(i))
+		c, err := g.commitAt(i)
+		if err != nil {
+			return 0, err
+		}
+		generations[sha] = c.generation
+	}
+	for i := 0; i < g.count; i++ {
+		sha := hex.EncodeToString(g.shaAt(i))
+		c, _ := g.commitAt(i)
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return 0, fmt.Errorf("failed to parse commit %s from object database for commit-graph: %w", sha, err)
+		}
+		if c.tree != commit.Tree {
+			return 0, fmt.Errorf("root tree OID for commit %s in commit-graph is %s != %s", sha, c.tree, commit.Tree)
+		}
+		if strings.Join(c.parents, " ") != strings.Join(commit.Parents, " ") {
+			return 0, fmt.Errorf("commit-graph parent list for commit %s is %v != %v", sha, c.parents, commit.Parents)
+		}
+		gen := uint32(1)
+		for _, parent := range c.parents {
+			if generations[parent]+1 > gen {
+				gen = generations[parent] + 1
+			}
+		}
+		if gen > graphGenerations {
+			gen = graphGenerations
+		}
+		if c.generation != gen {
+			return 0, fmt.Errorf("commit-graph generation for commit %s is %d != %d", sha, c.generation, gen)
+		}
+		when, _ := commit.Committer.When()
+		if t := when.Unix(); t >= 0 && t <= graphMaxTime && c.time != t {
+			return 0, fmt.Errorf("commit date for commit %s in commit-graph is %d != %d", sha, c.time, t)
+		}
+	}
+	return g.count, nil
+}
@@ -0,0 +1,154 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMurmur3(t *testing.T) {
+	assert.Equal(t, uint32(0x00000000), murmur3([]byte(""), 0))
+	assert.Equal(t, uint32(0x627b0c2c), murmur3([]byte("Hello world!"), 0))
+	assert.Equal(t, uint32(0x2e4ff723), murmur3([]byte("The quick brown fox jumps over the lazy dog"), 0))
+}
+
+func TestBloomFilter(t *testing.T) {
+	filter := newBloomFilter([]string{"a/b/c", "d"})
+	for _, path := range []string{"a", "a/b", "a/b/c", "d"} {
+		assert.True(t, filter.mayContain(path), path)
+	}
+	assert.False(t, filter.mayContain("a/b/e"))
+	assert.Equal(t, bloomFilter{0}, newBloomFilter(nil))
+	many := make([]string, bloomMaxChangedPaths+1)
+	for i := range many {
+		many[i] = string(rune('a'+i%26)) + "/" + string(rune('a'+i/26))
+	}
+	assert.Equal(t, bloomFilter{0xff}, newBloomFilter(many))
+}
+
+// writeTestTree write a tree of files whose contents are their paths.
+func writeTestTree(t *testing.T, repo *GitRepository, paths ...string) string {
+	entries := map[string][]string{}
+	var names []string
+	for _, path := range paths {
+		name, rest := path, ""
+		for i := range path {
+			if path[i] == '/' {
+				name, rest = path[:i], path[i+1:]
+				break
+			}
+		}
+		if _, ok := entries[name]; !ok {
+			names = append(names, name)
+		}
+		if rest != "" {
+			entries[name] = append(entries[name], rest)
+		} else {
+			entries[name] = nil
+		}
+	}
+	tree := &GitTree{}
+	for _, name := range names {
+		if sub := entries[name]; sub != nil {
+			tree.Entries = append(tree.Entries, &GitTreeEntry{Mode: ModeTree, Path: name, Sha: writeTestTree(t, repo, sub...)})
+			continue
+		}
+		blob, err := WriteObject(repo, NewGitBlob([]byte(name)))
+		assert.NoError(t, err)
+		tree.Entries = append(tree.Entries, &GitTreeEntry{Mode: ModeBlob, Path: name, Sha: blob})
+	}
+	sha, err := WriteObject(repo, tree)
+	assert.NoError(t, err)
+	return sha
+}
+
+func TestDiffTrees(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	oldTree := writeTestTree(t, repo, "a/b/c", "a/d", "e")
+	newTree := writeTestTree(t, repo, "a/b/c", "a/f", "e/g")
+
+	changes, err := DiffTrees(repo, oldTree, newTree)
+	assert.NoError(t, err)
+	var paths []string
+	for _, c := range changes {
+		paths = append(paths, c.Path)
+	}
+	assert.Equal(t, []string{"a/d", "a/f", "e", "e/g"}, paths)
+	assert.Nil(t, changes[0].New)
+	assert.Nil(t, changes[1].Old)
+
+	changes, err = DiffTrees(repo, "", oldTree)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 3)
+}
+
+func TestCommitGraph(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	commit := func(tree string, parents ...string) string {
+		user := GitUser{Name: "mygit", Email: "mygit@example.com", Time: "1600000000 +0000"}
+		sha, err := WriteObject(repo, &GitCommit{Tree: tree, Parents: parents, Author: user, Committer: user, Message: "m\n"})
+		assert.NoError(t, err)
+		return sha
+	}
+	root := commit(writeTestTree(t, repo, "a/b/c"))
+	left := commit(writeTestTree(t, repo, "a/b/c", "left"), root)
+	right := commit(writeTestTree(t, repo, "a/b/c", "right"), root)
+	third := commit(writeTestTree(t, repo, "a/b/c", "third"), root)
+	merge := commit(writeTestTree(t, repo, "a/b/c", "left", "right", "third"), left, right, third)
+	tip := commit(writeTestTree(t, repo, "a/b/d", "left", "right", "third"), merge)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", tip, ""))
+	assert.NoError(t, UpdateRef(repo, "refs/heads/left", left, ""))
+
+	assert.NoError(t, WriteCommitGraph(repo, CommitGraphOptions{Reachable: true, ChangedPaths: true}))
+	count, err := VerifyCommitGraph(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 6, count)
+
+	graph := loadCommitGraph(repo)
+	if !assert.NotNil(t, graph) {
+		return
+	}
+	for sha, generation := range map[string]uint32{root: 1, left: 2, merge: 3, tip: 4} {
+		node, err := readCommitNode(repo, graph, sha)
+		assert.NoError(t, err)
+		assert.Equal(t, generation, node.generation)
+		assert.Equal(t, int64(1600000000), node.time)
+	}
+	node, _ := readCommitNode(repo, graph, merge)
+	assert.Equal(t, []string{left, right, third}, node.parents)
+
+	assert.True(t, maybeChangedPath(graph, tip, "a/b/d"))
+	assert.True(t, maybeChangedPath(graph, tip, "a"))
+	assert.False(t, maybeChangedPath(graph, tip, "left"))
+	assert.False(t, maybeChangedPath(graph, merge, "a"))
+
+	ok, err := IsAncestor(repo, right, tip)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = IsAncestor(repo, tip, left)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	bases, err := MergeBases(repo, left, right)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{root}, bases)
+	bases, err = MergeBases(repo, tip, third)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{third}, bases)
+
+	// corrupt commit-graph is not used
+	path := commitGraphPath(repo)
+	data, err := ioutil.ReadFile(path)
+	assert.NoError(t, err)
+	data[len(data)-30] ^= 0xff
+	assert.NoError(t, os.Chmod(path, 0644))
+	assert.NoError(t, ioutil.WriteFile(path, data, 0644))
+	_, err = VerifyCommitGraph(repo)
+	assert.Error(t, err)
+	ok, err = IsAncestor(repo, right, tip)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
@@ -0,0 +1,571 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// GitConfig is content of a config file such as .git/config
+// the text of the file is kept, so that Serialize changes only edited lines and keeps comments.
+type GitConfig struct {
+	Sections []*ConfigSection
+	// head is comments and blank lines before the first section.
+	head string
+}
+
+// ConfigSection is a section of config file. a section appearing twice in the file is two ConfigSections.
+type ConfigSection struct {
+	Name       string
+	Subsection string
+	Entries    []*ConfigEntry
+	// raw is the header as read, which is written unless the name is changed.
+	raw                    string
+	rawName, rawSubsection string
+}
+
+// ConfigEntry is a key-value line of config file.
+// an entry with empty Key is a comment or a blank line, which is kept to be written as is.
+type ConfigEntry struct {
+	Key   string
+	Value string
+	// raw is the line as read, which is written unless the value is changed.
+	raw              string
+	rawKey, rawValue string
+}
+
+// configLine is a section header, key-value line or comment of config file in appearance order.
+type configLine struct {
+	Section    string
+	Subsection string
+	Key        string
+	Value      string
+	Line       int
+	// Comment is true for comments and blank lines. their Key is empty like section headers.
+	Comment bool
+	// Raw is the text of the line, and all of them make up the whole file.
+	Raw string
+}
+
+// ReadConfig read .git/config. return empty config if file is not exists.
+func ReadConfig(repo *GitRepository) (*GitConfig, error) {
+	return ReadConfigFile(repo.RepoPath("config"))
+}
+
+// WriteConfig write config to .git/config
+func WriteConfig(repo *GitRepository, cfg *GitConfig) error {
+	return WriteConfigFile(repo.RepoPath("config"), cfg)
+}
+
+// ReadConfigFile read config file. return empty config if file is not exists.
+func ReadConfigFile(path string) (*GitConfig, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return &GitConfig{}, nil
+		}
+		return nil, err
+	}
+	return ParseConfig(data)
+}
+
+// WriteConfigFile write config file through lock file.
+func WriteConfigFile(path string, cfg *GitConfig) error {
+	if err := os.MkdirAll(filepath.Dir(path), repoDirPerm()); err != nil {
+		return err
+	}
+	return writeLockedFile(path, cfg.Serialize())
+}
+
+// ParseConfig parse git config file.
+func ParseConfig(data []byte) (*GitConfig, error) {
+	lines, err := parseConfigLines(data)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &GitConfig{}
+	var cur *ConfigSection
+	for _, l := range lines {
+		switch {
+		case l.Comment && cur == nil:
+			cfg.head += l.Raw
+		case l.Comment:
+			cur.Entries = append(cur.Entries, &ConfigEntry{raw: l.Raw})
+		case l.Key == "":
+			cur = &ConfigSection{Name: l.Section, Subsection: l.Subsection, raw: l.Raw, rawName: l.Section, rawSubsection: l.Subsection}
+			cfg.Sections = append(cfg.Sections, cur)
+		default:
+			cur.Entries = append(cur.Entries, &ConfigEntry{Key: l.Key, Value: l.Value, raw: l.Raw, rawKey: l.Key, rawValue: l.Value})
+		}
+	}
+	return cfg, nil
+}
+
+// parseConfigLines parse git's INI dialect.
+// a section header without entries is returned as a line with empty Key.
+func parseConfigLines(data []byte) ([]configLine, error) {
+	p := &configParser{data: data, line: 1}
+	var lines []configLine
+	section, subsection := "", ""
+	for {
+		start := p.pos
+		p.skipSpaces()
+		c, ok := p.next()
+		if !ok {
+			if start < p.pos {
+				lines = append(lines, configLine{Line: p.line, Comment: true, Raw: string(p.data[start:])})
+			}
+			return lines, nil
+		}
+		switch {
+		case c == '\n':
+			lines = append(lines, configLine{Line: p.line - 1, Comment: true, Raw: string(p.data[start:p.pos])})
+		case c == '#' || c == ';':
+			line := p.line
+			p.skipLine()
+			lines = append(lines, configLine{Line: line, Comment: true, Raw: string(p.data[start:p.pos])})
+		case c == '[':
+			var err error
+			section, subsection, err = p.parseSectionHeader()
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, configLine{Section: section, Subsection: subsection, Line: p.line, Raw: string(p.data[start:p.pos])})
+		case isConfigKeyChar(c, true):
+			if section == "" {
+				return nil, fmt.Errorf("Bad config line %d: key outside of section", p.line)
+			}
+			line := p.line
+			key, value, err := p.parseKeyValue(c)
+			if err != nil {
+				return nil, err
+			}
+			lines = append(lines, configLine{Section: section, Subsection: subsection, Key: key, Value: value, Line: line, Raw: string(p.data[start:p.pos])})
+		default:
+			return nil, fmt.Errorf("Bad config line %d", p.line)
+		}
+	}
+}
+
+type configParser struct {
+	data []byte
+	pos  int
+	line int
+}
+
+func (p *configParser) next() (byte, bool) {
+	if p.pos >= len(p.data) {
+		return 0, false
+	}
+	c := p.data[p.pos]
+	p.pos++
+	if c == '\n' {
+		p.line++
+	}
+	return c, true
+}
+
+func (p *configParser) peek() (byte, bool) {
+	if p.pos >= len(p.data) {
+		return 0, false
+	}
+	return p.data[p.pos], true
+}
+
+func (p *configParser) skipSpaces() {
+	for {
+		c, ok := p.peek()
+		if !ok || c == '\n' || !isSpace(c) {
+			return
+		}
+		p.pos++
+	}
+}
+
+func (p *configParser) skipLine() {
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			return
+		}
+	}
+}
+
+// parseSectionHeader parse [section], [section "subsection"] and legacy [section.subsection].
+func (p *configParser) parseSectionHeader() (string, string, error) {
+	var name []byte
+	for {
+		c, ok := p.next()
+		if !ok {
+			return "", "", fmt.Errorf("Bad config line %d: unterminated section header", p.line)
+		}
+		switch {
+		case c == ']':
+			section := strings.ToLower(string(name))
+			if dot := strings.IndexByte(section, '.'); dot >= 0 {
+				return section[:dot], section[dot+1:], nil
+			}
+			if section == "" {
+				return "", "", fmt.Errorf("Bad config line %d: empty section name", p.line)
+			}
+			return section, "", nil
+		case isSpace(c):
+			p.skipSpaces()
+			sub, err := p.parseSubsection()
+			if err != nil {
+				return "", "", err
+			}
+			return strings.ToLower(string(name)), sub, nil
+		case isConfigKeyChar(c, false) || c == '.':
+			name = append(name, c)
+		default:
+			return "", "", fmt.Errorf("Bad config line %d: invalid section name", p.line)
+		}
+	}
+}
+
+func (p *configParser) parseSubsection() (string, error) {
+	if c, _ := p.next(); c != '"' {
+		return "", fmt.Errorf("Bad config line %d: subsection must be quoted", p.line)
+	}
+	var sub []byte
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			return "", fmt.Errorf("Bad config line %d: unterminated subsection", p.line)
+		}
+		if c == '"' {
+			break
+		}
+		if c == '\\' {
+			if c, ok = p.next(); !ok || c == '\n' {
+				return "", fmt.Errorf("Bad config line %d: unterminated subsection", p.line)
+			}
+		}
+		sub = append(sub, c)
+	}
+	if c, _ := p.next(); c != ']' {
+		return "", fmt.Errorf("Bad config line %d: expected ']'", p.line)
+	}
+	return string(sub), nil
+}
+
+func (p *configParser) parseKeyValue(first byte) (string, string, error) {
+	key := []byte{first}
+	for {
+		c, ok := p.peek()
+		if !ok || !isConfigKeyChar(c, false) {
+			break
+		}
+		key = append(key, c)
+		p.pos++
+	}
+	p.skipSpaces()
+	c, ok := p.next()
+	if !ok || c == '\n' {
+		// key without "=" means boolean true
+		return strings.ToLower(string(key)), "true", nil
+	}
+	if c == '#' || c == ';' {
+		p.skipLine()
+		return strings.ToLower(string(key)), "true", nil
+	}
+	if c != '=' {
+		return "", "", fmt.Errorf("Bad config line %d: invalid key", p.line)
+	}
+	value, err := p.parseValue()
+	return strings.ToLower(string(key)), value, err
+}
+
+// parseValue parse value with quoting, escapes and line continuation.
+// whitespaces outside of quote are converted to space, and trailing whitespaces are removed.
+func (p *configParser) parseValue() (string, error) {
+	p.skipSpaces()
+	var value []byte
+	quote := false
+	spaces := 0
+	for {
+		c, ok := p.next()
+		if !ok || c == '\n' {
+			if quote {
+				return "", fmt.Errorf("Bad config line %d: unterminated quote", p.line)
+			}
+			return string(value), nil
+		}
+		if !quote && (c == '#' || c == ';') {
+			p.skipLine()
+			return string(value), nil
+		}
+		if !quote && isSpace(c) {
+			if len(value) > 0 {
+				spaces++
+			}
+			continue
+		}
+		for ; spaces > 0; spaces-- {
+			value = append(value, ' ')
+		}
+		switch c {
+		case '"':
+			quote = !quote
+		case '\\':
+			e, ok := p.next()
+			if !ok {
+				return "", fmt.Errorf("Bad config line %d: invalid escape", p.line)
+			}
+			switch e {
+			case '\n':
+				// line continuation
+			case 'n':
+				value = append(value, '\n')
+			case 't':
+				value = append(value, '\t')
+			case 'b':
+				if len(value) > 0 {
+					value = value[:len(value)-1]
+				}
+			case '\\', '"':
+				value = append(value, e)
+			default:
+				return "", fmt.Errorf("Bad config line %d: invalid escape \\%c", p.line, e)
+			}
+		default:
+			value = append(value, c)
+		}
+	}
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\r' || c == '\v' || c == '\f'
+}
+
+func isConfigKeyChar(c byte, first bool) bool {
+	alpha := 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z'
+	if first {
+		return alpha
+	}
+	return alpha || '0' <= c && c <= '9' || c == '-'
+}
+
+// Serialize return config file data.
+// lines read from the file are written as they were unless they are changed, so comments are kept.
+func (c *GitConfig) Serialize() []byte {
+	var b bytes.Buffer
+	b.WriteString(c.head)
+	// a new line must not follow the last line of the file without newline
+	newLine := func() {
+		if b.Len() > 0 && b.Bytes()[b.Len()-1] != '\n' {
+			b.WriteByte('\n')
+		}
+	}
+	for _, s := range c.Sections {
+		switch {
+		case s.raw != "" && s.Name == s.rawName && s.Subsection == s.rawSubsection:
+			b.WriteString(s.raw)
+		case s.Subsection == "":
+			newLine()
+			fmt.Fprintf(&b, "[%s]", s.Name)
+		default:
+			newLine()
+			sub := strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s.Subsection)
+			fmt.Fprintf(&b, "[%s \"%s\"]", s.Name, sub)
+		}
+		// the rest of the header line is kept in entries of the section read from the file
+		if s.raw == "" {
+			b.WriteByte('\n')
+		}
+		for _, e := range s.Entries {
+			if e.raw != "" && e.Key == e.rawKey && e.Value == e.rawValue {
+				b.WriteString(e.raw)
+				continue
+			}
+			newLine()
+			fmt.Fprintf(&b, "\t%s = %s\n", e.Key, quoteConfigValue(e.Value))
+		}
+	}
+	return b.Bytes()
+}
+
+func quoteConfigValue(value string) string {
+	escaped := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`, "\t", `\t`).Replace(value)
+	if value != strings.TrimSpace(value) || strings.ContainsAny(value, "#;") {
+		return `"` + escaped + `"`
+	}
+	return escaped
+}
+
+// Get return last value of the key.
+func (c *GitConfig) Get(section, subsection, key string) (string, bool) {
+	values := c.GetAll(section, subsection, key)
+	if len(values) == 0 {
+		return "", false
+	}
+	return values[len(values)-1], true
+}
+
+// GetAll return all values of multi-valued key.
+func (c *GitConfig) GetAll(section, subsection, key string) []string {
+	var values []string
+	key = strings.ToLower(key)
+	for _, s := range c.Sections {
+		if s.Name != strings.ToLower(section) || s.Subsection != subsection {
+			continue
+		}
+		for _, e := range s.Entries {
+			if e.Key == key {
+				values = append(values, e.Value)
+			}
+		}
+	}
+	return values
+}
+
+// Set set value of key. section is created if not exists.
+// if the key has multiple values, the last one is replaced.
+func (c *GitConfig) Set(section, subsection, key, value string) {
+	key = strings.ToLower(key)
+	var last *ConfigEntry
+	for _, s := range c.Sections {
+		if s.Name != strings.ToLower(section) || s.Subsection != subsection {
+			continue
+		}
+		for _, e := range s.Entries {
+			if e.Key == key {
+				last = e
+			}
+		}
+	}
+	if last != nil {
+		last.Value = value
+		return
+	}
+	c.Add(section, subsection, key, value)
+}
+
+// Add add a value to multi-valued key.
+// the value is put after the last entry of the section, before comments following it.
+func (c *GitConfig) Add(section, subsection, key, value string) {
+	s := c.section(section, subsection, true)
+	pos := 0
+	if s.raw != "" && len(s.Entries) > 0 {
+		// the first entry of a section read from the file ends the header line
+		pos = 1
+	}
+	for i, e := range s.Entries {
+		if e.Key != "" {
+			pos = i + 1
+		}
+	}
+	entry := &ConfigEntry{Key: strings.ToLower(key), Value: value}
+	s.Entries = append(s.Entries[:pos], append([]*ConfigEntry{entry}, s.Entries[pos:]...)...)
+}
+
+// Unset remove all values of key, and return false if the key has no value.
+// section left without entries and comments is removed.
+func (c *GitConfig) Unset(section, subsection, key string) bool {
+	key = strings.ToLower(key)
+	removed := false
+	for _, s := range c.Sections {
+		if s.Name != strings.ToLower(section) || s.Subsection != subsection {
+			continue
+		}
+		var entries []*ConfigEntry
+		for _, e := range s.Entries {
+			if e.Key != key {
+				entries = append(entries, e)
+			} else {
+				removed = true
+			}
+		}
+		s.Entries = entries
+	}
+	var sections []*ConfigSection
+	for _, s := range c.Sections {
+		if !s.empty() || s.Name != strings.ToLower(section) || s.Subsection != subsection {
+			sections = append(sections, s)
+		}
+	}
+	c.Sections = sections
+	return removed
+}
+
+// empty return true if the section has neither entries nor comments, but blank lines.
+func (s *ConfigSection) empty() bool {
+	for _, e := range s.Entries {
+		if e.Key != "" || strings.TrimSpace(e.raw) != "" {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveSection remove all sections match name and subsection.
+func (c *GitConfig) RemoveSection(section, subsection string) {
+	var sections []*ConfigSection
+	for _, s := range c.Sections {
+		if !(s.Name == strings.ToLower(section) && s.Subsection == subsection) {
+			sections = append(sections, s)
+		}
+	}
+	c.Sections = sections
+}
+
+// RenameSection change subsection name.
+func (c *GitConfig) RenameSection(section, oldSubsection, newSubsection string) {
+	for _, s := range c.Sections {
+		if s.Name == strings.ToLower(section) && s.Subsection == oldSubsection {
+			s.Subsection = newSubsection
+		}
+	}
+}
+
+// section return the last section of the name, which new entries are added to.
+func (c *GitConfig) section(name, subsection string, create bool) *ConfigSection {
+	name = strings.ToLower(name)
+	for i := len(c.Sections) - 1; i >= 0; i-- {
+		if s := c.Sections[i]; s.Name == name && s.Subsection == subsection {
+			return s
+		}
+	}
+	if !create {
+		return nil
+	}
+	s := &ConfigSection{Name: name, Subsection: subsection}
+	c.Sections = append(c.Sections, s)
+	return s
+}
+
+// SplitConfigKey split "section.subsection.key" into its parts.
+// section and key are lower-cased, subsection is case sensitive.
+func SplitConfigKey(name string) (string, string, string, error) {
+	first := strings.IndexByte(name, '.')
+	last := strings.LastIndexByte(name, '.')
+	if first <= 0 || last == len(name)-1 {
+		return "", "", "", fmt.Errorf("key does not contain a section: %s", name)
+	}
+	section, key := strings.ToLower(name[:first]), strings.ToLower(name[last+1:])
+	subsection := ""
+	if first != last {
+		subsection = name[first+1 : last]
+	}
+	if !isConfigKeyChar(key[0], true) {
+		return "", "", "", fmt.Errorf("invalid key: %s", name)
+	}
+	for i := 1; i < len(key); i++ {
+		if !isConfigKeyChar(key[i], false) {
+			return "", "", "", fmt.Errorf("invalid key: %s", name)
+		}
+	}
+	return section, subsection, key, nil
+}
+
+// joinConfigKey make "section.subsection.key" form.
+func joinConfigKey(section, subsection, key string) string {
+	if subsection == "" {
+		return section + "." + key
+	}
+	return section + "." + subsection + "." + key
+}
@@ -0,0 +1,172 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseConfig(t *testing.T) {
+	data := []byte(`# comment
+[core]
+	bare = false ; trailing comment
+	Editor = "vim -u NONE"   
+	flag
+[remote "origin"]
+	url = https://example.com/repo.git
+	fetch = +refs/heads/*:refs/remotes/origin/*
+	fetch = +refs/tags/*:refs/tags/*
+[Section.SubName]
+	escaped = "tab\there \"quoted\" \\ # not comment"
+	long = first \
+second
+[branch "a \"b\""]
+	merge = refs/heads/a
+`)
+	cfg, err := ParseConfig(data)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		section, sub, key, want string
+	}{
+		{"core", "", "bare", "false"},
+		{"core", "", "editor", "vim -u NONE"},
+		{"core", "", "flag", "true"},
+		{"remote", "origin", "url", "https://example.com/repo.git"},
+		{"remote", "origin", "fetch", "+refs/tags/*:refs/tags/*"},
+		{"section", "subname", "escaped", "tab\there \"quoted\" \\ # not comment"},
+		{"section", "subname", "long", "first second"},
+		{"branch", `a "b"`, "merge", "refs/heads/a"},
+	}
+	for _, tt := range tests {
+		got, ok := cfg.Get(tt.section, tt.sub, tt.key)
+		assert.True(t, ok, tt.key)
+		assert.Equal(t, tt.want, got, tt.key)
+	}
+	assert.Equal(t, 2, len(cfg.GetAll("remote", "origin", "fetch")))
+
+	// serialized config is parsed to same values
+	reparsed, err := ParseConfig(cfg.Serialize())
+	assert.NoError(t, err)
+	assert.Equal(t, cfg, reparsed)
+
+	for _, bad := range []string{"key = value\n", "[core\n", "[core]\nk = \"open\n", "[a \"b]\n"} {
+		_, err := ParseConfig([]byte(bad))
+		assert.Error(t, err, bad)
+	}
+}
+
+func TestGitConfigEdit(t *testing.T) {
+	cfg := &GitConfig{}
+	cfg.Set("user", "", "Name", "alice")
+	cfg.Set("user", "", "name", "bob")
+	cfg.Add("remote", "origin", "fetch", "a")
+	cfg.Add("remote", "origin", "fetch", "b")
+	v, _ := cfg.Get("user", "", "name")
+	assert.Equal(t, "bob", v)
+	assert.Equal(t, []string{"a", "b"}, cfg.GetAll("remote", "origin", "fetch"))
+
+	assert.True(t, cfg.Unset("remote", "origin", "fetch"))
+	assert.Equal(t, 1, len(cfg.Sections))
+	assert.False(t, cfg.Unset("remote", "origin", "fetch"))
+	cfg.RenameSection("user", "", "x")
+	_, ok := cfg.Get("user", "x", "name")
+	assert.True(t, ok)
+}
+
+func TestGitConfigKeepsComments(t *testing.T) {
+	data := "# top comment\n\n[core] ; header comment\n\tbare = false\n\t# about editor\n\tEditor = vim # inline\n\n" +
+		"# before remote\n[remote \"origin\"]\n\turl = a\n\tfetch = x\n# after remote\n[branch \"main\"]\n\tremote = origin\n[core]\n\tlast = 1"
+	cfg, err := ParseConfig([]byte(data))
+	assert.NoError(t, err)
+	assert.Equal(t, data, string(cfg.Serialize()))
+
+	cfg.Set("core", "", "editor", "emacs")
+	cfg.Set("core", "", "bare", "false")
+	cfg.Add("remote", "origin", "fetch", "y")
+	assert.True(t, cfg.Unset("remote", "origin", "url"))
+	cfg.RenameSection("branch", "main", "trunk")
+	cfg.Add("core", "", "added", "2")
+	cfg.Set("user", "", "name", "me")
+	want := "# top comment\n\n[core] ; header comment\n\tbare = false\n\t# about editor\n\teditor = emacs\n\n" +
+		"# before remote\n[remote \"origin\"]\n\tfetch = x\n\tfetch = y\n# after remote\n[branch \"trunk\"]\n\tremote = origin\n[core]\n\tlast = 1\n\tadded = 2\n[user]\n\tname = me\n"
+	assert.Equal(t, want, string(cfg.Serialize()))
+
+	cfg.RemoveSection("branch", "trunk")
+	cfg.Unset("remote", "origin", "fetch")
+	want = "# top comment\n\n[core] ; header comment\n\tbare = false\n\t# about editor\n\teditor = emacs\n\n" +
+		"# before remote\n[remote \"origin\"]\n# after remote\n[core]\n\tlast = 1\n\tadded = 2\n[user]\n\tname = me\n"
+	assert.Equal(t, want, string(cfg.Serialize()))
+	cfg.Unset("user", "", "name")
+	cfg.Add("user", "", "email", "me@example.com")
+	assert.Equal(t, want[:len(want)-len("\tname = me\n")]+"\temail = me@example.com\n", string(cfg.Serialize()))
+}
+
+func TestLoadConfig(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+
+	home := filepath.Join(repo.Worktree, "home")
+	global := filepath.Join(home, "gitconfig")
+	assert.NoError(t, os.MkdirAll(home, 0755))
+	assert.NoError(t, ioutil.WriteFile(global, []byte("[user]\n\tname = global\n[include]\n\tpath = inc\n[includeIf \"gitdir:"+repo.Worktree+"/\"]\n\tpath = cond\n[includeIf \"onbranch:other\"]\n\tpath = never\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "inc"), []byte("[pack]\n\twindowMemory = 10m\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "cond"), []byte("[core]\n\tmatched = yes\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(home, "never"), []byte("[core]\n\tnever = yes\n"), 0644))
+	assert.NoError(t, repo.SaveRepoFile("config", []byte("[user]\n\tname = local\n\temail = local@example.com\n")))
+
+	os.Setenv("GIT_CONFIG_NOSYSTEM", "1")
+	os.Setenv("GIT_CONFIG_GLOBAL", global)
+	os.Setenv("GIT_CONFIG_PARAMETERS", QuoteConfigParameter("user.Email=cli'@example.com"))
+	defer os.Unsetenv("GIT_CONFIG_NOSYSTEM")
+	defer os.Unsetenv("GIT_CONFIG_GLOBAL")
+	defer os.Unsetenv("GIT_CONFIG_PARAMETERS")
+
+	cs, err := LoadConfig(repo)
+	assert.NoError(t, err)
+
+	name, ok := cs.Lookup("user.name")
+	assert.True(t, ok)
+	assert.Equal(t, "local", name.Value)
+	assert.Equal(t, ScopeLocal, name.Scope)
+	assert.Equal(t, []string{"global", "local"}, cs.GetAll("user.name"))
+
+	email, _ := cs.Lookup("user.email")
+	assert.Equal(t, "cli'@example.com", email.Value)
+	assert.Equal(t, ScopeCommand, email.Scope)
+
+	memory, err := cs.GetInt("pack.windowmemory", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(10*1024*1024), memory)
+
+	matched, err := cs.GetBool("core.matched", false)
+	assert.NoError(t, err)
+	assert.True(t, matched)
+	_, ok = cs.Get("core.never")
+	assert.False(t, ok)
+
+	_, err = cs.GetBool("user.name", false)
+	assert.Error(t, err)
+}
+
+func TestSplitConfigKey(t *testing.T) {
+	section, sub, key, err := SplitConfigKey("Remote.Origin.URL")
+	assert.NoError(t, err)
+	assert.Equal(t, "remote", section)
+	assert.Equal(t, "Origin", sub)
+	assert.Equal(t, "url", key)
+
+	section, sub, key, err = SplitConfigKey("includeIf.gitdir:~/a.b/.path")
+	assert.NoError(t, err)
+	assert.Equal(t, "includeif", section)
+	assert.Equal(t, "gitdir:~/a.b/", sub)
+	assert.Equal(t, "path", key)
+
+	for _, bad := range []string{"nosection", "a.", ".a", "a.1b"} {
+		_, _, _, err := SplitConfigKey(bad)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,498 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// maxIncludeDepth is a limit of nested include.
+const maxIncludeDepth = 10
+
+// ConfigScope is where a config value comes from.
+type ConfigScope int
+
+const (
+	ScopeSystem ConfigScope = iota
+	ScopeGlobal
+	ScopeLocal
+	ScopeWorktree
+	ScopeCommand
+)
+
+func (s ConfigScope) String() string {
+	switch s {
+	case ScopeSystem:
+		return "system"
+	case ScopeGlobal:
+		return "global"
+	case ScopeLocal:
+		return "local"
+	case ScopeWorktree:
+		return "worktree"
+	case ScopeCommand:
+		return "command"
+	}
+	return "unknown"
+}
+
+// ConfigValue is a value in layered config with its origin.
+// Origin is file path, or empty for command line.
+type ConfigValue struct {
+	Key    string
+	Value  string
+	Scope  ConfigScope
+	Origin string
+}
+
+// ConfigSet is merged view of config files.
+// values are ordered from low to high priority.
+type ConfigSet struct {
+	Values []ConfigValue
+	repo   *GitRepository
+}
+
+// SystemConfigPath return path of system scope config file.
+func SystemConfigPath() string {
+	if path := os.Getenv("GIT_CONFIG_SYSTEM"); path != "" {
+		return path
+	}
+	return "/etc/gitconfig"
+}
+
+// GlobalConfigPaths return paths of global scope config files. last one is used for writing.
+func GlobalConfigPaths() []string {
+	if path := os.Getenv("GIT_CONFIG_GLOBAL"); path != "" {
+		return []string{path}
+	}
+	var paths []string
+	xdg := os.Getenv("XDG_CONFIG_HOME")
+	home, _ := os.UserHomeDir()
+	if xdg == "" && home != "" {
+		xdg = filepath.Join(home, ".config")
+	}
+	if xdg != "" {
+		paths = append(paths, filepath.Join(xdg, "git", "config"))
+	}
+	if home != "" {
+		paths = append(paths, filepath.Join(home, ".gitconfig"))
+	}
+	return paths
+}
+
+// ConfigPath return path of config file of the scope.
+// repo can be nil for system and global scope.
+func ConfigPath(repo *GitRepository, scope ConfigScope) (string, error) {
+	switch scope {
+	case ScopeSystem:
+		return SystemConfigPath(), nil
+	case ScopeGlobal:
+		paths := GlobalConfigPaths()
+		if len(paths) == 0 {
+			return "", fmt.Errorf("$HOME not set")
+		}
+		// prefer existing xdg file, otherwise ~/.gitconfig
+		for _, path := range paths[:len(paths)-1] {
+			if _, err := os.Stat(path); err == nil {
+				if _, err := os.Stat(paths[len(paths)-1]); os.IsNotExist(err) {
+					return path, nil
+				}
+			}
+		}
+		return paths[len(paths)-1], nil
+	case ScopeLocal, ScopeWorktree:
+		if repo == nil {
+			return "", fmt.Errorf("not in a git directory")
+		}
+		if scope == ScopeLocal {
+			return repo.RepoPath("config"), nil
+		}
+		return repo.RepoPath("config.worktree"), nil
+	}
+	return "", fmt.Errorf("cannot write config of %s scope", scope)
+}
+
+// LoadConfig read all scopes of config.
+// system, global, local, worktree and command line (GIT_CONFIG_PARAMETERS, GIT_CONFIG_COUNT).
+// repo can be nil when outside of repository.
+func LoadConfig(repo *GitRepository) (*ConfigSet, error) {
+	cs := &ConfigSet{repo: repo}
+	if noSystem, _ := ParseConfigBool(os.Getenv("GIT_CONFIG_NOSYSTEM")); !noSystem {
+		if err := cs.loadFile(SystemConfigPath(), ScopeSystem, 0); err != nil {
+			return nil, err
+		}
+	}
+	for _, path := range GlobalConfigPaths() {
+		if err := cs.loadFile(path, ScopeGlobal, 0); err != nil {
+			return nil, err
+		}
+	}
+	if repo != nil {
+		if err := cs.loadFile(repo.RepoPath("config"), ScopeLocal, 0); err != nil {
+			return nil, err
+		}
+		if enabled, _ := cs.GetBool("extensions.worktreeConfig", false); enabled {
+			if err := cs.loadFile(repo.RepoPath("config.worktree"), ScopeWorktree, 0); err != nil {
+				return nil, err
+			}
+		}
+	}
+	params, err := CommandLineConfig()
+	if err != nil {
+		return nil, err
+	}
+	for _, p := range params {
+		cs.Values = append(cs.Values, ConfigValue{Key: p[0], Value: p[1], Scope: ScopeCommand})
+	}
+	return cs, nil
+}
+
+// LoadConfigFile read a single config file with its includes.
+func LoadConfigFile(repo *GitRepository, path string, scope ConfigScope) (*ConfigSet, error) {
+	cs := &ConfigSet{repo: repo}
+	if err := cs.loadFile(path, scope, 0); err != nil {
+		return nil, err
+	}
+	return cs, nil
+}
+
+func (cs *ConfigSet) loadFile(path string, scope ConfigScope, depth int) error {
+	if depth > maxIncludeDepth {
+		return fmt.Errorf("exceeded maximum include depth (%d) while including %s", maxIncludeDepth, path)
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+	lines, err := parseConfigLines(data)
+	if err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	for _, l := range lines {
+		if l.Key == "" {
+			continue
+		}
+		key := joinConfigKey(l.Section, l.Subsection, l.Key)
+		cs.Values = append(cs.Values, ConfigValue{Key: key, Value: l.Value, Scope: scope, Origin: path})
+		if l.Key != "path" || !(l.Section == "include" && l.Subsection == "" || l.Section == "includeif") {
+			continue
+		}
+		if l.Section == "includeif" && !cs.includeCondition(l.Subsection, path) {
+			continue
+		}
+		include := ExpandConfigPath(l.Value)
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(path), include)
+		}
+		if err := cs.loadFile(include, scope, depth+1); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// includeCondition evaluate condition of includeIf section.
+// supported conditions are gitdir:, gitdir/i: and onbranch:.
+func (cs *ConfigSet) includeCondition(cond, configPath string) bool {
+	if cs.repo == nil {
+		return false
+	}
+	switch {
+	case strings.HasPrefix(cond, "gitdir:"), strings.HasPrefix(cond, "gitdir/i:"):
+		icase := strings.HasPrefix(cond, "gitdir/i:")
+		pattern := cond[strings.IndexByte(cond, ':')+1:]
+		switch {
+		case strings.HasPrefix(pattern, "./"):
+			pattern = filepath.Join(filepath.Dir(configPath), pattern[2:])
+		case strings.HasPrefix(pattern, "~/"):
+			pattern = ExpandConfigPath(pattern)
+		case !filepath.IsAbs(pattern):
+			pattern = "**/" + pattern
+		}
+		if strings.HasSuffix(cond, "/") {
+			pattern += "**"
+		}
+		gitDir, err := filepath.Abs(cs.repo.GitDir)
+		if err != nil {
+			return false
+		}
+		return matchWildcard(pattern, filepath.ToSlash(gitDir), icase)
+	case strings.HasPrefix(cond, "onbranch:"):
+		pattern := strings.TrimPrefix(cond, "onbranch:")
+		if strings.HasSuffix(pattern, "/") {
+			pattern += "**"
+		}
+		current, err := CurrentBranch(cs.repo)
+		if err != nil || current == "" {
+			return false
+		}
+		return matchWildcard(pattern, strings.TrimPrefix(current, branchPrefix), false)
+	}
+	return false
+}
+
+// matchWildcard match path to glob pattern. "**" matches across directories.
+func matchWildcard(pattern, path string, icase bool) bool {
+	var b strings.Builder
+	if icase {
+		b.WriteString("(?i)")
+	}
+	b.WriteString("^")
+	for i := 0; i < len(pattern); i++ {
+		c := pattern[i]
+		switch {
+		case strings.HasPrefix(pattern[i:], "**/"):
+			b.WriteString("(.*/)?")
+			i += 2
+		case strings.HasPrefix(pattern[i:], "**"):
+			b.WriteString(".*")
+			i++
+		case c == '*':
+			b.WriteString("[^/]*")
+		case c == '?':
+			b.WriteString("[^/]")
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	b.WriteString("$")
+	re, err := regexp.Compile(b.String())
+	if err != nil {
+		return false
+	}
+	return re.MatchString(path)
+}
+
+// CommandLineConfig return key-value pairs given by GIT_CONFIG_PARAMETERS and GIT_CONFIG_COUNT.
+func CommandLineConfig() ([][2]string, error) {
+	var params [][2]string
+	for _, p := range splitSq(os.Getenv("GIT_CONFIG_PARAMETERS")) {
+		eq := strings.IndexByte(p, '=')
+		key, value := p, "true"
+		if eq >= 0 {
+			key, value = p[:eq], p[eq+1:]
+		}
+		section, sub, name, err := SplitConfigKey(key)
+		if err != nil {
+			return nil, err
+		}
+		params = append(params, [2]string{joinConfigKey(section, sub, name), value})
+	}
+	if count := os.Getenv("GIT_CONFIG_COUNT"); count != "" {
+		n, err := strconv.Atoi(count)
+		if err != nil {
+			return nil, fmt.Errorf("bogus count in GIT_CONFIG_COUNT: %s", count)
+		}
+		for i := 0; i < n; i++ {
+			key := os.Getenv(fmt.Sprintf("GIT_CONFIG_KEY_%d", i))
+			section, sub, name, err := SplitConfigKey(key)
+			if err != nil {
+				return nil, err
+			}
+			params = append(params, [2]string{joinConfigKey(section, sub, name), os.Getenv(fmt.Sprintf("GIT_CONFIG_VALUE_%d", i))})
+		}
+	}
+	return params, nil
+}
+
+// QuoteConfigParameter quote key=value for GIT_CONFIG_PARAMETERS.
+func QuoteConfigParameter(param string) string {
+	return "'" + strings.ReplaceAll(param, "'", `'\''`) + "'"
+}
+
+// splitSq split shell single quoted words, which is written by QuoteConfigParameter.
+//
+//	'a' 'b'\''c' -> [a, b'c]
+func splitSq(s string) []string {
+	var words []string
+	var cur []byte
+	inWord, quote := false, false
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote && c == '\'':
+			quote = false
+		case quote:
+			cur = append(cur, c)
+		case c == '\'':
+			quote, inWord = true, true
+		case c == '\\' && i+1 < len(s):
+			i++
+			cur, inWord = append(cur, s[i]), true
+		case c == ' ':
+			if inWord {
+				words = append(words, string(cur))
+				cur, inWord = nil, false
+			}
+		default:
+			cur, inWord = append(cur, c), true
+		}
+	}
+	if inWord {
+		words = append(words, string(cur))
+	}
+	return words
+}
+
+// normalizeKey lower-case section and key name.
+func normalizeKey(key string) string {
+	section, sub, name, err := SplitConfigKey(key)
+	if err != nil {
+		return strings.ToLower(key)
+	}
+	return joinConfigKey(section, sub, name)
+}
+
+// Lookup return last value of key with its origin.
+func (cs *ConfigSet) Lookup(key string) (ConfigValue, bool) {
+	key = normalizeKey(key)
+	for i := len(cs.Values) - 1; i >= 0; i-- {
+		if cs.Values[i].Key == key {
+			return cs.Values[i], true
+		}
+	}
+	return ConfigValue{}, false
+}
+
+// LookupAll return all values of key with their origins.
+func (cs *ConfigSet) LookupAll(key string) []ConfigValue {
+	key = normalizeKey(key)
+	var values []ConfigValue
+	for _, v := range cs.Values {
+		if v.Key == key {
+			values = append(values, v)
+		}
+	}
+	return values
+}
+
+// Get return last value of key. key is "section.subsection.key" form.
+func (cs *ConfigSet) Get(key string) (string, bool) {
+	v, ok := cs.Lookup(key)
+	return v.Value, ok
+}
+
+// GetAll return all values of multi-valued key.
+func (cs *ConfigSet) GetAll(key string) []string {
+	var values []string
+	for _, v := range cs.LookupAll(key) {
+		values = append(values, v.Value)
+	}
+	return values
+}
+
+// GetString return value of key, or def if key is not set.
+func (cs *ConfigSet) GetString(key, def string) string {
+	if v, ok := cs.Get(key); ok {
+		return v
+	}
+	return def
+}
+
+// GetBool return boolean value of key, or def if key is not set.
+func (cs *ConfigSet) GetBool(key string, def bool) (bool, error) {
+	v, ok := cs.Get(key)
+	if !ok {
+		return def, nil
+	}
+	b, err := ParseConfigBool(v)
+	if err != nil {
+		return def, fmt.Errorf("bad boolean config value '%s' for '%s'", v, key)
+	}
+	return b, nil
+}
+
+// GetInt return integer value of key, or def if key is not set.
+// value can have k, m, g suffix.
+func (cs *ConfigSet) GetInt(key string, def int64) (int64, error) {
+	v, ok := cs.Get(key)
+	if !ok {
+		return def, nil
+	}
+	n, err := ParseConfigInt(v)
+	if err != nil {
+		return def, fmt.Errorf("bad numeric config value '%s' for '%s'", v, key)
+	}
+	return n, nil
+}
+
+// GetPath return path value of key. leading "~/" is expanded to home directory.
+func (cs *ConfigSet) GetPath(key string) (string, bool) {
+	v, ok := cs.Get(key)
+	if !ok {
+		return "", false
+	}
+	return ExpandConfigPath(v), true
+}
+
+// Subsections return subsection names of section. ex) remote names of "remote" section.
+func (cs *ConfigSet) Subsections(section string) []string {
+	var subs []string
+	seen := map[string]bool{}
+	prefix := strings.ToLower(section) + "."
+	for _, v := range cs.Values {
+		if !strings.HasPrefix(v.Key, prefix) {
+			continue
+		}
+		_, sub, _, err := SplitConfigKey(v.Key)
+		if err != nil || sub == "" || seen[sub] {
+			continue
+		}
+		seen[sub] = true
+		subs = append(subs, sub)
+	}
+	return subs
+}
+
+// ParseConfigBool parse boolean value. true, yes, on, 1 or false, no, off, 0, empty.
+func ParseConfigBool(v string) (bool, error) {
+	switch strings.ToLower(v) {
+	case "true", "yes", "on", "1":
+		return true, nil
+	case "false", "no", "off", "0", "":
+		return false, nil
+	}
+	return false, fmt.Errorf("invalid boolean: %s", v)
+}
+
+// ParseConfigInt parse integer with k, m, g unit suffix.
+func ParseConfigInt(v string) (int64, error) {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0, fmt.Errorf("empty value")
+	}
+	unit := int64(1)
+	switch v[len(v)-1] {
+	case 'k', 'K':
+		unit = 1 << 10
+	case 'm', 'M':
+		unit = 1 << 20
+	case 'g', 'G':
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		v = v[:len(v)-1]
+	}
+	n, err := strconv.ParseInt(v, 0, 64)
+	if err != nil {
+		return 0, err
+	}
+	return n * unit, nil
+}
+
+// ExpandConfigPath expand leading "~/" to home directory.
+func ExpandConfigPath(path string) string {
+	if path == "~" || strings.HasPrefix(path, "~/") {
+		if home, err := os.UserHomeDir(); err == nil {
+			return filepath.Join(home, path[1:])
+		}
+	}
+	return path
+}
@@ -0,0 +1,258 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+// defaultDaemonPort is the port of git daemon.
+const defaultDaemonPort = "9418"
+
+// connectSSH run the service on the host by ssh.
+// the ssh command is GIT_SSH_COMMAND, sshCommand, GIT_SSH or "ssh" in this order.
+// GIT_PROTOCOL is sent to request protocol version 2.
+func connectSSH(u *remoteURL, service string, version int, sshCommand string) (io.ReadWriteCloser, error) {
+	cmd, err := sshCmd(u, service, version, sshCommand)
+	if err != nil {
+		return nil, err
+	}
+	cmd.Stderr = os.Stderr
+	return startProcess(cmd)
+}
+
+// sshCmd build command which runs service of the repository on remote host.
+func sshCmd(u *remoteURL, service string, version int, sshCommand string) (*exec.Cmd, error) {
+	program, shell := "ssh", false
+	if command := os.Getenv("GIT_SSH_COMMAND"); command != "" {
+		program, shell = command, true
+	} else if sshCommand != "" {
+		program, shell = sshCommand, true
+	} else if command := os.Getenv("GIT_SSH"); command != "" {
+		program = command
+	}
+
+	// options are given only to OpenSSH, other programs get host and command
+	name := program
+	if shell {
+		if fields := strings.Fields(program); len(fields) > 0 {
+			name = fields[0]
+		}
+	}
+	openSSH := strings.TrimSuffix(filepath.Base(name), ".exe") == "ssh"
+	var args []string
+	if openSSH {
+		if version == 2 {
+			args = append(args, "-o", "SendEnv=GIT_PROTOCOL")
+		}
+		if u.Port != "" {
+			args = append(args, "-p", u.Port)
+		}
+	} else if u.Port != "" {
+		return nil, fmt.Errorf("ssh variant of '%s' does not support setting port", name)
+	}
+	host := u.Host
+	if u.User != "" {
+		host = u.User + "@" + host
+	}
+	args = append(args, host, service+" "+shellQuote(u.Path))
+
+	var cmd *exec.Cmd
+	if shell {
+		cmd = exec.Command("sh", append([]string{"-c", program + ` "$@"`, program}, args...)...)
+	} else {
+		cmd = exec.Command(program, args...)
+	}
+	cmd.Env = os.Environ()
+	if version == 2 {
+		cmd.Env = append(cmd.Env, "GIT_PROTOCOL=version=2")
+	}
+	return cmd, nil
+}
+
+// shellQuote quote s with single quotes for POSIX shell.
+func shellQuote(s string) string {
+	s = strings.Replace(s, "'", `'\''`, -1)
+	s = strings.Replace(s, "!", `'\!'`, -1)
+	return "'" + s + "'"
+}
+
+// processConn is a connection to stdin and stdout of a child process.
+type processConn struct {
+	io.Reader
+	stdin io.WriteCloser
+	cmd   *exec.Cmd
+}
+
+func startProcess(cmd *exec.Cmd) (*processConn, error) {
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		return nil, err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := cmd.Start(); err != nil {
+		return nil, err
+	}
+	return &processConn{Reader: stdout, stdin: stdin, cmd: cmd}, nil
+}
+
+func (c *processConn) Write(b []byte) (int, error) {
+	return c.stdin.Write(b)
+}
+
+// Close close stdin and wait for the process to exit.
+func (c *processConn) Close() error {
+	c.stdin.Close()
+	return c.cmd.Wait()
+}
+
+// connectDaemon connect to git daemon and request the service.
+// protocol version 2 is requested by an extra parameter.
+func connectDaemon(u *remoteURL, service string, version int) (io.ReadWriteCloser, error) {
+	port := u.Port
+	if port == "" {
+		port = defaultDaemonPort
+	}
+	conn, err := net.Dial("tcp", net.JoinHostPort(u.Host, port))
+	if err != nil {
+		return nil, err
+	}
+	host := u.Host
+	if u.Port != "" {
+		host = net.JoinHostPort(u.Host, u.Port)
+	}
+	req := fmt.Sprintf("%s %s\x00host=%s\x00", service, u.Path, host)
+	if version == 2 {
+		req += "\x00version=2\x00"
+	}
+	if err := writePktData(conn, []byte(req)); err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return conn, nil
+}
+
+// connectLocal run the service for the repository at path in-process.
+func connectLocal(path, service string, version int) (io.ReadWriteCloser, error) {
+	repo, err := EnterRepository(path)
+	if err != nil {
+		return nil, err
+	}
+	var serve func(r io.Reader, w io.Writer) error
+	switch service {
+	case "git-upload-pack":
+		serve = func(r io.Reader, w io.Writer) error {
+			return UploadPack(repo, r, w, UploadPackOptions{Version: version})
+		}
+	case "git-receive-pack":
+		serve = func(r io.Reader, w io.Writer) error {
+			return ReceivePack(repo, r, w, ReceivePackOptions{})
+		}
+	default:
+		return nil, fmt.Errorf("%s is not supported for local repository", service)
+	}
+
+	toServer, fromClient := newBufferedPipe(), newBufferedPipe()
+	go func() {
+		err := serve(toServer, fromClient)
+		fromClient.CloseWithError(err)
+		toServer.CloseWithError(err)
+	}()
+	return &pipeConn{r: fromClient, w: toServer}, nil
+}
+
+// pipeConn is a connection to a server running in-process.
+type pipeConn struct {
+	r *bufferedPipe
+	w *bufferedPipe
+}
+
+func (c *pipeConn) Read(b []byte) (int, error) {
+	return c.r.Read(b)
+}
+
+func (c *pipeConn) Write(b []byte) (int, error) {
+	return c.w.Write(b)
+}
+
+// Close tell EOF to the server.
+func (c *pipeConn) Close() error {
+	c.w.CloseWithError(nil)
+	c.r.CloseWithError(nil)
+	return nil
+}
+
+// bufferedPipe is an in-memory pipe whose writes never block like a pipe of OS,
+// so that both sides can write requests and responses without deadlock.
+type bufferedPipe struct {
+	mu   sync.Mutex
+	cond *sync.Cond
+	buf  bytes.Buffer
+	err  error
+}
+
+func newBufferedPipe() *bufferedPipe {
+	p := &bufferedPipe{}
+	p.cond = sync.NewCond(&p.mu)
+	return p
+}
+
+func (p *bufferedPipe) Read(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for p.buf.Len() == 0 && p.err == nil {
+		p.cond.Wait()
+	}
+	if p.buf.Len() > 0 {
+		return p.buf.Read(b)
+	}
+	return 0, p.err
+}
+
+func (p *bufferedPipe) Write(b []byte) (int, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return 0, io.ErrClosedPipe
+	}
+	p.cond.Broadcast()
+	return p.buf.Write(b)
+}
+
+// CloseWithError close the pipe. reader gets err after buffered data, or EOF if err is nil.
+// the first error is kept.
+func (p *bufferedPipe) CloseWithError(err error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.err != nil {
+		return
+	}
+	if err == nil {
+		err = io.EOF
+	}
+	p.err = err
+	p.cond.Broadcast()
+}
+
+// EnterRepository open repository served by upload-pack or receive-pack.
+// path, path.git and path/.git are tried like git does.
+func EnterRepository(path string) (*GitRepository, error) {
+	for _, candidate := range []string{path, path + ".git"} {
+		if info, err := os.Stat(candidate); err != nil || !info.IsDir() {
+			continue
+		}
+		if IsGitDir(candidate) || IsGitDir(filepath.Join(candidate, ".git")) {
+			return NewGitRepository(candidate)
+		}
+	}
+	return nil, fmt.Errorf("'%s' does not appear to be a git repository", path)
+}
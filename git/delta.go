@@ -0,0 +1,166 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+)
+
+var errInvalidDelta = errors.New("Invalid delta data")
+
+// applyDelta build an object from base object and delta data of packfile.
+// delta is source size, target size, and sequence of copy and insert instructions.
+func applyDelta(base, delta []byte) ([]byte, error) {
+	srcSize, n := readDeltaSize(delta)
+	if n == 0 || srcSize != uint64(len(base)) {
+		return nil, errInvalidDelta
+	}
+	delta = delta[n:]
+	dstSize, n := readDeltaSize(delta)
+	if n == 0 {
+		return nil, errInvalidDelta
+	}
+	delta = delta[n:]
+	// reject a target size which the instructions can not produce before allocating it.
+	// an instruction byte copies at most 0xffffff bytes of base, or inserts less than itself.
+	perByte := uint64(len(base))
+	if perByte > 0xffffff {
+		perByte = 0xffffff
+	}
+	if perByte < 1 {
+		perByte = 1
+	}
+	if dstSize/perByte > uint64(len(delta)) {
+		return nil, errInvalidDelta
+	}
+
+	result := make([]byte, 0, dstSize)
+	for len(delta) > 0 {
+		op := delta[0]
+		delta = delta[1:]
+		switch {
+		case op&0x80 != 0:
+			// copy from base. bits of op tell which offset and size bytes follow.
+			var offset, size uint64
+			for i := uint(0); i < 4; i++ {
+				if op&(1<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errInvalidDelta
+					}
+					offset |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			for i := uint(0); i < 3; i++ {
+				if op&(0x10<<i) != 0 {
+					if len(delta) == 0 {
+						return nil, errInvalidDelta
+					}
+					size |= uint64(delta[0]) << (8 * i)
+					delta = delta[1:]
+				}
+			}
+			if size == 0 {
+				size = 0x10000
+			}
+			if offset+size > uint64(len(base)) {
+				return nil, errInvalidDelta
+			}
+			result = append(result, base[offset:offset+size]...)
+		case op != 0:
+			// insert following op bytes
+			if int(op) > len(delta) {
+				return nil, errInvalidDelta
+			}
+			result = append(result, delta[:op]...)
+			delta = delta[op:]
+		default:
+			return nil, errInvalidDelta
+		}
+	}
+	if uint64(len(result)) != dstSize {
+		return nil, errInvalidDelta
+	}
+	return result, nil
+}
+
+// readDeltaSize read little endian base 128 number. return 0 bytes read if data is truncated.
+func readDeltaSize(data []byte) (uint64, int) {
+	var size uint64
+	for i, b := range data {
+		size |= uint64(b&0x7f) << (7 * uint(i))
+		if b&0x80 == 0 {
+			return size, i + 1
+		}
+	}
+	return 0, 0
+}
+
+// createDelta make delta data which builds target from base.
+// it finds common prefix and suffix only, that is enough for small changes.
+func createDelta(base, target []byte) []byte {
+	var b bytes.Buffer
+	writeDeltaSize(&b, uint64(len(base)))
+	writeDeltaSize(&b, uint64(len(target)))
+
+	prefix := 0
+	for prefix < len(base) && prefix < len(target) && base[prefix] == target[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(base)-prefix && suffix < len(target)-prefix &&
+		base[len(base)-1-suffix] == target[len(target)-1-suffix] {
+		suffix++
+	}
+
+	writeDeltaCopy(&b, 0, prefix)
+	insert := target[prefix : len(target)-suffix]
+	for len(insert) > 0 {
+		n := len(insert)
+		if n > 0x7f {
+			n = 0x7f
+		}
+		b.WriteByte(byte(n))
+		b.Write(insert[:n])
+		insert = insert[n:]
+	}
+	writeDeltaCopy(&b, len(base)-suffix, suffix)
+	return b.Bytes()
+}
+
+func writeDeltaSize(b *bytes.Buffer, size uint64) {
+	for size >= 0x80 {
+		b.WriteByte(byte(size&0x7f) | 0x80)
+		size >>= 7
+	}
+	b.WriteByte(byte(size))
+}
+
+// writeDeltaCopy write copy instructions. one instruction copies 64KiB at most.
+func writeDeltaCopy(b *bytes.Buffer, offset, size int) {
+	for size > 0 {
+		n := size
+		if n > 0x10000 {
+			n = 0x10000
+		}
+		op := byte(0x80)
+		var args []byte
+		for i := uint(0); i < 4; i++ {
+			if v := byte(offset >> (8 * i)); v != 0 {
+				op |= 1 << i
+				args = append(args, v)
+			}
+		}
+		if n != 0x10000 {
+			for i := uint(0); i < 3; i++ {
+				if v := byte(n >> (8 * i)); v != 0 {
+					op |= 0x10 << i
+					args = append(args, v)
+				}
+			}
+		}
+		b.WriteByte(op)
+		b.Write(args)
+		offset += n
+		size -= n
+	}
+}
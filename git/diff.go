@@ -0,0 +1,125 @@
+package git
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// TreeChange is a changed file between two trees.
+// Old is nil if the file is added, and New is nil if the file is deleted.
+type TreeChange struct {
+	Path string
+	Old  *GitTreeEntry
+	New  *GitTreeEntry
+}
+
+// DiffTrees return changed files between trees recursively, sorted by path.
+// empty tree hash means an empty tree. subtrees themselves are not reported, only files in them.
+func DiffTrees(repo *GitRepository, oldTree, newTree string) ([]*TreeChange, error) {
+	var changes []*TreeChange
+	if err := diffTrees(repo, oldTree, newTree, "", &changes); err != nil {
+		return nil, err
+	}
+	sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	return changes, nil
+}
+
+func diffTrees(repo *GitRepository, oldTree, newTree, prefix string, changes *[]*TreeChange) error {
+	if oldTree == newTree {
+		return nil
+	}
+	oldEntries, err := readTreeEntries(repo, oldTree)
+	if err != nil {
+		return err
+	}
+	newEntries, err := readTreeEntries(repo, newTree)
+	if err != nil {
+		return err
+	}
+
+	// a file and a directory of the same name are different entries
+	type entryKey struct {
+		name string
+		tree bool
+	}
+	olds := map[entryKey]*GitTreeEntry{}
+	for _, e := range oldEntries {
+		olds[entryKey{e.Path, e.IsTree()}] = e
+	}
+	news := map[entryKey]*GitTreeEntry{}
+	for _, e := range newEntries {
+		news[entryKey{e.Path, e.IsTree()}] = e
+	}
+	keys := map[entryKey]bool{}
+	for k := range olds {
+		keys[k] = true
+	}
+	for k := range news {
+		keys[k] = true
+	}
+
+	for k := range keys {
+		o, n := olds[k], news[k]
+		path := prefix + k.name
+		if k.tree {
+			var oldSha, newSha string
+			if o != nil {
+				oldSha = o.Sha
+			}
+			if n != nil {
+				newSha = n.Sha
+			}
+			if err := diffTrees(repo, oldSha, newSha, path+"/", changes); err != nil {
+				return err
+			}
+			continue
+		}
+		if o != nil && n != nil && o.Sha == n.Sha && o.Mode == n.Mode {
+			continue
+		}
+		*changes = append(*changes, &TreeChange{Path: path, Old: o, New: n})
+	}
+	return nil
+}
+
+// readTreeEntries return entries of the tree. empty hash means an empty tree.
+func readTreeEntries(repo *GitRepository, sha string) ([]*GitTreeEntry, error) {
+	if sha == "" {
+		return nil, nil
+	}
+	objType, data, err := ReadObjectData(repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	if objType != "tree" {
+		return nil, fmt.Errorf("%s is a %s, not a tree", sha, objType)
+	}
+	return ParseTree(data), nil
+}
+
+// lookupTreePath return the entry at the path in the tree recursively. nil is returned if it does not exist.
+func lookupTreePath(repo *GitRepository, tree, name string) (*GitTreeEntry, error) {
+	parts := strings.Split(strings.Trim(name, "/"), "/")
+	for i, part := range parts {
+		entries, err := readTreeEntries(repo, tree)
+		if err != nil {
+			return nil, err
+		}
+		var found *GitTreeEntry
+		for _, e := range entries {
+			if e.Path == part {
+				found = e
+				break
+			}
+		}
+		if found == nil || i == len(parts)-1 {
+			return found, nil
+		}
+		if !found.IsTree() {
+			return nil, nil
+		}
+		tree = found.Sha
+	}
+	return nil, nil
+}
@@ -0,0 +1,216 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+)
+
+// ErrRepositoryNotFound is returned when repository discovery fails.
+var ErrRepositoryNotFound = errors.New("not a git repository (or any of the parent directories)")
+
+// DiscoverRepository find the repository which contains path.
+// it honors GIT_DIR, GIT_WORK_TREE, GIT_CEILING_DIRECTORIES and GIT_DISCOVERY_ACROSS_FILESYSTEM,
+// follows gitfile, recognizes bare repositories, and checks safe.directory
+// if the repository is owned by other user.
+func DiscoverRepository(path string) (*GitRepository, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return nil, err
+	}
+
+	var repo *GitRepository
+	if gitDir := os.Getenv("GIT_DIR"); gitDir != "" {
+		repo, err = openExplicitGitDir(gitDir, absPath)
+	} else {
+		repo, err = walkRepository(absPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if workTree := os.Getenv("GIT_WORK_TREE"); workTree != "" {
+		workTree, err := filepath.Abs(workTree)
+		if err != nil {
+			return nil, err
+		}
+		repo.Worktree = workTree
+		repo.Bare = false
+	}
+
+	if err := checkSafeDirectory(repo); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// openExplicitGitDir open repository given by GIT_DIR.
+// worktree is core.worktree, or cwd if core.bare is not true.
+func openExplicitGitDir(gitDir, cwd string) (*GitRepository, error) {
+	gitDir, err := filepath.Abs(gitDir)
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Stat(gitDir)
+	if err != nil {
+		return nil, fmt.Errorf("not a git repository: '%s'", gitDir)
+	}
+	if !info.IsDir() {
+		if gitDir, err = ReadGitFile(gitDir); err != nil {
+			return nil, err
+		}
+	}
+	if !IsGitDir(gitDir) {
+		return nil, fmt.Errorf("not a git repository: '%s'", gitDir)
+	}
+
+	repo := &GitRepository{GitDir: gitDir, Bare: true}
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	if bare, ok := cfg.Get("core", "", "bare"); ok {
+		if isBare, _ := ParseConfigBool(bare); isBare {
+			return repo, nil
+		}
+	}
+	repo.Bare = false
+	repo.Worktree = cwd
+	if worktree, ok := cfg.Get("core", "", "worktree"); ok {
+		if !filepath.IsAbs(worktree) {
+			worktree = filepath.Join(gitDir, worktree)
+		}
+		repo.Worktree = worktree
+	}
+	return repo, nil
+}
+
+// walkRepository find ".git" or bare repository from dir to its parents.
+func walkRepository(dir string) (*GitRepository, error) {
+	ceilings := ceilingDirectories()
+	acrossFS, _ := ParseConfigBool(os.Getenv("GIT_DISCOVERY_ACROSS_FILESYSTEM"))
+	startDev, hasDev := deviceOf(dir)
+
+	for {
+		dotGit := filepath.Join(dir, ".git")
+		if info, err := os.Stat(dotGit); err == nil {
+			if info.IsDir() && IsGitDir(dotGit) {
+				return &GitRepository{Worktree: dir, GitDir: dotGit}, nil
+			}
+			if !info.IsDir() {
+				gitDir, err := ReadGitFile(dotGit)
+				if err != nil {
+					return nil, err
+				}
+				return &GitRepository{Worktree: dir, GitDir: gitDir}, nil
+			}
+		}
+		if IsGitDir(dir) {
+			return openGitDir(dir)
+		}
+
+		parent := filepath.Dir(dir)
+		if parent == dir || ceilings[parent] {
+			break
+		}
+		if dev, ok := deviceOf(parent); hasDev && ok && dev != startDev && !acrossFS {
+			return nil, fmt.Errorf("%w\nStopping at filesystem boundary (GIT_DISCOVERY_ACROSS_FILESYSTEM not set).", ErrRepositoryNotFound)
+		}
+		dir = parent
+	}
+	return nil, ErrRepositoryNotFound
+}
+
+// ceilingDirectories return set of GIT_CEILING_DIRECTORIES. relative paths are ignored.
+func ceilingDirectories() map[string]bool {
+	ceilings := map[string]bool{}
+	for _, dir := range filepath.SplitList(os.Getenv("GIT_CEILING_DIRECTORIES")) {
+		if dir == "" || !filepath.IsAbs(dir) {
+			continue
+		}
+		ceilings[filepath.Clean(dir)] = true
+		if resolved, err := filepath.EvalSymlinks(dir); err == nil {
+			ceilings[resolved] = true
+		}
+	}
+	return ceilings
+}
+
+func deviceOf(path string) (uint64, bool) {
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, false
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return 0, false
+	}
+	return uint64(stat.Dev), true
+}
+
+// checkSafeDirectory reject repository owned by other user unless it is listed in safe.directory.
+// safe.directory is read only from system, global and command line config.
+func checkSafeDirectory(repo *GitRepository) error {
+	dir := repo.Worktree
+	if repo.Bare || dir == "" {
+		dir = repo.GitDir
+	}
+	if ownedByCurrentUser(dir) && (dir == repo.GitDir || ownedByCurrentUser(repo.GitDir)) {
+		return nil
+	}
+
+	cfg, err := LoadConfig(nil)
+	if err != nil {
+		return err
+	}
+	safe := false
+	for _, v := range cfg.GetAll("safe.directory") {
+		switch {
+		case v == "":
+			// empty value resets the list
+			safe = false
+		case v == "*":
+			safe = true
+		case strings.HasSuffix(v, "/*"):
+			prefix := ExpandConfigPath(strings.TrimSuffix(v, "*"))
+			if strings.HasPrefix(dir+"/", prefix) {
+				safe = true
+			}
+		case filepath.Clean(ExpandConfigPath(v)) == filepath.Clean(dir):
+			safe = true
+		}
+	}
+	if safe {
+		return nil
+	}
+	return fmt.Errorf("detected dubious ownership in repository at '%s'\n"+
+		"To add an exception for this directory, call:\n\n"+
+		"\tmygit config --global --add safe.directory %s", dir, dir)
+}
+
+// ownedByCurrentUser return true if path is owned by effective user.
+// when running as root via sudo, SUDO_UID is also accepted.
+func ownedByCurrentUser(path string) bool {
+	info, err := os.Stat(path)
+	if err != nil {
+		return true
+	}
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return true
+	}
+	euid := os.Geteuid()
+	if int(stat.Uid) == euid {
+		return true
+	}
+	if euid == 0 {
+		if sudo, err := strconv.Atoi(os.Getenv("SUDO_UID")); err == nil && int(stat.Uid) == sudo {
+			return true
+		}
+	}
+	return false
+}
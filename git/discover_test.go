@@ -0,0 +1,85 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiscoverRepository(t *testing.T) {
+	temp := newTempDir(t)
+	defer os.RemoveAll(temp)
+	worktree := filepath.Join(temp, "work")
+	sub := filepath.Join(worktree, "a", "b")
+	_ = os.MkdirAll(sub, 0755)
+	_, err := InitRepository(worktree, InitOptions{})
+	assert.NoError(t, err)
+
+	repo, err := DiscoverRepository(sub)
+	assert.NoError(t, err)
+	assert.Equal(t, worktree, repo.Worktree)
+	assert.Equal(t, filepath.Join(worktree, ".git"), repo.GitDir)
+
+	// ceiling directory stops discovery above it
+	os.Setenv("GIT_CEILING_DIRECTORIES", filepath.Join(worktree, "a"))
+	_, err = DiscoverRepository(sub)
+	os.Unsetenv("GIT_CEILING_DIRECTORIES")
+	assert.Error(t, err)
+
+	// the directory which has .git is still found when it is ceiling itself
+	os.Setenv("GIT_CEILING_DIRECTORIES", worktree)
+	_, err = DiscoverRepository(worktree)
+	os.Unsetenv("GIT_CEILING_DIRECTORIES")
+	assert.NoError(t, err)
+}
+
+func TestDiscoverRepositoryBareAndGitFile(t *testing.T) {
+	temp := newTempDir(t)
+	defer os.RemoveAll(temp)
+	bare := filepath.Join(temp, "bare.git")
+	_, err := InitRepository(bare, InitOptions{Bare: true})
+	assert.NoError(t, err)
+
+	repo, err := DiscoverRepository(filepath.Join(bare, "refs", "heads"))
+	assert.NoError(t, err)
+	assert.True(t, repo.Bare)
+	assert.Equal(t, bare, repo.GitDir)
+
+	linked := filepath.Join(temp, "linked")
+	_ = os.MkdirAll(linked, 0755)
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(linked, ".git"), []byte("gitdir: ../bare.git\n"), 0644))
+	repo, err = DiscoverRepository(linked)
+	assert.NoError(t, err)
+	assert.Equal(t, linked, repo.Worktree)
+	assert.Equal(t, bare, filepath.Clean(repo.GitDir))
+}
+
+func TestDiscoverRepositoryEnv(t *testing.T) {
+	temp := newTempDir(t)
+	defer os.RemoveAll(temp)
+	gitDir := filepath.Join(temp, "repo", ".git")
+	other := filepath.Join(temp, "other")
+	_ = os.MkdirAll(other, 0755)
+	_, err := InitRepository(filepath.Dir(gitDir), InitOptions{})
+	assert.NoError(t, err)
+
+	os.Setenv("GIT_DIR", gitDir)
+	defer os.Unsetenv("GIT_DIR")
+	repo, err := DiscoverRepository(other)
+	assert.NoError(t, err)
+	assert.Equal(t, gitDir, repo.GitDir)
+	assert.Equal(t, other, repo.Worktree)
+
+	os.Setenv("GIT_WORK_TREE", temp)
+	defer os.Unsetenv("GIT_WORK_TREE")
+	repo, err = DiscoverRepository(other)
+	assert.NoError(t, err)
+	assert.Equal(t, temp, repo.Worktree)
+
+	os.Setenv("GIT_DIR", other)
+	_, err = DiscoverRepository(other)
+	assert.Error(t, err)
+}
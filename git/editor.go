@@ -0,0 +1,115 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"strings"
+)
+
+// Editor return the editor command from GIT_EDITOR, core.editor, VISUAL or EDITOR. "vi" is the default.
+func Editor(repo *GitRepository) (string, error) {
+	if editor := os.Getenv("GIT_EDITOR"); editor != "" {
+		return editor, nil
+	}
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return "", err
+	}
+	if editor := cfg.GetString("core.editor", ""); editor != "" {
+		return editor, nil
+	}
+	for _, env := range []string{"VISUAL", "EDITOR"} {
+		if editor := os.Getenv(env); editor != "" {
+			return editor, nil
+		}
+	}
+	return "vi", nil
+}
+
+// SequenceEditor return the editor command for rebase todo lists from GIT_SEQUENCE_EDITOR or sequence.editor.
+// Editor is used if neither is set.
+func SequenceEditor(repo *GitRepository) (string, error) {
+	if editor := os.Getenv("GIT_SEQUENCE_EDITOR"); editor != "" {
+		return editor, nil
+	}
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return "", err
+	}
+	if editor := cfg.GetString("sequence.editor", ""); editor != "" {
+		return editor, nil
+	}
+	return Editor(repo)
+}
+
+// LaunchEditor run the editor command on file through the shell, and wait for it to exit.
+// ":" is an editor which leaves the file as it is.
+func LaunchEditor(repo *GitRepository, editor, file string) error {
+	if editor == ":" {
+		return nil
+	}
+	cmd := exec.Command("sh", "-c", editor+` "$@"`, editor, file)
+	cmd.Dir = repo.Worktree
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("There was a problem with the editor '%s'.", editor)
+	}
+	return nil
+}
+
+// EditCommitMessage let the user edit message in COMMIT_EDITMSG, and return the cleaned up message.
+func EditCommitMessage(repo *GitRepository, message string) (string, error) {
+	file := repo.RepoPath("COMMIT_EDITMSG")
+	help := "\n# Please enter the commit message for your changes. Lines starting\n" +
+		"# with '#' will be ignored, and an empty message aborts the commit.\n#\n"
+	if err := ioutil.WriteFile(file, []byte(message+help), 0644); err != nil {
+		return "", err
+	}
+	editor, err := Editor(repo)
+	if err != nil {
+		return "", err
+	}
+	if err := LaunchEditor(repo, editor, file); err != nil {
+		return "", err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+	message = CleanupMessage(string(data), true)
+	if message == "" {
+		return "", fmt.Errorf("Aborting commit due to empty commit message.")
+	}
+	return message, nil
+}
+
+// CleanupMessage remove trailing whitespaces, leading and trailing blank lines, and collapse consecutive blank lines.
+// comment lines starting with '#' are also removed if stripComments is true.
+// the result ends with a newline unless it is empty.
+func CleanupMessage(message string, stripComments bool) string {
+	var lines []string
+	blank := false
+	for _, line := range strings.Split(message, "\n") {
+		if stripComments && strings.HasPrefix(line, "#") {
+			continue
+		}
+		line = strings.TrimRight(line, " \t\r")
+		if line == "" {
+			blank = len(lines) > 0
+			continue
+		}
+		if blank {
+			lines = append(lines, "")
+			blank = false
+		}
+		lines = append(lines, line)
+	}
+	if len(lines) == 0 {
+		return ""
+	}
+	return strings.Join(lines, "\n") + "\n"
+}
@@ -0,0 +1,422 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+)
+
+// maxNegotiationHaves is the number of local commits told to remote while fetching.
+const maxNegotiationHaves = 256
+
+// ResolveRemote return name and URL of remote. remote is a configured remote name or URL.
+// name is empty if remote is given by URL.
+func ResolveRemote(repo *GitRepository, remote string) (string, string, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return "", "", err
+	}
+	if url, ok := cfg.Get("remote." + remote + ".url"); ok {
+		return remote, url, nil
+	}
+	if IsRemoteURL(remote) {
+		return "", remote, nil
+	}
+	return "", "", fmt.Errorf("'%s' does not appear to be a git repository", remote)
+}
+
+// newTransport return transport for url. protocol.version and core.sshCommand config are honored.
+func newTransport(repo *GitRepository, url string, progress io.Writer) (Transport, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	version, err := cfg.GetInt("protocol.version", 2)
+	if err != nil {
+		return nil, err
+	}
+	return NewTransport(url, TransportOptions{
+		ProtocolVersion: int(version),
+		Progress:        progress,
+		SSHCommand:      cfg.GetString("core.sshCommand", ""),
+		Repository:      repo,
+	})
+}
+
+// FetchOptions is options of Fetch.
+type FetchOptions struct {
+	// Refspecs are used instead of remote.<name>.fetch config.
+	Refspecs []string
+	// Prune delete remote-tracking refs which no longer exist on remote.
+	// fetch.prune and remote.<name>.prune config enable it too.
+	Prune bool
+	// Depth, ShallowSince and ShallowExclude deepen or shorten history of a shallow repository.
+	ShallowOptions
+	// Unshallow fetch all history of a shallow repository.
+	Unshallow bool
+	// Filter is a filter spec of partial clone. remote.<name>.partialclonefilter is used by default.
+	Filter   string
+	Progress io.Writer
+}
+
+// ShallowOptions limit history fetched from remote.
+// commits beyond Depth from the fetched refs, older than ShallowSince or reachable from ShallowExclude are not fetched.
+type ShallowOptions struct {
+	Depth          int
+	ShallowSince   time.Time
+	ShallowExclude []string
+}
+
+// fetchRequest return request of objects with shallow options and filter.
+func (o ShallowOptions) fetchRequest(filter string) *FetchRequest {
+	req := &FetchRequest{Depth: o.Depth, DeepenNot: o.ShallowExclude, Filter: filter}
+	if !o.ShallowSince.IsZero() {
+		req.DeepenSince = o.ShallowSince.Unix()
+	}
+	return req
+}
+
+// FetchedRef is a ref updated by fetch.
+// Local is empty if the ref is recorded only to FETCH_HEAD.
+// New is empty if the local ref is pruned.
+// Rejected is true if the update is not fast-forward and the refspec does not force it.
+type FetchedRef struct {
+	Remote   string
+	Local    string
+	Old      string
+	New      string
+	Forced   bool
+	Rejected bool
+	force    bool
+	merge    bool
+}
+
+// IsNew return true if the local ref is created by fetch.
+func (r *FetchedRef) IsNew() bool {
+	return r.Old == "" && r.Local != ""
+}
+
+// IsUpToDate return true if the local ref is not changed.
+func (r *FetchedRef) IsUpToDate() bool {
+	return r.Old == r.New && r.Local != ""
+}
+
+// IsPruned return true if the local ref is deleted because it does not exist on remote.
+func (r *FetchedRef) IsPruned() bool {
+	return r.New == ""
+}
+
+// Fetch download objects and refs from remote, then update local refs by refspecs.
+// refspecs are remote.<name>.fetch config unless opts.Refspecs is given, and HEAD is fetched if there are none.
+// tags which do not exist locally are stored unless opts.Refspecs is given.
+// all fetched refs are recorded to FETCH_HEAD.
+func Fetch(repo *GitRepository, remote string, opts FetchOptions) ([]*FetchedRef, error) {
+	name, url, err := ResolveRemote(repo, remote)
+	if err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	specs := opts.Refspecs
+	if len(specs) == 0 && name != "" {
+		specs = cfg.GetAll("remote." + name + ".fetch")
+	}
+	followTags := len(opts.Refspecs) == 0
+	if len(specs) == 0 {
+		specs = []string{"HEAD"}
+	}
+	refspecs, err := ParseRefspecs(specs)
+	if err != nil {
+		return nil, err
+	}
+	prune, err := cfg.GetBool("fetch.prune", false)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		if prune, err = cfg.GetBool("remote."+name+".prune", prune); err != nil {
+			return nil, err
+		}
+	}
+	prune = prune || opts.Prune
+	if opts.Unshallow {
+		if opts.Depth > 0 {
+			return nil, fmt.Errorf("--depth and --unshallow cannot be used together")
+		}
+		if !IsShallowRepository(repo) {
+			return nil, fmt.Errorf("--unshallow on a complete repository does not make sense")
+		}
+		opts.Depth = infiniteDepth
+	}
+	if opts.Filter == "" && name != "" {
+		opts.Filter = cfg.GetString("remote."+name+".partialclonefilter", "")
+	}
+
+	transport, err := newTransport(repo, url, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.Close()
+	adv, err := transport.FetchRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	updates, err := mapFetchRefspecs(repo, refspecs, adv, len(opts.Refspecs) > 0)
+	if err != nil {
+		return nil, err
+	}
+	if followTags {
+		mapped := map[string]bool{}
+		for _, u := range updates {
+			mapped[u.Local] = true
+		}
+		for _, ref := range adv.Refs {
+			if !strings.HasPrefix(ref.Name, "refs/tags/") || strings.HasSuffix(ref.Name, "^{}") || mapped[ref.Name] {
+				continue
+			}
+			if _, err := ReadRef(repo, ref.Name); err != nil {
+				updates = append(updates, &FetchedRef{Remote: ref.Name, Local: ref.Name, New: ref.Sha})
+			}
+		}
+	}
+	if err := fetchRefs(repo, transport, adv, updates, opts.fetchRequest(opts.Filter)); err != nil {
+		return nil, err
+	}
+
+	msg := "fetch"
+	if remote != "" {
+		msg += " " + remote
+	}
+	if prune {
+		stale, err := staleTrackingRefs(repo, refspecs, adv)
+		if err != nil {
+			return nil, err
+		}
+		for _, ref := range stale {
+			if err := DeleteRef(repo, ref.Name); err != nil {
+				return nil, err
+			}
+			updates = append(updates, &FetchedRef{Local: ref.Name, Old: ref.Sha})
+		}
+	}
+	if err := updateFetchedRefs(repo, updates, msg); err != nil {
+		return nil, err
+	}
+	if err := writeFetchHead(repo, url, updates); err != nil {
+		return nil, err
+	}
+	return updates, nil
+}
+
+// mapFetchRefspecs return updates of local refs for remote refs matched by refspecs.
+// a refspec without "*" must match a remote ref. merge is the refs marked for merge in FETCH_HEAD,
+// which are non-pattern refspecs given explicitly or upstream of the current branch.
+func mapFetchRefspecs(repo *GitRepository, refspecs []*Refspec, adv *RefAdvertisement, explicit bool) ([]*FetchedRef, error) {
+	upstream := ""
+	if current, err := CurrentBranch(repo); err == nil && current != "" && !explicit {
+		cfg, err := LoadConfig(repo)
+		if err != nil {
+			return nil, err
+		}
+		upstream = cfg.GetString("branch."+strings.TrimPrefix(current, branchPrefix)+".merge", "")
+	}
+
+	var updates []*FetchedRef
+	for _, r := range refspecs {
+		if r.Negative {
+			continue
+		}
+		matched := false
+		for _, ref := range adv.Refs {
+			if ref.Sha == "" || strings.HasSuffix(ref.Name, "^{}") || excludedByRefspecs(refspecs, ref.Name) {
+				continue
+			}
+			local, ok := r.MapSrc(ref.Name)
+			if !ok {
+				continue
+			}
+			matched = true
+			if local != "" && !strings.HasPrefix(local, "refs/") && local != "HEAD" {
+				if strings.HasPrefix(ref.Name, "refs/tags/") {
+					local = "refs/tags/" + local
+				} else {
+					local = branchPrefix + local
+				}
+			}
+			u := &FetchedRef{Remote: ref.Name, Local: local, New: ref.Sha, force: r.Force}
+			u.merge = (explicit && !r.IsPattern()) || (upstream != "" && ref.Name == upstream) || (!explicit && r.Src == "HEAD")
+			if local != "" {
+				u.Old, _ = ResolveRef(repo, local)
+			}
+			updates = append(updates, u)
+			if !r.IsPattern() {
+				break
+			}
+		}
+		if !matched && !r.IsPattern() {
+			return nil, fmt.Errorf("couldn't find remote ref %s", r.Src)
+		}
+	}
+	return updates, nil
+}
+
+// fetchRefs fetch objects of remote refs which do not exist locally, and update .git/shallow.
+// all refs are wanted if req deepens history, because history of existing commits may change.
+func fetchRefs(repo *GitRepository, transport Transport, adv *RefAdvertisement, updates []*FetchedRef, req *FetchRequest) error {
+	wanted := map[string]bool{}
+	for _, u := range updates {
+		if (req.deepen() || !HasObject(repo, u.New)) && !wanted[u.New] {
+			wanted[u.New] = true
+			req.Wants = append(req.Wants, u.New)
+		}
+	}
+	if len(req.Wants) == 0 {
+		return nil
+	}
+	shallow, err := ReadShallow(repo)
+	if err != nil {
+		return err
+	}
+	req.Shallow = shallow
+	req.Haves = negotiationHaves(repo)
+
+	res, err := transport.FetchPack(adv, req)
+	if err != nil {
+		return err
+	}
+	defer res.Close()
+	// packfiles of bundles may be thin
+	pack, err := IndexPack(repo, res, true)
+	if err != nil {
+		return err
+	}
+	if IsPartialClone(repo) {
+		if err := markPromisorPack(repo, pack); err != nil {
+			return err
+		}
+	}
+	if err := updateShallow(repo, res.ShallowInfo); err != nil {
+		return err
+	}
+	for _, sha := range req.Wants {
+		if !HasObject(repo, sha) {
+			return fmt.Errorf("Remote did not send all necessary objects: %s", sha)
+		}
+	}
+	return nil
+}
+
+// remoteRefUpdates return updates of local refs for remote refs whose local name is given by mapping.
+// refs which mapping returns empty name are skipped.
+func remoteRefUpdates(repo *GitRepository, adv *RefAdvertisement, mapping func(string) string) []*FetchedRef {
+	var updates []*FetchedRef
+	for _, ref := range adv.Refs {
+		local := mapping(ref.Name)
+		if local == "" || ref.Sha == "" {
+			continue
+		}
+		old, _ := ResolveRef(repo, local)
+		updates = append(updates, &FetchedRef{Remote: ref.Name, Local: local, Old: old, New: ref.Sha})
+	}
+	return updates
+}
+
+// updateFetchedRefs update local refs and mark forced updates.
+// non-fast-forward update is rejected unless its refspec has "+".
+func updateFetchedRefs(repo *GitRepository, updates []*FetchedRef, msg string) error {
+	for _, u := range updates {
+		if u.Local == "" || u.IsPruned() || u.IsUpToDate() {
+			continue
+		}
+		reason := "storing head"
+		switch {
+		case strings.HasPrefix(u.Local, "refs/tags/"):
+			reason = "storing tag"
+		case u.Old != "":
+			if ok, _ := IsAncestor(repo, u.Old, u.New); ok {
+				reason = "fast-forward"
+			} else if u.force {
+				reason = "forced-update"
+				u.Forced = true
+			} else {
+				u.Rejected = true
+				continue
+			}
+		}
+		if err := UpdateRef(repo, u.Local, u.New, msg+": "+reason); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// negotiationHaves return local commits told to remote as "have".
+// tips of all refs come first, then their ancestors.
+func negotiationHaves(repo *GitRepository) []string {
+	refs, _ := ListRefs(repo, "refs/")
+	var queue []string
+	seen := map[string]bool{}
+	for _, ref := range refs {
+		if ref.Sha != "" && !seen[ref.Sha] {
+			seen[ref.Sha] = true
+			queue = append(queue, ref.Sha)
+		}
+	}
+
+	var haves []string
+	for len(queue) > 0 && len(haves) < maxNegotiationHaves {
+		sha := queue[0]
+		queue = queue[1:]
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			// tags may point non-commit objects
+			continue
+		}
+		haves = append(haves, sha)
+		for _, parent := range commit.Parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return haves
+}
+
+// writeFetchHead record fetched refs to FETCH_HEAD. refs marked for merge come first.
+func writeFetchHead(repo *GitRepository, url string, updates []*FetchedRef) error {
+	url = AnonymizeURL(url)
+	var refs []*FetchedRef
+	for _, u := range updates {
+		if u.Remote != "" {
+			refs = append(refs, u)
+		}
+	}
+	sort.SliceStable(refs, func(i, j int) bool { return refs[i].merge && !refs[j].merge })
+	var b bytes.Buffer
+	for _, ref := range refs {
+		flag := "not-for-merge"
+		if ref.merge {
+			flag = ""
+		}
+		var desc string
+		switch {
+		case ref.Remote == "HEAD":
+			desc = url
+		case strings.HasPrefix(ref.Remote, branchPrefix):
+			desc = fmt.Sprintf("branch '%s' of %s", strings.TrimPrefix(ref.Remote, branchPrefix), url)
+		case strings.HasPrefix(ref.Remote, "refs/tags/"):
+			desc = fmt.Sprintf("tag '%s' of %s", strings.TrimPrefix(ref.Remote, "refs/tags/"), url)
+		default:
+			desc = fmt.Sprintf("'%s' of %s", ref.Remote, url)
+		}
+		fmt.Fprintf(&b, "%s\t%s\t%s\n", ref.New, flag, desc)
+	}
+	return repo.SaveRepoFile("FETCH_HEAD", b.Bytes())
+}
@@ -0,0 +1,83 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// ObjectFilter omits objects from packfile for partial clone.
+// "blob:none" omits all blobs, "blob:limit=<n>[kmg]" omits blobs of size at least n bytes,
+// and "tree:<depth>" omits blobs and trees whose depth from the root tree is at least depth.
+type ObjectFilter struct {
+	Spec string
+	// BlobLimit is the size of the smallest omitted blob. it is -1 if blobs are not filtered by size.
+	BlobLimit int64
+	// TreeDepth is -1 if trees are not filtered.
+	TreeDepth int
+}
+
+// ParseObjectFilter parse filter spec.
+func ParseObjectFilter(spec string) (*ObjectFilter, error) {
+	f := &ObjectFilter{Spec: spec, BlobLimit: -1, TreeDepth: -1}
+	switch {
+	case spec == "blob:none":
+		f.BlobLimit = 0
+	case strings.HasPrefix(spec, "blob:limit="):
+		limit, err := parseSizeUnit(strings.TrimPrefix(spec, "blob:limit="))
+		if err != nil {
+			return nil, fmt.Errorf("invalid filter-spec '%s'", spec)
+		}
+		f.BlobLimit = limit
+	case strings.HasPrefix(spec, "tree:"):
+		depth, err := strconv.Atoi(strings.TrimPrefix(spec, "tree:"))
+		if err != nil || depth < 0 {
+			return nil, fmt.Errorf("invalid filter-spec '%s'", spec)
+		}
+		f.TreeDepth = depth
+	default:
+		return nil, fmt.Errorf("invalid filter-spec '%s'", spec)
+	}
+	return f, nil
+}
+
+// parseSizeUnit parse size with optional unit k, m or g.
+func parseSizeUnit(s string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	unit := int64(1)
+	switch strings.ToLower(s[len(s)-1:]) {
+	case "k":
+		unit = 1 << 10
+	case "m":
+		unit = 1 << 20
+	case "g":
+		unit = 1 << 30
+	}
+	if unit != 1 {
+		s = s[:len(s)-1]
+	}
+	n, err := strconv.ParseInt(s, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("Invalid size: %s", s)
+	}
+	return n * unit, nil
+}
+
+// omitTree return true if a tree at depth is omitted. the root tree of a commit is at depth 0.
+func (f *ObjectFilter) omitTree(depth int) bool {
+	return f != nil && f.TreeDepth >= 0 && depth >= f.TreeDepth
+}
+
+// omitBlob return true if a blob of size at depth is omitted.
+// size is required only if the filter has a size limit.
+func (f *ObjectFilter) omitBlob(depth int, size func() int64) bool {
+	if f == nil {
+		return false
+	}
+	if f.TreeDepth >= 0 && depth >= f.TreeDepth {
+		return true
+	}
+	return f.BlobLimit == 0 || f.BlobLimit > 0 && size() >= f.BlobLimit
+}
@@ -0,0 +1,367 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// gcPidExpire is the age of gc.pid after which the gc is regarded as dead.
+const gcPidExpire = 12 * time.Hour
+
+// pseudoRefs are refs outside of refs/ whose objects are kept by gc.
+var pseudoRefs = []string{"HEAD", "ORIG_HEAD", "MERGE_HEAD", "CHERRY_PICK_HEAD", "REVERT_HEAD"}
+
+// GCOptions is options of GC.
+type GCOptions struct {
+	// PruneExpire is the expiry of unreachable loose objects. gc.pruneExpire or "2.weeks.ago" is used if empty.
+	PruneExpire string
+	// Force run gc even if another gc seems to be running.
+	Force bool
+}
+
+// GC clean up the repository. refs are packed into packed-refs, old reflog entries are expired,
+// reachable objects are packed into one packfile, and unreachable loose objects older than
+// PruneExpire are removed with stale temporary files. commit-graph is written unless gc.writeCommitGraph is false.
+// gc.pid is locked while running, so that gc does not run concurrently.
+func GC(repo *GitRepository, opts GCOptions) error {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	if opts.PruneExpire == "" {
+		opts.PruneExpire = cfg.GetString("gc.pruneExpire", "2.weeks.ago")
+	}
+	pruneExpire, err := ParseExpiry(opts.PruneExpire, now)
+	if err != nil {
+		return err
+	}
+	reflogExpire, err := ParseExpiry(cfg.GetString("gc.reflogExpire", "90.days.ago"), now)
+	if err != nil {
+		return err
+	}
+	reflogExpireUnreachable, err := ParseExpiry(cfg.GetString("gc.reflogExpireUnreachable", "30.days.ago"), now)
+	if err != nil {
+		return err
+	}
+
+	unlock, err := lockGC(repo, opts.Force, now)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if err := PackRefs(repo, true); err != nil {
+		return err
+	}
+	names, err := ListReflogs(repo)
+	if err != nil {
+		return err
+	}
+	for _, name := range names {
+		if _, err := ExpireReflog(repo, name, reflogExpire, reflogExpireUnreachable, false); err != nil {
+			return err
+		}
+	}
+
+	reachable, err := reachableObjects(repo)
+	if err != nil {
+		return err
+	}
+	if err := repack(repo, reachable, pruneExpire); err != nil {
+		return err
+	}
+	if _, err := PruneObjects(repo, reachable, pruneExpire, false); err != nil {
+		return err
+	}
+	if err := removeStaleTempFiles(repo, pruneExpire); err != nil {
+		return err
+	}
+	writeGraph, err := cfg.GetBool("gc.writeCommitGraph", true)
+	if err != nil || !writeGraph {
+		return err
+	}
+	return WriteCommitGraph(repo, CommitGraphOptions{Reachable: true})
+}
+
+// NeedsAutoGC return true if there are more loose objects than gc.auto (default 6700),
+// or more packs than gc.autoPackLimit (default 50). gc.auto=0 disables automatic gc.
+func NeedsAutoGC(repo *GitRepository) (bool, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return false, err
+	}
+	auto, err := cfg.GetInt("gc.auto", 6700)
+	if err != nil || auto <= 0 {
+		return false, err
+	}
+	// loose objects are estimated from one of 256 directories like git
+	files, err := ioutil.ReadDir(repo.RepoPath("objects/17"))
+	if err != nil && !os.IsNotExist(err) {
+		return false, err
+	}
+	loose := 0
+	for _, f := range files {
+		if len(f.Name()) == 38 && isHex(f.Name()) {
+			loose++
+		}
+	}
+	if int64(loose) > (auto+255)/256 {
+		return true, nil
+	}
+
+	packLimit, err := cfg.GetInt("gc.autoPackLimit", 50)
+	if err != nil || packLimit <= 0 {
+		return false, err
+	}
+	indexes, err := listPackIndexes(repo)
+	if err != nil {
+		return false, err
+	}
+	packs := 0
+	for _, idx := range indexes {
+		if !isKeptPack(idx) {
+			packs++
+		}
+	}
+	return int64(packs) > packLimit, nil
+}
+
+// lockGC write gc.pid and return function which removes it.
+// it fails if gc.pid is written recently by a running process, unless force is true.
+func lockGC(repo *GitRepository, force bool, now time.Time) (func(), error) {
+	path := repo.RepoPath("gc.pid")
+	hostname, _ := os.Hostname()
+	if info, err := os.Stat(path); err == nil && !force && now.Sub(info.ModTime()) < gcPidExpire {
+		data, _ := ioutil.ReadFile(path)
+		fields := strings.Fields(string(data))
+		if len(fields) == 2 {
+			pid, _ := strconv.Atoi(fields[0])
+			if fields[1] != hostname || syscall.Kill(pid, 0) == nil {
+				return nil, fmt.Errorf("gc is already running on machine '%s' pid %d (use --force if not)", fields[1], pid)
+			}
+		}
+	}
+	if err := writeLockedFile(path, []byte(fmt.Sprintf("%d %s", os.Getpid(), hostname))); err != nil {
+		return nil, err
+	}
+	return func() { os.Remove(path) }, nil
+}
+
+// reachableObjects return objects reachable from refs, pseudo refs like HEAD, reflogs and index.
+// objects missing in partial clone are not fetched.
+func reachableObjects(repo *GitRepository) (map[string]bool, error) {
+	var tips []string
+	refs, err := ListRefs(repo, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range refs {
+		tips = append(tips, ref.Sha)
+	}
+	for _, name := range pseudoRefs {
+		if sha, err := ResolveRef(repo, name); err == nil {
+			tips = append(tips, sha)
+		}
+	}
+	names, err := ListReflogs(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		entries, err := ReadReflog(repo, name)
+		if err != nil {
+			return nil, err
+		}
+		for _, e := range entries {
+			tips = append(tips, e.Old, e.New)
+		}
+	}
+	if index, err := ReadIndex(repo); err == nil {
+		for _, e := range index.Entries {
+			if e.Mode&modeTypeMask != ModeGitlink {
+				tips = append(tips, e.ObjectID)
+			}
+		}
+	}
+
+	reachable := map[string]bool{}
+	for _, sha := range tips {
+		if sha == "" || sha == zeroSha || !HasObject(repo, sha) {
+			continue
+		}
+		if err := walkObjects(repo, sha, reachable, objectWalk{skipMissing: true}, nil); err != nil {
+			return nil, err
+		}
+	}
+	return reachable, nil
+}
+
+// isKeptPack return true if the pack is not repacked. packs with .keep file and
+// packs fetched from promisor remote are kept.
+func isKeptPack(idx *packIndex) bool {
+	base := strings.TrimSuffix(idx.packPath, ".pack")
+	for _, ext := range []string{".keep", ".promisor"} {
+		if _, err := os.Stat(base + ext); err == nil {
+			return true
+		}
+	}
+	return false
+}
+
+// repack pack reachable objects into one packfile, and remove old packs and loose objects in it.
+// unreachable objects in old packs are written as loose objects unless the pack is older than expire,
+// so that they are pruned after the grace period.
+func repack(repo *GitRepository, reachable map[string]bool, expire time.Time) error {
+	indexes, err := listPackIndexes(repo)
+	if err != nil {
+		return err
+	}
+	kept := map[string]bool{}
+	var old []*packIndex
+	for _, idx := range indexes {
+		if !isKeptPack(idx) {
+			old = append(old, idx)
+			continue
+		}
+		for _, sha := range idx.objects() {
+			kept[sha] = true
+		}
+	}
+
+	var objects []string
+	for sha := range reachable {
+		if !kept[sha] && HasObject(repo, sha) {
+			objects = append(objects, sha)
+		}
+	}
+	newPack := ""
+	if len(objects) > 0 {
+		var b bytes.Buffer
+		if err := WritePack(repo, &b, objects); err != nil {
+			return err
+		}
+		if newPack, err = IndexPack(repo, &b, false); err != nil {
+			return err
+		}
+	}
+
+	for _, idx := range old {
+		base := strings.TrimSuffix(idx.packPath, ".pack")
+		if filepath.Base(base) == "pack-"+newPack {
+			continue
+		}
+		// multi-pack-index refers to the removed packs
+		if err := removeMultiPackIndex(repo); err != nil {
+			return err
+		}
+		info, err := os.Stat(idx.packPath)
+		if err != nil {
+			return err
+		}
+		if info.ModTime().After(expire) {
+			for _, sha := range idx.objects() {
+				if reachable[sha] || kept[sha] {
+					continue
+				}
+				if err := loosenObject(repo, sha, info.ModTime()); err != nil {
+					return err
+				}
+			}
+		}
+		if err := removePack(idx.packPath); err != nil {
+			return err
+		}
+	}
+
+	for _, sha := range objects {
+		if err := os.Remove(repo.RepoPath(objectPath(sha))); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// loosenObject write the packed object as a loose object whose modification time is mtime.
+func loosenObject(repo *GitRepository, sha string, mtime time.Time) error {
+	path := repo.RepoPath(objectPath(sha))
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+	objType, data, err := readPackedObject(repo, sha)
+	if err != nil {
+		return err
+	}
+	if err := repo.SaveRepoFile(objectPath(sha), compressZlib(append(objectHeader(objType, len(data)), data...))); err != nil {
+		return err
+	}
+	return os.Chtimes(path, mtime, mtime)
+}
+
+// PruneObjects remove loose objects which are not in reachable and older than expire.
+// return pruned objects, which are not removed if dryRun is true.
+func PruneObjects(repo *GitRepository, reachable map[string]bool, expire time.Time, dryRun bool) ([]string, error) {
+	dirs, err := ioutil.ReadDir(repo.RepoPath("objects"))
+	if err != nil {
+		return nil, err
+	}
+	var pruned []string
+	for _, dir := range dirs {
+		if !dir.IsDir() || len(dir.Name()) != 2 || !isHex(dir.Name()) {
+			continue
+		}
+		path := repo.RepoPath(filepath.Join("objects", dir.Name()))
+		files, err := ioutil.ReadDir(path)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range files {
+			sha := dir.Name() + f.Name()
+			if !isHexSha(sha) || reachable[sha] || !f.ModTime().Before(expire) {
+				continue
+			}
+			pruned = append(pruned, sha)
+			if dryRun {
+				continue
+			}
+			if err := os.Remove(filepath.Join(path, f.Name())); err != nil {
+				return nil, err
+			}
+		}
+		if !dryRun {
+			// fails unless the directory is empty
+			os.Remove(path)
+		}
+	}
+	return pruned, nil
+}
+
+// removeStaleTempFiles remove temporary files in objects directory which are older than expire.
+// they are left by interrupted writes of objects and packs.
+func removeStaleTempFiles(repo *GitRepository, expire time.Time) error {
+	for _, dir := range []string{"objects", "objects/pack"} {
+		files, err := ioutil.ReadDir(repo.RepoPath(dir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		for _, f := range files {
+			if f.IsDir() || !strings.HasPrefix(f.Name(), "tmp_") || !f.ModTime().Before(expire) {
+				continue
+			}
+			if err := os.Remove(repo.RepoPath(filepath.Join(dir, f.Name()))); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
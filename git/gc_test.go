@@ -0,0 +1,100 @@
+package git
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPackRefs(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", first, ""))
+	assert.NoError(t, UpdateRef(repo, "refs/heads/topic", second, ""))
+	assert.NoError(t, UpdateRef(repo, "refs/tags/v1", first, ""))
+
+	// only tags are packed by default
+	assert.NoError(t, PackRefs(repo, false))
+	packed, err := readPackedRefs(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, []*GitRef{{Name: "refs/tags/v1", Sha: first}}, packed)
+	_, err = os.Stat(repo.RepoPath("refs/tags/v1"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(repo.RepoPath("refs/tags"))
+	assert.NoError(t, err)
+
+	assert.NoError(t, PackRefs(repo, true))
+	data, err := ioutil.ReadFile(repo.RepoPath("packed-refs"))
+	assert.NoError(t, err)
+	assert.Equal(t, packedRefsHeader+
+		first+" refs/heads/master\n"+
+		second+" refs/heads/topic\n"+
+		first+" refs/tags/v1\n", string(data))
+
+	// loose refs take precedence over packed refs
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+	sha, err := ResolveRef(repo, "refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, second, sha)
+	refs, err := ListRefs(repo, "refs/heads/")
+	assert.NoError(t, err)
+	assert.Len(t, refs, 2)
+
+	assert.NoError(t, DeleteRef(repo, "refs/heads/topic"))
+	_, err = ReadRef(repo, "refs/heads/topic")
+	assert.True(t, errors.Is(err, ErrRefNotFound))
+	assert.True(t, errors.Is(DeleteRef(repo, "refs/heads/topic"), ErrRefNotFound))
+}
+
+func TestGC(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+
+	old, err := WriteObject(repo, NewGitBlob([]byte("old garbage\n")))
+	assert.NoError(t, err)
+	recent, err := WriteObject(repo, NewGitBlob([]byte("recent garbage\n")))
+	assert.NoError(t, err)
+	month := time.Now().AddDate(0, -1, 0)
+	assert.NoError(t, os.Chtimes(repo.RepoPath(objectPath(old)), month, month))
+	assert.NoError(t, ioutil.WriteFile(repo.RepoPath("objects/tmp_obj_stale"), nil, 0644))
+	assert.NoError(t, os.Chtimes(repo.RepoPath("objects/tmp_obj_stale"), month, month))
+
+	needed, err := NeedsAutoGC(repo)
+	assert.NoError(t, err)
+	assert.False(t, needed)
+
+	assert.NoError(t, GC(repo, GCOptions{}))
+	assert.False(t, HasObject(repo, old))
+	assert.True(t, HasObject(repo, recent))
+	for _, sha := range []string{first, second} {
+		assert.True(t, HasObject(repo, sha))
+		_, err := os.Stat(repo.RepoPath(objectPath(sha)))
+		assert.True(t, os.IsNotExist(err), "reachable objects are packed")
+	}
+	_, err = os.Stat(repo.RepoPath("objects/tmp_obj_stale"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(repo.RepoPath("gc.pid"))
+	assert.True(t, os.IsNotExist(err))
+	ref, err := findPackedRef(repo, "refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, second, ref.Sha)
+
+	// gc again keeps the pack, and prunes everything unreachable with "now"
+	assert.NoError(t, GC(repo, GCOptions{PruneExpire: "now"}))
+	assert.False(t, HasObject(repo, recent))
+	assert.True(t, HasObject(repo, first))
+
+	// another gc is running
+	assert.NoError(t, ioutil.WriteFile(repo.RepoPath("gc.pid"), []byte("1 other-host"), 0644))
+	assert.Error(t, GC(repo, GCOptions{}))
+	assert.NoError(t, GC(repo, GCOptions{Force: true}))
+}
@@ -11,16 +11,20 @@ import (
 	"io/ioutil"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
 	"syscall"
 	"time"
 )
 
+// GitRepository is a repository. Worktree is empty if the repository is bare.
 type GitRepository struct {
 	Worktree string
 	GitDir   string
+	Bare     bool
+
+	// shallow is commits in .git/shallow, which is loaded on demand.
+	shallow map[string]bool
 }
 
 type GitObject interface {
@@ -30,7 +34,8 @@ type GitObject interface {
 }
 
 // NewGitRepository return `GitRepository`
-// return error if ".git" dir is not exists in path.
+// return error if path is not a worktree which has ".git" directory or gitfile,
+// nor a bare repository.
 func NewGitRepository(path string) (*GitRepository, error) {
 	return newRepo(path, false)
 }
@@ -47,15 +52,87 @@ func newRepo(path string, force bool) (*GitRepository, error) {
 		GitDir:   filepath.Join(path, ".git"),
 	}
 	info, err := os.Stat(repo.GitDir)
-	if err != nil && os.IsExist(err) {
+	switch {
+	case err == nil && info.IsDir():
+		return repo, nil
+	case err == nil:
+		// .git is a gitfile which points real git directory
+		gitDir, err := ReadGitFile(repo.GitDir)
+		if err != nil {
+			return nil, err
+		}
+		repo.GitDir = gitDir
+		return repo, nil
+	case !os.IsNotExist(err):
 		return nil, err
 	}
-	if !(force || info.IsDir()) {
+
+	if IsGitDir(path) {
+		return openGitDir(path)
+	}
+	if !force {
 		return nil, fmt.Errorf("Not a Git repository. %s", path)
 	}
 	return repo, nil
 }
 
+// openGitDir return repository of git directory.
+// a git directory named ".git" is not bare unless core.bare is set.
+func openGitDir(gitDir string) (*GitRepository, error) {
+	repo := &GitRepository{GitDir: gitDir, Bare: true}
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	bare, ok := cfg.Get("core", "", "bare")
+	if isBare, _ := ParseConfigBool(bare); isBare || !ok && filepath.Base(gitDir) != ".git" {
+		return repo, nil
+	}
+	repo.Bare = false
+	repo.Worktree = filepath.Dir(gitDir)
+	if worktree, ok := cfg.Get("core", "", "worktree"); ok {
+		if !filepath.IsAbs(worktree) {
+			worktree = filepath.Join(gitDir, worktree)
+		}
+		repo.Worktree = worktree
+	}
+	return repo, nil
+}
+
+// IsGitDir return true if path looks like a git directory.
+func IsGitDir(path string) bool {
+	if info, err := os.Stat(filepath.Join(path, "HEAD")); err != nil || info.IsDir() {
+		return false
+	}
+	for _, dir := range []string{"objects", "refs"} {
+		if info, err := os.Stat(filepath.Join(path, dir)); err != nil || !info.IsDir() {
+			return false
+		}
+	}
+	return true
+}
+
+// ReadGitFile return git directory written in gitfile. ("gitdir: <path>")
+// relative path is resolved from the directory of gitfile.
+func ReadGitFile(path string) (string, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	content := strings.TrimSpace(string(data))
+	if !strings.HasPrefix(content, "gitdir: ") {
+		return "", fmt.Errorf("Invalid gitfile format: %s", path)
+	}
+	gitDir := strings.TrimPrefix(content, "gitdir: ")
+	if !filepath.IsAbs(gitDir) {
+		gitDir = filepath.Join(filepath.Dir(path), gitDir)
+	}
+	if !IsGitDir(gitDir) {
+		return "", fmt.Errorf("Not a git repository: %s", gitDir)
+	}
+	return gitDir, nil
+}
+
 // RepoPath return path joined ".git" directory
 func (gr *GitRepository) RepoPath(path string) string {
 	return filepath.Join(gr.GitDir, path)
@@ -82,15 +159,68 @@ func (gr *GitRepository) CreateRepoDir(path string) error {
 	return nil
 }
 
+// InitOptions is options of InitRepository.
+type InitOptions struct {
+	// Bare create a repository without worktree at the path.
+	Bare bool
+	// InitialBranch is the branch HEAD points. init.defaultBranch or "master" is used if empty.
+	InitialBranch string
+	// Template is a directory whose files are copied into git directory.
+	// GIT_TEMPLATE_DIR or init.templateDir is used if empty.
+	Template string
+	// SeparateGitDir create git directory at this path, and gitfile in the worktree.
+	SeparateGitDir string
+}
+
+const defaultDescription = "Unnamed repository; edit this file 'description' to name the repository.\n"
+
+const defaultExclude = `# git ls-files --others --exclude-from=.git/info/exclude
+# Lines that start with '#' are comments.
+# For a project mostly in C, the following would be a good set of
+# exclude patterns (uncomment them if you want to use them):
+# *.[oa]
+# *~
+`
+
 // Create a new repository at path
 func CreateAndInitializeRepo(path string) (*GitRepository, error) {
-	repo, err := NewGitRepositoryForceCreate(path)
-	if err != nil {
-		return nil, err
+	return InitRepository(path, InitOptions{})
+}
+
+// InitRepository create a new repository, or reinitialize existing repository at path.
+// existing HEAD, config and files are kept.
+func InitRepository(path string, opts InitOptions) (*GitRepository, error) {
+	repo := &GitRepository{Worktree: path, GitDir: filepath.Join(path, ".git")}
+	if opts.Bare {
+		repo = &GitRepository{GitDir: path, Bare: true}
+	} else if existing, err := NewGitRepository(path); err == nil {
+		repo = existing
+		opts.Bare = existing.Bare
 	}
+
+	if opts.SeparateGitDir != "" {
+		if opts.Bare {
+			return nil, errors.New("--separate-git-dir and --bare are mutually exclusive")
+		}
+		separate, err := filepath.Abs(opts.SeparateGitDir)
+		if err != nil {
+			return nil, err
+		}
+		// move existing git directory to the new place
+		if info, err := os.Stat(repo.GitDir); err == nil && info.IsDir() && repo.GitDir != separate {
+			if err := os.Rename(repo.GitDir, separate); err != nil {
+				return nil, err
+			}
+		}
+		repo.GitDir = separate
+	}
+
 	dirs := []string{
-		"objects",
+		"objects/info",
+		"objects/pack",
 		"branches",
+		"hooks",
+		"info",
 		"refs/tags",
 		"refs/heads",
 	}
@@ -100,15 +230,126 @@ func CreateAndInitializeRepo(path string) (*GitRepository, error) {
 		}
 	}
 
-	// .git/description
-	repo.SaveRepoFile("description", []byte("Unnamed repository; edit this file 'description' to name the repository.\n"))
+	if opts.SeparateGitDir != "" {
+		gitFile := filepath.Join(path, ".git")
+		if err := ioutil.WriteFile(gitFile, []byte("gitdir: "+repo.GitDir+"\n"), repoFilePerm()); err != nil {
+			return nil, err
+		}
+	}
+
+	global, err := LoadConfig(nil)
+	if err != nil {
+		return nil, err
+	}
+	template := opts.Template
+	if template == "" {
+		template = os.Getenv("GIT_TEMPLATE_DIR")
+	}
+	if template == "" {
+		template, _ = global.GetPath("init.templatedir")
+	}
+	if template != "" {
+		if err := copyTemplate(template, repo.GitDir); err != nil {
+			return nil, err
+		}
+	}
+
+	defaults := map[string][]byte{
+		"description":  []byte(defaultDescription),
+		"info/exclude": []byte(defaultExclude),
+	}
+	for name, data := range defaults {
+		if _, err := os.Stat(repo.RepoPath(name)); os.IsNotExist(err) {
+			if err := repo.SaveRepoFile(name, data); err != nil {
+				return nil, err
+			}
+		}
+	}
 
 	// .git/HEAD
-	repo.SaveRepoFile("HEAD", []byte("ref: refs/heads/master\n"))
+	if _, err := os.Stat(repo.RepoPath("HEAD")); os.IsNotExist(err) {
+		branch := opts.InitialBranch
+		if branch == "" {
+			branch = global.GetString("init.defaultbranch", "master")
+		}
+		if !IsValidRefName(BranchRef(branch)) {
+			return nil, fmt.Errorf("invalid initial branch name: '%s'", branch)
+		}
+		if err := repo.SaveRepoFile("HEAD", []byte("ref: "+BranchRef(branch)+"\n")); err != nil {
+			return nil, err
+		}
+	}
+
+	// .git/config
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Set("core", "", "repositoryformatversion", "0")
+	cfg.Set("core", "", "filemode", strconv.FormatBool(probeFileMode(repo)))
+	cfg.Set("core", "", "bare", strconv.FormatBool(opts.Bare))
+	if !opts.Bare {
+		cfg.Set("core", "", "logallrefupdates", "true")
+	}
+	if err := WriteConfig(repo, cfg); err != nil {
+		return nil, err
+	}
 
 	return repo, nil
 }
 
+// copyTemplate copy files in template directory to git directory.
+// existing files are not overwritten.
+func copyTemplate(template, gitDir string) error {
+	return filepath.Walk(template, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) && path == template {
+				return nil
+			}
+			return err
+		}
+		rel, err := filepath.Rel(template, path)
+		if err != nil {
+			return err
+		}
+		dst := filepath.Join(gitDir, rel)
+		if info.IsDir() {
+			return os.MkdirAll(dst, repoDirPerm())
+		}
+		if _, err := os.Lstat(dst); err == nil {
+			return nil
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			link, err := os.Readlink(path)
+			if err != nil {
+				return err
+			}
+			return os.Symlink(link, dst)
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+		return ioutil.WriteFile(dst, data, info.Mode().Perm())
+	})
+}
+
+// probeFileMode check whether the filesystem respects executable bit.
+func probeFileMode(repo *GitRepository) bool {
+	f, err := ioutil.TempFile(repo.GitDir, "filemode")
+	if err != nil {
+		return false
+	}
+	name := f.Name()
+	f.Close()
+	defer os.Remove(name)
+	if err := os.Chmod(name, 0755); err != nil {
+		return false
+	}
+	info, err := os.Stat(name)
+	return err == nil && info.Mode().Perm()&0100 != 0
+}
+
 // FindRepo return git repository path
 // if .git directory is not exist in path,
 // find parent directory recursively.
@@ -145,12 +386,103 @@ type GitUser struct {
 	Time  string
 }
 
+// ParseGitUser parse "Name <email> timestamp timezone" form.
+func ParseGitUser(s string) GitUser {
+	lt := strings.IndexByte(s, '<')
+	gt := strings.LastIndexByte(s, '>')
+	if lt < 0 || gt < lt {
+		return GitUser{Name: strings.TrimSpace(s)}
+	}
+	return GitUser{
+		Name:  strings.TrimSpace(s[:lt]),
+		Email: s[lt+1 : gt],
+		Time:  strings.TrimSpace(s[gt+1:]),
+	}
+}
+
+func (u GitUser) String() string {
+	return fmt.Sprintf("%s <%s> %s", u.Name, u.Email, u.Time)
+}
+
+// When return time of Time field. Time is formatted "unixtime timezone".
+func (u GitUser) When() (time.Time, error) {
+	fields := strings.Fields(u.Time)
+	if len(fields) == 0 {
+		return time.Time{}, fmt.Errorf("Invalid time: %q", u.Time)
+	}
+	sec, err := strconv.ParseInt(fields[0], 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+	t := time.Unix(sec, 0)
+	if len(fields) < 2 || len(fields[1]) != 5 {
+		return t.UTC(), nil
+	}
+	tz := fields[1]
+	hour, err1 := strconv.Atoi(tz[1:3])
+	min, err2 := strconv.Atoi(tz[3:5])
+	if err1 != nil || err2 != nil {
+		return t.UTC(), nil
+	}
+	offset := hour*3600 + min*60
+	if tz[0] == '-' {
+		offset = -offset
+	}
+	return t.In(time.FixedZone(tz, offset)), nil
+}
+
+// NewGitUser return GitUser which time is t.
+func NewGitUser(name, email string, t time.Time) GitUser {
+	return GitUser{Name: name, Email: email, Time: fmt.Sprintf("%d %s", t.Unix(), t.Format("-0700"))}
+}
+
+// GitHeader is a header line of commit or tag object.
+type GitHeader struct {
+	Key   string
+	Value string
+}
+
+// parseObjectHeaders parse headers and message of commit and tag object.
+// continuation lines of a header value start with a space.
+func parseObjectHeaders(data []byte) ([]GitHeader, string) {
+	var headers []GitHeader
+	rest := string(data)
+	for len(rest) > 0 {
+		nl := strings.IndexByte(rest, '\n')
+		if nl < 0 {
+			nl = len(rest)
+		}
+		line := rest[:nl]
+		if nl < len(rest) {
+			rest = rest[nl+1:]
+		} else {
+			rest = ""
+		}
+		if line == "" {
+			return headers, rest
+		}
+		if line[0] == ' ' && len(headers) > 0 {
+			last := &headers[len(headers)-1]
+			last.Value += "\n" + line[1:]
+			continue
+		}
+		sp := strings.IndexByte(line, ' ')
+		if sp < 0 {
+			headers = append(headers, GitHeader{Key: line})
+			continue
+		}
+		headers = append(headers, GitHeader{Key: line[:sp], Value: line[sp+1:]})
+	}
+	return headers, ""
+}
+
 type (
 	GitCommit struct {
 		Tree      string
-		Parent    string
+		Parents   []string
 		Author    GitUser
 		Committer GitUser
+		Extra     []GitHeader
 		Message   string
 	}
 
@@ -161,6 +493,15 @@ type (
 	GitBlob struct {
 		Data []byte
 	}
+
+	GitTag struct {
+		Object  string
+		ObjType string
+		Tag     string
+		Tagger  GitUser
+		Extra   []GitHeader
+		Message string
+	}
 )
 
 func NewGitBlob(data []byte) GitObject {
@@ -204,12 +545,16 @@ func NewGitTreeFromIndex(index *GitIndex) GitObject {
 }
 
 func (o *GitTree) Serialize() []byte {
-	result := make([][]byte, len(o.Entries))
+	var b bytes.Buffer
 	for _, entry := range o.Entries {
-		e := bytes.Join([][]byte{[]byte(entry.Mode.String()), []byte(" "), []byte(entry.Path), []byte("\x00"), []byte(entry.Sha)}, []byte(""))
-		result = append(result, e)
+		sha, _ := hex.DecodeString(entry.Sha)
+		b.WriteString(strconv.FormatUint(uint64(entry.Mode), 8))
+		b.WriteByte(' ')
+		b.WriteString(entry.Path)
+		b.WriteByte(0)
+		b.Write(sha)
 	}
-	return bytes.Join(result, []byte(""))
+	return b.Bytes()
 }
 
 func (o *GitTree) Deserialize(data []byte) {
@@ -229,33 +574,88 @@ func NewGitCommitFromObjData(data []byte) GitObject {
 func (o *GitCommit) Serialize() []byte {
 	var data [][]byte
 	data = append(data, []byte(fmt.Sprintf("tree %s\n", o.Tree)))
-	data = append(data, []byte(fmt.Sprintf("parent %s\n", o.Parent)))
-	data = append(data, []byte(fmt.Sprintf("author %s <%s> %s\n", o.Author.Name, o.Author.Email, o.Author.Time)))
-	data = append(data, []byte(fmt.Sprintf("commiter %s <%s> %s\n", o.Committer.Name, o.Committer.Email, o.Committer.Time)))
+	for _, parent := range o.Parents {
+		data = append(data, []byte(fmt.Sprintf("parent %s\n", parent)))
+	}
+	data = append(data, []byte(fmt.Sprintf("author %s\n", o.Author.String())))
+	data = append(data, []byte(fmt.Sprintf("committer %s\n", o.Committer.String())))
+	for _, h := range o.Extra {
+		value := strings.ReplaceAll(h.Value, "\n", "\n ")
+		data = append(data, []byte(fmt.Sprintf("%s %s\n", h.Key, value)))
+	}
 	data = append(data, []byte("\n"))
 	data = append(data, []byte(o.Message))
 	return bytes.Join(data, []byte(""))
 }
 
 func (o *GitCommit) Deserialize(data []byte) {
-	re := regexp.MustCompile(`(?m)^tree (.+)\nparent (.+)\nauthor (.+) <(.+)> (.+)\ncommitter (.+) <(.+)> (.+)\n\n(.+)$`)
-	strData := strings.NewReplacer(
-		`\r\n`, `\n`,
-		`\r`, `\n`,
-	).Replace(string(data))
-
-	fields := re.FindAllStringSubmatch(strData, -1)[0]
-	if fields == nil {
-		return
-	}
-	// for _, fie := range fields {
-	// 	fmt.Println(fie)
-	// }
-	o.Tree = fields[1]
-	o.Parent = fields[2]
-	o.Author = GitUser{Name: fields[3], Email: fields[4], Time: fields[5]}
-	o.Committer = GitUser{Name: fields[6], Email: fields[7], Time: fields[8]}
-	o.Message = fields[9]
+	headers, message := parseObjectHeaders(data)
+	o.Parents = nil
+	o.Extra = nil
+	for _, h := range headers {
+		switch h.Key {
+		case "tree":
+			o.Tree = h.Value
+		case "parent":
+			o.Parents = append(o.Parents, h.Value)
+		case "author":
+			o.Author = ParseGitUser(h.Value)
+		case "committer":
+			o.Committer = ParseGitUser(h.Value)
+		default:
+			o.Extra = append(o.Extra, h)
+		}
+	}
+	o.Message = message
+}
+
+func NewGitTag(data []byte) GitObject {
+	o := new(GitTag)
+	o.Deserialize(data)
+	return o
+}
+
+func (o *GitTag) Serialize() []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "object %s\ntype %s\ntag %s\n", o.Object, o.ObjType, o.Tag)
+	if o.Tagger.Name != "" || o.Tagger.Email != "" {
+		fmt.Fprintf(&b, "tagger %s\n", o.Tagger.String())
+	}
+	for _, h := range o.Extra {
+		fmt.Fprintf(&b, "%s %s\n", h.Key, strings.ReplaceAll(h.Value, "\n", "\n "))
+	}
+	b.WriteString("\n")
+	b.WriteString(o.Message)
+	return b.Bytes()
+}
+
+func (o *GitTag) Deserialize(data []byte) {
+	headers, message := parseObjectHeaders(data)
+	o.Extra = nil
+	for _, h := range headers {
+		switch h.Key {
+		case "object":
+			o.Object = h.Value
+		case "type":
+			o.ObjType = h.Value
+		case "tag":
+			o.Tag = h.Value
+		case "tagger":
+			o.Tagger = ParseGitUser(h.Value)
+		default:
+			o.Extra = append(o.Extra, h)
+		}
+	}
+	o.Message = message
+}
+
+func (o *GitTag) Type() []byte {
+	return []byte("tag")
+}
+
+// Subject return first line of the commit message.
+func (o *GitCommit) Subject() string {
+	return strings.SplitN(strings.TrimLeft(o.Message, "\n"), "\n", 2)[0]
 }
 
 func (o *GitCommit) Type() []byte {
@@ -263,28 +663,13 @@ func (o *GitCommit) Type() []byte {
 }
 
 // ReadObject retrun a GitObject whose exact type depends on the object.
+// loose objects are looked up first, then packfiles.
 func ReadObject(repo *GitRepository, sha string) (GitObject, error) {
-	path := filepath.Join("objects", sha[:2], sha[2:])
-	encData, err := ioutil.ReadFile(repo.RepoPath(path))
-	if err != nil {
-		return nil, err
-	}
-	data, err := decompressZlib(encData)
+	objType, data, err := ReadObjectData(repo, sha)
 	if err != nil {
 		return nil, err
 	}
 
-	// Read Object Type
-	x := bytes.IndexByte(data, ' ')
-	objType := string(data[:x])
-
-	// Read Object size
-	y := bytes.IndexByte(data, '\x00')
-	size, err := byte2Int(data[x+1 : y])
-	if size != len(data)-y-1 {
-		return nil, fmt.Errorf("Malformed object %d: bad length", size)
-	}
-
 	var fn func([]byte) GitObject
 	switch objType {
 	case "commit":
@@ -293,9 +678,50 @@ func ReadObject(repo *GitRepository, sha string) (GitObject, error) {
 		fn = NewGitTree
 	case "blob":
 		fn = NewGitBlob
+	case "tag":
+		fn = NewGitTag
+	default:
+		return nil, fmt.Errorf("Unknown object type %s for object %s", objType, sha)
 	}
 
-	return fn(data[y+1:]), nil
+	return fn(data), nil
+}
+
+// ReadObjectData return type and content of the object without parsing the content.
+func ReadObjectData(repo *GitRepository, sha string) (string, []byte, error) {
+	if len(sha) < 3 {
+		return "", nil, fmt.Errorf("Invalid object name: %s", sha)
+	}
+	encData, err := ioutil.ReadFile(repo.RepoPath(objectPath(sha)))
+	if os.IsNotExist(err) {
+		objType, data, err := readPackedObject(repo, sha)
+		if errors.Is(err, errObjectNotFound) && isHexSha(sha) && IsPartialClone(repo) {
+			return readPromisedObject(repo, sha)
+		}
+		return objType, data, err
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := decompressZlib(encData)
+	if err != nil {
+		return "", nil, err
+	}
+
+	// Read Object Type
+	x := bytes.IndexByte(data, ' ')
+	y := bytes.IndexByte(data, '\x00')
+	if x < 0 || y < x {
+		return "", nil, fmt.Errorf("Malformed object %s: bad header", sha)
+	}
+	objType := string(data[:x])
+
+	// Read Object size
+	size, err := byte2Int(data[x+1 : y])
+	if err != nil || size != len(data)-y-1 {
+		return "", nil, fmt.Errorf("Malformed object %d: bad length", size)
+	}
+	return objType, data[y+1:], nil
 }
 
 func WriteObject(repo *GitRepository, obj GitObject) (string, error) {
@@ -371,16 +797,49 @@ func byte2Int(b []byte) (int, error) {
 	return strconv.Atoi(string(b))
 }
 
+// Modes of tree entry. Mode of GitTreeEntry holds these git modes, not os.FileMode bits.
+const (
+	ModeTree       os.FileMode = 0040000
+	ModeBlob       os.FileMode = 0100644
+	ModeExecutable os.FileMode = 0100755
+	ModeSymlink    os.FileMode = 0120000
+	ModeGitlink    os.FileMode = 0160000
+
+	modeTypeMask os.FileMode = 0170000
+)
+
 type GitTreeEntry struct {
 	Mode os.FileMode
 	Path string
 	Sha  string
 }
 
+// IsTree return true if the entry is a subtree.
+func (e *GitTreeEntry) IsTree() bool {
+	return e.Mode&modeTypeMask == ModeTree
+}
+
+// IsGitlink return true if the entry is a commit of submodule.
+func (e *GitTreeEntry) IsGitlink() bool {
+	return e.Mode&modeTypeMask == ModeGitlink
+}
+
+// ObjectType return the type of the object which the entry points to.
+func (e *GitTreeEntry) ObjectType() string {
+	switch {
+	case e.IsTree():
+		return "tree"
+	case e.IsGitlink():
+		return "commit"
+	}
+	return "blob"
+}
+
 func parseTreeOneEntry(data []byte) (int, *GitTreeEntry) {
 	// find a terminator of the mode
 	x := bytes.IndexByte(data, ' ')
-	mode := binary.BigEndian.Uint32(data[:x])
+	// mode is written in octal digits
+	mode, _ := strconv.ParseUint(string(data[:x]), 8, 32)
 
 	// find a null terminator of the path
 	y := bytes.IndexByte(data, '\x00')
@@ -411,6 +870,8 @@ type GitIndex struct {
 	Entries []*IndexEntry
 }
 
+// IndexEntry is an entry of the index. Ctime and Mtime hold seconds in the upper 32 bits
+// and nanoseconds in the lower 32 bits, as the index file does.
 type IndexEntry struct {
 	Ctime    uint64
 	Mtime    uint64
@@ -425,12 +886,17 @@ type IndexEntry struct {
 	FilePath string
 }
 
+// indexTime return the time in the encoding of Ctime and Mtime of IndexEntry.
+func indexTime(sec, nsec int64) uint64 {
+	return uint64(uint32(sec))<<32 | uint64(uint32(nsec))
+}
+
 func NewIndexEntry(info os.FileInfo, path, sha string) *IndexEntry {
 	entry := new(IndexEntry)
 	stat := info.Sys().(*syscall.Stat_t)
 
-	entry.Ctime = uint64(time.Unix(stat.Ctimespec.Sec, stat.Ctimespec.Nsec).UnixNano())
-	entry.Mtime = uint64(time.Unix(stat.Mtimespec.Sec, stat.Mtimespec.Nsec).UnixNano())
+	entry.Ctime = indexTime(int64(stat.Ctimespec.Sec), int64(stat.Ctimespec.Nsec))
+	entry.Mtime = indexTime(int64(stat.Mtimespec.Sec), int64(stat.Mtimespec.Nsec))
 	entry.Dev = uint32(stat.Dev)
 	entry.Ino = uint32(stat.Ino)
 	entry.Mode = os.FileMode(stat.Mode)
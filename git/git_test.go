@@ -68,6 +68,71 @@ func TestFindRepo(t *testing.T) {
 	os.RemoveAll(temp)
 }
 
+func TestInitRepository(t *testing.T) {
+	temp := newTempDir(t)
+	defer os.RemoveAll(temp)
+
+	repo, err := InitRepository(temp, InitOptions{InitialBranch: "main"})
+	assert.NoError(t, err)
+	assert.False(t, repo.Bare)
+	assert.FileExists(t, repo.RepoPath("info/exclude"))
+	assert.DirExists(t, repo.RepoPath("hooks"))
+	head, _ := ioutil.ReadFile(repo.RepoPath("HEAD"))
+	assert.Equal(t, "ref: refs/heads/main\n", string(head))
+	cfg, err := ReadConfig(repo)
+	assert.NoError(t, err)
+	bare, _ := cfg.Get("core", "", "bare")
+	assert.Equal(t, "false", bare)
+	version, _ := cfg.Get("core", "", "repositoryformatversion")
+	assert.Equal(t, "0", version)
+
+	// reinitialize keeps HEAD
+	_, err = InitRepository(temp, InitOptions{InitialBranch: "other"})
+	assert.NoError(t, err)
+	head, _ = ioutil.ReadFile(repo.RepoPath("HEAD"))
+	assert.Equal(t, "ref: refs/heads/main\n", string(head))
+}
+
+func TestInitRepositoryBare(t *testing.T) {
+	temp := newTempDir(t)
+	defer os.RemoveAll(temp)
+	path := filepath.Join(temp, "repo.git")
+
+	_, err := InitRepository(path, InitOptions{Bare: true})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(path, "HEAD"))
+
+	repo, err := NewGitRepository(path)
+	assert.NoError(t, err)
+	assert.True(t, repo.Bare)
+	assert.Equal(t, path, repo.GitDir)
+	assert.Equal(t, "", repo.Worktree)
+}
+
+func TestInitRepositorySeparateGitDir(t *testing.T) {
+	temp := newTempDir(t)
+	defer os.RemoveAll(temp)
+	worktree := filepath.Join(temp, "work")
+	gitDir := filepath.Join(temp, "gitdir")
+	template := filepath.Join(temp, "template")
+	_ = os.MkdirAll(filepath.Join(template, "hooks"), 0755)
+	_ = ioutil.WriteFile(filepath.Join(template, "hooks", "pre-commit"), []byte("#!/bin/sh\n"), 0755)
+	_ = os.MkdirAll(worktree, 0755)
+
+	_, err := InitRepository(worktree, InitOptions{SeparateGitDir: gitDir, Template: template})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(gitDir, "hooks", "pre-commit"))
+
+	repo, err := NewGitRepository(worktree)
+	assert.NoError(t, err)
+	assert.False(t, repo.Bare)
+	assert.Equal(t, gitDir, repo.GitDir)
+	assert.Equal(t, worktree, repo.Worktree)
+
+	_, err = NewGitRepository(gitDir + "-none")
+	assert.Error(t, err)
+}
+
 func TestHashObject(t *testing.T) {
 	obj := NewGitBlob([]byte("test\n"))
 	sha, data := HashObject(obj)
@@ -153,3 +218,71 @@ func TestWriteIndex(t *testing.T) {
 	assert.NoError(t, err)
 	assert.Equal(t, indexData, got)
 }
+
+func TestCommitSerialize(t *testing.T) {
+	data := []byte("tree 4b825dc642cb6eb9a060e54bf8d69288fbee4904\n" +
+		"parent 9daeafb9864cf43055ae93beb0afd6c7d144bfa4\n" +
+		"parent 3b18e512dba79e4c8300dd08aeb37f8e728b8dad\n" +
+		"author alice <alice@example.com> 1600000000 +0900\n" +
+		"committer bob <bob@example.com> 1600000001 -0130\n" +
+		"gpgsig -----BEGIN PGP SIGNATURE-----\n \n -----END PGP SIGNATURE-----\n" +
+		"\n" +
+		"subject\n\nbody\n")
+
+	commit := NewGitCommitFromObjData(data).(*GitCommit)
+	assert.Equal(t, "4b825dc642cb6eb9a060e54bf8d69288fbee4904", commit.Tree)
+	assert.Equal(t, 2, len(commit.Parents))
+	assert.Equal(t, "alice", commit.Author.Name)
+	assert.Equal(t, "bob@example.com", commit.Committer.Email)
+	assert.Equal(t, "subject", commit.Subject())
+	assert.Equal(t, data, commit.Serialize())
+
+	when, err := commit.Committer.When()
+	assert.NoError(t, err)
+	_, offset := when.Zone()
+	assert.Equal(t, int64(1600000001), when.Unix())
+	assert.Equal(t, -90*60, offset)
+}
+
+// newTempDir create a temporary directory.
+// other tests may remove os.TempDir() itself, so it is created if needed.
+func newTempDir(t *testing.T) string {
+	if err := os.MkdirAll(os.TempDir(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	temp, err := ioutil.TempDir("", "mygit")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return temp
+}
+
+// newTestRepo create a repository in temporary directory.
+func newTestRepo(t *testing.T) *GitRepository {
+	repo, err := CreateAndInitializeRepo(newTempDir(t))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return repo
+}
+
+// writeTestCommit write a commit which has empty tree.
+func writeTestCommit(t *testing.T, repo *GitRepository, message string, parents ...string) string {
+	tree, err := WriteObject(repo, &GitTree{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := GitUser{Name: "mygit", Email: "mygit@example.com", Time: "1600000000 +0000"}
+	commit := &GitCommit{
+		Tree:      tree,
+		Parents:   parents,
+		Author:    user,
+		Committer: user,
+		Message:   message + "\n",
+	}
+	sha, err := WriteObject(repo, commit)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
@@ -0,0 +1,335 @@
+package git
+
+import (
+	"container/heap"
+	"fmt"
+)
+
+// ReadCommit read commit object.
+// commits in .git/shallow have no parents, so that walks stop at the boundary of shallow history.
+func ReadCommit(repo *GitRepository, sha string) (*GitCommit, error) {
+	obj, err := ReadObject(repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	commit, ok := obj.(*GitCommit)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a commit", sha)
+	}
+	if isShallowCommit(repo, sha) {
+		commit.Parents = nil
+	}
+	return commit, nil
+}
+
+// commitNode is a commit in history walks.
+// generation is generationInfinity if the commit is not in commit-graph.
+type commitNode struct {
+	sha        string
+	parents    []string
+	generation uint32
+	time       int64
+}
+
+// readCommitNode read parents of the commit from commit-graph if it is available, or from the commit object.
+func readCommitNode(repo *GitRepository, graph *commitGraph, sha string) (*commitNode, error) {
+	if graph != nil {
+		if i, ok := graph.find(sha); ok {
+			c, err := graph.commitAt(i)
+			if err != nil {
+				return nil, err
+			}
+			return &commitNode{sha: sha, parents: c.parents, generation: c.generation, time: c.time}, nil
+		}
+	}
+	commit, err := ReadCommit(repo, sha)
+	if err != nil {
+		return nil, err
+	}
+	when, _ := commit.Committer.When()
+	return &commitNode{sha: sha, parents: commit.Parents, generation: generationInfinity, time: when.Unix()}, nil
+}
+
+// IsAncestor return true if ancestor is reachable from descendant.
+// a commit is ancestor of itself.
+// commits whose generation is lower than ancestor are not walked, because they can not reach it.
+func IsAncestor(repo *GitRepository, ancestor, descendant string) (bool, error) {
+	graph := loadCommitGraph(repo)
+	minGeneration := uint32(0)
+	if node, err := readCommitNode(repo, graph, ancestor); err == nil && node.generation != generationInfinity {
+		minGeneration = node.generation
+	}
+	seen := map[string]bool{descendant: true}
+	queue := []string{descendant}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		if sha == ancestor {
+			return true, nil
+		}
+		node, err := readCommitNode(repo, graph, sha)
+		if err != nil {
+			return false, err
+		}
+		if node.generation < minGeneration {
+			continue
+		}
+		for _, parent := range node.parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return false, nil
+}
+
+// flags to paint commits while finding merge bases.
+const (
+	paintParent1 = 1 << iota
+	paintParent2
+	paintStale
+	paintResult
+)
+
+// commitQueue is a priority queue of commits. commits of higher generation come first,
+// and newer commits among the same generation.
+type commitQueue []*commitNode
+
+func (q commitQueue) Len() int      { return len(q) }
+func (q commitQueue) Swap(i, j int) { q[i], q[j] = q[j], q[i] }
+func (q commitQueue) Less(i, j int) bool {
+	if q[i].generation != q[j].generation {
+		return q[i].generation > q[j].generation
+	}
+	return q[i].time > q[j].time
+}
+func (q *commitQueue) Push(x interface{}) { *q = append(*q, x.(*commitNode)) }
+func (q *commitQueue) Pop() interface{} {
+	old := *q
+	node := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return node
+}
+
+// MergeBases return best common ancestors of two commits.
+// none of them is an ancestor of another.
+func MergeBases(repo *GitRepository, one, two string) ([]string, error) {
+	if one == two {
+		return []string{one}, nil
+	}
+	graph := loadCommitGraph(repo)
+	flags := map[string]int{}
+	queue := &commitQueue{}
+	paint := func(sha string, flag int) error {
+		flags[sha] |= flag
+		node, err := readCommitNode(repo, graph, sha)
+		if err != nil {
+			return err
+		}
+		heap.Push(queue, node)
+		return nil
+	}
+	if err := paint(one, paintParent1); err != nil {
+		return nil, err
+	}
+	if err := paint(two, paintParent2); err != nil {
+		return nil, err
+	}
+
+	// commits painted by both sides are common ancestors, and their ancestors become stale
+	var results []string
+	for queueHasNonStale(*queue, flags) {
+		node := heap.Pop(queue).(*commitNode)
+		flag := flags[node.sha] & (paintParent1 | paintParent2 | paintStale)
+		if flag == paintParent1|paintParent2 {
+			if flags[node.sha]&paintResult == 0 {
+				flags[node.sha] |= paintResult
+				results = append(results, node.sha)
+			}
+			flag |= paintStale
+		}
+		for _, parent := range node.parents {
+			if flags[parent]&flag == flag {
+				continue
+			}
+			if err := paint(parent, flag); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	var bases []string
+	for _, sha := range results {
+		if flags[sha]&paintStale == 0 {
+			bases = append(bases, sha)
+		}
+	}
+	return removeRedundantCommits(repo, bases)
+}
+
+func queueHasNonStale(queue commitQueue, flags map[string]int) bool {
+	for _, node := range queue {
+		if flags[node.sha]&paintStale == 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// removeRedundantCommits remove commits which are ancestors of other commits.
+func removeRedundantCommits(repo *GitRepository, shas []string) ([]string, error) {
+	var result []string
+	for i, sha := range shas {
+		redundant := false
+		for j, other := range shas {
+			if i == j {
+				continue
+			}
+			ancestor, err := IsAncestor(repo, sha, other)
+			if err != nil {
+				return nil, err
+			}
+			if ancestor {
+				redundant = true
+				break
+			}
+		}
+		if !redundant {
+			result = append(result, sha)
+		}
+	}
+	return result, nil
+}
+
+// maybeChangedPath return false if the commit does not change path from its first parent,
+// according to changed-path filter in commit-graph. it returns true if the filter is not available.
+func maybeChangedPath(graph *commitGraph, sha, path string) bool {
+	if graph == nil {
+		return true
+	}
+	i, ok := graph.find(sha)
+	if !ok {
+		return true
+	}
+	return graph.bloomFilterAt(i).mayContain(path)
+}
+
+// ListObjects return objects reachable from wants but not from haves.
+// haves which do not exist in repository are ignored.
+func ListObjects(repo *GitRepository, wants, haves []string) ([]string, error) {
+	return listObjects(repo, wants, haves, objectWalk{})
+}
+
+// objectWalk limits objects listed by listObjects.
+// parents of commits in boundary are not walked from wants, nor parents of commits in haveBoundary from haves.
+// objects omitted by filter are not listed unless they are wanted.
+// missing objects are skipped without fetching from promisor remote if skipMissing is true.
+type objectWalk struct {
+	boundary     map[string]bool
+	haveBoundary map[string]bool
+	filter       *ObjectFilter
+	skipMissing  bool
+}
+
+func listObjects(repo *GitRepository, wants, haves []string, walk objectWalk) ([]string, error) {
+	excluded := map[string]bool{}
+	for _, have := range haves {
+		if !HasObject(repo, have) {
+			continue
+		}
+		if err := walkObjects(repo, have, excluded, objectWalk{boundary: walk.haveBoundary}, nil); err != nil {
+			return nil, err
+		}
+	}
+
+	var objects []string
+	for _, want := range wants {
+		// wanted objects are listed even if the filter omits them, because the filter applies only to links
+		err := walkObjects(repo, want, excluded, walk, func(sha string) {
+			objects = append(objects, sha)
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return objects, nil
+}
+
+// walkedObject is an object to visit with its depth from the root tree.
+type walkedObject struct {
+	sha   string
+	depth int
+}
+
+// walkObjects visit objects reachable from sha which are not in seen yet.
+// visited objects are added to seen. objects omitted by walk.filter are not visited nor added.
+// commits in .git/shallow and walk.boundary are visited but their parents are not.
+func walkObjects(repo *GitRepository, sha string, seen map[string]bool, walk objectWalk, visit func(string)) error {
+	stack := []walkedObject{{sha: sha}}
+	for len(stack) > 0 {
+		obj := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if seen[obj.sha] || (walk.skipMissing && !HasObject(repo, obj.sha)) {
+			continue
+		}
+		seen[obj.sha] = true
+		if visit != nil {
+			visit(obj.sha)
+		}
+
+		objType, data, err := ReadObjectData(repo, obj.sha)
+		if err != nil {
+			return err
+		}
+		switch objType {
+		case "commit":
+			commit := NewGitCommitFromObjData(data).(*GitCommit)
+			if !walk.boundary[obj.sha] && !isShallowCommit(repo, obj.sha) {
+				for _, parent := range commit.Parents {
+					stack = append(stack, walkedObject{sha: parent})
+				}
+			}
+			if !walk.filter.omitTree(0) {
+				stack = append(stack, walkedObject{sha: commit.Tree})
+			}
+		case "tree":
+			for _, entry := range ParseTree(data) {
+				switch {
+				case entry.IsGitlink():
+					// submodule commits are not in this repository
+				case entry.IsTree():
+					if !walk.filter.omitTree(obj.depth + 1) {
+						stack = append(stack, walkedObject{sha: entry.Sha, depth: obj.depth + 1})
+					}
+				case !seen[entry.Sha]:
+					// blobs have no link, so they are not read unless the filter needs the size
+					if walk.filter.omitBlob(obj.depth+1, func() int64 { return blobSize(repo, entry.Sha) }) {
+						continue
+					}
+					seen[entry.Sha] = true
+					if visit != nil {
+						visit(entry.Sha)
+					}
+				}
+			}
+		case "tag":
+			headers, _ := parseObjectHeaders(data)
+			for _, h := range headers {
+				if h.Key == "object" {
+					stack = append(stack, walkedObject{sha: h.Value})
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// blobSize return size of the blob, or 0 if it can not be read.
+func blobSize(repo *GitRepository, sha string) int64 {
+	_, data, err := ReadObjectData(repo, sha)
+	if err != nil {
+		return 0
+	}
+	return int64(len(data))
+}
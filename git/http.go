@@ -0,0 +1,222 @@
+package git
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// HTTPTransport talk with remote repository by smart HTTP protocol.
+// ProtocolVersion is 0 or 2. version 2 is used only if the server supports it.
+type HTTPTransport struct {
+	URL             string
+	Client          *http.Client
+	Progress        io.Writer
+	ProtocolVersion int
+}
+
+// NewHTTPTransport return transport for http:// or https:// URL.
+func NewHTTPTransport(rawurl string) (*HTTPTransport, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("Unsupported protocol: %s", AnonymizeURL(rawurl))
+	}
+	return &HTTPTransport{
+		URL:             strings.TrimSuffix(rawurl, "/"),
+		Client:          http.DefaultClient,
+		ProtocolVersion: 2,
+	}, nil
+}
+
+// IsHTTPURL return true if url is http:// or https://.
+func IsHTTPURL(url string) bool {
+	return strings.HasPrefix(url, "http://") || strings.HasPrefix(url, "https://")
+}
+
+func (t *HTTPTransport) newRequest(method, rawurl string, body io.Reader) (*http.Request, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	// credentials in URL are sent by basic authentication
+	var user, password string
+	if u.User != nil {
+		user = u.User.Username()
+		password, _ = u.User.Password()
+		u.User = nil
+	}
+	req, err := http.NewRequest(method, u.String(), body)
+	if err != nil {
+		return nil, err
+	}
+	if user != "" {
+		req.SetBasicAuth(user, password)
+	}
+	req.Header.Set("User-Agent", "git/"+agent)
+	return req, nil
+}
+
+func (t *HTTPTransport) do(req *http.Request) (*http.Response, error) {
+	res, err := t.Client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode == http.StatusOK {
+		return res, nil
+	}
+	res.Body.Close()
+	switch res.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden:
+		return nil, fmt.Errorf("Authentication failed for '%s'", AnonymizeURL(t.URL))
+	case http.StatusNotFound:
+		return nil, fmt.Errorf("Repository '%s' not found", AnonymizeURL(t.URL))
+	}
+	return nil, fmt.Errorf("Unable to access '%s': %s", AnonymizeURL(t.URL), res.Status)
+}
+
+// discover request ref advertisement of the service. ("git-upload-pack" or "git-receive-pack")
+func (t *HTTPTransport) discover(service string, version int) (*RefAdvertisement, error) {
+	req, err := t.newRequest("GET", t.URL+"/info/refs?service="+service, nil)
+	if err != nil {
+		return nil, err
+	}
+	if version == 2 {
+		req.Header.Set("Git-Protocol", "version=2")
+	}
+	res, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Type") != "application/x-"+service+"-advertisement" {
+		return nil, fmt.Errorf("'%s' is not a smart HTTP server", AnonymizeURL(t.URL))
+	}
+	adv, err := parseAdvertisement(newPktLineReader(res.Body))
+	if err != nil {
+		return nil, err
+	}
+	adv.applySymrefs()
+	return adv, nil
+}
+
+// rpc post request body to the service and return response body.
+func (t *HTTPTransport) rpc(service string, body []byte, version int) (io.ReadCloser, error) {
+	var payload bytes.Buffer
+	encoding := ""
+	// large requests are compressed like git does
+	if len(body) > 1024 {
+		gz := gzip.NewWriter(&payload)
+		gz.Write(body)
+		gz.Close()
+		encoding = "gzip"
+	} else {
+		payload.Write(body)
+	}
+	req, err := t.newRequest("POST", t.URL+"/"+service, &payload)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-"+service+"-request")
+	req.Header.Set("Accept", "application/x-"+service+"-result")
+	if encoding != "" {
+		req.Header.Set("Content-Encoding", encoding)
+	}
+	if version == 2 {
+		req.Header.Set("Git-Protocol", "version=2")
+	}
+	res, err := t.do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.Header.Get("Content-Type") != "application/x-"+service+"-result" {
+		res.Body.Close()
+		return nil, fmt.Errorf("Invalid response of %s from '%s'", service, AnonymizeURL(t.URL))
+	}
+	return res.Body, nil
+}
+
+// FetchRefs return refs of remote repository which can be fetched.
+func (t *HTTPTransport) FetchRefs() (*RefAdvertisement, error) {
+	adv, err := t.discover("git-upload-pack", t.ProtocolVersion)
+	if err != nil {
+		return nil, err
+	}
+	if adv.Version != 2 {
+		return adv, nil
+	}
+
+	var req bytes.Buffer
+	if err := writeLsRefsRequest(&req, lsRefsPrefixes); err != nil {
+		return nil, err
+	}
+	body, err := t.rpc("git-upload-pack", req.Bytes(), 2)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	adv.Refs, err = parseLsRefs(newPktLineReader(body))
+	if err != nil {
+		return nil, err
+	}
+	return adv, nil
+}
+
+// FetchPack request objects and return packfile with changes of shallow commits.
+// adv is the advertisement returned by FetchRefs.
+func (t *HTTPTransport) FetchPack(adv *RefAdvertisement, req *FetchRequest) (*FetchResponse, error) {
+	var b bytes.Buffer
+	if err := writeFetchRequest(&b, adv, req); err != nil {
+		return nil, err
+	}
+	body, err := t.rpc("git-upload-pack", b.Bytes(), adv.Version)
+	if err != nil {
+		return nil, err
+	}
+	res := &FetchResponse{}
+	pack, err := readFetchResponse(newPktLineReader(body), adv, t.Progress, &res.ShallowInfo)
+	if err != nil {
+		body.Close()
+		return nil, err
+	}
+	res.ReadCloser = readCloser{pack, body}
+	return res, nil
+}
+
+// PushRefs return refs of remote repository which can be updated.
+// push always uses protocol version 0.
+func (t *HTTPTransport) PushRefs() (*RefAdvertisement, error) {
+	return t.discover("git-receive-pack", 0)
+}
+
+// SendPack send update commands and packfile to remote repository.
+func (t *HTTPTransport) SendPack(adv *RefAdvertisement, cmds []*RefUpdateCommand, pack io.Reader) (*PushReport, error) {
+	var b bytes.Buffer
+	caps, err := writePushRequest(&b, adv, cmds, pack)
+	if err != nil {
+		return nil, err
+	}
+	body, err := t.rpc("git-receive-pack", b.Bytes(), 0)
+	if err != nil {
+		return nil, err
+	}
+	defer body.Close()
+	return readPushResponse(newPktLineReader(body), caps, t.Progress)
+}
+
+// Close do nothing because every request of smart HTTP is a new connection.
+func (t *HTTPTransport) Close() error {
+	return nil
+}
+
+// readCloser combine reader and closer of underlying stream.
+type readCloser struct {
+	io.Reader
+	io.Closer
+}
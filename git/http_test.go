@@ -0,0 +1,239 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// newTestServer serve repo by a minimal smart HTTP server which speaks protocol version 0.
+func newTestServer(t *testing.T, repo *GitRepository) *httptest.Server {
+	handler := http.NewServeMux()
+	handler.HandleFunc("/repo.git/info/refs", func(w http.ResponseWriter, r *http.Request) {
+		service := r.URL.Query().Get("service")
+		w.Header().Set("Content-Type", "application/x-"+service+"-advertisement")
+		writePktLine(w, "# service=%s", service)
+		writeFlush(w)
+		caps := "side-band-64k ofs-delta report-status delete-refs"
+		refs, err := ListRefs(repo, "refs/")
+		assert.NoError(t, err)
+		if head, err := ResolveRef(repo, "HEAD"); err == nil {
+			target, _ := CurrentBranch(repo)
+			caps += " symref=HEAD:" + target
+			refs = append([]*GitRef{{Name: "HEAD", Sha: head}}, refs...)
+		}
+		if len(refs) == 0 {
+			refs = []*GitRef{{Name: "capabilities^{}", Sha: zeroSha}}
+		}
+		writePktData(w, []byte(refs[0].Sha+" "+refs[0].Name+"\x00"+caps+"\n"))
+		for _, ref := range refs[1:] {
+			writePktLine(w, "%s %s", ref.Sha, ref.Name)
+		}
+		writeFlush(w)
+	})
+	handler.HandleFunc("/repo.git/git-upload-pack", func(w http.ResponseWriter, r *http.Request) {
+		pkt := newPktLineReader(requestBody(t, r))
+		var wants, haves []string
+		for {
+			line, ok, err := pkt.readLine()
+			assert.NoError(t, err)
+			if line == "done" || err != nil {
+				break
+			}
+			if !ok {
+				continue
+			}
+			fields := strings.Fields(line)
+			if fields[0] == "want" {
+				wants = append(wants, fields[1])
+			} else if fields[0] == "have" && HasObject(repo, fields[1]) {
+				haves = append(haves, fields[1])
+			}
+		}
+		objects, err := ListObjects(repo, wants, haves)
+		assert.NoError(t, err)
+		var pack bytes.Buffer
+		assert.NoError(t, WritePack(repo, &pack, objects))
+
+		w.Header().Set("Content-Type", "application/x-git-upload-pack-result")
+		writePktLine(w, "NAK")
+		for pack.Len() > 0 {
+			writePktData(w, append([]byte{sidebandData}, pack.Next(1000)...))
+		}
+		writeFlush(w)
+	})
+	handler.HandleFunc("/repo.git/git-receive-pack", func(w http.ResponseWriter, r *http.Request) {
+		body := bufio.NewReader(requestBody(t, r))
+		pkt := newPktLineReader(body)
+		lines, err := pkt.readLines()
+		assert.NoError(t, err)
+		if _, err := body.Peek(1); err == nil {
+			_, err := IndexPack(repo, body, true)
+			assert.NoError(t, err)
+		}
+
+		var report bytes.Buffer
+		writePktLine(&report, "unpack ok")
+		for _, line := range lines {
+			fields := strings.Fields(strings.SplitN(line, "\x00", 2)[0])
+			if fields[1] == zeroSha {
+				assert.NoError(t, DeleteRef(repo, fields[2]))
+			} else {
+				assert.NoError(t, UpdateRef(repo, fields[2], fields[1], "push"))
+			}
+			writePktLine(&report, "ok %s", fields[2])
+		}
+		writeFlush(&report)
+
+		w.Header().Set("Content-Type", "application/x-git-receive-pack-result")
+		writePktData(w, append([]byte{sidebandData}, report.Bytes()...))
+		writeFlush(w)
+	})
+	return httptest.NewServer(handler)
+}
+
+func requestBody(t *testing.T, r *http.Request) io.Reader {
+	if r.Header.Get("Content-Encoding") != "gzip" {
+		return r.Body
+	}
+	gz, err := gzip.NewReader(r.Body)
+	assert.NoError(t, err)
+	return gz
+}
+
+func TestCloneFetchPush(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	first := writeTestCommit(t, src, "first")
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", first, ""))
+	assert.NoError(t, UpdateRef(src, "refs/tags/v1", first, ""))
+	server := newTestServer(t, src)
+	defer server.Close()
+	url := server.URL + "/repo.git"
+
+	dir := filepath.Join(newTempDir(t), "clone")
+	defer os.RemoveAll(filepath.Dir(dir))
+	repo, err := Clone(url, dir, CloneOptions{})
+	assert.NoError(t, err)
+	head, err := ResolveRef(repo, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, first, head)
+	tracking, _ := ResolveRef(repo, "refs/remotes/origin/master")
+	assert.Equal(t, first, tracking)
+	tag, _ := ResolveRef(repo, "refs/tags/v1")
+	assert.Equal(t, first, tag)
+	cfg, err := LoadConfig(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/heads/master", cfg.GetString("branch.master.merge", ""))
+
+	_, err = Clone(url, dir, CloneOptions{})
+	assert.Error(t, err)
+
+	// fetch new commit of remote
+	second := writeTestCommit(t, src, "second", first)
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", second, ""))
+	updates, err := Fetch(repo, "origin", FetchOptions{})
+	assert.NoError(t, err)
+	tracking, _ = ResolveRef(repo, "refs/remotes/origin/master")
+	assert.Equal(t, second, tracking)
+	for _, u := range updates {
+		if u.Local == "refs/remotes/origin/master" {
+			assert.Equal(t, first, u.Old)
+			assert.False(t, u.Forced)
+		}
+	}
+	fetchHead, err := ioutil.ReadFile(repo.RepoPath("FETCH_HEAD"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(fetchHead), second+"\t\tbranch 'master' of "+url)
+
+	// push local commit
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+	third := writeTestCommit(t, repo, "third", second)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", third, ""))
+	pushed, err := Push(repo, "origin", nil, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	remoteHead, _ := ResolveRef(src, "refs/heads/master")
+	assert.Equal(t, third, remoteHead)
+	tracking, _ = ResolveRef(repo, "refs/remotes/origin/master")
+	assert.Equal(t, third, tracking)
+
+	pushed, err = Push(repo, "origin", []string{"master:topic"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.True(t, pushed[0].IsNew())
+	pushed, err = Push(repo, "origin", nil, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushUpToDate, pushed[0].Status)
+
+	// non-fast-forward is rejected unless forced
+	pushed, err = Push(repo, "origin", []string{first + ":refs/heads/master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushRejected, pushed[0].Status)
+	assert.Equal(t, "non-fast-forward", pushed[0].Reason)
+	pushed, err = Push(repo, "origin", []string{"+" + first + ":refs/heads/master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	assert.True(t, pushed[0].Forced)
+
+	pushed, err = Push(repo, "origin", []string{":topic"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	_, err = ResolveRef(src, "refs/heads/topic")
+	assert.Error(t, err)
+	_, err = ResolveRef(repo, "refs/remotes/origin/topic")
+	assert.Error(t, err)
+}
+
+func TestCloneEmpty(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	server := newTestServer(t, src)
+	defer server.Close()
+
+	dir := filepath.Join(newTempDir(t), "clone")
+	defer os.RemoveAll(filepath.Dir(dir))
+	repo, err := Clone(server.URL+"/repo.git", dir, CloneOptions{})
+	assert.Equal(t, ErrEmptyRepository, err)
+	assert.NotNil(t, repo)
+	assert.DirExists(t, dir)
+
+	_, err = Clone(server.URL+"/missing.git", filepath.Join(filepath.Dir(dir), "missing"), CloneOptions{})
+	assert.Error(t, err)
+	_, err = os.Stat(filepath.Join(filepath.Dir(dir), "missing"))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestHTTPHidesCredentials(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	first := writeTestCommit(t, src, "first")
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", first, ""))
+	server := newTestServer(t, src)
+	defer server.Close()
+	url := strings.Replace(server.URL, "://", "://user:secret@", 1)
+
+	dir := filepath.Join(newTempDir(t), "clone")
+	defer os.RemoveAll(filepath.Dir(dir))
+	repo, err := Clone(url+"/repo.git", dir, CloneOptions{})
+	assert.NoError(t, err)
+	_, err = Fetch(repo, "origin", FetchOptions{})
+	assert.NoError(t, err)
+	fetchHead, err := ioutil.ReadFile(repo.RepoPath("FETCH_HEAD"))
+	assert.NoError(t, err)
+	assert.Contains(t, string(fetchHead), "branch 'master' of "+server.URL+"/repo.git")
+	assert.NotContains(t, string(fetchHead), "secret")
+
+	_, err = Clone(url+"/missing.git", filepath.Join(filepath.Dir(dir), "missing"), CloneOptions{})
+	assert.Error(t, err)
+	assert.NotContains(t, err.Error(), "secret")
+}
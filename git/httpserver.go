@@ -0,0 +1,220 @@
+package git
+
+import (
+	"bufio"
+	"compress/gzip"
+	"crypto/subtle"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// HTTPServer serve repositories under Root by smart HTTP protocol.
+//
+// access to each repository is decided by its config like git-http-backend.
+// http.uploadpack allows fetch (default true), and http.receivepack allows push
+// (default true only for authenticated users). http.user restricts the repository to listed users.
+type HTTPServer struct {
+	// Root is the directory which contains repositories.
+	Root string
+	// Users is user names and passwords of basic authentication.
+	// requests without valid credentials are anonymous.
+	Users map[string]string
+	// Logger logs errors of requests if it is not nil.
+	Logger *log.Logger
+}
+
+// LoadHTTPUsers read "user:password" lines of file. empty lines and lines starting with "#" are ignored.
+func LoadHTTPUsers(file string) (map[string]string, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	users := map[string]string{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		colon := strings.IndexByte(line, ':')
+		if colon <= 0 {
+			return nil, fmt.Errorf("Invalid line %d of %s", n, file)
+		}
+		users[line[:colon]] = line[colon+1:]
+	}
+	return users, scanner.Err()
+}
+
+func (s *HTTPServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	repoPath, action := splitServicePath(r.URL.Path)
+	service := ""
+	switch {
+	case action == "info/refs" && r.Method == "GET":
+		service = r.URL.Query().Get("service")
+	case (action == "git-upload-pack" || action == "git-receive-pack") && r.Method == "POST":
+		service = action
+	default:
+		http.NotFound(w, r)
+		return
+	}
+	if service != "git-upload-pack" && service != "git-receive-pack" {
+		http.Error(w, "only smart HTTP protocol is supported", http.StatusForbidden)
+		return
+	}
+
+	user, ok := s.authenticate(r)
+	if !ok {
+		s.requireAuth(w)
+		return
+	}
+	repo, err := s.openRepository(repoPath)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	allowed, err := httpAccessAllowed(repo, user, service)
+	if err != nil {
+		s.logf("%s: %s", repoPath, err)
+		http.Error(w, "server error", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		if user == "" {
+			s.requireAuth(w)
+		} else {
+			http.Error(w, "access denied", http.StatusForbidden)
+		}
+		return
+	}
+
+	if action == "info/refs" {
+		err = s.serveAdvertisement(w, r, repo, service)
+	} else {
+		err = s.serveRPC(w, r, repo, service)
+	}
+	if err != nil {
+		s.logf("%s %s: %s", service, repoPath, err)
+	}
+}
+
+// splitServicePath split URL path into repository path and action.
+// ex) "/team/repo.git/info/refs" -> "team/repo.git", "info/refs"
+func splitServicePath(urlPath string) (string, string) {
+	urlPath = path.Clean("/" + urlPath)
+	for _, action := range []string{"info/refs", "git-upload-pack", "git-receive-pack"} {
+		if strings.HasSuffix(urlPath, "/"+action) {
+			return strings.TrimPrefix(strings.TrimSuffix(urlPath, "/"+action), "/"), action
+		}
+	}
+	return "", ""
+}
+
+// authenticate check basic authentication. return empty user for anonymous request.
+// ok is false if the credentials are wrong.
+func (s *HTTPServer) authenticate(r *http.Request) (string, bool) {
+	user, password, hasAuth := r.BasicAuth()
+	if !hasAuth {
+		return "", true
+	}
+	expected, known := s.Users[user]
+	if !known || subtle.ConstantTimeCompare([]byte(password), []byte(expected)) != 1 {
+		return "", false
+	}
+	return user, true
+}
+
+func (s *HTTPServer) requireAuth(w http.ResponseWriter) {
+	w.Header().Set("WWW-Authenticate", `Basic realm="mygit"`)
+	http.Error(w, "authentication required", http.StatusUnauthorized)
+}
+
+// openRepository open repository at path relative to Root.
+func (s *HTTPServer) openRepository(repoPath string) (*GitRepository, error) {
+	if repoPath == "" {
+		return nil, fmt.Errorf("No repository")
+	}
+	return EnterRepository(filepath.Join(s.Root, filepath.FromSlash(repoPath)))
+}
+
+// httpAccessAllowed return true if user can use the service of repo.
+func httpAccessAllowed(repo *GitRepository, user, service string) (bool, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return false, err
+	}
+	if users := cfg.GetAll("http.user"); len(users) > 0 {
+		listed := false
+		for _, u := range users {
+			listed = listed || u == user
+		}
+		if !listed {
+			return false, nil
+		}
+	}
+	if service == "git-upload-pack" {
+		return cfg.GetBool("http.uploadpack", true)
+	}
+	return cfg.GetBool("http.receivepack", user != "")
+}
+
+// serveAdvertisement respond to "info/refs?service=<service>".
+func (s *HTTPServer) serveAdvertisement(w http.ResponseWriter, r *http.Request, repo *GitRepository, service string) error {
+	version := 0
+	if service == "git-upload-pack" {
+		version = ParseProtocolVersion(r.Header.Get("Git-Protocol"))
+	}
+	w.Header().Set("Content-Type", "application/x-"+service+"-advertisement")
+	w.Header().Set("Cache-Control", "no-cache")
+	if version != 2 {
+		writePktLine(w, "# service=%s", service)
+		writeFlush(w)
+	}
+	if service == "git-upload-pack" {
+		return UploadPack(repo, nil, w, UploadPackOptions{Version: version, AdvertiseRefs: true})
+	}
+	return ReceivePack(repo, nil, w, ReceivePackOptions{AdvertiseRefs: true})
+}
+
+// serveRPC respond to POST request of the service. gzip request body is decompressed.
+func (s *HTTPServer) serveRPC(w http.ResponseWriter, r *http.Request, repo *GitRepository, service string) error {
+	if r.Header.Get("Content-Type") != "application/x-"+service+"-request" {
+		http.Error(w, "invalid content type", http.StatusUnsupportedMediaType)
+		return nil
+	}
+	var body io.Reader = r.Body
+	switch r.Header.Get("Content-Encoding") {
+	case "gzip", "x-gzip":
+		gz, err := gzip.NewReader(r.Body)
+		if err != nil {
+			http.Error(w, "invalid gzip body", http.StatusBadRequest)
+			return err
+		}
+		defer gz.Close()
+		body = gz
+	case "":
+	default:
+		http.Error(w, "unsupported content encoding", http.StatusUnsupportedMediaType)
+		return nil
+	}
+
+	w.Header().Set("Content-Type", "application/x-"+service+"-result")
+	w.Header().Set("Cache-Control", "no-cache")
+	if service == "git-upload-pack" {
+		version := ParseProtocolVersion(r.Header.Get("Git-Protocol"))
+		return UploadPack(repo, body, w, UploadPackOptions{Version: version, StatelessRPC: true})
+	}
+	return ReceivePack(repo, body, w, ReceivePackOptions{StatelessRPC: true})
+}
+
+func (s *HTTPServer) logf(format string, args ...interface{}) {
+	if s.Logger != nil {
+		s.Logger.Printf(format, args...)
+	}
+}
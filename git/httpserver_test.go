@@ -0,0 +1,124 @@
+package git
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSplitServicePath(t *testing.T) {
+	tests := []struct {
+		path   string
+		repo   string
+		action string
+	}{
+		{"/repo.git/info/refs", "repo.git", "info/refs"},
+		{"/team/repo.git/git-upload-pack", "team/repo.git", "git-upload-pack"},
+		{"/../../repo/git-receive-pack", "repo", "git-receive-pack"},
+		{"/repo.git/HEAD", "", ""},
+	}
+	for _, tt := range tests {
+		repo, action := splitServicePath(tt.path)
+		assert.Equal(t, tt.repo, repo, tt.path)
+		assert.Equal(t, tt.action, action, tt.path)
+	}
+}
+
+func TestHTTPServer(t *testing.T) {
+	root := newTempDir(t)
+	defer os.RemoveAll(root)
+	remote, err := InitRepository(filepath.Join(root, "repo.git"), InitOptions{Bare: true})
+	assert.NoError(t, err)
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	first := writeTestCommit(t, src, "first")
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", first, ""))
+	_, err = Push(src, remote.GitDir, []string{"master"}, PushOptions{})
+	assert.NoError(t, err)
+
+	server := httptest.NewServer(&HTTPServer{Root: root, Users: map[string]string{"alice": "secret"}})
+	defer server.Close()
+
+	// test repositories are anywhere in the file system
+	anyRepo := httptest.NewServer(&HTTPServer{Root: "/"})
+	defer anyRepo.Close()
+	for _, version := range []int{0, 2} {
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			testFetchFrom(t, func(path string) string { return anyRepo.URL + filepath.ToSlash(path) }, version)
+		})
+	}
+
+	dir := filepath.Join(newTempDir(t), "clone")
+	defer os.RemoveAll(filepath.Dir(dir))
+	repo, err := Clone(server.URL+"/repo", dir, CloneOptions{})
+	assert.NoError(t, err)
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+
+	// anonymous push is denied
+	_, err = Push(repo, "origin", nil, PushOptions{})
+	assert.Error(t, err)
+	_, err = Push(repo, strings.Replace(server.URL, "http://", "http://alice:wrong@", 1)+"/repo.git", []string{"master"}, PushOptions{})
+	assert.Error(t, err)
+
+	pushed, err := Push(repo, strings.Replace(server.URL, "http://", "http://alice:secret@", 1)+"/repo.git", []string{"master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	sha, _ := ResolveRef(remote, "refs/heads/master")
+	assert.Equal(t, second, sha)
+
+	// fetch is denied by http.uploadpack
+	cfg, err := ReadConfig(remote)
+	assert.NoError(t, err)
+	cfg.Set("http", "", "uploadpack", "false")
+	assert.NoError(t, WriteConfig(remote, cfg))
+	_, err = Fetch(repo, "origin", FetchOptions{})
+	assert.Error(t, err)
+}
+
+func TestHTTPServerGzipRequest(t *testing.T) {
+	root := newTempDir(t)
+	defer os.RemoveAll(root)
+	repo, err := InitRepository(filepath.Join(root, "repo.git"), InitOptions{Bare: true})
+	assert.NoError(t, err)
+	first := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", first, ""))
+	server := httptest.NewServer(&HTTPServer{Root: root})
+	defer server.Close()
+
+	var body bytes.Buffer
+	gz := gzip.NewWriter(&body)
+	writePktLine(gz, "want %s", first)
+	writeFlush(gz)
+	writePktLine(gz, "done")
+	gz.Close()
+	req, err := http.NewRequest("POST", server.URL+"/repo.git/git-upload-pack", &body)
+	assert.NoError(t, err)
+	req.Header.Set("Content-Type", "application/x-git-upload-pack-request")
+	req.Header.Set("Content-Encoding", "gzip")
+	res, err := http.DefaultClient.Do(req)
+	assert.NoError(t, err)
+	defer res.Body.Close()
+	assert.Equal(t, http.StatusOK, res.StatusCode)
+	assert.Equal(t, "application/x-git-upload-pack-result", res.Header.Get("Content-Type"))
+	line, _, err := newPktLineReader(res.Body).readLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "NAK", line)
+
+	res, err = http.Get(server.URL + "/repo.git/info/refs")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusForbidden, res.StatusCode)
+	res, err = http.Get(server.URL + "/missing.git/info/refs?service=git-upload-pack")
+	assert.NoError(t, err)
+	res.Body.Close()
+	assert.Equal(t, http.StatusNotFound, res.StatusCode)
+}
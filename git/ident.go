@@ -0,0 +1,151 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"os/user"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// AuthorIdent return author identity from GIT_AUTHOR_* environment variables or user config.
+func AuthorIdent(repo *GitRepository) (GitUser, error) {
+	return ident(repo, "AUTHOR", "author")
+}
+
+// CommitterIdent return committer identity from GIT_COMMITTER_* environment variables or user config.
+func CommitterIdent(repo *GitRepository) (GitUser, error) {
+	return ident(repo, "COMMITTER", "committer")
+}
+
+func ident(repo *GitRepository, env, section string) (GitUser, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return GitUser{}, err
+	}
+	name := os.Getenv("GIT_" + env + "_NAME")
+	if name == "" {
+		name = cfg.GetString(section+".name", cfg.GetString("user.name", ""))
+	}
+	email := os.Getenv("GIT_" + env + "_EMAIL")
+	if email == "" {
+		email = cfg.GetString(section+".email", cfg.GetString("user.email", os.Getenv("EMAIL")))
+	}
+	if name == "" || email == "" {
+		u, err := user.Current()
+		if err != nil {
+			return GitUser{}, err
+		}
+		host, _ := os.Hostname()
+		if name == "" {
+			name = u.Username
+		}
+		if email == "" {
+			email = u.Username + "@" + host
+		}
+	}
+
+	now := time.Now()
+	if date := os.Getenv("GIT_" + env + "_DATE"); date != "" {
+		t, err := ParseDate(date, now)
+		if err != nil {
+			return GitUser{}, err
+		}
+		now = t
+	}
+	return NewGitUser(name, email, now), nil
+}
+
+// ParseDate parse date in git's formats.
+// "<unix> <tz>", "@<unix>", RFC 3339, RFC 2822, "YYYY-MM-DD [HH:MM:SS]",
+// and relative dates such as "now", "yesterday", "2 weeks ago", "3.days.ago".
+func ParseDate(s string, now time.Time) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty date")
+	}
+
+	// "<unix timestamp> [<timezone>]" which is used in objects
+	fields := strings.Fields(strings.TrimPrefix(s, "@"))
+	if len(fields) == 1 || len(fields) == 2 && isTimezoneOffset(fields[1]) {
+		if _, err := strconv.ParseUint(fields[0], 10, 64); err == nil {
+			if len(fields) == 1 {
+				fields = append(fields, "+0000")
+			}
+			return GitUser{Time: strings.Join(fields, " ")}.When()
+		}
+	}
+
+	layouts := []string{
+		time.RFC3339,
+		time.RFC1123Z,
+		"Mon, 2 Jan 2006 15:04:05 -0700",
+		"Mon Jan 2 15:04:05 2006 -0700",
+		"2006-01-02 15:04:05 -0700",
+		"2006-01-02T15:04:05",
+		"2006-01-02 15:04:05",
+		"2006-01-02",
+	}
+	for _, layout := range layouts {
+		if t, err := time.ParseInLocation(layout, s, now.Location()); err == nil {
+			return t, nil
+		}
+	}
+	return parseRelativeDate(s, now)
+}
+
+// isTimezoneOffset return true if s is a timezone like "+0900".
+func isTimezoneOffset(s string) bool {
+	if len(s) != 5 || s[0] != '+' && s[0] != '-' {
+		return false
+	}
+	_, err := strconv.ParseUint(s[1:], 10, 16)
+	return err == nil
+}
+
+var dateUnits = map[string]time.Duration{
+	"second": time.Second,
+	"minute": time.Minute,
+	"hour":   time.Hour,
+	"day":    24 * time.Hour,
+	"week":   7 * 24 * time.Hour,
+}
+
+func parseRelativeDate(s string, now time.Time) (time.Time, error) {
+	words := strings.Fields(strings.ToLower(strings.ReplaceAll(s, ".", " ")))
+	switch strings.Join(words, " ") {
+	case "now":
+		return now, nil
+	case "yesterday":
+		return now.AddDate(0, 0, -1), nil
+	}
+	// "<n> <unit>[s]" is repeated and followed by optional "ago". ex) "1 year 2 months ago", "3 days"
+	if len(words) > 0 && words[len(words)-1] == "ago" {
+		words = words[:len(words)-1]
+	}
+	if len(words) == 0 || len(words)%2 != 0 {
+		return time.Time{}, fmt.Errorf("invalid date: %s", s)
+	}
+	t := now
+	for i := 0; i < len(words); i += 2 {
+		n, err := strconv.Atoi(words[i])
+		if err != nil {
+			return time.Time{}, fmt.Errorf("invalid date: %s", s)
+		}
+		unit := strings.TrimSuffix(words[i+1], "s")
+		switch unit {
+		case "month":
+			t = t.AddDate(0, -n, 0)
+		case "year":
+			t = t.AddDate(-n, 0, 0)
+		default:
+			d, ok := dateUnits[unit]
+			if !ok {
+				return time.Time{}, fmt.Errorf("invalid date: %s", s)
+			}
+			t = t.Add(-time.Duration(n) * d)
+		}
+	}
+	return t, nil
+}
@@ -0,0 +1,343 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// ignorePattern is a pattern of gitignore.
+// base is the directory of the file where the pattern is written, relative to worktree.
+type ignorePattern struct {
+	pattern  string
+	base     string
+	negative bool
+	dirOnly  bool
+	noSlash  bool
+}
+
+// parseIgnorePattern parse a line of gitignore. nil is returned for blank lines and comments.
+func parseIgnorePattern(line, base string) *ignorePattern {
+	line = strings.TrimSuffix(line, "\r")
+	// trailing spaces are ignored unless they are escaped
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, "\\ ") {
+		line = line[:len(line)-1]
+	}
+	if line == "" || line[0] == '#' {
+		return nil
+	}
+	p := &ignorePattern{base: base}
+	if line[0] == '!' {
+		p.negative = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, "\\!") || strings.HasPrefix(line, "\\#") {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") {
+		p.dirOnly = true
+		line = strings.TrimRight(line, "/")
+	}
+	p.noSlash = !strings.Contains(line, "/")
+	p.pattern = strings.TrimPrefix(line, "/")
+	if p.pattern == "" {
+		return nil
+	}
+	return p
+}
+
+// parseIgnoreFile return patterns in the content of gitignore file.
+func parseIgnoreFile(data []byte, base string) []*ignorePattern {
+	var patterns []*ignorePattern
+	for _, line := range strings.Split(string(data), "\n") {
+		if p := parseIgnorePattern(line, base); p != nil {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// match return true if the path relative to worktree matches the pattern.
+func (p *ignorePattern) match(name string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	if p.base != "" {
+		if !strings.HasPrefix(name, p.base+"/") {
+			return false
+		}
+		name = name[len(p.base)+1:]
+	}
+	if p.noSlash {
+		return wildmatch(p.pattern, path.Base(name), true)
+	}
+	return wildmatch(p.pattern, name, true)
+}
+
+// IgnoreMatcher decide whether paths are ignored by gitignore rules.
+// patterns given explicitly take precedence over .gitignore in directories from the deepest one,
+// then $GIT_DIR/info/exclude and core.excludesFile.
+type IgnoreMatcher struct {
+	repo     *GitRepository
+	explicit []*ignorePattern
+	perDir   string
+	dirs     map[string][]*ignorePattern
+	files    [][]*ignorePattern
+}
+
+// NewIgnoreMatcher return a matcher of patterns.
+// if standard is true, .gitignore in each directory, info/exclude and core.excludesFile are also used.
+func NewIgnoreMatcher(repo *GitRepository, patterns []string, standard bool) (*IgnoreMatcher, error) {
+	m := &IgnoreMatcher{repo: repo, dirs: map[string][]*ignorePattern{}}
+	for _, line := range patterns {
+		if p := parseIgnorePattern(line, ""); p != nil {
+			m.explicit = append(m.explicit, p)
+		}
+	}
+	if !standard {
+		return m, nil
+	}
+	m.perDir = ".gitignore"
+	if err := m.AddExcludeFile(repo.RepoPath("info/exclude")); err != nil {
+		return nil, err
+	}
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	excludes, ok := cfg.GetPath("core.excludesFile")
+	if !ok {
+		xdg := os.Getenv("XDG_CONFIG_HOME")
+		if home, _ := os.UserHomeDir(); xdg == "" && home != "" {
+			xdg = filepath.Join(home, ".config")
+		}
+		if xdg != "" {
+			excludes = filepath.Join(xdg, "git", "ignore")
+		}
+	}
+	if excludes != "" {
+		if err := m.AddExcludeFile(excludes); err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// AddExcludeFile add patterns in the file, which take precedence below the files already added.
+// a file which does not exist is ignored.
+func (m *IgnoreMatcher) AddExcludeFile(file string) error {
+	data, err := ioutil.ReadFile(file)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	m.files = append(m.files, parseIgnoreFile(data, ""))
+	return nil
+}
+
+// SetPerDirectory set the name of files read in each directory instead of .gitignore.
+func (m *IgnoreMatcher) SetPerDirectory(name string) {
+	m.perDir = name
+	m.dirs = map[string][]*ignorePattern{}
+}
+
+// dirPatterns return patterns of the per-directory file in dir. "" is the top directory.
+func (m *IgnoreMatcher) dirPatterns(dir string) []*ignorePattern {
+	if patterns, ok := m.dirs[dir]; ok {
+		return patterns
+	}
+	data, err := ioutil.ReadFile(worktreeFile(m.repo, path.Join(dir, m.perDir)))
+	var patterns []*ignorePattern
+	if err == nil {
+		patterns = parseIgnoreFile(data, dir)
+	}
+	m.dirs[dir] = patterns
+	return patterns
+}
+
+// Match return true if the path is ignored by its own patterns.
+// rules of leading directories are not checked, see IsIgnored.
+func (m *IgnoreMatcher) Match(name string, isDir bool) bool {
+	if matched, ok := matchPatterns(m.explicit, name, isDir); ok {
+		return matched
+	}
+	if m.perDir != "" {
+		dir := name
+		for dir != "" {
+			dir = path.Dir(dir)
+			if dir == "." {
+				dir = ""
+			}
+			if matched, ok := matchPatterns(m.dirPatterns(dir), name, isDir); ok {
+				return matched
+			}
+		}
+	}
+	for _, patterns := range m.files {
+		if matched, ok := matchPatterns(patterns, name, isDir); ok {
+			return matched
+		}
+	}
+	return false
+}
+
+// IsIgnored return true if the path or one of its leading directories is ignored.
+func (m *IgnoreMatcher) IsIgnored(name string, isDir bool) bool {
+	for i := 0; i < len(name); i++ {
+		if name[i] == '/' && m.Match(name[:i], true) {
+			return true
+		}
+	}
+	return m.Match(name, isDir)
+}
+
+// matchPatterns return the result of the last pattern which matches the path.
+// ok is false if no pattern matches.
+func matchPatterns(patterns []*ignorePattern, name string, isDir bool) (matched, ok bool) {
+	for i := len(patterns) - 1; i >= 0; i-- {
+		if patterns[i].match(name, isDir) {
+			return !patterns[i].negative, true
+		}
+	}
+	return false, false
+}
+
+// wildmatch match text to the shell glob pattern like git's wildmatch.
+// if pathname is true, wildcards do not match "/" except "**" between slashes.
+func wildmatch(pattern, text string, pathname bool) bool {
+	return wildmatchAt(pattern, 0, text, pathname)
+}
+
+func wildmatchAt(pattern string, pi int, text string, pathname bool) bool {
+	for pi < len(pattern) {
+		c := pattern[pi]
+		switch c {
+		case '?':
+			if text == "" || pathname && text[0] == '/' {
+				return false
+			}
+			pi++
+			text = text[1:]
+			continue
+		case '*':
+			start := pi
+			for pi < len(pattern) && pattern[pi] == '*' {
+				pi++
+			}
+			if pathname && pi-start >= 2 && (start == 0 || pattern[start-1] == '/') && (pi == len(pattern) || pattern[pi] == '/') {
+				if pi == len(pattern) {
+					return true
+				}
+				// "**/" matches zero or more directories
+				pi++
+				for {
+					if wildmatchAt(pattern, pi, text, pathname) {
+						return true
+					}
+					slash := strings.IndexByte(text, '/')
+					if slash < 0 {
+						return false
+					}
+					text = text[slash+1:]
+				}
+			}
+			if pi == len(pattern) {
+				return !pathname || !strings.Contains(text, "/")
+			}
+			for i := 0; i <= len(text); i++ {
+				if wildmatchAt(pattern, pi, text[i:], pathname) {
+					return true
+				}
+				if i < len(text) && pathname && text[i] == '/' {
+					return false
+				}
+			}
+			return false
+		case '[':
+			if text == "" || pathname && text[0] == '/' {
+				return false
+			}
+			if n, matched := matchBracket(pattern[pi:], text[0]); n > 0 {
+				if !matched {
+					return false
+				}
+				pi += n
+				text = text[1:]
+				continue
+			}
+		case '\\':
+			if pi+1 < len(pattern) {
+				pi++
+				c = pattern[pi]
+			}
+		}
+		if text == "" || text[0] != c {
+			return false
+		}
+		pi++
+		text = text[1:]
+	}
+	return text == ""
+}
+
+// bracketClasses are character classes in brackets. ex) "[[:digit:]]"
+var bracketClasses = map[string]func(byte) bool{
+	"alnum":  func(c byte) bool { return isAlpha(c) || isDigit(c) },
+	"alpha":  isAlpha,
+	"blank":  func(c byte) bool { return c == ' ' || c == '\t' },
+	"digit":  isDigit,
+	"lower":  func(c byte) bool { return 'a' <= c && c <= 'z' },
+	"upper":  func(c byte) bool { return 'A' <= c && c <= 'Z' },
+	"space":  func(c byte) bool { return strings.IndexByte(" \t\n\r\v\f", c) >= 0 },
+	"punct":  func(c byte) bool { return 0x21 <= c && c <= 0x7e && !isAlpha(c) && !isDigit(c) },
+	"xdigit": func(c byte) bool { return isDigit(c) || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F' },
+}
+
+func isAlpha(c byte) bool { return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' }
+func isDigit(c byte) bool { return '0' <= c && c <= '9' }
+
+// matchBracket match c to the bracket expression at the beginning of pattern.
+// n is the length of the expression, which is 0 if the bracket is not closed.
+func matchBracket(pattern string, c byte) (n int, matched bool) {
+	i := 1
+	negate := false
+	if i < len(pattern) && (pattern[i] == '!' || pattern[i] == '^') {
+		negate = true
+		i++
+	}
+	for first := true; i < len(pattern); first = false {
+		ch := pattern[i]
+		if ch == ']' && !first {
+			return i + 1, matched != negate
+		}
+		if ch == '[' && i+1 < len(pattern) && pattern[i+1] == ':' {
+			if end := strings.Index(pattern[i+2:], ":]"); end >= 0 {
+				if class, ok := bracketClasses[pattern[i+2:i+2+end]]; ok {
+					matched = matched || class(c)
+					i += end + 4
+					continue
+				}
+			}
+		}
+		if ch == '\\' && i+1 < len(pattern) {
+			i++
+			ch = pattern[i]
+		}
+		if i+2 < len(pattern) && pattern[i+1] == '-' && pattern[i+2] != ']' {
+			hi := pattern[i+2]
+			if hi == '\\' && i+3 < len(pattern) {
+				i++
+				hi = pattern[i+2]
+			}
+			matched = matched || ch <= c && c <= hi
+			i += 3
+			continue
+		}
+		matched = matched || ch == c
+		i++
+	}
+	return 0, false
+}
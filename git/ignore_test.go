@@ -0,0 +1,78 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWildmatch(t *testing.T) {
+	cases := []struct {
+		pattern, text string
+		pathname      bool
+		want          bool
+	}{
+		{"*.o", "a.o", true, true},
+		{"*.o", "d/a.o", true, false},
+		{"*.o", "d/a.o", false, true},
+		{"a?c", "abc", true, true},
+		{"a?c", "a/c", true, false},
+		{"**/foo", "foo", true, true},
+		{"**/foo", "a/b/foo", true, true},
+		{"foo/**", "foo/a/b", true, true},
+		{"a/**/b", "a/b", true, true},
+		{"a/**/b", "a/x/y/b", true, true},
+		{"[a-c]x", "bx", true, true},
+		{"[!a-c]x", "bx", true, false},
+		{"[[:digit:]]x", "1x", true, true},
+		{"\\*", "*", true, true},
+		{"\\*", "a", true, false},
+	}
+	for _, c := range cases {
+		assert.Equal(t, c.want, wildmatch(c.pattern, c.text, c.pathname), "%s %s", c.pattern, c.text)
+	}
+}
+
+func TestIgnoreMatcher(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	os.Setenv("XDG_CONFIG_HOME", repo.Worktree)
+	defer os.Unsetenv("XDG_CONFIG_HOME")
+	write := func(name, content string) {
+		file := filepath.Join(repo.Worktree, name)
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	write(".gitignore", "*.log\n!keep.log\n/top\nbuild/\n")
+	write("sub/.gitignore", "keep.log\n")
+	write(".git/info/exclude", "*.tmp\n")
+
+	m, err := NewIgnoreMatcher(repo, nil, true)
+	assert.NoError(t, err)
+	assert.True(t, m.IsIgnored("a.log", false))
+	assert.True(t, m.IsIgnored("d/a.log", false))
+	assert.False(t, m.IsIgnored("keep.log", false))
+	// the deeper .gitignore takes precedence
+	assert.True(t, m.IsIgnored("sub/keep.log", false))
+	// anchored patterns match only at the directory of .gitignore
+	assert.True(t, m.IsIgnored("top", false))
+	assert.False(t, m.IsIgnored("d/top", false))
+	// directory only patterns
+	assert.False(t, m.IsIgnored("build", false))
+	assert.True(t, m.IsIgnored("build", true))
+	assert.True(t, m.IsIgnored("build/out.c", false))
+	assert.False(t, m.Match("build/out.c", false))
+	assert.True(t, m.IsIgnored("x.tmp", false))
+
+	// explicit patterns override files
+	m, err = NewIgnoreMatcher(repo, []string{"!a.log"}, true)
+	assert.NoError(t, err)
+	assert.False(t, m.IsIgnored("a.log", false))
+
+	m, err = NewIgnoreMatcher(repo, nil, false)
+	assert.NoError(t, err)
+	assert.False(t, m.IsIgnored("a.log", false))
+}
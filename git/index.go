@@ -0,0 +1,211 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"sort"
+	"strings"
+)
+
+// Stage return merge stage of the entry. 0 is a normal entry, 1 is the common ancestor,
+// 2 is ours and 3 is theirs of a conflicted path.
+func (e *IndexEntry) Stage() int {
+	return int(e.Flags>>12) & 3
+}
+
+// newIndexEntryFromTree return an index entry of the tree entry without stat information.
+func newIndexEntryFromTree(name string, entry *GitTreeEntry, stage int) *IndexEntry {
+	return &IndexEntry{
+		Mode:     entry.Mode,
+		ObjectID: entry.Sha,
+		Flags:    entryFlags(name, stage),
+		FilePath: name,
+	}
+}
+
+// entryFlags return flags of an index entry, which hold the stage and the length of the name.
+func entryFlags(name string, stage int) uint16 {
+	length := len(name)
+	if length > 0xfff {
+		length = 0xfff
+	}
+	return uint16(stage<<12 | length)
+}
+
+// rename change the path of the entry, keeping its stage.
+func (e *IndexEntry) rename(name string) {
+	e.Flags = entryFlags(name, e.Stage())
+	e.FilePath = name
+}
+
+// ReadIndexOrEmpty read index, and return an empty index if it does not exist yet.
+func ReadIndexOrEmpty(repo *GitRepository) (*GitIndex, error) {
+	index, err := ReadIndex(repo)
+	if os.IsNotExist(err) {
+		return &GitIndex{}, nil
+	}
+	return index, err
+}
+
+// SortIndex sort entries by path and stage, which is the order of index file.
+func SortIndex(index *GitIndex) {
+	sort.SliceStable(index.Entries, func(i, j int) bool {
+		a, b := index.Entries[i], index.Entries[j]
+		if a.FilePath != b.FilePath {
+			return a.FilePath < b.FilePath
+		}
+		return a.Stage() < b.Stage()
+	})
+}
+
+// Entry return the entry of stage 0 at the path, or nil.
+func (index *GitIndex) Entry(name string) *IndexEntry {
+	for _, e := range index.Entries {
+		if e.FilePath == name && e.Stage() == 0 {
+			return e
+		}
+	}
+	return nil
+}
+
+// Conflicts return sorted paths which have entries of non-zero stages.
+func (index *GitIndex) Conflicts() []string {
+	seen := map[string]bool{}
+	var paths []string
+	for _, e := range index.Entries {
+		if e.Stage() != 0 && !seen[e.FilePath] {
+			seen[e.FilePath] = true
+			paths = append(paths, e.FilePath)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+// canonicalMode return the mode which is recorded in trees for the file mode of index.
+func canonicalMode(mode os.FileMode) os.FileMode {
+	switch mode & modeTypeMask {
+	case ModeSymlink, ModeGitlink, ModeTree:
+		return mode & modeTypeMask
+	}
+	if mode&0111 != 0 {
+		return ModeExecutable
+	}
+	return ModeBlob
+}
+
+// WriteIndexTree write trees of the index including subdirectories, and return hash of the root tree.
+// the index must not have conflicts.
+func WriteIndexTree(repo *GitRepository, index *GitIndex) (string, error) {
+	if conflicts := index.Conflicts(); len(conflicts) > 0 {
+		return "", fmt.Errorf("%s: unmerged (%s)", conflicts[0], index.entryOf(conflicts[0]).ObjectID)
+	}
+	var entries []*GitTreeEntry
+	for _, e := range index.Entries {
+		entries = append(entries, &GitTreeEntry{Mode: canonicalMode(e.Mode), Path: e.FilePath, Sha: e.ObjectID})
+	}
+	return writeTreeFiles(repo, entries)
+}
+
+func (index *GitIndex) entryOf(name string) *IndexEntry {
+	for _, e := range index.Entries {
+		if e.FilePath == name {
+			return e
+		}
+	}
+	return nil
+}
+
+// writeTreeFiles write trees of files whose paths are relative to the root, and return hash of the root tree.
+func writeTreeFiles(repo *GitRepository, files []*GitTreeEntry) (string, error) {
+	tree := &GitTree{}
+	subtrees := map[string][]*GitTreeEntry{}
+	var names []string
+	for _, f := range files {
+		slash := strings.IndexByte(f.Path, '/')
+		if slash < 0 {
+			tree.Entries = append(tree.Entries, f)
+			continue
+		}
+		dir := f.Path[:slash]
+		if _, ok := subtrees[dir]; !ok {
+			names = append(names, dir)
+		}
+		subtrees[dir] = append(subtrees[dir], &GitTreeEntry{Mode: f.Mode, Path: f.Path[slash+1:], Sha: f.Sha})
+	}
+	for _, dir := range names {
+		sha, err := writeTreeFiles(repo, subtrees[dir])
+		if err != nil {
+			return "", err
+		}
+		tree.Entries = append(tree.Entries, &GitTreeEntry{Mode: ModeTree, Path: dir, Sha: sha})
+	}
+	sortTreeEntries(tree.Entries)
+	return WriteObject(repo, tree)
+}
+
+// sortTreeEntries sort entries in the order of trees, where a subtree is sorted as if its name ends with "/".
+func sortTreeEntries(entries []*GitTreeEntry) {
+	key := func(e *GitTreeEntry) string {
+		if e.IsTree() {
+			return e.Path + "/"
+		}
+		return e.Path
+	}
+	sort.Slice(entries, func(i, j int) bool { return key(entries[i]) < key(entries[j]) })
+}
+
+// ReadTreeFiles return all files in the tree recursively, whose paths are relative to the root.
+// empty hash means an empty tree.
+func ReadTreeFiles(repo *GitRepository, tree string) ([]*GitTreeEntry, error) {
+	var files []*GitTreeEntry
+	if err := readTreeFiles(repo, tree, "", &files); err != nil {
+		return nil, err
+	}
+	return files, nil
+}
+
+func readTreeFiles(repo *GitRepository, tree, prefix string, files *[]*GitTreeEntry) error {
+	entries, err := readTreeEntries(repo, tree)
+	if err != nil {
+		return err
+	}
+	for _, e := range entries {
+		name := path.Join(prefix, e.Path)
+		if e.IsTree() {
+			if err := readTreeFiles(repo, e.Sha, name, files); err != nil {
+				return err
+			}
+			continue
+		}
+		*files = append(*files, &GitTreeEntry{Mode: e.Mode, Path: name, Sha: e.Sha})
+	}
+	return nil
+}
+
+// IndexFromTree return an index which has files of the tree. entries have no stat information.
+func IndexFromTree(repo *GitRepository, tree string) (*GitIndex, error) {
+	files, err := ReadTreeFiles(repo, tree)
+	if err != nil {
+		return nil, err
+	}
+	index := &GitIndex{}
+	for _, f := range files {
+		index.Entries = append(index.Entries, newIndexEntryFromTree(f.Path, f, 0))
+	}
+	SortIndex(index)
+	return index, nil
+}
+
+// CommitTree return hash of the tree of the commit. empty hash means no commit, whose tree is empty.
+func CommitTree(repo *GitRepository, sha string) (string, error) {
+	if sha == "" {
+		return "", nil
+	}
+	commit, err := ReadCommit(repo, sha)
+	if err != nil {
+		return "", err
+	}
+	return commit.Tree, nil
+}
@@ -0,0 +1,259 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// splitLines split data into lines which keep their line terminators.
+// the last line has no terminator if data does not end with a newline.
+func splitLines(data []byte) []string {
+	var lines []string
+	for len(data) > 0 {
+		i := bytes.IndexByte(data, '\n')
+		if i < 0 {
+			lines = append(lines, string(data))
+			break
+		}
+		lines = append(lines, string(data[:i+1]))
+		data = data[i+1:]
+	}
+	return lines
+}
+
+// isBinary return true if data looks like a binary file, which has NUL in the first 8000 bytes like git.
+func isBinary(data []byte) bool {
+	if len(data) > 8000 {
+		data = data[:8000]
+	}
+	return bytes.IndexByte(data, 0) >= 0
+}
+
+// diffLines return pairs of indexes of lines which are common between a and b in increasing order.
+// lines are compared by the Myers' algorithm after common leading and trailing lines are removed.
+func diffLines(a, b []string) [][2]int {
+	ids := map[string]int{}
+	toIDs := func(lines []string) []int {
+		s := make([]int, len(lines))
+		for i, line := range lines {
+			id, ok := ids[line]
+			if !ok {
+				id = len(ids)
+				ids[line] = id
+			}
+			s[i] = id
+		}
+		return s
+	}
+	x, y := toIDs(a), toIDs(b)
+
+	var matches [][2]int
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		matches = append(matches, [2]int{prefix, prefix})
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+	for _, m := range myersDiff(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix]) {
+		matches = append(matches, [2]int{m[0] + prefix, m[1] + prefix})
+	}
+	for i := suffix; i > 0; i-- {
+		matches = append(matches, [2]int{len(x) - i, len(y) - i})
+	}
+	return matches
+}
+
+// myersDiff return matched indexes of the shortest edit script between a and b.
+func myersDiff(a, b []int) [][2]int {
+	n, m := len(a), len(b)
+	if n == 0 || m == 0 {
+		return nil
+	}
+	max := n + m
+	offset := max + 1
+	v := make([]int, 2*max+3)
+	var trace [][]int
+	done := false
+	for d := 0; d <= max && !done; d++ {
+		snapshot := make([]int, 2*d+3)
+		copy(snapshot, v[offset-d-1:offset+d+2])
+		trace = append(trace, snapshot)
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[offset+k-1] < v[offset+k+1] {
+				x = v[offset+k+1]
+			} else {
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				done = true
+				break
+			}
+		}
+	}
+
+	var matches [][2]int
+	x, y := n, m
+	for d := len(trace) - 1; d >= 0; d-- {
+		snapshot := trace[d]
+		at := func(k int) int { return snapshot[k+d+1] }
+		k := x - y
+		var prevK int
+		if k == -d || k != d && at(k-1) < at(k+1) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := at(prevK)
+		prevY := prevX - prevK
+		for x > prevX && y > prevY && x > 0 && y > 0 {
+			x--
+			y--
+			matches = append(matches, [2]int{x, y})
+		}
+		if d > 0 {
+			x, y = prevX, prevY
+		}
+	}
+	for i, j := 0, len(matches)-1; i < j; i, j = i+1, j-1 {
+		matches[i], matches[j] = matches[j], matches[i]
+	}
+	return matches
+}
+
+// diffHunk is a hunk of unified diff. starts are 0-based indexes of lines.
+type diffHunk struct {
+	oldStart, oldLines int
+	newStart, newLines int
+	lines              []string
+}
+
+// diffHunks return hunks of changes between a and b with context lines.
+// lines of hunks are prefixed by " ", "-" or "+".
+func diffHunks(a, b []string, context int) []*diffHunk {
+	type op struct {
+		kind byte
+		line string
+		i, j int
+	}
+	var ops []op
+	i, j := 0, 0
+	for _, m := range append(diffLines(a, b), [2]int{len(a), len(b)}) {
+		for ; i < m[0]; i++ {
+			ops = append(ops, op{'-', a[i], i, j})
+		}
+		for ; j < m[1]; j++ {
+			ops = append(ops, op{'+', b[j], i, j})
+		}
+		if i < len(a) && j < len(b) {
+			ops = append(ops, op{' ', a[i], i, j})
+			i++
+			j++
+		}
+	}
+
+	var hunks []*diffHunk
+	for start := 0; start < len(ops); {
+		if ops[start].kind == ' ' {
+			start++
+			continue
+		}
+		// extend the hunk while changes are close enough to share context
+		end := start
+		for k := start; k < len(ops); k++ {
+			if ops[k].kind != ' ' {
+				end = k + 1
+				continue
+			}
+			if k-end >= 2*context {
+				break
+			}
+		}
+		from := start - context
+		if from < 0 {
+			from = 0
+		}
+		for from < start && ops[from].kind != ' ' {
+			from++
+		}
+		to := end + context
+		if to > len(ops) {
+			to = len(ops)
+		}
+		h := &diffHunk{oldStart: ops[from].i, newStart: ops[from].j}
+		for _, o := range ops[from:to] {
+			if o.kind != '+' {
+				h.oldLines++
+			}
+			if o.kind != '-' {
+				h.newLines++
+			}
+			h.lines = append(h.lines, string(o.kind)+o.line)
+		}
+		hunks = append(hunks, h)
+		start = to
+	}
+	return hunks
+}
+
+// hunkRange format a range of hunk header. empty range starts before the first line.
+func hunkRange(start, lines int) string {
+	if lines == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if lines == 1 {
+		return fmt.Sprintf("%d", start+1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, lines)
+}
+
+// funcContext return the nearest line before the index which looks like a function header,
+// which starts with an alphabet, "_" or "$" like git's default.
+func funcContext(lines []string, before int) string {
+	for i := before - 1; i >= 0; i-- {
+		line := lines[i]
+		if line != "" && (isAlpha(line[0]) || line[0] == '_' || line[0] == '$') {
+			line = strings.TrimRight(line, " \t\r\n")
+			if len(line) > 80 {
+				line = line[:80]
+			}
+			return line
+		}
+	}
+	return ""
+}
+
+// writeUnifiedDiff write hunks of unified diff between a and b.
+func writeUnifiedDiff(w io.Writer, a, b []string, context int) error {
+	for _, h := range diffHunks(a, b, context) {
+		header := fmt.Sprintf("@@ -%s +%s @@", hunkRange(h.oldStart, h.oldLines), hunkRange(h.newStart, h.newLines))
+		if fn := funcContext(a, h.oldStart); fn != "" {
+			header += " " + fn
+		}
+		if _, err := fmt.Fprintln(w, header); err != nil {
+			return err
+		}
+		for _, line := range h.lines {
+			if _, err := io.WriteString(w, line); err != nil {
+				return err
+			}
+			if !strings.HasSuffix(line, "\n") {
+				if _, err := io.WriteString(w, "\n\\ No newline at end of file\n"); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,205 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// LsFilesOptions is options of ListFiles.
+type LsFilesOptions struct {
+	// Cached lists entries of the index.
+	Cached bool
+	// Unmerged limits cached entries to unmerged ones.
+	Unmerged bool
+	// Deleted lists entries whose files are deleted from worktree.
+	Deleted bool
+	// Modified lists entries whose files are modified or deleted in worktree.
+	Modified bool
+	// Others lists untracked files.
+	Others bool
+	// Ignored lists only files matched by ignore rules, instead of excluding them.
+	Ignored bool
+	// Excludes are ignore patterns, which take precedence over other rules.
+	Excludes []string
+	// ExcludeFiles are files of ignore patterns.
+	ExcludeFiles []string
+	// ExcludeStandard uses .gitignore in each directory, info/exclude and core.excludesFile.
+	ExcludeStandard bool
+	// Pathspecs limits files to be listed.
+	Pathspecs []string
+}
+
+// LsFile is a file listed by ListFiles. Entry is nil for untracked files.
+// a nested repository or a directory listed by Others has Path ending with "/".
+type LsFile struct {
+	Path  string
+	Entry *IndexEntry
+}
+
+// ListFiles return files like git ls-files.
+// untracked files come first, then for each index entry, the cached entry, the deleted one and the modified one in this order.
+// so an entry can be listed more than once, as git does.
+func ListFiles(repo *GitRepository, opts LsFilesOptions) ([]*LsFile, error) {
+	var ignore *IgnoreMatcher
+	if opts.ExcludeStandard || len(opts.Excludes) > 0 || len(opts.ExcludeFiles) > 0 {
+		var err error
+		if ignore, err = NewIgnoreMatcher(repo, opts.Excludes, opts.ExcludeStandard); err != nil {
+			return nil, err
+		}
+		for _, file := range opts.ExcludeFiles {
+			if err := ignore.AddExcludeFile(file); err != nil {
+				return nil, err
+			}
+		}
+	} else if opts.Ignored {
+		return nil, fmt.Errorf("ls-files --ignored needs some exclude pattern")
+	}
+	if (opts.Others || opts.Deleted || opts.Modified) && repo.Bare {
+		return nil, fmt.Errorf("this operation must be run in a work tree")
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []*LsFile
+	if opts.Others {
+		untracked, err := ListUntracked(repo, index, ignore)
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range untracked {
+			if f.Ignored != opts.Ignored || !MatchPathspec(opts.Pathspecs, f.Path) {
+				continue
+			}
+			if f.Dir {
+				// empty directories are not listed
+				if _, isRepo := nestedRepoHead(worktreeFile(repo, f.Path)); !isRepo {
+					continue
+				}
+				files = append(files, &LsFile{Path: f.Path + "/"})
+				continue
+			}
+			files = append(files, &LsFile{Path: f.Path})
+		}
+	}
+
+	for _, e := range index.Entries {
+		if !MatchPathspec(opts.Pathspecs, e.FilePath) {
+			continue
+		}
+		if opts.Ignored && !ignore.IsIgnored(e.FilePath, false) {
+			continue
+		}
+		if opts.Cached && (!opts.Unmerged || e.Stage() != 0) {
+			files = append(files, &LsFile{Path: e.FilePath, Entry: e})
+		}
+		if !opts.Deleted && !opts.Modified {
+			continue
+		}
+		_, err := os.Lstat(worktreeFile(repo, e.FilePath))
+		deleted := err != nil
+		if opts.Deleted && deleted {
+			files = append(files, &LsFile{Path: e.FilePath, Entry: e})
+		}
+		if !opts.Modified {
+			continue
+		}
+		// unmerged entries are always modified
+		modified := deleted || e.Stage() != 0
+		if !modified {
+			if modified, err = IsEntryModified(repo, e); err != nil {
+				return nil, err
+			}
+		}
+		if modified {
+			files = append(files, &LsFile{Path: e.FilePath, Entry: e})
+		}
+	}
+	return files, nil
+}
+
+// FormatIndexEntryStat return the stat information of the index entry like ls-files --debug.
+func FormatIndexEntryStat(e *IndexEntry) string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "  ctime: %d:%d\n", e.Ctime>>32, e.Ctime&0xffffffff)
+	fmt.Fprintf(&b, "  mtime: %d:%d\n", e.Mtime>>32, e.Mtime&0xffffffff)
+	fmt.Fprintf(&b, "  dev: %d\tino: %d\n", e.Dev, e.Ino)
+	fmt.Fprintf(&b, "  uid: %d\tgid: %d\n", e.Uid, e.Gid)
+	// the length of the name is not a flag
+	fmt.Fprintf(&b, "  size: %d\tflags: %x\n", e.FileSize, e.Flags&^0xfff)
+	return b.String()
+}
+
+// FormatLsFile expand placeholders of ls-files --format for the index entry, which are
+// %(objectmode), %(objectname), %(objecttype), %(objectsize), %(objectsize:padded), %(stage), %(path),
+// %% and %xNN. objectsize is read only if it is used, and the path is quoted by QuotePath if quote is true.
+func FormatLsFile(repo *GitRepository, format string, e *IndexEntry, quote bool) (string, error) {
+	var b []byte
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			b = append(b, format[i])
+			continue
+		}
+		p := format[i+1:]
+		if p[0] == '%' {
+			b = append(b, '%')
+			i++
+			continue
+		}
+		if p[0] == 'x' {
+			if n, s := expandPlaceholder(p, "", nil); n > 0 {
+				b = append(b, s...)
+				i += n
+				continue
+			}
+		}
+		end := -1
+		if p[0] == '(' {
+			for j := 1; j < len(p); j++ {
+				if p[j] == ')' {
+					end = j
+					break
+				}
+			}
+		}
+		if end < 0 {
+			b = append(b, '%')
+			continue
+		}
+		var s string
+		switch name := p[1:end]; name {
+		case "objectmode":
+			s = fmt.Sprintf("%06o", uint32(canonicalMode(e.Mode)))
+		case "objectname":
+			s = e.ObjectID
+		case "objecttype":
+			s = (&GitTreeEntry{Mode: canonicalMode(e.Mode)}).ObjectType()
+		case "objectsize", "objectsize:padded":
+			s = "-"
+			if canonicalMode(e.Mode)&modeTypeMask != ModeGitlink {
+				_, data, err := ReadObjectData(repo, e.ObjectID)
+				if err != nil {
+					return "", err
+				}
+				s = fmt.Sprint(len(data))
+			}
+			if name == "objectsize:padded" {
+				s = fmt.Sprintf("%7s", s)
+			}
+		case "stage":
+			s = fmt.Sprint(e.Stage())
+		case "path":
+			s = e.FilePath
+			if quote {
+				s = QuotePath(s)
+			}
+		default:
+			return "", fmt.Errorf("bad ls-files format: %%(%s)", name)
+		}
+		b = append(b, s...)
+		i += end + 1
+	}
+	return string(b), nil
+}
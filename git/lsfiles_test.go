@@ -0,0 +1,91 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListFiles(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "c": "c\n", "d/b": "b\n", ".gitignore": "*.log\n"})
+	for name, content := range map[string]string{"a": "modified\n", "u": "u\n", "l.log": "l\n", "n/z": "z\n"} {
+		file := filepath.Join(repo.Worktree, filepath.FromSlash(name))
+		assert.NoError(t, os.MkdirAll(filepath.Dir(file), 0755))
+		assert.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+	assert.NoError(t, os.Remove(filepath.Join(repo.Worktree, "c")))
+	assert.NoError(t, os.Mkdir(filepath.Join(repo.Worktree, "empty"), 0755))
+	// an unmerged entry
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	index.Entries = append(index.Entries, newIndexEntryFromTree("x", &GitTreeEntry{Mode: ModeBlob, Sha: index.Entries[1].ObjectID}, 2))
+	SortIndex(index)
+	assert.NoError(t, WriteIndex(repo, index))
+
+	tests := []struct {
+		opts LsFilesOptions
+		want []string
+	}{
+		{LsFilesOptions{Cached: true}, []string{".gitignore", "a", "c", "d/b", "x"}},
+		{LsFilesOptions{Cached: true, Unmerged: true}, []string{"x"}},
+		{LsFilesOptions{Deleted: true}, []string{"c", "x"}},
+		{LsFilesOptions{Modified: true}, []string{"a", "c", "x"}},
+		{LsFilesOptions{Modified: true, Deleted: true}, []string{"a", "c", "c", "x", "x"}},
+		{LsFilesOptions{Others: true}, []string{"l.log", "n/z", "u"}},
+		{LsFilesOptions{Others: true, ExcludeStandard: true}, []string{"n/z", "u"}},
+		{LsFilesOptions{Others: true, Ignored: true, ExcludeStandard: true}, []string{"l.log"}},
+		{LsFilesOptions{Others: true, Cached: true, Excludes: []string{"u"}}, []string{"l.log", "n/z", ".gitignore", "a", "c", "d/b", "x"}},
+		{LsFilesOptions{Cached: true, Ignored: true, Excludes: []string{"d/"}}, []string{"d/b"}},
+		{LsFilesOptions{Cached: true, Others: true, Pathspecs: []string{"d", "n"}}, []string{"n/z", "d/b"}},
+	}
+	for _, test := range tests {
+		files, err := ListFiles(repo, test.opts)
+		assert.NoError(t, err)
+		var got []string
+		for _, f := range files {
+			got = append(got, f.Path)
+		}
+		assert.Equal(t, test.want, got, "%+v", test.opts)
+	}
+	_, err = ListFiles(repo, LsFilesOptions{Others: true, Ignored: true})
+	assert.EqualError(t, err, "ls-files --ignored needs some exclude pattern")
+
+	files, err := ListFiles(repo, LsFilesOptions{Cached: true, Pathspecs: []string{"x"}})
+	assert.NoError(t, err)
+	line, err := FormatLsFile(repo, "%(objectmode) %(objecttype) %(objectsize:padded) %(stage)%x09%(path)%%", files[0].Entry, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "100644 blob       2 2\tx%", line)
+	_, err = FormatLsFile(repo, "%(bogus)", files[0].Entry, false)
+	assert.EqualError(t, err, "bad ls-files format: %(bogus)")
+}
+
+func TestFormatIndexEntryStat(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+
+	// the index written by git
+	data, err := ioutil.ReadFile("testdata/index")
+	assert.NoError(t, err)
+	assert.NoError(t, repo.SaveRepoFile("index", data))
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	stat := FormatIndexEntryStat(index.Entries[0])
+	assert.Contains(t, stat, "  ctime: 1595159090:157816499\n  mtime: 1595159090:157816499\n")
+	assert.Contains(t, stat, "\tflags: 0\n")
+
+	// entries made from files have the same encoding
+	file := filepath.Join(repo.Worktree, "a")
+	assert.NoError(t, ioutil.WriteFile(file, []byte("a\n"), 0644))
+	info, err := os.Lstat(file)
+	assert.NoError(t, err)
+	e := NewIndexEntry(info, "a", "")
+	assert.Equal(t, uint64(info.ModTime().Unix()), e.Mtime>>32)
+	assert.Equal(t, uint64(info.ModTime().Nanosecond()), e.Mtime&0xffffffff)
+}
@@ -0,0 +1,85 @@
+package git
+
+import (
+	"strings"
+)
+
+// LsTreeOptions is options of ListTree.
+type LsTreeOptions struct {
+	// Recursive lists files in subtrees instead of the subtrees.
+	Recursive bool
+	// ShowTrees shows subtrees walked into for Recursive or pathspecs.
+	ShowTrees bool
+	// OnlyTrees shows only subtrees.
+	OnlyTrees bool
+	// Pathspecs limits entries to paths, files under them, or trees containing them.
+	// a pathspec ending with "/" lists the contents of the tree instead of the tree itself.
+	// unlike other commands, wildcards are not supported.
+	Pathspecs []string
+}
+
+// ListTree return entries of the tree-ish like git ls-tree, in the order of the tree.
+// the tree-ish is any revision which can be peeled to a tree, and paths of entries are from its top.
+func ListTree(repo *GitRepository, treeish string, opts LsTreeOptions) ([]*GitTreeEntry, error) {
+	sha, err := ResolveRevision(repo, treeish)
+	if err != nil {
+		return nil, err
+	}
+	tree, err := PeelObject(repo, sha, "tree")
+	if err != nil {
+		return nil, err
+	}
+	var entries []*GitTreeEntry
+	if err := listTree(repo, tree, "", opts, &entries); err != nil {
+		return nil, err
+	}
+	return entries, nil
+}
+
+func listTree(repo *GitRepository, tree, prefix string, opts LsTreeOptions, entries *[]*GitTreeEntry) error {
+	children, err := readTreeEntries(repo, tree)
+	if err != nil {
+		return err
+	}
+	for _, e := range children {
+		name := prefix + e.Path
+		show, descend := lsTreeMatch(opts, name, e.IsTree())
+		if show && (!opts.OnlyTrees || e.IsTree()) {
+			*entries = append(*entries, &GitTreeEntry{Mode: e.Mode, Path: name, Sha: e.Sha})
+		}
+		if descend {
+			if err := listTree(repo, e.Sha, name+"/", opts, entries); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// lsTreeMatch return whether the entry is shown, and whether the tree is walked into.
+func lsTreeMatch(opts LsTreeOptions, name string, isTree bool) (bool, bool) {
+	specs := opts.Pathspecs
+	if len(specs) == 0 {
+		specs = []string{""}
+	}
+	show, descend := false, false
+	for _, spec := range specs {
+		contents := strings.HasSuffix(spec, "/")
+		spec = strings.TrimSuffix(spec, "/")
+		switch {
+		case spec == "" || spec == "." || strings.HasPrefix(name, spec+"/") || name == spec && !(contents && isTree):
+			// the entry itself is matched. trees are replaced with their files when recursive
+			if isTree && opts.Recursive {
+				show = show || opts.ShowTrees || opts.OnlyTrees
+				descend = true
+			} else {
+				show = true
+			}
+		case isTree && (name == spec || strings.HasPrefix(spec, name+"/")):
+			// the tree contains the pathspec
+			show = show || opts.ShowTrees
+			descend = true
+		}
+	}
+	return show, descend
+}
@@ -0,0 +1,46 @@
+package git
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestListTree(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "d/b": "b\n", "d/e/c": "c\n", "f/x": "x\n"})
+	list := func(treeish string, opts LsTreeOptions) []string {
+		entries, err := ListTree(repo, treeish, opts)
+		assert.NoError(t, err)
+		var names []string
+		for _, e := range entries {
+			names = append(names, e.ObjectType()+" "+e.Path)
+		}
+		return names
+	}
+
+	assert.Equal(t, []string{"blob a", "tree d", "tree f"}, list("HEAD", LsTreeOptions{}))
+	assert.Equal(t, []string{"blob a", "blob d/b", "blob d/e/c", "blob f/x"}, list("HEAD", LsTreeOptions{Recursive: true}))
+	assert.Equal(t, []string{"tree d", "tree d/e", "tree f"}, list("HEAD", LsTreeOptions{Recursive: true, OnlyTrees: true}))
+	assert.Equal(t, []string{"blob b", "tree e"}, list("HEAD:d", LsTreeOptions{}))
+
+	// pathspecs are matched literally, and "/" lists the contents of the tree
+	assert.Equal(t, []string{"tree d"}, list("HEAD", LsTreeOptions{Pathspecs: []string{"d"}}))
+	assert.Equal(t, []string{"blob d/b", "tree d/e"}, list("HEAD", LsTreeOptions{Pathspecs: []string{"d/"}}))
+	assert.Equal(t, []string{"blob d/b", "blob d/e/c"}, list("HEAD", LsTreeOptions{Recursive: true, Pathspecs: []string{"d"}}))
+	assert.Equal(t, []string{"tree d", "tree d/e", "blob d/e/c"}, list("HEAD", LsTreeOptions{ShowTrees: true, Pathspecs: []string{"d/e/c"}}))
+	assert.Empty(t, list("HEAD", LsTreeOptions{Pathspecs: []string{"d/*"}}))
+
+	_, err := ListTree(repo, "HEAD:a", LsTreeOptions{})
+	assert.Error(t, err)
+}
+
+func TestQuotePath(t *testing.T) {
+	assert.Equal(t, "a/b c", QuotePath("a/b c"))
+	assert.Equal(t, `"t\tab\\\""`, QuotePath("t\tab\\\""))
+	assert.Equal(t, `"\303\274\001"`, QuotePath("ü\x01"))
+}
@@ -0,0 +1,312 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// conflictMarkerSize is the length of conflict markers. ex) "<<<<<<<"
+const conflictMarkerSize = 7
+
+// MergeOptions is options of three-way merge.
+// labels are written after conflict markers. Diff3 adds the base version to conflicts.
+type MergeOptions struct {
+	OursLabel   string
+	BaseLabel   string
+	TheirsLabel string
+	Diff3       bool
+}
+
+// mergeChunk is a region of three-way merge. stable chunks have the same lines in all versions.
+type mergeChunk struct {
+	stable             bool
+	base, ours, theirs []string
+}
+
+// diff3Chunks split versions into stable chunks and unstable chunks by lines matched with base.
+func diff3Chunks(base, ours, theirs []string) []*mergeChunk {
+	matchOurs := make([]int, len(base))
+	matchTheirs := make([]int, len(base))
+	for i := range base {
+		matchOurs[i], matchTheirs[i] = -1, -1
+	}
+	for _, m := range diffLines(base, ours) {
+		matchOurs[m[0]] = m[1]
+	}
+	for _, m := range diffLines(base, theirs) {
+		matchTheirs[m[0]] = m[1]
+	}
+
+	var chunks []*mergeChunk
+	o, a, b := 0, 0, 0
+	for o < len(base) || a < len(ours) || b < len(theirs) {
+		if o < len(base) && matchOurs[o] == a && matchTheirs[o] == b {
+			if n := len(chunks); n > 0 && chunks[n-1].stable {
+				chunks[n-1].base = append(chunks[n-1].base, base[o])
+			} else {
+				chunks = append(chunks, &mergeChunk{stable: true, base: []string{base[o]}})
+			}
+			o, a, b = o+1, a+1, b+1
+			continue
+		}
+		// the unstable chunk ends at the next line which is matched in both versions
+		next := o
+		for next < len(base) && (matchOurs[next] < 0 || matchTheirs[next] < 0) {
+			next++
+		}
+		endOurs, endTheirs := len(ours), len(theirs)
+		if next < len(base) {
+			endOurs, endTheirs = matchOurs[next], matchTheirs[next]
+		}
+		chunks = append(chunks, &mergeChunk{base: base[o:next], ours: ours[a:endOurs], theirs: theirs[b:endTheirs]})
+		o, a, b = next, endOurs, endTheirs
+	}
+	return chunks
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// mergeContent merge changes of ours and theirs from base line by line,
+// and return merged content with conflict markers and the number of conflicts.
+func mergeContent(base, ours, theirs []byte, opts MergeOptions) ([]byte, int) {
+	var b bytes.Buffer
+	writeLines := func(lines []string) {
+		for _, line := range lines {
+			b.WriteString(line)
+		}
+	}
+	marker := func(c byte, label string) {
+		if b.Len() > 0 && b.Bytes()[b.Len()-1] != '\n' {
+			b.WriteByte('\n')
+		}
+		b.WriteString(strings.Repeat(string(c), conflictMarkerSize))
+		if label != "" {
+			b.WriteString(" " + label)
+		}
+		b.WriteByte('\n')
+	}
+
+	conflicts := 0
+	for _, c := range diff3Chunks(splitLines(base), splitLines(ours), splitLines(theirs)) {
+		switch {
+		case c.stable:
+			writeLines(c.base)
+		case equalLines(c.ours, c.theirs) || equalLines(c.theirs, c.base):
+			writeLines(c.ours)
+		case equalLines(c.ours, c.base):
+			writeLines(c.theirs)
+		default:
+			conflicts++
+			oursLines, theirsLines := c.ours, c.theirs
+			if !opts.Diff3 {
+				// lines changed in the same way on both sides are out of the conflict
+				head := 0
+				for head < len(oursLines) && head < len(theirsLines) && oursLines[head] == theirsLines[head] {
+					head++
+				}
+				writeLines(oursLines[:head])
+				oursLines, theirsLines = oursLines[head:], theirsLines[head:]
+				tail := 0
+				for tail < len(oursLines) && tail < len(theirsLines) && oursLines[len(oursLines)-1-tail] == theirsLines[len(theirsLines)-1-tail] {
+					tail++
+				}
+				marker('<', opts.OursLabel)
+				writeLines(oursLines[:len(oursLines)-tail])
+				marker('=', "")
+				writeLines(theirsLines[:len(theirsLines)-tail])
+				marker('>', opts.TheirsLabel)
+				writeLines(oursLines[len(oursLines)-tail:])
+				continue
+			}
+			marker('<', opts.OursLabel)
+			writeLines(oursLines)
+			marker('|', opts.BaseLabel)
+			writeLines(c.base)
+			marker('=', "")
+			writeLines(theirsLines)
+			marker('>', opts.TheirsLabel)
+		}
+	}
+	return b.Bytes(), conflicts
+}
+
+// MergeResult is a result of three-way merge of trees.
+// Index has merged files at stage 0 and conflicted files at stages 1 to 3.
+// Contents are worktree contents of conflicted files, and Messages describe conflicts.
+type MergeResult struct {
+	Index    *GitIndex
+	Contents map[string][]byte
+	Messages []string
+}
+
+// Clean return true if the merge has no conflicts.
+func (r *MergeResult) Clean() bool {
+	return len(r.Index.Conflicts()) == 0
+}
+
+// isRegularFile return true if the entry is a blob which is not a symbolic link.
+func isRegularFile(e *GitTreeEntry) bool {
+	return e != nil && e.Mode&modeTypeMask == ModeBlob&modeTypeMask
+}
+
+func sameEntry(a, b *GitTreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Sha == b.Sha && a.Mode == b.Mode
+}
+
+// MergeTrees merge changes from base tree to ours and theirs trees.
+// files changed on both sides are merged line by line. empty hash means an empty tree.
+// merge.conflictStyle of diff3 and zdiff3 turns on Diff3 option.
+func MergeTrees(repo *GitRepository, base, ours, theirs string, opts MergeOptions) (*MergeResult, error) {
+	if cfg, err := LoadConfig(repo); err == nil {
+		if style := cfg.GetString("merge.conflictStyle", "merge"); style == "diff3" || style == "zdiff3" {
+			opts.Diff3 = true
+		}
+	}
+	versions := make([]map[string]*GitTreeEntry, 3)
+	names := map[string]bool{}
+	for i, tree := range []string{base, ours, theirs} {
+		files, err := ReadTreeFiles(repo, tree)
+		if err != nil {
+			return nil, err
+		}
+		versions[i] = map[string]*GitTreeEntry{}
+		for _, f := range files {
+			versions[i][f.Path] = f
+			names[f.Path] = true
+		}
+	}
+	var paths []string
+	for name := range names {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+
+	result := &MergeResult{Index: &GitIndex{}, Contents: map[string][]byte{}}
+	add := func(name string, e *GitTreeEntry, stage int) {
+		if e != nil {
+			result.Index.Entries = append(result.Index.Entries, newIndexEntryFromTree(name, e, stage))
+		}
+	}
+	for _, name := range paths {
+		b, o, t := versions[0][name], versions[1][name], versions[2][name]
+		switch {
+		case sameEntry(o, t), sameEntry(b, t):
+			add(name, o, 0)
+			continue
+		case sameEntry(b, o):
+			add(name, t, 0)
+			continue
+		}
+
+		if o == nil || t == nil {
+			deleted, modified, kept := opts.OursLabel, opts.TheirsLabel, t
+			if t == nil {
+				deleted, modified, kept = opts.TheirsLabel, opts.OursLabel, o
+			}
+			result.Messages = append(result.Messages, fmt.Sprintf("CONFLICT (modify/delete): %s deleted in %s and modified in %s.  Version %s of %s left in tree.",
+				name, deleted, modified, modified, name))
+			_, data, err := ReadObjectData(repo, kept.Sha)
+			if err != nil {
+				return nil, err
+			}
+			result.Contents[name] = data
+			add(name, b, 1)
+			add(name, o, 2)
+			add(name, t, 3)
+			continue
+		}
+
+		if isRegularFile(o) && isRegularFile(t) {
+			result.Messages = append(result.Messages, "Auto-merging "+name)
+		}
+		merged, conflicts, err := mergeFile(repo, b, o, t, opts)
+		if err != nil {
+			return nil, err
+		}
+		mode := o.Mode
+		if b != nil && o.Mode == b.Mode {
+			mode = t.Mode
+		}
+		if conflicts == 0 && (o.Mode == t.Mode || b != nil && (o.Mode == b.Mode || t.Mode == b.Mode)) {
+			sha, err := WriteObject(repo, NewGitBlob(merged))
+			if err != nil {
+				return nil, err
+			}
+			add(name, &GitTreeEntry{Mode: mode, Path: name, Sha: sha}, 0)
+			continue
+		}
+		kind := "content"
+		if b == nil {
+			kind = "add/add"
+		}
+		if conflicts < 0 {
+			result.Messages = append(result.Messages, fmt.Sprintf("warning: Cannot merge binary files: %s (%s vs. %s)", name, opts.OursLabel, opts.TheirsLabel))
+		}
+		result.Messages = append(result.Messages, fmt.Sprintf("CONFLICT (%s): Merge conflict in %s", kind, name))
+		result.Contents[name] = merged
+		add(name, b, 1)
+		add(name, o, 2)
+		add(name, t, 3)
+	}
+
+	if err := checkFileDirectoryConflicts(result.Index); err != nil {
+		return nil, err
+	}
+	SortIndex(result.Index)
+	return result, nil
+}
+
+// mergeFile merge contents of files. base may be nil for files added on both sides.
+// conflicts is -1 if files can not be merged line by line, then ours content is returned.
+func mergeFile(repo *GitRepository, base, ours, theirs *GitTreeEntry, opts MergeOptions) ([]byte, int, error) {
+	var contents [3][]byte
+	for i, e := range []*GitTreeEntry{base, ours, theirs} {
+		if e == nil {
+			continue
+		}
+		_, data, err := ReadObjectData(repo, e.Sha)
+		if err != nil {
+			return nil, 0, err
+		}
+		contents[i] = data
+	}
+	if !isRegularFile(ours) || !isRegularFile(theirs) || base != nil && !isRegularFile(base) {
+		return contents[1], -1, nil
+	}
+	if isBinary(contents[0]) || isBinary(contents[1]) || isBinary(contents[2]) {
+		return contents[1], -1, nil
+	}
+	merged, conflicts := mergeContent(contents[0], contents[1], contents[2], opts)
+	return merged, conflicts, nil
+}
+
+// checkFileDirectoryConflicts return an error if a file and a directory of the same path are merged.
+func checkFileDirectoryConflicts(index *GitIndex) error {
+	files := map[string]bool{}
+	for _, e := range index.Entries {
+		files[e.FilePath] = true
+	}
+	for _, e := range index.Entries {
+		for i := 0; i < len(e.FilePath); i++ {
+			if e.FilePath[i] == '/' && files[e.FilePath[:i]] {
+				return fmt.Errorf("CONFLICT (file/directory): %s and %s can not be merged", e.FilePath[:i], e.FilePath)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffLines(t *testing.T) {
+	a := splitLines([]byte("a\nb\nc\nd\n"))
+	b := splitLines([]byte("a\nc\nd\ne\n"))
+	assert.Equal(t, [][2]int{{0, 0}, {2, 1}, {3, 2}}, diffLines(a, b))
+	assert.Nil(t, diffLines(nil, b))
+
+	var out bytes.Buffer
+	assert.NoError(t, writeUnifiedDiff(&out, a, b, 3))
+	assert.Equal(t, "@@ -1,4 +1,4 @@\n a\n-b\n c\n d\n+e\n", out.String())
+
+	// far changes are split into hunks, and the last line may have no newline
+	a = splitLines([]byte("func\n1\n2\n3\n4\n5\n6\n7\n8\n9\nend"))
+	b = splitLines([]byte("func\n1\n2\n3\n4\n5\n6\n7\n8\n9\nEND"))
+	b[1] = "one\n"
+	out.Reset()
+	assert.NoError(t, writeUnifiedDiff(&out, a, b, 3))
+	assert.Equal(t, "@@ -1,5 +1,5 @@\n func\n-1\n+one\n 2\n 3\n 4\n"+
+		"@@ -8,4 +8,4 @@ func\n 7\n 8\n 9\n-end\n\\ No newline at end of file\n+END\n\\ No newline at end of file\n", out.String())
+}
+
+func TestMergeContent(t *testing.T) {
+	base := []byte("1\n2\n3\n4\n5\n")
+	ours := []byte("1\nours\n3\n4\n5\n")
+	theirs := []byte("1\n2\n3\n4\ntheirs\n")
+	merged, conflicts := mergeContent(base, ours, theirs, MergeOptions{})
+	assert.Equal(t, 0, conflicts)
+	assert.Equal(t, "1\nours\n3\n4\ntheirs\n", string(merged))
+
+	theirs = []byte("1\ntheirs\n3\n4\n5\n")
+	merged, conflicts = mergeContent(base, ours, theirs, MergeOptions{OursLabel: "HEAD", TheirsLabel: "other"})
+	assert.Equal(t, 1, conflicts)
+	assert.Equal(t, "1\n<<<<<<< HEAD\nours\n=======\ntheirs\n>>>>>>> other\n3\n4\n5\n", string(merged))
+
+	merged, _ = mergeContent(base, ours, theirs, MergeOptions{Diff3: true, BaseLabel: "base"})
+	assert.Equal(t, "1\n<<<<<<<\nours\n||||||| base\n2\n=======\ntheirs\n>>>>>>>\n3\n4\n5\n", string(merged))
+
+	// the same changes on both sides do not conflict
+	merged, conflicts = mergeContent(base, ours, ours, MergeOptions{})
+	assert.Equal(t, 0, conflicts)
+	assert.Equal(t, string(ours), string(merged))
+}
+
+func TestMergeTrees(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	blob := func(content string) *GitTreeEntry {
+		sha, err := WriteObject(repo, NewGitBlob([]byte(content)))
+		assert.NoError(t, err)
+		return &GitTreeEntry{Mode: ModeBlob, Sha: sha}
+	}
+	tree := func(files map[string]*GitTreeEntry) string {
+		var entries []*GitTreeEntry
+		for name, e := range files {
+			entries = append(entries, &GitTreeEntry{Mode: e.Mode, Path: name, Sha: e.Sha})
+		}
+		sha, err := writeTreeFiles(repo, entries)
+		assert.NoError(t, err)
+		return sha
+	}
+	base := tree(map[string]*GitTreeEntry{"a": blob("1\n2\n3\n"), "d/b": blob("b\n"), "c": blob("c\n")})
+	ours := tree(map[string]*GitTreeEntry{"a": blob("0\n1\n2\n3\n"), "d/b": blob("ours\n"), "c": blob("c\n")})
+	theirs := tree(map[string]*GitTreeEntry{"a": blob("1\n2\n3\n4\n"), "d/b": blob("theirs\n"), "new": blob("new\n")})
+
+	result, err := MergeTrees(repo, base, ours, theirs, MergeOptions{OursLabel: "ours", TheirsLabel: "theirs"})
+	assert.NoError(t, err)
+	assert.False(t, result.Clean())
+	assert.Equal(t, []string{"d/b"}, result.Index.Conflicts())
+	assert.Equal(t, "<<<<<<< ours\nours\n=======\ntheirs\n>>>>>>> theirs\n", string(result.Contents["d/b"]))
+	assert.Contains(t, result.Messages, "CONFLICT (content): Merge conflict in d/b")
+
+	var paths []string
+	for _, e := range result.Index.Entries {
+		paths = append(paths, e.FilePath)
+	}
+	assert.Equal(t, []string{"a", "d/b", "d/b", "d/b", "new"}, paths)
+	_, data, err := ReadObjectData(repo, result.Index.Entry("a").ObjectID)
+	assert.NoError(t, err)
+	assert.Equal(t, "0\n1\n2\n3\n4\n", string(data))
+}
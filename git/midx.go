@@ -0,0 +1,532 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// multiPackIndexMagic is the signature of multi-pack-index file.
+var multiPackIndexMagic = []byte("MIDX")
+
+// chunk IDs of multi-pack-index file.
+const (
+	chunkPackNames     = 0x504e414d // "PNAM"
+	chunkObjectOffsets = 0x4f4f4646 // "OOFF"
+	chunkLargeOffsets  = 0x4c4f4646 // "LOFF"
+	midxLargeOffset    = 0x80000000
+)
+
+// multiPackIndex is a loaded multi-pack-index, which indexes objects in several packfiles.
+// each object is recorded once with the packfile and the offset in it.
+type multiPackIndex struct {
+	path         string
+	modTime      time.Time
+	packNames    []string
+	count        int
+	fanout       []byte
+	oids         []byte
+	offsets      []byte
+	largeOffsets []byte
+}
+
+func multiPackIndexPath(repo *GitRepository) string {
+	return repo.RepoPath("objects/pack/multi-pack-index")
+}
+
+// parseMultiPackIndex parse multi-pack-index file and check its checksum and chunks.
+func parseMultiPackIndex(path string, data []byte) (*multiPackIndex, error) {
+	if len(data) < 12+12+20 || !bytes.Equal(data[:4], multiPackIndexMagic) {
+		return nil, fmt.Errorf("Unsupported multi-pack-index: %s", path)
+	}
+	if data[4] != 1 || data[5] != 1 {
+		return nil, fmt.Errorf("Unsupported multi-pack-index version %d hash version %d: %s", data[4], data[5], path)
+	}
+	if sum := sha1.Sum(data[:len(data)-20]); !bytes.Equal(sum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("multi-pack-index checksum mismatch: %s", path)
+	}
+	chunks, err := parseChunkTable(data, 12, int(data[6]))
+	if err != nil {
+		return nil, fmt.Errorf("Invalid multi-pack-index %s: %w", path, err)
+	}
+
+	m := &multiPackIndex{
+		path:         path,
+		fanout:       chunks[chunkOIDFanout],
+		oids:         chunks[chunkOIDLookup],
+		offsets:      chunks[chunkObjectOffsets],
+		largeOffsets: chunks[chunkLargeOffsets],
+	}
+	if len(m.fanout) != 256*4 {
+		return nil, fmt.Errorf("multi-pack-index is missing the OID Fanout chunk: %s", path)
+	}
+	m.count = int(binary.BigEndian.Uint32(m.fanout[255*4:]))
+	if len(m.oids) != m.count*20 || len(m.offsets) != m.count*8 {
+		return nil, fmt.Errorf("multi-pack-index object chunks are the wrong size: %s", path)
+	}
+	for _, name := range strings.Split(string(chunks[chunkPackNames]), "\x00") {
+		if name != "" {
+			m.packNames = append(m.packNames, name)
+		}
+	}
+	if packs := int(binary.BigEndian.Uint32(data[8:])); len(m.packNames) != packs {
+		return nil, fmt.Errorf("multi-pack-index has %d pack names, but %d packs: %s", len(m.packNames), packs, path)
+	}
+	return m, nil
+}
+
+func (m *multiPackIndex) shaAt(i int) []byte {
+	return m.oids[i*20 : i*20+20]
+}
+
+// objectAt return position of the pack and offset in it of the object at position i.
+func (m *multiPackIndex) objectAt(i int) (int, int64, error) {
+	pack := int(binary.BigEndian.Uint32(m.offsets[i*8:]))
+	offset := binary.BigEndian.Uint32(m.offsets[i*8+4:])
+	if pack >= len(m.packNames) {
+		return 0, 0, fmt.Errorf("multi-pack-index has invalid pack position %d", pack)
+	}
+	if offset&midxLargeOffset == 0 || m.largeOffsets == nil {
+		return pack, int64(offset), nil
+	}
+	large := int(offset&^midxLargeOffset) * 8
+	if large+8 > len(m.largeOffsets) {
+		return 0, 0, fmt.Errorf("multi-pack-index large offset out of bounds")
+	}
+	return pack, int64(binary.BigEndian.Uint64(m.largeOffsets[large:])), nil
+}
+
+// find return path of the packfile and offset of the object in it.
+func (m *multiPackIndex) find(sha string) (string, int64, bool) {
+	i, ok := searchFanout(m.fanout, m.oids, sha)
+	if !ok {
+		return "", 0, false
+	}
+	pack, offset, err := m.objectAt(i)
+	if err != nil {
+		return "", 0, false
+	}
+	return m.packPath(pack), offset, true
+}
+
+// packPath return path of the packfile at position i.
+func (m *multiPackIndex) packPath(i int) string {
+	return filepath.Join(filepath.Dir(m.path), strings.TrimSuffix(m.packNames[i], ".idx")+".pack")
+}
+
+// searchFanout return position of the object in sorted hashes with fanout table,
+// which are shared by pack index, commit-graph and multi-pack-index.
+func searchFanout(fanout, oids []byte, sha string) (int, bool) {
+	target, err := hex.DecodeString(sha)
+	if err != nil || len(target) != 20 {
+		return 0, false
+	}
+	lo := 0
+	if target[0] > 0 {
+		lo = int(binary.BigEndian.Uint32(fanout[(int(target[0])-1)*4:]))
+	}
+	hi := int(binary.BigEndian.Uint32(fanout[int(target[0])*4:]))
+	at := func(i int) []byte { return oids[i*20 : i*20+20] }
+	i := lo + sort.Search(hi-lo, func(i int) bool { return bytes.Compare(at(lo+i), target) >= 0 })
+	if i < hi && bytes.Equal(at(i), target) {
+		return i, true
+	}
+	return 0, false
+}
+
+// encodeFanout return fanout table of sorted hashes, and the hashes in binary.
+func encodeFanout(shas []string) ([]byte, []byte, error) {
+	var fanout, oids bytes.Buffer
+	var counts [256]uint32
+	for _, sha := range shas {
+		oid, err := hex.DecodeString(sha)
+		if err != nil {
+			return nil, nil, err
+		}
+		oids.Write(oid)
+		counts[oid[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		counts[i] += counts[i-1]
+	}
+	binary.Write(&fanout, binary.BigEndian, counts)
+	return fanout.Bytes(), oids.Bytes(), nil
+}
+
+// encodeChunks make chunk table and chunks after the header.
+func encodeChunks(b *bytes.Buffer, chunks []graphChunk) {
+	offset := uint64(b.Len() + (len(chunks)+1)*12)
+	for _, c := range chunks {
+		binary.Write(b, binary.BigEndian, c.id)
+		binary.Write(b, binary.BigEndian, offset)
+		offset += uint64(len(c.data))
+	}
+	binary.Write(b, binary.BigEndian, uint32(0))
+	binary.Write(b, binary.BigEndian, offset)
+	for _, c := range chunks {
+		b.Write(c.data)
+	}
+	sum := sha1.Sum(b.Bytes())
+	b.Write(sum[:])
+}
+
+// multiPackIndexCache keeps loaded multi-pack-index. it is reloaded when the file is modified.
+var multiPackIndexCache = struct {
+	sync.Mutex
+	indexes map[string]*multiPackIndex
+}{indexes: map[string]*multiPackIndex{}}
+
+// loadMultiPackIndex return multi-pack-index of the repository, or nil if it is not available.
+func loadMultiPackIndex(repo *GitRepository) *multiPackIndex {
+	path := multiPackIndexPath(repo)
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil
+	}
+	multiPackIndexCache.Lock()
+	defer multiPackIndexCache.Unlock()
+	if m, ok := multiPackIndexCache.indexes[path]; ok && m.modTime.Equal(info.ModTime()) {
+		return m
+	}
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil
+	}
+	m, err := parseMultiPackIndex(path, data)
+	if err != nil {
+		return nil
+	}
+	m.modTime = info.ModTime()
+	multiPackIndexCache.indexes[path] = m
+	return m
+}
+
+// midxObject is an object to write into multi-pack-index.
+type midxObject struct {
+	sha       string
+	pack      int
+	offset    int64
+	preferred bool
+	mtime     time.Time
+}
+
+// WriteMultiPackIndex write multi-pack-index of all packfiles.
+// if an object is in several packs, the preferred pack is used, then the newest pack.
+// preferredPack is a name of packfile like "pack-<hash>.pack", and may be empty.
+func WriteMultiPackIndex(repo *GitRepository, preferredPack string) error {
+	indexes, err := listPackIndexes(repo)
+	if err != nil {
+		return err
+	}
+	sort.Slice(indexes, func(i, j int) bool { return indexes[i].packPath < indexes[j].packPath })
+	preferredPack = strings.TrimSuffix(strings.TrimSuffix(preferredPack, ".pack"), ".idx")
+
+	var names []string
+	var objects []midxObject
+	havePreferred := false
+	for i, idx := range indexes {
+		base := strings.TrimSuffix(filepath.Base(idx.packPath), ".pack")
+		names = append(names, base+".idx")
+		havePreferred = havePreferred || base == preferredPack
+		info, err := os.Stat(idx.packPath)
+		if err != nil {
+			return err
+		}
+		for j := 0; j < idx.count; j++ {
+			objects = append(objects, midxObject{
+				sha:       hex.EncodeToString(idx.shaAt(j)),
+				pack:      i,
+				offset:    idx.offsetAt(j),
+				preferred: base == preferredPack,
+				mtime:     info.ModTime(),
+			})
+		}
+	}
+	if preferredPack != "" && !havePreferred {
+		return fmt.Errorf("unknown preferred pack: '%s'", preferredPack)
+	}
+	sort.SliceStable(objects, func(i, j int) bool {
+		a, b := objects[i], objects[j]
+		switch {
+		case a.sha != b.sha:
+			return a.sha < b.sha
+		case a.preferred != b.preferred:
+			return a.preferred
+		case !a.mtime.Equal(b.mtime):
+			return a.mtime.After(b.mtime)
+		}
+		return a.pack < b.pack
+	})
+	unique := objects[:0]
+	for _, o := range objects {
+		if len(unique) == 0 || unique[len(unique)-1].sha != o.sha {
+			unique = append(unique, o)
+		}
+	}
+	return writeMultiPackIndex(repo, names, unique)
+}
+
+func writeMultiPackIndex(repo *GitRepository, names []string, objects []midxObject) error {
+	var packNames bytes.Buffer
+	for _, name := range names {
+		packNames.WriteString(name + "\x00")
+	}
+	for packNames.Len()%4 != 0 {
+		packNames.WriteByte(0)
+	}
+	shas := make([]string, len(objects))
+	for i, o := range objects {
+		shas[i] = o.sha
+	}
+	fanout, oids, err := encodeFanout(shas)
+	if err != nil {
+		return err
+	}
+	needLarge := false
+	for _, o := range objects {
+		if o.offset > 0x7fffffff {
+			needLarge = true
+		}
+	}
+	var offsets, largeOffsets bytes.Buffer
+	for _, o := range objects {
+		binary.Write(&offsets, binary.BigEndian, uint32(o.pack))
+		if needLarge && o.offset >= midxLargeOffset {
+			binary.Write(&offsets, binary.BigEndian, midxLargeOffset|uint32(largeOffsets.Len()/8))
+			binary.Write(&largeOffsets, binary.BigEndian, uint64(o.offset))
+			continue
+		}
+		binary.Write(&offsets, binary.BigEndian, uint32(o.offset))
+	}
+
+	chunks := []graphChunk{
+		{chunkPackNames, packNames.Bytes()},
+		{chunkOIDFanout, fanout},
+		{chunkOIDLookup, oids},
+		{chunkObjectOffsets, offsets.Bytes()},
+	}
+	if largeOffsets.Len() > 0 {
+		chunks = append(chunks, graphChunk{chunkLargeOffsets, largeOffsets.Bytes()})
+	}
+	var b bytes.Buffer
+	b.Write(multiPackIndexMagic)
+	b.Write([]byte{1, 1, byte(len(chunks)), 0})
+	binary.Write(&b, binary.BigEndian, uint32(len(names)))
+	encodeChunks(&b, chunks)
+
+	path := multiPackIndexPath(repo)
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return writeFileAtomic(path, b.Bytes(), 0444)
+}
+
+// removeMultiPackIndex remove multi-pack-index. it is called when packfiles in it are removed.
+func removeMultiPackIndex(repo *GitRepository) error {
+	if err := os.Remove(multiPackIndexPath(repo)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// VerifyMultiPackIndex check that multi-pack-index is consistent with pack indexes.
+// return number of verified objects.
+func VerifyMultiPackIndex(repo *GitRepository) (int, error) {
+	path := multiPackIndexPath(repo)
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, nil
+		}
+		return 0, err
+	}
+	m, err := parseMultiPackIndex(path, data)
+	if err != nil {
+		return 0, err
+	}
+	packs := make([]*packIndex, len(m.packNames))
+	for i, name := range m.packNames {
+		idxPath := filepath.Join(filepath.Dir(path), name)
+		idxData, err := ioutil.ReadFile(idxPath)
+		if err != nil {
+			return 0, fmt.Errorf("failed to load pack in position %d: %w", i, err)
+		}
+		if packs[i], err = parsePackIndex(idxPath, idxData); err != nil {
+			return 0, fmt.Errorf("failed to load pack in position %d: %w", i, err)
+		}
+		if i > 0 && m.packNames[i-1] >= name {
+			return 0, fmt.Errorf("multi-pack-index pack names out of order: '%s' before '%s'", m.packNames[i-1], name)
+		}
+	}
+	for i := 0; i < 256; i++ {
+		count := 0
+		for count < m.count && int(m.shaAt(count)[0]) <= i {
+			count++
+		}
+		if fanout := int(binary.BigEndian.Uint32(m.fanout[i*4:])); fanout != count {
+			return 0, fmt.Errorf("oid fanout out of order: fanout[%d] = %d != %d", i, fanout, count)
+		}
+	}
+	for i := 0; i < m.count; i++ {
+		if i > 0 && bytes.Compare(m.shaAt(i-1), m.shaAt(i)) >= 0 {
+			return 0, fmt.Errorf("oid lookup out of order: oid[%d] = %x >= %x = oid[%d]", i-1, m.shaAt(i-1), m.shaAt(i), i)
+		}
+		pack, offset, err := m.objectAt(i)
+		if err != nil {
+			return 0, err
+		}
+		sha := hex.EncodeToString(m.shaAt(i))
+		expected, ok := packs[pack].find(sha)
+		if !ok {
+			return 0, fmt.Errorf("failed to load pack entry for oid[%d] = %s", i, sha)
+		}
+		if expected != offset {
+			return 0, fmt.Errorf("incorrect object offset for oid[%d] = %s: %d != %d", i, sha, offset, expected)
+		}
+	}
+	return m.count, nil
+}
+
+// referencedObjects return objects in multi-pack-index by positions of packs which they refer.
+func (m *multiPackIndex) referencedObjects() (map[int][]string, error) {
+	objects := map[int][]string{}
+	for i := 0; i < m.count; i++ {
+		pack, _, err := m.objectAt(i)
+		if err != nil {
+			return nil, err
+		}
+		objects[pack] = append(objects[pack], hex.EncodeToString(m.shaAt(i)))
+	}
+	return objects, nil
+}
+
+// ExpireMultiPackIndex remove packfiles in multi-pack-index which have no objects referred from it,
+// and rewrite multi-pack-index. packs with .keep file are not removed.
+// return names of removed packs.
+func ExpireMultiPackIndex(repo *GitRepository) ([]string, error) {
+	m := loadMultiPackIndex(repo)
+	if m == nil {
+		return nil, nil
+	}
+	referenced, err := m.referencedObjects()
+	if err != nil {
+		return nil, err
+	}
+	var removed []string
+	for i := range m.packNames {
+		packPath := m.packPath(i)
+		if len(referenced[i]) > 0 {
+			continue
+		}
+		if _, err := os.Stat(strings.TrimSuffix(packPath, ".pack") + ".keep"); err == nil {
+			continue
+		}
+		if err := removePack(packPath); err != nil {
+			return nil, err
+		}
+		removed = append(removed, filepath.Base(packPath))
+	}
+	if len(removed) == 0 {
+		return nil, nil
+	}
+	return removed, WriteMultiPackIndex(repo, "")
+}
+
+// removePack remove packfile and its index and other files.
+// index is removed first, so that readers never see index without pack.
+func removePack(packPath string) error {
+	base := strings.TrimSuffix(packPath, ".pack")
+	for _, ext := range []string{".idx", ".pack", ".bitmap", ".rev", ".promisor"} {
+		if err := os.Remove(base + ext); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// RepackMultiPackIndex pack objects in small packfiles of multi-pack-index into a new packfile,
+// and rewrite multi-pack-index. packs are selected from old ones whose expected size,
+// that is the size of objects referred from multi-pack-index, is smaller than batchSize,
+// until the total expected size reaches batchSize. all packs are selected if batchSize is 0.
+// nothing is done if less than two packs are selected. return name of the new pack.
+func RepackMultiPackIndex(repo *GitRepository, batchSize int64) (string, error) {
+	m := loadMultiPackIndex(repo)
+	if m == nil {
+		return "", nil
+	}
+	referenced, err := m.referencedObjects()
+	if err != nil {
+		return "", err
+	}
+	indexes, err := listPackIndexes(repo)
+	if err != nil {
+		return "", err
+	}
+	counts := map[string]int{}
+	for _, idx := range indexes {
+		counts[idx.packPath] = idx.count
+	}
+	type candidate struct {
+		pack     int
+		size     int64
+		mtime    time.Time
+		expected int64
+	}
+	var candidates []candidate
+	for i := range m.packNames {
+		packPath := m.packPath(i)
+		if _, err := os.Stat(strings.TrimSuffix(packPath, ".pack") + ".keep"); err == nil {
+			continue
+		}
+		info, err := os.Stat(packPath)
+		if err != nil {
+			return "", err
+		}
+		c := candidate{pack: i, size: info.Size(), mtime: info.ModTime()}
+		if count := counts[packPath]; count > 0 {
+			c.expected = info.Size() * int64(len(referenced[i])) / int64(count)
+		}
+		candidates = append(candidates, c)
+	}
+	sort.SliceStable(candidates, func(i, j int) bool { return candidates[i].mtime.Before(candidates[j].mtime) })
+
+	var selected []int
+	var total int64
+	for _, c := range candidates {
+		if batchSize > 0 && total >= batchSize {
+			break
+		}
+		if batchSize > 0 && c.expected >= batchSize {
+			continue
+		}
+		selected = append(selected, c.pack)
+		total += c.expected
+	}
+	if len(selected) < 2 || batchSize > 0 && total < batchSize {
+		return "", nil
+	}
+
+	var objects []string
+	for _, pack := range selected {
+		objects = append(objects, referenced[pack]...)
+	}
+	var b bytes.Buffer
+	if err := WritePack(repo, &b, objects); err != nil {
+		return "", err
+	}
+	name, err := IndexPack(repo, &b, false)
+	if err != nil {
+		return "", err
+	}
+	// the new pack is preferred, so that the old packs are expired later
+	return name, WriteMultiPackIndex(repo, "pack-"+name)
+}
@@ -0,0 +1,82 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMultiPackIndex(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	var blobs []string
+	for _, content := range []string{"one\n", "two\n", "three\n"} {
+		sha, err := WriteObject(repo, NewGitBlob([]byte(content)))
+		assert.NoError(t, err)
+		blobs = append(blobs, sha)
+	}
+	pack := func(shas ...string) string {
+		var b bytes.Buffer
+		assert.NoError(t, WritePack(repo, &b, shas))
+		name, err := IndexPack(repo, &b, false)
+		assert.NoError(t, err)
+		return "pack-" + name
+	}
+	packPath := func(name string) string {
+		return filepath.Join(repo.RepoPath("objects/pack"), name+".pack")
+	}
+	first := pack(blobs[0], blobs[1])
+	second := pack(blobs[1], blobs[2])
+	old := time.Now().Add(-time.Hour)
+	assert.NoError(t, os.Chtimes(packPath(first), old, old))
+	for _, sha := range blobs {
+		assert.NoError(t, os.Remove(repo.RepoPath(objectPath(sha))))
+	}
+
+	// duplicated objects are taken from the newest pack
+	assert.NoError(t, WriteMultiPackIndex(repo, ""))
+	count, err := VerifyMultiPackIndex(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	m := loadMultiPackIndex(repo)
+	if !assert.NotNil(t, m) {
+		return
+	}
+	assert.ElementsMatch(t, []string{first + ".idx", second + ".idx"}, m.packNames)
+	path, _, ok := m.find(blobs[1])
+	assert.True(t, ok)
+	assert.Equal(t, packPath(second), path)
+
+	assert.NoError(t, WriteMultiPackIndex(repo, first+".pack"))
+	path, _, _ = loadMultiPackIndex(repo).find(blobs[1])
+	assert.Equal(t, packPath(first), path)
+	assert.Error(t, WriteMultiPackIndex(repo, "pack-unknown.pack"))
+
+	// objects are read through multi-pack-index
+	_, data, err := ReadObjectData(repo, blobs[2])
+	assert.NoError(t, err)
+	assert.Equal(t, "three\n", string(data))
+
+	// repack all packs into one, and expire old packs
+	name, err := RepackMultiPackIndex(repo, 0)
+	assert.NoError(t, err)
+	assert.NotEmpty(t, name)
+	removed, err := ExpireMultiPackIndex(repo)
+	assert.NoError(t, err)
+	assert.ElementsMatch(t, []string{first + ".pack", second + ".pack"}, removed)
+	count, err = VerifyMultiPackIndex(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count)
+	for _, sha := range blobs {
+		assert.True(t, HasObject(repo, sha))
+	}
+
+	// nothing is repacked from one pack
+	name, err = RepackMultiPackIndex(repo, 0)
+	assert.NoError(t, err)
+	assert.Empty(t, name)
+}
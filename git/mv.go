@@ -0,0 +1,142 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+)
+
+// MoveOptions is options of MoveFiles.
+type MoveOptions struct {
+	// Force overwrites existing destination files.
+	Force bool
+	// SkipErrors skips sources which cannot be moved instead of failing.
+	SkipErrors bool
+	// DryRun reports renames without doing them.
+	DryRun bool
+}
+
+// Move is a rename of a file or directory in worktree.
+type Move struct {
+	From string
+	To   string
+}
+
+// MoveFiles rename sources to dest in worktree and the index. dest is the new path of a single source,
+// or a directory where sources are moved into. a source directory is moved with all tracked files under it.
+func MoveFiles(repo *GitRepository, sources []string, dest string, opts MoveOptions) ([]*Move, error) {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+	dest = strings.TrimSuffix(dest, "/")
+	destDir := isWorktreeDir(repo, dest)
+	if len(sources) > 1 && !destDir {
+		return nil, fmt.Errorf("destination '%s' is not a directory", dest)
+	}
+
+	var moves []*Move
+	renames := map[string]string{}
+	targets := map[string]bool{}
+	for _, src := range sources {
+		src = strings.TrimSuffix(src, "/")
+		dst := dest
+		if destDir {
+			dst = path.Join(dest, path.Base(src))
+		}
+		entries, err := checkMove(repo, index, src, dst, opts.Force)
+		if err == nil && targets[dst] {
+			err = fmt.Errorf("multiple sources for the same target")
+		}
+		if err != nil {
+			if opts.SkipErrors {
+				continue
+			}
+			return nil, fmt.Errorf("%v, source=%s, destination=%s", err, src, dst)
+		}
+		targets[dst] = true
+		moves = append(moves, &Move{From: src, To: dst})
+		for _, name := range entries {
+			renames[name] = dst + strings.TrimPrefix(name, src)
+		}
+	}
+	if opts.DryRun {
+		return moves, nil
+	}
+
+	for _, m := range moves {
+		if err := os.Rename(worktreeFile(repo, m.From), worktreeFile(repo, m.To)); err != nil {
+			return nil, err
+		}
+	}
+	moved := &GitIndex{}
+	for _, e := range index.Entries {
+		if name, ok := renames[e.FilePath]; ok {
+			e.rename(name)
+		} else if targets[e.FilePath] {
+			// overwritten by -f
+			continue
+		}
+		moved.Entries = append(moved.Entries, e)
+	}
+	SortIndex(moved)
+	return moves, WriteIndex(repo, moved)
+}
+
+// checkMove return tracked files to be renamed by moving src to dst, or an error if it cannot be moved.
+func checkMove(repo *GitRepository, index *GitIndex, src, dst string, force bool) ([]string, error) {
+	info, err := os.Lstat(worktreeFile(repo, src))
+	if err != nil {
+		return nil, fmt.Errorf("bad source")
+	}
+	if src == "." || dst == src || strings.HasPrefix(dst, src+"/") {
+		return nil, fmt.Errorf("can not move directory into itself")
+	}
+	if dir := path.Dir(dst); !isWorktreeDir(repo, dir) {
+		return nil, fmt.Errorf("destination directory does not exist")
+	}
+	_, destErr := os.Lstat(worktreeFile(repo, dst))
+
+	if info.IsDir() && index.Entry(src) == nil {
+		if destErr == nil {
+			return nil, fmt.Errorf("destination already exists")
+		}
+		var entries []string
+		for _, e := range index.Entries {
+			if strings.HasPrefix(e.FilePath, src+"/") {
+				if e.Stage() != 0 {
+					return nil, fmt.Errorf("conflicted")
+				}
+				entries = append(entries, e.FilePath)
+			}
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("source directory is empty")
+		}
+		return entries, nil
+	}
+
+	if index.Entry(src) == nil {
+		for _, e := range index.Entries {
+			if e.FilePath == src {
+				return nil, fmt.Errorf("conflicted")
+			}
+		}
+		return nil, fmt.Errorf("not under version control")
+	}
+	if destErr == nil {
+		if !force {
+			return nil, fmt.Errorf("destination exists")
+		}
+		if isWorktreeDir(repo, dst) {
+			return nil, fmt.Errorf("cannot overwrite a directory")
+		}
+	}
+	return []string{src}, nil
+}
+
+func isWorktreeDir(repo *GitRepository, name string) bool {
+	info, err := os.Stat(worktreeFile(repo, name))
+	return err == nil && info.IsDir()
+}
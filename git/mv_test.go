@@ -0,0 +1,43 @@
+package git
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveFiles(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "b": "b\n", "d/c": "c\n"})
+
+	_, err := MoveFiles(repo, []string{"a"}, "b", MoveOptions{})
+	assert.EqualError(t, err, "destination exists, source=a, destination=b")
+	_, err = MoveFiles(repo, []string{"nothing"}, "x", MoveOptions{})
+	assert.EqualError(t, err, "bad source, source=nothing, destination=x")
+	_, err = MoveFiles(repo, []string{"d"}, "d/x", MoveOptions{})
+	assert.EqualError(t, err, "can not move directory into itself, source=d, destination=d/x")
+
+	moves, err := MoveFiles(repo, []string{"a"}, "renamed", MoveOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, []*Move{{From: "a", To: "renamed"}}, moves)
+	moves, err = MoveFiles(repo, []string{"nothing", "renamed", "b"}, "d", MoveOptions{SkipErrors: true})
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(moves))
+	_, err = MoveFiles(repo, []string{"d"}, "sub", MoveOptions{})
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(repo.Worktree, "sub", "renamed"))
+
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	var names []string
+	for _, e := range index.Entries {
+		names = append(names, e.FilePath)
+		assert.Equal(t, len(e.FilePath), int(e.Flags&0xfff))
+	}
+	assert.Equal(t, []string{"sub/b", "sub/c", "sub/renamed"}, names)
+}
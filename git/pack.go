@@ -0,0 +1,509 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+// object types in packfile
+const (
+	packObjCommit   = 1
+	packObjTree     = 2
+	packObjBlob     = 3
+	packObjTag      = 4
+	packObjOfsDelta = 6
+	packObjRefDelta = 7
+)
+
+var packTypeNames = map[int]string{
+	packObjCommit: "commit",
+	packObjTree:   "tree",
+	packObjBlob:   "blob",
+	packObjTag:    "tag",
+}
+
+func packTypeOf(objType string) (int, error) {
+	for t, name := range packTypeNames {
+		if name == objType {
+			return t, nil
+		}
+	}
+	return 0, fmt.Errorf("Unknown object type %s", objType)
+}
+
+// packEntryHeader is a header of an object in packfile.
+// baseOffset is absolute offset of base object of ofs-delta, baseSha is base of ref-delta.
+type packEntryHeader struct {
+	typ        int
+	size       uint64
+	baseOffset int64
+	baseSha    string
+}
+
+// readPackEntryHeader read header of object at offset.
+func readPackEntryHeader(r io.ByteReader, offset int64) (*packEntryHeader, error) {
+	c, err := r.ReadByte()
+	if err != nil {
+		return nil, err
+	}
+	h := &packEntryHeader{typ: int(c>>4) & 7, size: uint64(c & 0x0f)}
+	for shift := uint(4); c&0x80 != 0; shift += 7 {
+		if c, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+		h.size |= uint64(c&0x7f) << shift
+	}
+
+	switch h.typ {
+	case packObjOfsDelta:
+		if c, err = r.ReadByte(); err != nil {
+			return nil, err
+		}
+		rel := int64(c & 0x7f)
+		for c&0x80 != 0 {
+			if c, err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+			rel = ((rel + 1) << 7) | int64(c&0x7f)
+		}
+		h.baseOffset = offset - rel
+		if h.baseOffset <= 0 || h.baseOffset >= offset {
+			return nil, fmt.Errorf("Invalid delta base offset at %d", offset)
+		}
+	case packObjRefDelta:
+		sha := make([]byte, 20)
+		for i := range sha {
+			if sha[i], err = r.ReadByte(); err != nil {
+				return nil, err
+			}
+		}
+		h.baseSha = hex.EncodeToString(sha)
+	case packObjCommit, packObjTree, packObjBlob, packObjTag:
+	default:
+		return nil, fmt.Errorf("Unknown object type %d in pack at %d", h.typ, offset)
+	}
+	return h, nil
+}
+
+func writePackEntryHeader(w io.Writer, typ int, size uint64) error {
+	b := []byte{byte(typ<<4) | byte(size&0x0f)}
+	size >>= 4
+	for size > 0 {
+		b[len(b)-1] |= 0x80
+		b = append(b, byte(size&0x7f))
+		size >>= 7
+	}
+	_, err := w.Write(b)
+	return err
+}
+
+// inflate read whole zlib stream and check its length.
+// it stops as soon as the stream exceeds size, so that a small entry cannot inflate to unlimited memory.
+func inflate(r io.Reader, size uint64) ([]byte, error) {
+	if size >= math.MaxInt64 {
+		return nil, fmt.Errorf("object size too large: %d", size)
+	}
+	zr, err := zlib.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	defer zr.Close()
+	data, err := ioutil.ReadAll(io.LimitReader(zr, int64(size)+1))
+	if err != nil {
+		return nil, err
+	}
+	if uint64(len(data)) != size {
+		return nil, fmt.Errorf("Inflated size mismatch: %d != %d", len(data), size)
+	}
+	return data, nil
+}
+
+// objectHeader return "<type> <size>\0" which is hashed with object content.
+func objectHeader(objType string, size int) []byte {
+	return []byte(objType + " " + strconv.Itoa(size) + "\x00")
+}
+
+// hashObjectData return object hash of the content.
+func hashObjectData(objType string, data []byte) string {
+	h := sha1.New()
+	h.Write(objectHeader(objType, len(data)))
+	h.Write(data)
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// WritePack write packfile which contains objects to w.
+// objects are stored without delta compression.
+func WritePack(repo *GitRepository, w io.Writer, shas []string) error {
+	h := sha1.New()
+	mw := io.MultiWriter(w, h)
+
+	header := make([]byte, 12)
+	copy(header, "PACK")
+	binary.BigEndian.PutUint32(header[4:], 2)
+	binary.BigEndian.PutUint32(header[8:], uint32(len(shas)))
+	if _, err := mw.Write(header); err != nil {
+		return err
+	}
+
+	for _, sha := range shas {
+		objType, data, err := ReadObjectData(repo, sha)
+		if err != nil {
+			return err
+		}
+		typ, err := packTypeOf(objType)
+		if err != nil {
+			return err
+		}
+		if err := writePackEntryHeader(mw, typ, uint64(len(data))); err != nil {
+			return err
+		}
+		if _, err := mw.Write(compressZlib(data)); err != nil {
+			return err
+		}
+	}
+	_, err := w.Write(h.Sum(nil))
+	return err
+}
+
+// packedObject is an object found while indexing packfile.
+type packedObject struct {
+	offset int64
+	end    int64
+	header *packEntryHeader
+	// data is the content, or delta data until the object is resolved.
+	data     []byte
+	objType  string
+	sha      string
+	resolved bool
+}
+
+// IndexPack read packfile from r and store it with its index into objects/pack.
+// if fixThin is true, base objects of thin pack are taken from repository and appended to the pack.
+// return hash of the pack, or empty string if the pack has no object.
+func IndexPack(repo *GitRepository, r io.Reader, fixThin bool) (string, error) {
+	pack, err := readPackStream(r)
+	if err != nil {
+		return "", err
+	}
+	objects, err := parsePack(pack)
+	if err != nil {
+		return "", err
+	}
+	if len(objects) == 0 {
+		return "", nil
+	}
+
+	external, err := resolvePackObjects(repo, objects, fixThin)
+	if err != nil {
+		return "", err
+	}
+	if len(external) > 0 {
+		if pack, objects, err = completeThinPack(pack, objects, external); err != nil {
+			return "", err
+		}
+	}
+	return storePack(repo, pack, objects)
+}
+
+// packStreamReader record bytes read from underlying reader.
+// it is an io.ByteReader, so that zlib does not read beyond the end of compressed data.
+type packStreamReader struct {
+	r    *bufio.Reader
+	data []byte
+}
+
+func (p *packStreamReader) Read(b []byte) (int, error) {
+	n, err := p.r.Read(b)
+	p.data = append(p.data, b[:n]...)
+	return n, err
+}
+
+func (p *packStreamReader) ReadByte() (byte, error) {
+	c, err := p.r.ReadByte()
+	if err == nil {
+		p.data = append(p.data, c)
+	}
+	return c, err
+}
+
+// readPackStream read a packfile from the stream and return its bytes.
+// it stops at the end of the packfile, so that the stream can be used after the packfile.
+func readPackStream(r io.Reader) ([]byte, error) {
+	br, ok := r.(*bufio.Reader)
+	if !ok {
+		br = bufio.NewReader(r)
+	}
+	p := &packStreamReader{r: br}
+	header := make([]byte, 12)
+	if _, err := io.ReadFull(p, header); err != nil {
+		return nil, fmt.Errorf("Invalid packfile header: %w", err)
+	}
+	if string(header[:4]) != "PACK" {
+		return nil, errors.New("Invalid packfile signature")
+	}
+	count := binary.BigEndian.Uint32(header[8:12])
+	for i := uint32(0); i < count; i++ {
+		offset := int64(len(p.data))
+		h, err := readPackEntryHeader(p, offset)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pack entry at %d: %w", offset, err)
+		}
+		if _, err := inflate(p, h.size); err != nil {
+			return nil, fmt.Errorf("Invalid pack entry at %d: %w", offset, err)
+		}
+	}
+	trailer := make([]byte, 20)
+	if _, err := io.ReadFull(p, trailer); err != nil {
+		return nil, fmt.Errorf("Invalid packfile trailer: %w", err)
+	}
+	return p.data, nil
+}
+
+// parsePack parse all entries of packfile and check its checksum.
+func parsePack(pack []byte) ([]*packedObject, error) {
+	if len(pack) < 32 || string(pack[:4]) != "PACK" {
+		return nil, errors.New("Invalid packfile signature")
+	}
+	if version := binary.BigEndian.Uint32(pack[4:8]); version != 2 && version != 3 {
+		return nil, fmt.Errorf("Unsupported packfile version %d", version)
+	}
+	count := binary.BigEndian.Uint32(pack[8:12])
+	body := pack[:len(pack)-20]
+	if sum := sha1.Sum(body); !bytes.Equal(sum[:], pack[len(pack)-20:]) {
+		return nil, errors.New("Packfile checksum mismatch")
+	}
+
+	objects := make([]*packedObject, 0, count)
+	r := bytes.NewReader(body)
+	r.Seek(12, io.SeekStart)
+	for i := uint32(0); i < count; i++ {
+		offset := int64(len(body) - r.Len())
+		header, err := readPackEntryHeader(r, offset)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pack entry at %d: %w", offset, err)
+		}
+		data, err := inflate(r, header.size)
+		if err != nil {
+			return nil, fmt.Errorf("Invalid pack entry at %d: %w", offset, err)
+		}
+		obj := &packedObject{offset: offset, end: int64(len(body) - r.Len()), header: header, data: data}
+		if name, ok := packTypeNames[header.typ]; ok {
+			obj.objType = name
+			obj.sha = hashObjectData(name, data)
+			obj.resolved = true
+		}
+		objects = append(objects, obj)
+	}
+	if r.Len() != 0 {
+		return nil, errors.New("Packfile has garbage at the end")
+	}
+	return objects, nil
+}
+
+// resolvePackObjects apply deltas of pack objects.
+// return base objects of ref-delta which are not in the pack.
+func resolvePackObjects(repo *GitRepository, objects []*packedObject, fixThin bool) ([]*packedObject, error) {
+	byOffset := map[int64]*packedObject{}
+	bySha := map[string]*packedObject{}
+	for _, obj := range objects {
+		byOffset[obj.offset] = obj
+		if obj.resolved {
+			bySha[obj.sha] = obj
+		}
+	}
+
+	var external []*packedObject
+	for progress := true; progress; {
+		progress = false
+		for _, obj := range objects {
+			if obj.resolved {
+				continue
+			}
+			var baseType string
+			var baseData []byte
+			if obj.header.typ == packObjOfsDelta {
+				base, ok := byOffset[obj.header.baseOffset]
+				if !ok {
+					return nil, fmt.Errorf("Invalid delta base offset at %d", obj.offset)
+				}
+				if !base.resolved {
+					continue
+				}
+				baseType, baseData = base.objType, base.data
+			} else if base, ok := bySha[obj.header.baseSha]; ok {
+				baseType, baseData = base.objType, base.data
+			} else {
+				continue
+			}
+			data, err := applyDelta(baseData, obj.data)
+			if err != nil {
+				return nil, fmt.Errorf("Invalid delta at %d: %w", obj.offset, err)
+			}
+			obj.objType, obj.data, obj.resolved = baseType, data, true
+			obj.sha = hashObjectData(baseType, data)
+			bySha[obj.sha] = obj
+			progress = true
+		}
+
+		if progress {
+			continue
+		}
+		// rest are deltas against objects outside of the pack
+		for _, obj := range objects {
+			if obj.resolved || obj.header.typ != packObjRefDelta {
+				continue
+			}
+			base := obj.header.baseSha
+			if !fixThin {
+				return nil, fmt.Errorf("Pack has delta against missing object %s", base)
+			}
+			if _, ok := bySha[base]; ok {
+				continue
+			}
+			baseType, baseData, err := ReadObjectData(repo, base)
+			if err != nil {
+				return nil, fmt.Errorf("Pack has delta against missing object %s", base)
+			}
+			ext := &packedObject{objType: baseType, data: baseData, sha: base, resolved: true}
+			bySha[base] = ext
+			external = append(external, ext)
+			progress = true
+		}
+	}
+
+	for _, obj := range objects {
+		if !obj.resolved {
+			return nil, fmt.Errorf("Unresolved delta at %d", obj.offset)
+		}
+	}
+	return external, nil
+}
+
+// completeThinPack append base objects to the pack, so that the pack is self-contained.
+func completeThinPack(pack []byte, objects, external []*packedObject) ([]byte, []*packedObject, error) {
+	var b bytes.Buffer
+	b.Write(pack[:len(pack)-20])
+	for _, obj := range external {
+		typ, err := packTypeOf(obj.objType)
+		if err != nil {
+			return nil, nil, err
+		}
+		obj.offset = int64(b.Len())
+		if err := writePackEntryHeader(&b, typ, uint64(len(obj.data))); err != nil {
+			return nil, nil, err
+		}
+		b.Write(compressZlib(obj.data))
+		obj.end = int64(b.Len())
+		objects = append(objects, obj)
+	}
+
+	data := b.Bytes()
+	binary.BigEndian.PutUint32(data[8:12], uint32(len(objects)))
+	sum := sha1.Sum(data)
+	return append(data, sum[:]...), objects, nil
+}
+
+// storePack write packfile and its index to objects/pack.
+func storePack(repo *GitRepository, pack []byte, objects []*packedObject) (string, error) {
+	checksum := pack[len(pack)-20:]
+	name := hex.EncodeToString(checksum)
+
+	entries := make([]packIndexEntry, 0, len(objects))
+	seen := map[string]bool{}
+	for _, obj := range objects {
+		if seen[obj.sha] {
+			continue
+		}
+		seen[obj.sha] = true
+		entries = append(entries, packIndexEntry{
+			sha:    obj.sha,
+			offset: obj.offset,
+			crc:    crc32.ChecksumIEEE(pack[obj.offset:obj.end]),
+		})
+	}
+	idx, err := encodePackIndex(entries, checksum)
+	if err != nil {
+		return "", err
+	}
+
+	dir := repo.RepoPath("objects/pack")
+	if err := os.MkdirAll(dir, repoDirPerm()); err != nil {
+		return "", err
+	}
+	base := filepath.Join(dir, "pack-"+name)
+	// packfile is written first, so that readers never see index without pack
+	if err := writeFileAtomic(base+".pack", pack, 0444); err != nil {
+		return "", err
+	}
+	if err := writeFileAtomic(base+".idx", idx, 0444); err != nil {
+		return "", err
+	}
+	return name, nil
+}
+
+// writeFileAtomic write data to temporary file and rename it to path.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := ioutil.TempFile(filepath.Dir(path), "tmp_"+filepath.Base(path))
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err := os.Chmod(f.Name(), perm); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
+
+// readPackObjectAt read object at offset of packfile. deltas are resolved.
+func readPackObjectAt(repo *GitRepository, f io.ReaderAt, offset int64) (string, []byte, error) {
+	br := bufio.NewReader(io.NewSectionReader(f, offset, 1<<62))
+	header, err := readPackEntryHeader(br, offset)
+	if err != nil {
+		return "", nil, err
+	}
+	data, err := inflate(br, header.size)
+	if err != nil {
+		return "", nil, err
+	}
+
+	var baseType string
+	var baseData []byte
+	switch header.typ {
+	case packObjOfsDelta:
+		baseType, baseData, err = readPackObjectAt(repo, f, header.baseOffset)
+	case packObjRefDelta:
+		baseType, baseData, err = ReadObjectData(repo, header.baseSha)
+	default:
+		return packTypeNames[header.typ], data, nil
+	}
+	if err != nil {
+		return "", nil, err
+	}
+	data, err = applyDelta(baseData, data)
+	if err != nil {
+		return "", nil, err
+	}
+	return baseType, data, nil
+}
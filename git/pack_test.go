@@ -0,0 +1,187 @@
+package git
+
+import (
+	"bytes"
+	"compress/zlib"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApplyDelta(t *testing.T) {
+	base := bytes.Repeat([]byte("0123456789abcdef"), 10000)
+	tests := [][]byte{
+		append(append([]byte{}, base...), "tail"...),
+		append([]byte("head"), base...),
+		[]byte("totally different"),
+		{},
+		append(append(append([]byte{}, base[:70000]...), "middle"...), base[80000:]...),
+	}
+	for _, target := range tests {
+		got, err := applyDelta(base, createDelta(base, target))
+		assert.NoError(t, err)
+		assert.Equal(t, target, got)
+	}
+
+	_, err := applyDelta([]byte("short"), createDelta(base, base))
+	assert.Error(t, err)
+
+	// the target size is far larger than the instructions can produce
+	huge := []byte{5, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 0x90, 5}
+	_, err = applyDelta([]byte("short"), huge)
+	assert.Error(t, err)
+}
+
+func TestInflate(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zlib.NewWriter(&buf)
+	zw.Write([]byte("hello"))
+	zw.Close()
+	data, err := inflate(bytes.NewReader(buf.Bytes()), 5)
+	assert.NoError(t, err)
+	assert.Equal(t, []byte("hello"), data)
+	_, err = inflate(bytes.NewReader(buf.Bytes()), 6)
+	assert.Error(t, err)
+
+	// an endless stream must stop at the declared size
+	pr, pw := io.Pipe()
+	go func() {
+		zw := zlib.NewWriter(pw)
+		zero := make([]byte, 1<<16)
+		for {
+			if _, err := zw.Write(zero); err != nil {
+				return
+			}
+		}
+	}()
+	_, err = inflate(pr, 10)
+	assert.Error(t, err)
+	pr.Close()
+}
+
+func TestWriteAndIndexPack(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	blob, err := WriteObject(src, &GitBlob{Data: []byte("hello\n")})
+	assert.NoError(t, err)
+	tree := &GitTree{Entries: []*GitTreeEntry{{Mode: ModeBlob, Path: "hello.txt", Sha: blob}}}
+	treeSha, err := WriteObject(src, tree)
+	assert.NoError(t, err)
+	first := writeTestCommit(t, src, "first")
+	second := writeTestCommit(t, src, "second", first)
+
+	objects, err := ListObjects(src, []string{second, treeSha}, nil)
+	assert.NoError(t, err)
+	// 2 commits, empty tree, tree and blob
+	assert.Equal(t, 5, len(objects))
+	objects, err = ListObjects(src, []string{second}, []string{first})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{second}, objects)
+
+	var pack bytes.Buffer
+	assert.NoError(t, WritePack(src, &pack, []string{second, first, treeSha, blob}))
+
+	dst := newTestRepo(t)
+	defer os.RemoveAll(dst.Worktree)
+	name, err := IndexPack(dst, &pack, false)
+	assert.NoError(t, err)
+	assert.FileExists(t, filepath.Join(dst.RepoPath("objects/pack"), "pack-"+name+".idx"))
+
+	commit, err := ReadCommit(dst, second)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{first}, commit.Parents)
+	obj, err := ReadObject(dst, treeSha)
+	assert.NoError(t, err)
+	assert.Equal(t, "hello.txt", obj.(*GitTree).Entries[0].Path)
+	assert.Equal(t, ModeBlob, obj.(*GitTree).Entries[0].Mode)
+	assert.True(t, HasObject(dst, blob))
+	expanded, err := ExpandObjectID(dst, blob[:6])
+	assert.NoError(t, err)
+	assert.Equal(t, blob, expanded)
+	// the empty tree of commits was not packed
+	_, err = ReadObject(dst, commit.Tree)
+	assert.Error(t, err)
+}
+
+func TestIndexPackWithDeltas(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	base := bytes.Repeat([]byte("base content\n"), 100)
+	target := append(append([]byte{}, base...), "more\n"...)
+	third := append(append([]byte{}, target...), "and more\n"...)
+	baseSha := hashObjectData("blob", base)
+
+	// base, ofs-delta against base, ref-delta against the ofs-delta object
+	var b bytes.Buffer
+	b.WriteString("PACK")
+	binary.Write(&b, binary.BigEndian, uint32(2))
+	binary.Write(&b, binary.BigEndian, uint32(3))
+	writePackEntryHeader(&b, packObjBlob, uint64(len(base)))
+	b.Write(compressZlib(base))
+	ofs := b.Len()
+	delta := createDelta(base, target)
+	writePackEntryHeader(&b, packObjOfsDelta, uint64(len(delta)))
+	b.WriteByte(byte(ofs - 12))
+	b.Write(compressZlib(delta))
+	delta = createDelta(target, third)
+	writePackEntryHeader(&b, packObjRefDelta, uint64(len(delta)))
+	targetSha, _ := hex.DecodeString(hashObjectData("blob", target))
+	b.Write(targetSha)
+	b.Write(compressZlib(delta))
+	sum := sha1.Sum(b.Bytes())
+	b.Write(sum[:])
+
+	_, err := IndexPack(repo, &b, false)
+	assert.NoError(t, err)
+	for _, want := range [][]byte{base, target, third} {
+		objType, data, err := ReadObjectData(repo, hashObjectData("blob", want))
+		assert.NoError(t, err)
+		assert.Equal(t, "blob", objType)
+		assert.Equal(t, want, data)
+	}
+	assert.True(t, HasObject(repo, baseSha))
+}
+
+func TestIndexPackThin(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	base := []byte("base of thin pack\n")
+	target := []byte("base of thin pack\nchanged\n")
+	baseSha, err := WriteObject(repo, &GitBlob{Data: base})
+	assert.NoError(t, err)
+
+	thinPack := func() *bytes.Buffer {
+		var b bytes.Buffer
+		b.WriteString("PACK")
+		binary.Write(&b, binary.BigEndian, uint32(2))
+		binary.Write(&b, binary.BigEndian, uint32(1))
+		delta := createDelta(base, target)
+		writePackEntryHeader(&b, packObjRefDelta, uint64(len(delta)))
+		bin, _ := hex.DecodeString(baseSha)
+		b.Write(bin)
+		b.Write(compressZlib(delta))
+		sum := sha1.Sum(b.Bytes())
+		b.Write(sum[:])
+		return &b
+	}
+
+	_, err = IndexPack(repo, thinPack(), false)
+	assert.Error(t, err)
+	_, err = IndexPack(repo, thinPack(), true)
+	assert.NoError(t, err)
+
+	// base is appended to the pack, so the pack is usable without the loose object
+	assert.NoError(t, os.Remove(repo.RepoPath(objectPath(baseSha))))
+	_, data, err := ReadObjectData(repo, hashObjectData("blob", target))
+	assert.NoError(t, err)
+	assert.Equal(t, target, data)
+	_, data, err = ReadObjectData(repo, baseSha)
+	assert.NoError(t, err)
+	assert.Equal(t, base, data)
+}
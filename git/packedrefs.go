@@ -0,0 +1,139 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// packedRefsHeader is the first line of packed-refs. refs are sorted and peeled objects of tags are recorded.
+const packedRefsHeader = "# pack-refs with: peeled fully-peeled sorted \n"
+
+// readPackedRefs return refs in packed-refs file sorted by name.
+// lines of peeled objects ("^<sha>") are skipped.
+func readPackedRefs(repo *GitRepository) ([]*GitRef, error) {
+	data, err := ioutil.ReadFile(repo.RepoPath("packed-refs"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var refs []*GitRef
+	for _, line := range strings.Split(string(data), "\n") {
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, "^") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || !isHexSha(fields[0]) {
+			return nil, fmt.Errorf("unexpected line in packed-refs: %q", line)
+		}
+		refs = append(refs, &GitRef{Name: fields[1], Sha: fields[0]})
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// findPackedRef return ref in packed-refs, or nil if it is not packed.
+func findPackedRef(repo *GitRepository, name string) (*GitRef, error) {
+	if !strings.HasPrefix(name, "refs/") {
+		return nil, nil
+	}
+	refs, err := readPackedRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	i := sort.Search(len(refs), func(i int) bool { return refs[i].Name >= name })
+	if i < len(refs) && refs[i].Name == name {
+		return refs[i], nil
+	}
+	return nil, nil
+}
+
+// writePackedRefs write packed-refs with peeled objects of annotated tags.
+// the file is removed if refs is empty.
+func writePackedRefs(repo *GitRepository, refs []*GitRef) error {
+	path := repo.RepoPath("packed-refs")
+	if len(refs) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sorted := append([]*GitRef(nil), refs...)
+	sort.Slice(sorted, func(i, j int) bool { return sorted[i].Name < sorted[j].Name })
+	var b bytes.Buffer
+	b.WriteString(packedRefsHeader)
+	for _, ref := range sorted {
+		fmt.Fprintf(&b, "%s %s\n", ref.Sha, ref.Name)
+		if peeled := peelTag(repo, ref.Sha); peeled != "" {
+			fmt.Fprintf(&b, "^%s\n", peeled)
+		}
+	}
+	return writeLockedFile(path, b.Bytes())
+}
+
+// deletePackedRef remove ref from packed-refs. return false if it is not packed.
+func deletePackedRef(repo *GitRepository, name string) (bool, error) {
+	refs, err := readPackedRefs(repo)
+	if err != nil {
+		return false, err
+	}
+	for i, ref := range refs {
+		if ref.Name == name {
+			return true, writePackedRefs(repo, append(refs[:i:i], refs[i+1:]...))
+		}
+	}
+	return false, nil
+}
+
+// PackRefs move refs to packed-refs and remove their loose files.
+// tags and refs which are already packed are packed, and all refs if all is true.
+// symbolic refs are not packed.
+func PackRefs(repo *GitRepository, all bool) error {
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		return err
+	}
+	wasPacked := map[string]bool{}
+	for _, ref := range packed {
+		wasPacked[ref.Name] = true
+	}
+	refs, err := ListRefs(repo, "refs/")
+	if err != nil {
+		return err
+	}
+	var pack, loose []*GitRef
+	for _, ref := range refs {
+		if ref.IsSymbolic() || ref.Sha == "" {
+			continue
+		}
+		if all || wasPacked[ref.Name] || strings.HasPrefix(ref.Name, "refs/tags/") {
+			pack = append(pack, ref)
+			loose = append(loose, ref)
+		}
+	}
+	if err := writePackedRefs(repo, pack); err != nil {
+		return err
+	}
+
+	// loose files are removed only if they are not updated while packing
+	for _, ref := range loose {
+		path := repo.RepoPath(ref.Name)
+		data, err := ioutil.ReadFile(path)
+		if err != nil || strings.TrimSpace(string(data)) != ref.Sha {
+			continue
+		}
+		if err := os.Remove(path); err != nil {
+			return err
+		}
+		// directories of categories like refs/heads are kept
+		category := strings.SplitN(ref.Name, "/", 3)
+		removeEmptyDirs(filepath.Dir(path), repo.RepoPath(category[0]+"/"+category[1]))
+	}
+	return nil
+}
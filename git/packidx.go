@@ -0,0 +1,259 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// packIndexEntry is an object entry of pack index.
+type packIndexEntry struct {
+	sha    string
+	offset int64
+	crc    uint32
+}
+
+// packIndexMagic is the signature of pack index version 2. ("\377tOc")
+var packIndexMagic = []byte{0xff, 't', 'O', 'c'}
+
+// encodePackIndex make pack index version 2.
+// fanout table, sorted hashes, crc32s, offsets, large offsets, pack checksum and index checksum.
+func encodePackIndex(entries []packIndexEntry, packChecksum []byte) ([]byte, error) {
+	sort.Slice(entries, func(i, j int) bool { return entries[i].sha < entries[j].sha })
+
+	var b bytes.Buffer
+	b.Write(packIndexMagic)
+	binary.Write(&b, binary.BigEndian, uint32(2))
+
+	var fanout [256]uint32
+	for _, e := range entries {
+		first, err := hex.DecodeString(e.sha[:2])
+		if err != nil {
+			return nil, err
+		}
+		fanout[first[0]]++
+	}
+	for i := 1; i < 256; i++ {
+		fanout[i] += fanout[i-1]
+	}
+	binary.Write(&b, binary.BigEndian, fanout)
+
+	for _, e := range entries {
+		sha, err := hex.DecodeString(e.sha)
+		if err != nil {
+			return nil, err
+		}
+		b.Write(sha)
+	}
+	for _, e := range entries {
+		binary.Write(&b, binary.BigEndian, e.crc)
+	}
+	var large []uint64
+	for _, e := range entries {
+		if e.offset < 0x80000000 {
+			binary.Write(&b, binary.BigEndian, uint32(e.offset))
+			continue
+		}
+		binary.Write(&b, binary.BigEndian, uint32(0x80000000|len(large)))
+		large = append(large, uint64(e.offset))
+	}
+	for _, offset := range large {
+		binary.Write(&b, binary.BigEndian, offset)
+	}
+
+	b.Write(packChecksum)
+	sum := sha1.Sum(b.Bytes())
+	b.Write(sum[:])
+	return b.Bytes(), nil
+}
+
+// packIndex is a loaded pack index.
+type packIndex struct {
+	packPath string
+	data     []byte
+	count    int
+	modTime  time.Time
+}
+
+func parsePackIndex(path string, data []byte) (*packIndex, error) {
+	if len(data) < 8+256*4+40 || !bytes.Equal(data[:4], packIndexMagic) {
+		return nil, fmt.Errorf("Unsupported pack index: %s", path)
+	}
+	if version := binary.BigEndian.Uint32(data[4:8]); version != 2 {
+		return nil, fmt.Errorf("Unsupported pack index version %d: %s", version, path)
+	}
+	count := int(binary.BigEndian.Uint32(data[8+255*4:]))
+	if len(data) < 8+256*4+count*28+40 {
+		return nil, fmt.Errorf("Pack index is truncated: %s", path)
+	}
+	if sum := sha1.Sum(data[:len(data)-20]); !bytes.Equal(sum[:], data[len(data)-20:]) {
+		return nil, fmt.Errorf("Pack index checksum mismatch: %s", path)
+	}
+	return &packIndex{
+		packPath: strings.TrimSuffix(path, ".idx") + ".pack",
+		data:     data,
+		count:    count,
+	}, nil
+}
+
+func (idx *packIndex) fanout(i int) int {
+	if i < 0 {
+		return 0
+	}
+	return int(binary.BigEndian.Uint32(idx.data[8+i*4:]))
+}
+
+func (idx *packIndex) shaAt(i int) []byte {
+	start := 8 + 256*4 + i*20
+	return idx.data[start : start+20]
+}
+
+// objects return hashes of all objects in the pack.
+func (idx *packIndex) objects() []string {
+	shas := make([]string, idx.count)
+	for i := range shas {
+		shas[i] = hex.EncodeToString(idx.shaAt(i))
+	}
+	return shas
+}
+
+func (idx *packIndex) offsetAt(i int) int64 {
+	start := 8 + 256*4 + idx.count*24 + i*4
+	offset := binary.BigEndian.Uint32(idx.data[start:])
+	if offset&0x80000000 == 0 {
+		return int64(offset)
+	}
+	large := 8 + 256*4 + idx.count*28 + int(offset&0x7fffffff)*8
+	return int64(binary.BigEndian.Uint64(idx.data[large:]))
+}
+
+// find return offset of object in packfile.
+func (idx *packIndex) find(sha string) (int64, bool) {
+	bin, err := hex.DecodeString(sha)
+	if err != nil || len(bin) != 20 {
+		return 0, false
+	}
+	lo, hi := idx.fanout(int(bin[0])-1), idx.fanout(int(bin[0]))
+	i := lo + sort.Search(hi-lo, func(i int) bool { return bytes.Compare(idx.shaAt(lo+i), bin) >= 0 })
+	if i < hi && bytes.Equal(idx.shaAt(i), bin) {
+		return idx.offsetAt(i), true
+	}
+	return 0, false
+}
+
+// withPrefix return hashes in the index which begin with hex prefix.
+func (idx *packIndex) withPrefix(prefix string) []string {
+	var found []string
+	first, err := hex.DecodeString(prefix[:2])
+	if err != nil {
+		return nil
+	}
+	for i := idx.fanout(int(first[0]) - 1); i < idx.fanout(int(first[0])); i++ {
+		if sha := hex.EncodeToString(idx.shaAt(i)); strings.HasPrefix(sha, prefix) {
+			found = append(found, sha)
+		}
+	}
+	return found
+}
+
+// packIndexCache keeps loaded pack indexes. entries are reloaded when the file is modified.
+var packIndexCache = struct {
+	sync.Mutex
+	indexes map[string]*packIndex
+}{indexes: map[string]*packIndex{}}
+
+// listPackIndexes return indexes of all packfiles in repository.
+func listPackIndexes(repo *GitRepository) ([]*packIndex, error) {
+	paths, err := filepath.Glob(filepath.Join(repo.RepoPath("objects/pack"), "pack-*.idx"))
+	if err != nil {
+		return nil, err
+	}
+	packIndexCache.Lock()
+	defer packIndexCache.Unlock()
+
+	var indexes []*packIndex
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if err != nil {
+			continue
+		}
+		if idx, ok := packIndexCache.indexes[path]; ok && idx.modTime.Equal(info.ModTime()) {
+			indexes = append(indexes, idx)
+			continue
+		}
+		data, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		idx, err := parsePackIndex(path, data)
+		if err != nil {
+			return nil, err
+		}
+		idx.modTime = info.ModTime()
+		packIndexCache.indexes[path] = idx
+		indexes = append(indexes, idx)
+	}
+	return indexes, nil
+}
+
+var errObjectNotFound = errors.New("Object not found")
+
+// findPackedObject return path of the packfile which contains the object and offset in it.
+// multi-pack-index is looked up first, then indexes of each packfile.
+func findPackedObject(repo *GitRepository, sha string) (string, int64, bool, error) {
+	if m := loadMultiPackIndex(repo); m != nil {
+		if packPath, offset, ok := m.find(sha); ok {
+			// the pack may be removed after multi-pack-index is written
+			if _, err := os.Stat(packPath); err == nil {
+				return packPath, offset, true, nil
+			}
+		}
+	}
+	indexes, err := listPackIndexes(repo)
+	if err != nil {
+		return "", 0, false, err
+	}
+	for _, idx := range indexes {
+		if offset, ok := idx.find(sha); ok {
+			return idx.packPath, offset, true, nil
+		}
+	}
+	return "", 0, false, nil
+}
+
+// readPackedObject read object from packfiles.
+func readPackedObject(repo *GitRepository, sha string) (string, []byte, error) {
+	packPath, offset, ok, err := findPackedObject(repo, sha)
+	if err != nil {
+		return "", nil, err
+	}
+	if !ok {
+		return "", nil, fmt.Errorf("%w: %s", errObjectNotFound, sha)
+	}
+	f, err := os.Open(packPath)
+	if err != nil {
+		return "", nil, err
+	}
+	defer f.Close()
+	objType, data, err := readPackObjectAt(repo, f, offset)
+	if err != nil {
+		return "", nil, fmt.Errorf("Corrupt object %s in %s: %w", sha, filepath.Base(packPath), err)
+	}
+	return objType, data, nil
+}
+
+// hasPackedObject return true if object is in any packfile.
+func hasPackedObject(repo *GitRepository, sha string) bool {
+	_, _, ok, _ := findPackedObject(repo, sha)
+	return ok
+}
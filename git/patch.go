@@ -0,0 +1,244 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// diffContextLines is the number of context lines of patches.
+const diffContextLines = 3
+
+// entryContent return content of the tree entry for diff. nil entry has empty content.
+// a submodule is shown as the commit which it points.
+func entryContent(repo *GitRepository, e *GitTreeEntry) ([]byte, error) {
+	if e == nil {
+		return nil, nil
+	}
+	if e.IsGitlink() {
+		return []byte("Subproject commit " + e.Sha + "\n"), nil
+	}
+	_, data, err := ReadObjectData(repo, e.Sha)
+	return data, err
+}
+
+func shortSha(sha string) string {
+	if len(sha) > 7 {
+		return sha[:7]
+	}
+	return sha
+}
+
+// WritePatch write changes in the format of git diff.
+func WritePatch(repo *GitRepository, w io.Writer, changes []*TreeChange) error {
+	for _, c := range changes {
+		if err := writeFilePatch(repo, w, c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeFilePatch(repo *GitRepository, w io.Writer, c *TreeChange) error {
+	var b strings.Builder
+	fmt.Fprintf(&b, "diff --git a/%s b/%s\n", c.Path, c.Path)
+	oldSha, newSha := zeroSha, zeroSha
+	switch {
+	case c.Old == nil:
+		fmt.Fprintf(&b, "new file mode %o\n", c.New.Mode)
+		newSha = c.New.Sha
+		fmt.Fprintf(&b, "index %s..%s\n", shortSha(oldSha), shortSha(newSha))
+	case c.New == nil:
+		fmt.Fprintf(&b, "deleted file mode %o\n", c.Old.Mode)
+		oldSha = c.Old.Sha
+		fmt.Fprintf(&b, "index %s..%s\n", shortSha(oldSha), shortSha(newSha))
+	default:
+		oldSha, newSha = c.Old.Sha, c.New.Sha
+		if c.Old.Mode != c.New.Mode {
+			fmt.Fprintf(&b, "old mode %o\nnew mode %o\n", c.Old.Mode, c.New.Mode)
+			if oldSha != newSha {
+				fmt.Fprintf(&b, "index %s..%s\n", shortSha(oldSha), shortSha(newSha))
+			}
+		} else {
+			fmt.Fprintf(&b, "index %s..%s %o\n", shortSha(oldSha), shortSha(newSha), c.New.Mode)
+		}
+	}
+	if _, err := io.WriteString(w, b.String()); err != nil {
+		return err
+	}
+	if oldSha == newSha {
+		return nil
+	}
+
+	oldData, err := entryContent(repo, c.Old)
+	if err != nil {
+		return err
+	}
+	newData, err := entryContent(repo, c.New)
+	if err != nil {
+		return err
+	}
+	oldName, newName := "a/"+c.Path, "b/"+c.Path
+	if c.Old == nil {
+		oldName = "/dev/null"
+	}
+	if c.New == nil {
+		newName = "/dev/null"
+	}
+	if isBinary(oldData) || isBinary(newData) {
+		_, err := fmt.Fprintf(w, "Binary files %s and %s differ\n", oldName, newName)
+		return err
+	}
+	if len(oldData) == 0 && len(newData) == 0 {
+		return nil
+	}
+	if _, err := fmt.Fprintf(w, "--- %s\n+++ %s\n", oldName, newName); err != nil {
+		return err
+	}
+	return writeUnifiedDiff(w, splitLines(oldData), splitLines(newData), diffContextLines)
+}
+
+// FileStat is numbers of changed lines of a file. binary files have sizes instead of lines.
+type FileStat struct {
+	Path             string
+	Added, Deleted   int
+	Binary           bool
+	OldSize, NewSize int
+}
+
+// DiffStats return numbers of changed lines of changes.
+func DiffStats(repo *GitRepository, changes []*TreeChange) ([]*FileStat, error) {
+	var stats []*FileStat
+	for _, c := range changes {
+		oldData, err := entryContent(repo, c.Old)
+		if err != nil {
+			return nil, err
+		}
+		newData, err := entryContent(repo, c.New)
+		if err != nil {
+			return nil, err
+		}
+		stat := &FileStat{Path: c.Path, OldSize: len(oldData), NewSize: len(newData)}
+		if isBinary(oldData) || isBinary(newData) {
+			stat.Binary = true
+		} else {
+			a, b := splitLines(oldData), splitLines(newData)
+			common := len(diffLines(a, b))
+			stat.Added, stat.Deleted = len(b)-common, len(a)-common
+		}
+		stats = append(stats, stat)
+	}
+	return stats, nil
+}
+
+// WriteDiffStat write the graph of changed lines and the summary like git diff --stat for 80 columns.
+func WriteDiffStat(w io.Writer, stats []*FileStat) error {
+	const width = 80
+	maxLen, maxChange, binWidth := 0, 0, 0
+	for _, s := range stats {
+		if len(s.Path) > maxLen {
+			maxLen = len(s.Path)
+		}
+		if s.Binary {
+			if n := len(fmt.Sprintf("Bin %d -> %d bytes", s.OldSize, s.NewSize)); n > binWidth {
+				binWidth = n
+			}
+		} else if s.Added+s.Deleted > maxChange {
+			maxChange = s.Added + s.Deleted
+		}
+	}
+	numberWidth := len(strconv.Itoa(maxChange))
+	if binWidth > 0 && numberWidth < 3 {
+		numberWidth = 3
+	}
+	graphWidth := maxChange
+	if maxChange+4 <= binWidth {
+		graphWidth = binWidth - 4
+	}
+	nameWidth := maxLen
+	if nameWidth+numberWidth+6+graphWidth > width {
+		if graphWidth > width*3/8-numberWidth-6 {
+			graphWidth = width*3/8 - numberWidth - 6
+			if graphWidth < 6 {
+				graphWidth = 6
+			}
+		}
+		if nameWidth > width-numberWidth-6-graphWidth {
+			nameWidth = width - numberWidth - 6 - graphWidth
+		} else {
+			graphWidth = width - numberWidth - 6 - nameWidth
+		}
+	}
+	scale := func(n int) int {
+		if n == 0 {
+			return 0
+		}
+		return 1 + n*(graphWidth-1)/maxChange
+	}
+
+	insertions, deletions := 0, 0
+	for _, s := range stats {
+		name := s.Path
+		if len(name) > nameWidth {
+			name = name[len(name)-nameWidth+3:]
+			if slash := strings.IndexByte(name, '/'); slash >= 0 {
+				name = name[slash:]
+			}
+			name = "..." + name
+		}
+		if s.Binary {
+			if _, err := fmt.Fprintf(w, " %-*s | %*s %d -> %d bytes\n", nameWidth, name, numberWidth, "Bin", s.OldSize, s.NewSize); err != nil {
+				return err
+			}
+			continue
+		}
+		insertions += s.Added
+		deletions += s.Deleted
+		add, del := s.Added, s.Deleted
+		if graphWidth <= maxChange {
+			total := scale(add + del)
+			if total < 2 && add > 0 && del > 0 {
+				total = 2
+			}
+			if add < del {
+				add = scale(add)
+				del = total - add
+			} else {
+				del = scale(del)
+				add = total - del
+			}
+		}
+		space := ""
+		if s.Added+s.Deleted > 0 {
+			space = " "
+		}
+		if _, err := fmt.Fprintf(w, " %-*s | %*d%s%s%s\n", nameWidth, name, numberWidth, s.Added+s.Deleted, space,
+			strings.Repeat("+", add), strings.Repeat("-", del)); err != nil {
+			return err
+		}
+	}
+	_, err := io.WriteString(w, diffStatSummary(len(stats), insertions, deletions)+"\n")
+	return err
+}
+
+// diffStatSummary return the summary line of diffstat.
+func diffStatSummary(files, insertions, deletions int) string {
+	plural := func(n int, word string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s", n, word)
+		}
+		return fmt.Sprintf("%d %ss", n, word)
+	}
+	summary := " " + plural(files, "file") + " changed"
+	if files == 0 {
+		return " 0 files changed"
+	}
+	if insertions > 0 || deletions == 0 {
+		summary += ", " + plural(insertions, "insertion") + "(+)"
+	}
+	if deletions > 0 || insertions == 0 {
+		summary += ", " + plural(deletions, "deletion") + "(-)"
+	}
+	return summary
+}
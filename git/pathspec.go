@@ -0,0 +1,101 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// MatchPathspec return true if the path matches one of pathspecs. empty pathspecs match any path.
+// a pathspec matches the path itself and files under it, and its wildcards match across "/".
+func MatchPathspec(specs []string, name string) bool {
+	if len(specs) == 0 {
+		return true
+	}
+	for _, spec := range specs {
+		if matchPathspec(spec, name) {
+			return true
+		}
+	}
+	return false
+}
+
+func matchPathspec(spec, name string) bool {
+	spec = strings.TrimSuffix(spec, "/")
+	if spec == "" || spec == "." || name == spec || strings.HasPrefix(name, spec+"/") {
+		return true
+	}
+	return strings.ContainsAny(spec, "*?[") && wildmatch(spec, name, false)
+}
+
+// UnmatchedPathspecs return pathspecs which match none of paths.
+func UnmatchedPathspecs(specs, paths []string) []string {
+	var unmatched []string
+	for _, spec := range specs {
+		found := false
+		for _, name := range paths {
+			if matchPathspec(spec, name) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			unmatched = append(unmatched, spec)
+		}
+	}
+	return unmatched
+}
+
+// RepoRelativePath convert the path relative to the directory cwd into the path relative to worktree.
+// the top directory of worktree is converted into ".".
+func RepoRelativePath(repo *GitRepository, cwd, name string) (string, error) {
+	if !filepath.IsAbs(name) {
+		name = filepath.Join(cwd, name)
+	}
+	worktree, err := filepath.EvalSymlinks(repo.Worktree)
+	if err != nil {
+		worktree = repo.Worktree
+	}
+	for _, top := range []string{repo.Worktree, worktree} {
+		rel, err := filepath.Rel(top, filepath.Clean(name))
+		if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+	if dir, err := filepath.EvalSymlinks(filepath.Dir(name)); err == nil {
+		if rel, err := filepath.Rel(worktree, filepath.Join(dir, filepath.Base(name))); err == nil && !strings.HasPrefix(rel, "..") {
+			return filepath.ToSlash(rel), nil
+		}
+	}
+	return "", fmt.Errorf("%s: '%s' is outside repository at '%s'", name, name, repo.Worktree)
+}
+
+// QuotePath quote the path in double quotes like core.quotePath of git,
+// if it has control characters, double quotes, backslashes or non-ASCII bytes.
+func QuotePath(name string) string {
+	quoted := false
+	var b strings.Builder
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		switch {
+		case c == '"' || c == '\\':
+			b.WriteByte('\\')
+			b.WriteByte(c)
+		case c < 0x20 || c >= 0x7f:
+			if i := strings.IndexByte("\a\b\t\n\v\f\r", c); i >= 0 {
+				b.WriteByte('\\')
+				b.WriteByte("abtnvfr"[i])
+			} else {
+				fmt.Fprintf(&b, "\\%03o", c)
+			}
+		default:
+			b.WriteByte(c)
+			continue
+		}
+		quoted = true
+	}
+	if !quoted {
+		return name
+	}
+	return `"` + b.String() + `"`
+}
@@ -0,0 +1,205 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// maxPktPayload is the maximum data length of a pkt-line.
+const maxPktPayload = 65516
+
+// kinds of pkt-line
+const (
+	pktData = iota
+	// pktFlush is "0000" which ends a message.
+	pktFlush
+	// pktDelim is "0001" which separates sections of protocol v2.
+	pktDelim
+	// pktResponseEnd is "0002" which ends a response of protocol v2 stateless connection.
+	pktResponseEnd
+)
+
+// pktLineReader read pkt-line framed stream.
+type pktLineReader struct {
+	r   io.Reader
+	buf [maxPktPayload + 4]byte
+}
+
+func newPktLineReader(r io.Reader) *pktLineReader {
+	return &pktLineReader{r: r}
+}
+
+// read return kind of next packet and its payload.
+// the payload is valid until next read.
+func (p *pktLineReader) read() (int, []byte, error) {
+	if _, err := io.ReadFull(p.r, p.buf[:4]); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return 0, nil, errors.New("Unexpected EOF in pkt-line header")
+		}
+		return 0, nil, err
+	}
+	n, err := strconv.ParseUint(string(p.buf[:4]), 16, 16)
+	if err != nil {
+		return 0, nil, fmt.Errorf("Invalid pkt-line length: %q", p.buf[:4])
+	}
+	switch n {
+	case 0:
+		return pktFlush, nil, nil
+	case 1:
+		return pktDelim, nil, nil
+	case 2:
+		return pktResponseEnd, nil, nil
+	case 3:
+		return 0, nil, fmt.Errorf("Invalid pkt-line length: %q", p.buf[:4])
+	}
+	if n > maxPktPayload+4 {
+		return 0, nil, fmt.Errorf("Too long pkt-line: %d", n)
+	}
+	data := p.buf[4:n]
+	if _, err := io.ReadFull(p.r, data); err != nil {
+		return 0, nil, fmt.Errorf("Unexpected EOF in pkt-line: %w", err)
+	}
+	return pktData, data, nil
+}
+
+// readLine return next data packet as text without trailing newline.
+// ok is false if the packet is flush, delim or response-end.
+func (p *pktLineReader) readLine() (string, bool, error) {
+	kind, data, err := p.read()
+	if err != nil || kind != pktData {
+		return "", false, err
+	}
+	line := strings.TrimSuffix(string(data), "\n")
+	if strings.HasPrefix(line, "ERR ") {
+		return "", false, fmt.Errorf("remote error: %s", line[4:])
+	}
+	return line, true, nil
+}
+
+// readLines return text lines until flush or delim packet.
+func (p *pktLineReader) readLines() ([]string, error) {
+	var lines []string
+	for {
+		line, ok, err := p.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			return lines, nil
+		}
+		lines = append(lines, line)
+	}
+}
+
+// writePktLine write a text line in pkt-line format. newline is appended.
+func writePktLine(w io.Writer, format string, args ...interface{}) error {
+	return writePktData(w, []byte(fmt.Sprintf(format, args...)+"\n"))
+}
+
+// writePktData write data as a pkt-line.
+func writePktData(w io.Writer, data []byte) error {
+	if len(data) > maxPktPayload {
+		return fmt.Errorf("Too long pkt-line: %d", len(data))
+	}
+	if _, err := fmt.Fprintf(w, "%04x", len(data)+4); err != nil {
+		return err
+	}
+	_, err := w.Write(data)
+	return err
+}
+
+func writeFlush(w io.Writer) error {
+	_, err := io.WriteString(w, "0000")
+	return err
+}
+
+func writeDelim(w io.Writer) error {
+	_, err := io.WriteString(w, "0001")
+	return err
+}
+
+// side-band channels
+const (
+	sidebandData     = 1
+	sidebandProgress = 2
+	sidebandError    = 3
+)
+
+// sidebandReader demultiplex side-band stream. data of band 1 is read,
+// progress messages of band 2 are written to progress, and band 3 becomes an error.
+type sidebandReader struct {
+	pkt      *pktLineReader
+	progress io.Writer
+	buf      []byte
+	eof      bool
+}
+
+func newSidebandReader(pkt *pktLineReader, progress io.Writer) *sidebandReader {
+	return &sidebandReader{pkt: pkt, progress: progress}
+}
+
+func (s *sidebandReader) Read(b []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.eof {
+			return 0, io.EOF
+		}
+		kind, data, err := s.pkt.read()
+		if err != nil {
+			return 0, err
+		}
+		if kind != pktData {
+			s.eof = true
+			continue
+		}
+		if len(data) == 0 {
+			continue
+		}
+		switch data[0] {
+		case sidebandData:
+			s.buf = append(s.buf[:0], data[1:]...)
+		case sidebandProgress:
+			if s.progress != nil {
+				s.progress.Write(data[1:])
+			}
+		case sidebandError:
+			return 0, fmt.Errorf("remote error: %s", strings.TrimSpace(string(data[1:])))
+		default:
+			return 0, fmt.Errorf("Invalid side-band channel %d", data[0])
+		}
+	}
+	n := copy(b, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
+
+// sidebandWriter multiplex data to a side-band channel.
+// max is the maximum payload of a packet including the band number,
+// which is 996 for "side-band" and maxPktPayload for "side-band-64k".
+type sidebandWriter struct {
+	w    io.Writer
+	band byte
+	max  int
+}
+
+func newSidebandWriter(w io.Writer, band byte, max int) *sidebandWriter {
+	return &sidebandWriter{w: w, band: band, max: max}
+}
+
+func (s *sidebandWriter) Write(b []byte) (int, error) {
+	written := 0
+	for len(b) > 0 {
+		n := len(b)
+		if n > s.max-1 {
+			n = s.max - 1
+		}
+		if err := writePktData(s.w, append([]byte{s.band}, b[:n]...)); err != nil {
+			return written, err
+		}
+		written += n
+		b = b[n:]
+	}
+	return written, nil
+}
@@ -0,0 +1,272 @@
+package git
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// defaultDateLayout is the date format of git log.
+const defaultDateLayout = "Mon Jan 2 15:04:05 2006 -0700"
+
+// PrettyFormat is a format of commits given by --format or --pretty.
+// it is one of builtin formats, or a user format with placeholders like "%h %s".
+type PrettyFormat struct {
+	// AbbrevCommit shows abbreviated hashes of commits in builtin formats.
+	AbbrevCommit bool
+
+	builtin string
+	user    string
+	// terminated is true if each commit ends with a newline, instead of newlines between commits.
+	terminated bool
+}
+
+// ParsePrettyFormat parse the format name, which is oneline, short, medium, full, fuller, raw, reference,
+// "format:<string>", "tformat:<string>", or a string including "%" which means tformat. empty name means medium.
+func ParsePrettyFormat(name string) (*PrettyFormat, error) {
+	switch {
+	case name == "":
+		return &PrettyFormat{builtin: "medium"}, nil
+	case name == "oneline":
+		return &PrettyFormat{builtin: name, terminated: true}, nil
+	case name == "short" || name == "medium" || name == "full" || name == "fuller" || name == "raw":
+		return &PrettyFormat{builtin: name}, nil
+	case name == "reference":
+		return &PrettyFormat{user: "%h (%s, %as)", terminated: true}, nil
+	case strings.HasPrefix(name, "format:"):
+		return &PrettyFormat{user: strings.TrimPrefix(name, "format:")}, nil
+	case strings.HasPrefix(name, "tformat:"):
+		return &PrettyFormat{user: strings.TrimPrefix(name, "tformat:"), terminated: true}, nil
+	case strings.Contains(name, "%"):
+		return &PrettyFormat{user: name, terminated: true}, nil
+	}
+	return nil, fmt.Errorf("invalid --pretty format: %s", name)
+}
+
+// BlankBeforePatch return true if a blank line is put between a commit and its patch.
+// it is false for oneline and "format:" formats.
+func (f *PrettyFormat) BlankBeforePatch() bool {
+	if f.user != "" || f.builtin == "" {
+		return f.terminated
+	}
+	return f.builtin != "oneline"
+}
+
+// Separated return true if commits are separated by newlines, instead of terminated.
+func (f *PrettyFormat) Separated() bool {
+	return !f.terminated
+}
+
+// FormatCommit return the formatted commit. it ends with a newline unless the format is separated.
+func (f *PrettyFormat) FormatCommit(sha string, commit *GitCommit) string {
+	if f.user != "" || f.builtin == "" {
+		s := expandPrettyFormat(f.user, sha, commit)
+		if f.terminated {
+			s += "\n"
+		}
+		return s
+	}
+	name := sha
+	if f.AbbrevCommit {
+		name = shortSha(sha)
+	}
+	if f.builtin == "oneline" {
+		return fmt.Sprintf("%s %s\n", name, commitSubject(commit.Message))
+	}
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "commit %s\n", name)
+	if f.builtin == "raw" {
+		headers, _ := parseObjectHeaders(commit.Serialize())
+		for _, h := range headers {
+			fmt.Fprintf(&b, "%s %s\n", h.Key, strings.ReplaceAll(h.Value, "\n", "\n "))
+		}
+	} else if len(commit.Parents) > 1 {
+		var parents []string
+		for _, p := range commit.Parents {
+			parents = append(parents, shortSha(p))
+		}
+		fmt.Fprintf(&b, "Merge: %s\n", strings.Join(parents, " "))
+	}
+	switch f.builtin {
+	case "short":
+		fmt.Fprintf(&b, "Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+	case "medium":
+		fmt.Fprintf(&b, "Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+		fmt.Fprintf(&b, "Date:   %s\n", formatIdentDate(commit.Author, defaultDateLayout))
+	case "full":
+		fmt.Fprintf(&b, "Author: %s <%s>\n", commit.Author.Name, commit.Author.Email)
+		fmt.Fprintf(&b, "Commit: %s <%s>\n", commit.Committer.Name, commit.Committer.Email)
+	case "fuller":
+		fmt.Fprintf(&b, "Author:     %s <%s>\n", commit.Author.Name, commit.Author.Email)
+		fmt.Fprintf(&b, "AuthorDate: %s\n", formatIdentDate(commit.Author, defaultDateLayout))
+		fmt.Fprintf(&b, "Commit:     %s <%s>\n", commit.Committer.Name, commit.Committer.Email)
+		fmt.Fprintf(&b, "CommitDate: %s\n", formatIdentDate(commit.Committer, defaultDateLayout))
+	}
+	message := commit.Message
+	if f.builtin == "short" {
+		message = commitSubject(message)
+	}
+	b.WriteString("\n")
+	for _, line := range strings.Split(strings.TrimRight(message, "\n"), "\n") {
+		b.WriteString("    " + line + "\n")
+	}
+	return b.String()
+}
+
+// commitSubject return the first paragraph of the message joined into a line.
+func commitSubject(message string) string {
+	paragraph := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)[0]
+	return strings.Join(strings.Fields(strings.ReplaceAll(paragraph, "\n", " ")), " ")
+}
+
+// commitBody return the message after the first paragraph.
+func commitBody(message string) string {
+	parts := strings.SplitN(strings.TrimLeft(message, "\n"), "\n\n", 2)
+	if len(parts) < 2 {
+		return ""
+	}
+	return strings.TrimLeft(parts[1], "\n")
+}
+
+// formatIdentDate return the time of the ident in the layout, or empty string if it is invalid.
+func formatIdentDate(u GitUser, layout string) string {
+	when, err := u.When()
+	if err != nil {
+		return ""
+	}
+	return when.Format(layout)
+}
+
+// relativeDate return the time relative to now like "3 days ago".
+func relativeDate(t, now time.Time) string {
+	diff := now.Sub(t)
+	if diff < 0 {
+		return "in the future"
+	}
+	seconds := int64(diff / time.Second)
+	days := seconds / 86400
+	unit := func(n int64, name string) string {
+		if n == 1 {
+			return fmt.Sprintf("%d %s ago", n, name)
+		}
+		return fmt.Sprintf("%d %ss ago", n, name)
+	}
+	switch {
+	case seconds < 90:
+		return unit(seconds, "second")
+	case seconds < 90*60:
+		return unit((seconds+30)/60, "minute")
+	case seconds < 36*3600:
+		return unit((seconds+1800)/3600, "hour")
+	case days < 14:
+		return unit((seconds+43200)/86400, "day")
+	case days < 70:
+		return unit((days+3)/7, "week")
+	case days < 365:
+		return unit((days+15)/30, "month")
+	}
+	return unit((days+183)/365, "year")
+}
+
+// expandPrettyFormat replace placeholders in the user format. unknown placeholders are left as they are.
+func expandPrettyFormat(format, sha string, commit *GitCommit) string {
+	var b strings.Builder
+	for i := 0; i < len(format); i++ {
+		if format[i] != '%' || i+1 >= len(format) {
+			b.WriteByte(format[i])
+			continue
+		}
+		n, s := expandPlaceholder(format[i+1:], sha, commit)
+		if n == 0 {
+			b.WriteByte('%')
+			continue
+		}
+		b.WriteString(s)
+		i += n
+	}
+	return b.String()
+}
+
+// expandPlaceholder return the length of the placeholder after "%" and its value. 0 length means unknown.
+func expandPlaceholder(p, sha string, commit *GitCommit) (int, string) {
+	switch p[0] {
+	case '%':
+		return 1, "%"
+	case 'n':
+		return 1, "\n"
+	case 'H':
+		return 1, sha
+	case 'h':
+		return 1, shortSha(sha)
+	case 'T':
+		return 1, commit.Tree
+	case 't':
+		return 1, shortSha(commit.Tree)
+	case 'P':
+		return 1, strings.Join(commit.Parents, " ")
+	case 'p':
+		var parents []string
+		for _, parent := range commit.Parents {
+			parents = append(parents, shortSha(parent))
+		}
+		return 1, strings.Join(parents, " ")
+	case 's':
+		return 1, commitSubject(commit.Message)
+	case 'b':
+		return 1, commitBody(commit.Message)
+	case 'B':
+		return 1, commit.Message
+	case 'x':
+		if len(p) >= 3 {
+			if v, err := strconv.ParseUint(p[1:3], 16, 8); err == nil {
+				return 3, string([]byte{byte(v)})
+			}
+		}
+	case 'a', 'c':
+		if len(p) < 2 {
+			return 0, ""
+		}
+		u := commit.Author
+		if p[0] == 'c' {
+			u = commit.Committer
+		}
+		if s, ok := expandIdentPlaceholder(p[1], u); ok {
+			return 2, s
+		}
+	}
+	return 0, ""
+}
+
+// expandIdentPlaceholder return the value of the author or committer placeholder like "n" of "%an".
+func expandIdentPlaceholder(c byte, u GitUser) (string, bool) {
+	switch c {
+	case 'n':
+		return u.Name, true
+	case 'e':
+		return u.Email, true
+	case 'd':
+		return formatIdentDate(u, defaultDateLayout), true
+	case 'D':
+		return formatIdentDate(u, time.RFC1123Z), true
+	case 'i':
+		return formatIdentDate(u, "2006-01-02 15:04:05 -0700"), true
+	case 'I':
+		return formatIdentDate(u, "2006-01-02T15:04:05-07:00"), true
+	case 's':
+		return formatIdentDate(u, "2006-01-02"), true
+	case 't':
+		if fields := strings.Fields(u.Time); len(fields) > 0 {
+			return fields[0], true
+		}
+		return "", true
+	case 'r':
+		when, err := u.When()
+		if err != nil {
+			return "", true
+		}
+		return relativeDate(when, time.Now()), true
+	}
+	return "", false
+}
@@ -0,0 +1,41 @@
+package git
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrettyFormat(t *testing.T) {
+	sha := "0123456789abcdef0123456789abcdef01234567"
+	author := GitUser{Name: "alice", Email: "alice@example.com", Time: "1700000000 +0900"}
+	commit := &GitCommit{
+		Tree:      "89abcdef0123456789abcdef0123456789abcdef",
+		Parents:   []string{"fedcba9876543210fedcba9876543210fedcba98"},
+		Author:    author,
+		Committer: GitUser{Name: "bob", Email: "bob@example.com", Time: "1700003600 +0000"},
+		Message:   "subject\nline\n\nbody\n",
+	}
+	format := func(name string) string {
+		f, err := ParsePrettyFormat(name)
+		assert.NoError(t, err)
+		return f.FormatCommit(sha, commit)
+	}
+
+	assert.Equal(t, sha+" subject line\n", format("oneline"))
+	assert.Equal(t, "commit "+sha+"\nAuthor: alice <alice@example.com>\nDate:   Wed Nov 15 07:13:20 2023 +0900\n\n    subject\n    line\n    \n    body\n", format(""))
+	assert.Equal(t, "commit "+sha+"\nAuthor: alice <alice@example.com>\n\n    subject line\n", format("short"))
+	assert.Equal(t, "commit "+sha+"\nAuthor:     alice <alice@example.com>\nAuthorDate: Wed Nov 15 07:13:20 2023 +0900\n"+
+		"Commit:     bob <bob@example.com>\nCommitDate: Tue Nov 14 23:13:20 2023 +0000\n\n    subject\n    line\n    \n    body\n", format("fuller"))
+	assert.Equal(t, "0123456 (subject line, 2023-11-15)\n", format("reference"))
+	assert.Equal(t, "0123456 fedcba9 alice alice@example.com 2023-11-15T07:13:20+09:00 1700000000 body\n%z\t", format("format:%h %p %an %ae %aI %at %b%%z%x09"))
+	assert.Equal(t, "bob 2023-11-14 23:13:20 +0000\n", format("%cn %ci"))
+
+	_, err := ParsePrettyFormat("unknown")
+	assert.EqualError(t, err, "invalid --pretty format: unknown")
+
+	now := time.Unix(1700000000, 0)
+	assert.Equal(t, "3 days ago", relativeDate(now.Add(-3*24*time.Hour), now))
+	assert.Equal(t, "2 years ago", relativeDate(now.Add(-2*365*24*time.Hour), now))
+}
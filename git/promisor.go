@@ -0,0 +1,141 @@
+package git
+
+import (
+	"fmt"
+	"path/filepath"
+	"sync"
+)
+
+// lazyFetching is git directories which are fetching promised objects.
+// objects missing while fetching are not fetched again.
+var lazyFetching sync.Map
+
+// promisorRemote return name of remote which promises objects omitted by partial clone.
+// return empty string if repo is not a partial clone.
+func promisorRemote(repo *GitRepository) string {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return ""
+	}
+	if name := cfg.GetString("extensions.partialClone", ""); name != "" {
+		return name
+	}
+	for _, name := range cfg.Subsections("remote") {
+		if promisor, _ := cfg.GetBool("remote."+name+".promisor", false); promisor {
+			return name
+		}
+	}
+	return ""
+}
+
+// IsPartialClone return true if objects of repo may be missing and fetched on demand.
+func IsPartialClone(repo *GitRepository) bool {
+	return promisorRemote(repo) != ""
+}
+
+// setPromisorRemote record remote as promisor remote with the filter used for later fetches.
+func setPromisorRemote(repo *GitRepository, name, filter string) error {
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	cfg.Set("core", "", "repositoryformatversion", "1")
+	cfg.Set("extensions", "", "partialclone", name)
+	cfg.Set("remote", name, "promisor", "true")
+	cfg.Set("remote", name, "partialclonefilter", filter)
+	return WriteConfig(repo, cfg)
+}
+
+// readPromisedObject fetch the object missing in a partial clone from promisor remote, then read it.
+func readPromisedObject(repo *GitRepository, sha string) (string, []byte, error) {
+	if err := fetchPromisedObjects(repo, []string{sha}); err != nil {
+		return "", nil, err
+	}
+	return readPackedObject(repo, sha)
+}
+
+// fetchPromisedObjects fetch objects from promisor remote. blobs which the objects refer are not fetched.
+// it does nothing if repo is not a partial clone.
+func fetchPromisedObjects(repo *GitRepository, shas []string) error {
+	name := promisorRemote(repo)
+	if name == "" || len(shas) == 0 {
+		return nil
+	}
+	if _, busy := lazyFetching.LoadOrStore(repo.GitDir, true); busy {
+		return nil
+	}
+	defer lazyFetching.Delete(repo.GitDir)
+
+	remote, err := GetRemote(repo, name)
+	if err != nil {
+		return err
+	}
+	transport, err := newTransport(repo, remote.URL, nil)
+	if err != nil {
+		return err
+	}
+	defer transport.Close()
+	adv, err := transport.FetchRefs()
+	if err != nil {
+		return err
+	}
+	shallow, err := ReadShallow(repo)
+	if err != nil {
+		return err
+	}
+	res, err := transport.FetchPack(adv, &FetchRequest{Wants: shas, Shallow: shallow, Filter: "blob:none"})
+	if err != nil {
+		return fmt.Errorf("Could not fetch %s from promisor remote: %w", shas[0], err)
+	}
+	defer res.Close()
+	pack, err := IndexPack(repo, res, false)
+	if err != nil {
+		return err
+	}
+	return markPromisorPack(repo, pack)
+}
+
+// markPromisorPack create .promisor file of the pack fetched from promisor remote,
+// which tells that objects referred from the pack may be missing.
+func markPromisorPack(repo *GitRepository, pack string) error {
+	if pack == "" {
+		return nil
+	}
+	return repo.SaveRepoFile(filepath.Join("objects", "pack", "pack-"+pack+".promisor"), nil)
+}
+
+// prefetchMissingBlobs fetch blobs in tree which are omitted by partial clone at once,
+// so that checkout does not fetch them one by one.
+func prefetchMissingBlobs(repo *GitRepository, treeSha string) error {
+	if !IsPartialClone(repo) {
+		return nil
+	}
+	var missing []string
+	var walk func(sha string) error
+	walk = func(sha string) error {
+		obj, err := ReadObject(repo, sha)
+		if err != nil {
+			return err
+		}
+		tree, ok := obj.(*GitTree)
+		if !ok {
+			return fmt.Errorf("%s is not a tree", sha)
+		}
+		for _, entry := range tree.Entries {
+			switch {
+			case entry.IsTree():
+				if err := walk(entry.Sha); err != nil {
+					return err
+				}
+			case entry.IsGitlink():
+			case !HasObject(repo, entry.Sha):
+				missing = append(missing, entry.Sha)
+			}
+		}
+		return nil
+	}
+	if err := walk(treeSha); err != nil {
+		return err
+	}
+	return fetchPromisedObjects(repo, missing)
+}
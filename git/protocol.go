@@ -0,0 +1,479 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// agent is sent to remote as "agent" capability.
+const agent = "mygit/0.0.1"
+
+// RemoteRef is a ref advertised by remote repository.
+// Target is referent of symbolic ref, Peeled is the object which annotated tag points.
+type RemoteRef struct {
+	Name   string
+	Sha    string
+	Target string
+	Peeled string
+}
+
+// Capabilities is a list of capabilities of pack protocol. ex) "ofs-delta", "symref=HEAD:refs/heads/master"
+type Capabilities []string
+
+// Has return true if the capability is in the list.
+func (c Capabilities) Has(name string) bool {
+	_, ok := c.Value(name)
+	return ok
+}
+
+// Value return value of "name=value" capability.
+func (c Capabilities) Value(name string) (string, bool) {
+	if values := c.Values(name); len(values) > 0 {
+		return values[0], true
+	}
+	return "", false
+}
+
+// Values return all values of the capability.
+func (c Capabilities) Values(name string) []string {
+	var values []string
+	for _, cap := range c {
+		if cap == name {
+			values = append(values, "")
+		} else if strings.HasPrefix(cap, name+"=") {
+			values = append(values, cap[len(name)+1:])
+		}
+	}
+	return values
+}
+
+// RefAdvertisement is the first response of remote repository.
+// Refs is empty for protocol version 2 until refs are listed by ls-refs command.
+type RefAdvertisement struct {
+	Version      int
+	Refs         []*RemoteRef
+	Capabilities Capabilities
+	Shallow      []string
+}
+
+// Ref return advertised ref of the name, or nil.
+func (a *RefAdvertisement) Ref(name string) *RemoteRef {
+	for _, ref := range a.Refs {
+		if ref.Name == name {
+			return ref
+		}
+	}
+	return nil
+}
+
+// Head return the branch which remote HEAD points, or empty string if unknown.
+func (a *RefAdvertisement) Head() string {
+	head := a.Ref("HEAD")
+	if head == nil {
+		return ""
+	}
+	if head.Target != "" {
+		return head.Target
+	}
+	// old servers do not tell symref. guess a branch pointing the same commit.
+	for _, ref := range a.Refs {
+		if strings.HasPrefix(ref.Name, branchPrefix) && ref.Sha == head.Sha {
+			return ref.Name
+		}
+	}
+	return ""
+}
+
+// supportsFetch return true if the server supports the feature of fetch.
+// features of protocol version 2 are given to "fetch" capability, and "shallow" includes all deepen requests.
+func (a *RefAdvertisement) supportsFetch(feature string) bool {
+	if a.Version != 2 {
+		return a.Capabilities.Has(feature)
+	}
+	value, _ := a.Capabilities.Value("fetch")
+	if strings.HasPrefix(feature, "deepen-") {
+		feature = "shallow"
+	}
+	for _, f := range strings.Fields(value) {
+		if f == feature {
+			return true
+		}
+	}
+	return false
+}
+
+// parseAdvertisement parse ref advertisement of version 0, 1 and 2.
+// "# service=<name>" line which smart HTTP server sends first is skipped.
+func parseAdvertisement(pkt *pktLineReader) (*RefAdvertisement, error) {
+	adv := &RefAdvertisement{}
+	first := true
+	for {
+		line, ok, err := pkt.readLine()
+		if err == io.EOF && first {
+			return nil, errors.New("Remote hung up before ref advertisement")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			if first {
+				// flush after "# service=" line
+				continue
+			}
+			return adv, nil
+		}
+
+		switch {
+		case first && strings.HasPrefix(line, "# service="):
+			continue
+		case first && line == "version 2":
+			adv.Version = 2
+			caps, err := pkt.readLines()
+			if err != nil {
+				return nil, err
+			}
+			adv.Capabilities = caps
+			return adv, nil
+		case first && line == "version 1":
+			adv.Version = 1
+			continue
+		case strings.HasPrefix(line, "shallow "):
+			adv.Shallow = append(adv.Shallow, line[8:])
+			continue
+		}
+
+		if first {
+			if nul := strings.IndexByte(line, 0); nul >= 0 {
+				adv.Capabilities = strings.Fields(line[nul+1:])
+				line = line[:nul]
+			}
+			first = false
+		}
+		fields := strings.SplitN(line, " ", 2)
+		if len(fields) != 2 || !isHexSha(fields[0]) {
+			return nil, fmt.Errorf("Invalid ref advertisement: %q", line)
+		}
+		sha, name := fields[0], fields[1]
+		switch {
+		case name == "capabilities^{}":
+			// empty repository
+		case strings.HasSuffix(name, "^{}"):
+			if ref := adv.Ref(strings.TrimSuffix(name, "^{}")); ref != nil {
+				ref.Peeled = sha
+			}
+		default:
+			adv.Refs = append(adv.Refs, &RemoteRef{Name: name, Sha: sha})
+		}
+	}
+}
+
+// applySymrefs set targets of symbolic refs from "symref=<name>:<target>" capabilities.
+func (a *RefAdvertisement) applySymrefs() {
+	for _, symref := range a.Capabilities.Values("symref") {
+		parts := strings.SplitN(symref, ":", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		if ref := a.Ref(parts[0]); ref != nil {
+			ref.Target = parts[1]
+		}
+	}
+}
+
+// writeLsRefsRequest write ls-refs command of protocol version 2.
+func writeLsRefsRequest(w io.Writer, prefixes []string) error {
+	var b bytes.Buffer
+	writePktLine(&b, "command=ls-refs")
+	writePktLine(&b, "agent=%s", agent)
+	writeDelim(&b)
+	writePktLine(&b, "peel")
+	writePktLine(&b, "symrefs")
+	for _, prefix := range prefixes {
+		writePktLine(&b, "ref-prefix %s", prefix)
+	}
+	writeFlush(&b)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// parseLsRefs parse response of ls-refs. "<sha> <name>[ symref-target:<target>][ peeled:<sha>]"
+func parseLsRefs(pkt *pktLineReader) ([]*RemoteRef, error) {
+	lines, err := pkt.readLines()
+	if err != nil {
+		return nil, err
+	}
+	var refs []*RemoteRef
+	for _, line := range lines {
+		fields := strings.Split(line, " ")
+		if len(fields) < 2 {
+			return nil, fmt.Errorf("Invalid ls-refs response: %q", line)
+		}
+		ref := &RemoteRef{Sha: fields[0], Name: fields[1]}
+		if ref.Sha == "unborn" {
+			ref.Sha = ""
+		}
+		for _, attr := range fields[2:] {
+			switch {
+			case strings.HasPrefix(attr, "symref-target:"):
+				ref.Target = strings.TrimPrefix(attr, "symref-target:")
+			case strings.HasPrefix(attr, "peeled:"):
+				ref.Peeled = strings.TrimPrefix(attr, "peeled:")
+			}
+		}
+		refs = append(refs, ref)
+	}
+	return refs, nil
+}
+
+// FetchRequest is a request of objects to upload-pack.
+// Shallow are shallow commits of the client. Depth, DeepenSince (unix time) and DeepenNot
+// request shallow history. Filter is a filter spec of partial clone.
+type FetchRequest struct {
+	Wants       []string
+	Haves       []string
+	Shallow     []string
+	Depth       int
+	DeepenSince int64
+	DeepenNot   []string
+	Filter      string
+}
+
+// deepen return true if the request changes the shallow boundary.
+func (req *FetchRequest) deepen() bool {
+	return req.Depth > 0 || req.DeepenSince > 0 || len(req.DeepenNot) > 0
+}
+
+// ShallowInfo is changes of shallow commits of the client sent by upload-pack.
+type ShallowInfo struct {
+	Shallow   []string
+	Unshallow []string
+}
+
+// FetchResponse is the packfile and shallow info sent for FetchRequest.
+type FetchResponse struct {
+	io.ReadCloser
+	ShallowInfo
+}
+
+// readShallowLine record "shallow <sha>" or "unshallow <sha>" line. return false for other lines.
+func (info *ShallowInfo) readShallowLine(line string) bool {
+	switch {
+	case strings.HasPrefix(line, "shallow "):
+		info.Shallow = append(info.Shallow, line[8:])
+	case strings.HasPrefix(line, "unshallow "):
+		info.Unshallow = append(info.Unshallow, line[10:])
+	default:
+		return false
+	}
+	return true
+}
+
+// writeShallowRequest write shallow, deepen and filter lines which are common to protocol version 0 and 2.
+func writeShallowRequest(w io.Writer, req *FetchRequest) {
+	for _, sha := range req.Shallow {
+		writePktLine(w, "shallow %s", sha)
+	}
+	if req.Depth > 0 {
+		writePktLine(w, "deepen %d", req.Depth)
+	}
+	if req.DeepenSince > 0 {
+		writePktLine(w, "deepen-since %d", req.DeepenSince)
+	}
+	for _, ref := range req.DeepenNot {
+		writePktLine(w, "deepen-not %s", ref)
+	}
+	if req.Filter != "" {
+		writePktLine(w, "filter %s", req.Filter)
+	}
+}
+
+// clientCapabilities choose capabilities which client uses from server's list.
+func clientCapabilities(server Capabilities, wanted ...string) Capabilities {
+	var caps Capabilities
+	for _, name := range wanted {
+		if server.Has(name) {
+			caps = append(caps, name)
+		}
+	}
+	return append(caps, "agent="+agent)
+}
+
+// writeUploadPackRequest write want and have lines of protocol version 0 followed by "done".
+// negotiation is finished in one round, so that it works on stateless connections.
+func writeUploadPackRequest(w io.Writer, req *FetchRequest, caps Capabilities) error {
+	var b bytes.Buffer
+	for i, want := range req.Wants {
+		if i == 0 {
+			writePktLine(&b, "want %s %s", want, strings.Join(caps, " "))
+		} else {
+			writePktLine(&b, "want %s", want)
+		}
+	}
+	writeShallowRequest(&b, req)
+	writeFlush(&b)
+	for _, have := range req.Haves {
+		writePktLine(&b, "have %s", have)
+	}
+	writePktLine(&b, "done")
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// readUploadPackResponse read shallow info and ACK/NAK lines, and return reader of the packfile.
+// shallow and unshallow lines are recorded to shallow if it is not nil.
+func readUploadPackResponse(pkt *pktLineReader, sideband bool, progress io.Writer, shallow *ShallowInfo) (io.Reader, error) {
+	if shallow == nil {
+		shallow = &ShallowInfo{}
+	}
+	for {
+		line, ok, err := pkt.readLine()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			continue
+		}
+		if line == "NAK" {
+			break
+		}
+		if strings.HasPrefix(line, "ACK ") {
+			// "ACK <sha> common|ready|continue" are sent while negotiation
+			if len(strings.Fields(line)) == 2 {
+				break
+			}
+			continue
+		}
+		if shallow.readShallowLine(line) {
+			continue
+		}
+		return nil, fmt.Errorf("Unexpected response of upload-pack: %q", line)
+	}
+	if sideband {
+		return newSidebandReader(pkt, progress), nil
+	}
+	return pkt.r, nil
+}
+
+// writeFetchRequestV2 write fetch command of protocol version 2.
+func writeFetchRequestV2(w io.Writer, req *FetchRequest, server Capabilities) error {
+	var b bytes.Buffer
+	writePktLine(&b, "command=fetch")
+	writePktLine(&b, "agent=%s", agent)
+	writeDelim(&b)
+	writePktLine(&b, "ofs-delta")
+	for _, want := range req.Wants {
+		writePktLine(&b, "want %s", want)
+	}
+	writeShallowRequest(&b, req)
+	for _, have := range req.Haves {
+		writePktLine(&b, "have %s", have)
+	}
+	writePktLine(&b, "done")
+	writeFlush(&b)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// readFetchResponseV2 read sections before "packfile" section and return reader of the packfile.
+// lines of shallow-info section are recorded to shallow.
+func readFetchResponseV2(pkt *pktLineReader, progress io.Writer, shallow *ShallowInfo) (io.Reader, error) {
+	if shallow == nil {
+		shallow = &ShallowInfo{}
+	}
+	for {
+		kind, data, err := pkt.read()
+		if err != nil {
+			return nil, err
+		}
+		if kind != pktData {
+			continue
+		}
+		line := strings.TrimSuffix(string(data), "\n")
+		if strings.HasPrefix(line, "ERR ") {
+			return nil, fmt.Errorf("remote error: %s", line[4:])
+		}
+		if line == "packfile" {
+			return newSidebandReader(pkt, progress), nil
+		}
+		// acknowledgments and wanted-refs sections are not used
+		shallow.readShallowLine(line)
+	}
+}
+
+// RefUpdateCommand is a command to update a ref of remote repository.
+// Old or New is zero hash when the ref is created or deleted.
+type RefUpdateCommand struct {
+	Name string
+	Old  string
+	New  string
+}
+
+// PushReport is report-status of receive-pack.
+// RefStatus is "ok" or reason of rejection for each ref.
+type PushReport struct {
+	UnpackStatus string
+	RefStatus    map[string]string
+}
+
+// writeReceivePackRequest write update commands. packfile follows if any ref is created or updated.
+func writeReceivePackRequest(w io.Writer, cmds []*RefUpdateCommand, caps Capabilities) error {
+	var b bytes.Buffer
+	for i, c := range cmds {
+		if i == 0 {
+			writePktData(&b, []byte(fmt.Sprintf("%s %s %s\x00%s\n", c.Old, c.New, c.Name, strings.Join(caps, " "))))
+		} else {
+			writePktLine(&b, "%s %s %s", c.Old, c.New, c.Name)
+		}
+	}
+	writeFlush(&b)
+	_, err := w.Write(b.Bytes())
+	return err
+}
+
+// readPushReport parse report-status. "unpack ok", "ok <ref>" and "ng <ref> <reason>"
+func readPushReport(pkt *pktLineReader) (*PushReport, error) {
+	lines, err := pkt.readLines()
+	if err != nil {
+		return nil, err
+	}
+	report := &PushReport{RefStatus: map[string]string{}}
+	for _, line := range lines {
+		switch {
+		case strings.HasPrefix(line, "unpack "):
+			report.UnpackStatus = line[7:]
+		case strings.HasPrefix(line, "ok "):
+			report.RefStatus[line[3:]] = "ok"
+		case strings.HasPrefix(line, "ng "):
+			parts := strings.SplitN(line[3:], " ", 2)
+			reason := "failed"
+			if len(parts) == 2 {
+				reason = parts[1]
+			}
+			report.RefStatus[parts[0]] = reason
+		default:
+			return nil, fmt.Errorf("Invalid report-status: %q", line)
+		}
+	}
+	if report.UnpackStatus == "" {
+		return nil, errors.New("Remote did not send report-status")
+	}
+	return report, nil
+}
+
+// ParseProtocolVersion return protocol version requested by GIT_PROTOCOL. ex) "version=2"
+// parameters are separated by colon. return 0 if no version is requested.
+func ParseProtocolVersion(env string) int {
+	version := 0
+	for _, param := range strings.Split(env, ":") {
+		switch param {
+		case "version=1":
+			version = 1
+		case "version=2":
+			version = 2
+		}
+	}
+	return version
+}
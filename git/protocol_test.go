@@ -0,0 +1,127 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPktLine(t *testing.T) {
+	var b bytes.Buffer
+	writePktLine(&b, "hello %s", "world")
+	writeDelim(&b)
+	writePktData(&b, []byte("raw"))
+	writeFlush(&b)
+	assert.Equal(t, "0010hello world\n00010007raw0000", b.String())
+
+	pkt := newPktLineReader(&b)
+	line, ok, err := pkt.readLine()
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.Equal(t, "hello world", line)
+	kind, _, err := pkt.read()
+	assert.NoError(t, err)
+	assert.Equal(t, pktDelim, kind)
+	lines, err := pkt.readLines()
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"raw"}, lines)
+
+	_, _, err = newPktLineReader(strings.NewReader("000fERR denied\n")).readLine()
+	assert.EqualError(t, err, "remote error: denied")
+	_, _, err = newPktLineReader(strings.NewReader("zzzz")).read()
+	assert.Error(t, err)
+	_, _, err = newPktLineReader(strings.NewReader("0010short")).read()
+	assert.Error(t, err)
+}
+
+func TestParseAdvertisement(t *testing.T) {
+	a := strings.Repeat("a", 40)
+	b := strings.Repeat("b", 40)
+	c := strings.Repeat("c", 40)
+	var buf bytes.Buffer
+	writePktLine(&buf, "# service=git-upload-pack")
+	writeFlush(&buf)
+	writePktData(&buf, []byte(a+" HEAD\x00multi_ack side-band-64k symref=HEAD:refs/heads/main agent=git/2\n"))
+	writePktLine(&buf, "%s refs/heads/main", a)
+	writePktLine(&buf, "%s refs/tags/v1", b)
+	writePktLine(&buf, "%s refs/tags/v1^{}", c)
+	writeFlush(&buf)
+
+	adv, err := parseAdvertisement(newPktLineReader(&buf))
+	assert.NoError(t, err)
+	adv.applySymrefs()
+	assert.Equal(t, 0, adv.Version)
+	assert.Equal(t, 3, len(adv.Refs))
+	assert.True(t, adv.Capabilities.Has("side-band-64k"))
+	assert.False(t, adv.Capabilities.Has("side-band"))
+	agent, _ := adv.Capabilities.Value("agent")
+	assert.Equal(t, "git/2", agent)
+	assert.Equal(t, "refs/heads/main", adv.Head())
+	assert.Equal(t, c, adv.Ref("refs/tags/v1").Peeled)
+
+	// empty repository
+	buf.Reset()
+	writePktData(&buf, []byte(zeroSha+" capabilities^{}\x00report-status delete-refs\n"))
+	writeFlush(&buf)
+	adv, err = parseAdvertisement(newPktLineReader(&buf))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(adv.Refs))
+	assert.True(t, adv.Capabilities.Has("delete-refs"))
+
+	// version 2 sends capabilities only
+	buf.Reset()
+	writePktLine(&buf, "version 2")
+	writePktLine(&buf, "ls-refs=unborn")
+	writePktLine(&buf, "fetch=shallow")
+	writeFlush(&buf)
+	adv, err = parseAdvertisement(newPktLineReader(&buf))
+	assert.NoError(t, err)
+	assert.Equal(t, 2, adv.Version)
+	v, _ := adv.Capabilities.Value("fetch")
+	assert.Equal(t, "shallow", v)
+
+	buf.Reset()
+	writePktLine(&buf, "%s HEAD symref-target:refs/heads/main", a)
+	writePktLine(&buf, "%s refs/tags/v1 peeled:%s", b, c)
+	writePktLine(&buf, "unborn refs/heads/empty")
+	writeFlush(&buf)
+	refs, err := parseLsRefs(newPktLineReader(&buf))
+	assert.NoError(t, err)
+	assert.Equal(t, &RemoteRef{Name: "HEAD", Sha: a, Target: "refs/heads/main"}, refs[0])
+	assert.Equal(t, c, refs[1].Peeled)
+	assert.Equal(t, "", refs[2].Sha)
+}
+
+func TestSidebandReader(t *testing.T) {
+	var buf bytes.Buffer
+	writePktData(&buf, []byte("\x01PACK"))
+	writePktData(&buf, []byte("\x02Counting objects\r"))
+	writePktData(&buf, []byte("\x01data"))
+	writeFlush(&buf)
+	var progress bytes.Buffer
+	data, err := ioutil.ReadAll(newSidebandReader(newPktLineReader(&buf), &progress))
+	assert.NoError(t, err)
+	assert.Equal(t, "PACKdata", string(data))
+	assert.Equal(t, "Counting objects\r", progress.String())
+
+	buf.Reset()
+	writePktData(&buf, []byte("\x03fatal"))
+	_, err = ioutil.ReadAll(newSidebandReader(newPktLineReader(&buf), nil))
+	assert.EqualError(t, err, "remote error: fatal")
+}
+
+func TestReadPushReport(t *testing.T) {
+	var buf bytes.Buffer
+	writePktLine(&buf, "unpack ok")
+	writePktLine(&buf, "ok refs/heads/main")
+	writePktLine(&buf, "ng refs/heads/locked pre-receive hook declined")
+	writeFlush(&buf)
+	report, err := readPushReport(newPktLineReader(&buf))
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", report.UnpackStatus)
+	assert.Equal(t, "ok", report.RefStatus["refs/heads/main"])
+	assert.Equal(t, "pre-receive hook declined", report.RefStatus["refs/heads/locked"])
+}
@@ -0,0 +1,278 @@
+package git
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// status of pushed ref
+const (
+	PushOK             = "ok"
+	PushUpToDate       = "up to date"
+	PushRejected       = "rejected"
+	PushRemoteRejected = "remote rejected"
+)
+
+// PushOptions is options of Push.
+type PushOptions struct {
+	// Force allow non-fast-forward updates of all refs.
+	Force    bool
+	Progress io.Writer
+}
+
+// PushUpdate is an update of remote ref by push.
+// Src is local ref or revision, which is empty when the remote ref is deleted.
+// Forced is true if the update is not fast-forward but allowed by Force.
+// Reason tells why the update is rejected.
+type PushUpdate struct {
+	Src    string
+	Dst    string
+	Old    string
+	New    string
+	Force  bool
+	Forced bool
+	Status string
+	Reason string
+}
+
+// IsDelete return true if the update deletes the remote ref.
+func (u *PushUpdate) IsDelete() bool {
+	return u.New == zeroSha
+}
+
+// IsNew return true if the update creates the remote ref.
+func (u *PushUpdate) IsNew() bool {
+	return u.Old == zeroSha
+}
+
+// Push update refs of remote by refspecs. ("[+]<src>[:<dst>]", ":<dst>" deletes dst)
+// the current branch is pushed to its upstream or the same name if refspecs is empty.
+// remote.<name>.pushurl is used instead of url if it is set.
+// remote-tracking refs are updated for successful updates by fetch refspecs of the remote.
+func Push(repo *GitRepository, remote string, refspecs []string, opts PushOptions) ([]*PushUpdate, error) {
+	name, url, err := ResolveRemote(repo, remote)
+	if err != nil {
+		return nil, err
+	}
+	if name != "" {
+		if r, err := GetRemote(repo, name); err == nil && r.PushURL != "" {
+			url = r.PushURL
+		}
+	}
+	if len(refspecs) == 0 {
+		spec, err := defaultPushRefspec(repo, name)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = []string{spec}
+	}
+	transport, err := newTransport(repo, url, opts.Progress)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.Close()
+	adv, err := transport.PushRefs()
+	if err != nil {
+		return nil, err
+	}
+
+	var updates []*PushUpdate
+	for _, spec := range refspecs {
+		u, err := parsePushRefspec(repo, spec)
+		if err != nil {
+			return nil, err
+		}
+		u.Force = u.Force || opts.Force
+		u.Old = zeroSha
+		if ref := adv.Ref(u.Dst); ref != nil {
+			u.Old = ref.Sha
+		}
+		checkPushUpdate(repo, u)
+		updates = append(updates, u)
+	}
+
+	var cmds []*RefUpdateCommand
+	var wants, haves []string
+	for _, u := range updates {
+		if u.Status != "" {
+			continue
+		}
+		cmds = append(cmds, &RefUpdateCommand{Name: u.Dst, Old: u.Old, New: u.New})
+		if !u.IsDelete() {
+			wants = append(wants, u.New)
+		}
+	}
+	if len(cmds) == 0 {
+		return updates, nil
+	}
+	for _, ref := range adv.Refs {
+		haves = append(haves, ref.Sha)
+	}
+
+	var pack io.Reader
+	if len(wants) > 0 {
+		objects, err := ListObjects(repo, wants, haves)
+		if err != nil {
+			return nil, err
+		}
+		var b bytes.Buffer
+		if err := WritePack(repo, &b, objects); err != nil {
+			return nil, err
+		}
+		pack = &b
+	}
+	report, err := transport.SendPack(adv, cmds, pack)
+	if err != nil {
+		return nil, err
+	}
+	if report.UnpackStatus != "ok" {
+		return nil, fmt.Errorf("remote unpack failed: %s", report.UnpackStatus)
+	}
+
+	for _, u := range updates {
+		if u.Status != "" {
+			continue
+		}
+		status, ok := report.RefStatus[u.Dst]
+		switch {
+		case !ok:
+			u.Status, u.Reason = PushRemoteRejected, "no report"
+		case status != "ok":
+			u.Status, u.Reason = PushRemoteRejected, status
+		default:
+			u.Status = PushOK
+			if err := updateTrackingRef(repo, name, u); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return updates, nil
+}
+
+// defaultPushRefspec return refspec which pushes the current branch to its upstream,
+// or to the branch of the same name.
+func defaultPushRefspec(repo *GitRepository, remote string) (string, error) {
+	current, err := CurrentBranch(repo)
+	if err != nil {
+		return "", err
+	}
+	if current == "" {
+		return "", errors.New("You are not currently on a branch.")
+	}
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return "", err
+	}
+	short := strings.TrimPrefix(current, branchPrefix)
+	if merge, ok := cfg.Get("branch." + short + ".merge"); ok && remote != "" && cfg.GetString("branch."+short+".remote", "") == remote {
+		return current + ":" + merge, nil
+	}
+	return current + ":" + current, nil
+}
+
+// parsePushRefspec parse "[+]<src>[:<dst>]" and resolve src.
+func parsePushRefspec(repo *GitRepository, spec string) (*PushUpdate, error) {
+	u := &PushUpdate{}
+	if strings.HasPrefix(spec, "+") {
+		u.Force = true
+		spec = spec[1:]
+	}
+	src, dst := spec, ""
+	if colon := strings.IndexByte(spec, ':'); colon >= 0 {
+		src, dst = spec[:colon], spec[colon+1:]
+	}
+
+	if src == "" {
+		if dst == "" {
+			return nil, fmt.Errorf("Invalid refspec '%s'", spec)
+		}
+		u.New = zeroSha
+		u.Dst = dst
+		if !strings.HasPrefix(dst, "refs/") {
+			u.Dst = BranchRef(dst)
+		}
+		return u, nil
+	}
+
+	sha, err := ResolveRevision(repo, src)
+	if err != nil {
+		return nil, fmt.Errorf("src refspec %s does not match any", src)
+	}
+	u.Src, u.New = src, sha
+	full, isRef := DwimRef(repo, src)
+	if isRef {
+		u.Src = full
+	}
+	switch {
+	case dst == "" && isRef && (strings.HasPrefix(full, branchPrefix) || strings.HasPrefix(full, "refs/tags/")):
+		u.Dst = full
+	case dst == "":
+		return nil, fmt.Errorf("The destination you provided is not a full refname: %s", src)
+	case strings.HasPrefix(dst, "refs/"):
+		u.Dst = dst
+	case isRef && strings.HasPrefix(full, "refs/tags/"):
+		u.Dst = "refs/tags/" + dst
+	default:
+		u.Dst = BranchRef(dst)
+	}
+	if !IsValidRefName(u.Dst) {
+		return nil, fmt.Errorf("Invalid refspec '%s'", spec)
+	}
+	return u, nil
+}
+
+// checkPushUpdate reject updates which are not fast-forward unless forced.
+func checkPushUpdate(repo *GitRepository, u *PushUpdate) {
+	switch {
+	case u.IsDelete() && u.IsNew():
+		u.Status, u.Reason = PushRejected, "remote ref does not exist"
+		return
+	case u.Old == u.New:
+		u.Status = PushUpToDate
+		return
+	case u.IsDelete() || u.IsNew():
+		return
+	}
+
+	reason := "non-fast-forward"
+	switch {
+	case strings.HasPrefix(u.Dst, "refs/tags/"):
+		reason = "already exists"
+	case !HasObject(repo, u.Old):
+		reason = "fetch first"
+	default:
+		if ok, err := IsAncestor(repo, u.Old, u.New); err == nil && ok {
+			return
+		}
+	}
+	if u.Force {
+		u.Forced = true
+		return
+	}
+	u.Status, u.Reason = PushRejected, reason
+}
+
+// updateTrackingRef update remote-tracking ref which fetch refspecs of remote map the pushed ref to.
+func updateTrackingRef(repo *GitRepository, remote string, u *PushUpdate) error {
+	if remote == "" {
+		return nil
+	}
+	r, err := GetRemote(repo, remote)
+	if err != nil {
+		return err
+	}
+	spec, tracking := MapRef(r.Fetch, u.Dst)
+	if spec == nil || tracking == "" {
+		return nil
+	}
+	if u.IsDelete() {
+		if err := DeleteRef(repo, tracking); err != nil && !errors.Is(err, ErrRefNotFound) {
+			return err
+		}
+		return nil
+	}
+	return UpdateRef(repo, tracking, u.New, "update by push")
+}
@@ -0,0 +1,1000 @@
+package git
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"unicode"
+)
+
+// rebaseDir is the directory which keeps the state of rebase across processes.
+const rebaseDir = "rebase-merge"
+
+// ErrNoRebase is returned when --continue, --skip or --abort is run without rebase in progress.
+var ErrNoRebase = errors.New("No rebase in progress?")
+
+// RebaseOptions is options of rebase. commits from Upstream to the current branch are replayed onto Onto,
+// which is Upstream if it is empty. Branch is checked out before rebasing if it is given.
+// the todo list is edited by the user if Interactive is true, and fixup!/squash! commits are
+// moved after the commits they fix if Autosquash is true.
+type RebaseOptions struct {
+	Upstream    string
+	Onto        string
+	Branch      string
+	Interactive bool
+	Autosquash  bool
+}
+
+// RebaseStep is a command of the todo list. Arg is the subject of Commit, or the command line of exec.
+type RebaseStep struct {
+	Command string
+	Commit  string
+	Arg     string
+}
+
+// rebaseCommands map names and abbreviations of todo commands to their names.
+var rebaseCommands = map[string]string{
+	"p": "pick", "pick": "pick",
+	"r": "reword", "reword": "reword",
+	"e": "edit", "edit": "edit",
+	"s": "squash", "squash": "squash",
+	"f": "fixup", "fixup": "fixup",
+	"x": "exec", "exec": "exec",
+	"d": "drop", "drop": "drop",
+}
+
+const rebaseTodoHelp = `
+# Commands:
+# p, pick <commit> = use commit
+# r, reword <commit> = use commit, but edit the commit message
+# e, edit <commit> = use commit, but stop for amending
+# s, squash <commit> = use commit, but meld into previous commit
+# f, fixup <commit> = like "squash" but keep only the previous
+#                    commit's log message
+# x, exec <command> = run command (the rest of the line) using shell
+# d, drop <commit> = remove commit
+#
+# These lines can be re-ordered; they are executed from top to bottom.
+#
+# If you remove a line here THAT COMMIT WILL BE LOST.
+#
+# However, if you remove everything, the rebase will be aborted.
+#
+`
+
+func (s *RebaseStep) format(abbrev bool) string {
+	if s.Command == "exec" {
+		return "exec " + s.Arg
+	}
+	sha := s.Commit
+	if abbrev {
+		sha = shortSha(sha)
+	}
+	return fmt.Sprintf("%s %s %s", s.Command, sha, s.Arg)
+}
+
+func (s *RebaseStep) String() string {
+	return s.format(false)
+}
+
+// isSquash return true if the step melds the commit into the previous one.
+func (s *RebaseStep) isSquash() bool {
+	return s != nil && (s.Command == "squash" || s.Command == "fixup")
+}
+
+// ParseRebaseTodo parse a todo list. empty lines and comments are ignored.
+func ParseRebaseTodo(repo *GitRepository, todo string) ([]*RebaseStep, error) {
+	var steps []*RebaseStep
+	for i, line := range strings.Split(todo, "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		fields := strings.SplitN(line, " ", 2)
+		command, ok := rebaseCommands[fields[0]]
+		if !ok || len(fields) < 2 {
+			return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+		}
+		rest := strings.TrimSpace(fields[1])
+		if command == "exec" {
+			steps = append(steps, &RebaseStep{Command: command, Arg: rest})
+			continue
+		}
+		fields = strings.SplitN(rest, " ", 2)
+		sha, err := ResolveCommit(repo, fields[0])
+		if err != nil {
+			return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+		}
+		step := &RebaseStep{Command: command, Commit: sha}
+		if len(fields) == 2 {
+			step.Arg = strings.TrimSpace(fields[1])
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func formatRebaseTodo(steps []*RebaseStep, abbrev bool) string {
+	var b strings.Builder
+	for _, s := range steps {
+		b.WriteString(s.format(abbrev) + "\n")
+	}
+	return b.String()
+}
+
+func rebasePath(repo *GitRepository, name string) string {
+	return repo.RepoPath(filepath.Join(rebaseDir, name))
+}
+
+// readRebaseFile return the trimmed content of a state file. a missing file is empty.
+func readRebaseFile(repo *GitRepository, name string) string {
+	data, err := ioutil.ReadFile(rebasePath(repo, name))
+	if err != nil {
+		return ""
+	}
+	return strings.TrimSpace(string(data))
+}
+
+func writeRebaseFile(repo *GitRepository, name, content string) error {
+	return ioutil.WriteFile(rebasePath(repo, name), []byte(content), 0644)
+}
+
+func removeRebaseFiles(repo *GitRepository, names ...string) error {
+	for _, name := range names {
+		if err := os.Remove(rebasePath(repo, name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// InRebase return true if a rebase is in progress.
+func InRebase(repo *GitRepository) bool {
+	info, err := os.Stat(repo.RepoPath(rebaseDir))
+	return err == nil && info.IsDir()
+}
+
+// readRebaseTodo return the remaining steps.
+func readRebaseTodo(repo *GitRepository) ([]*RebaseStep, error) {
+	data, err := ioutil.ReadFile(rebasePath(repo, "git-rebase-todo"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	return ParseRebaseTodo(repo, string(data))
+}
+
+// lastRebaseStep return the step which was run last.
+func lastRebaseStep(repo *GitRepository) (*RebaseStep, error) {
+	data, err := ioutil.ReadFile(rebasePath(repo, "done"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	steps, err := ParseRebaseTodo(repo, string(data))
+	if err != nil || len(steps) == 0 {
+		return nil, err
+	}
+	return steps[len(steps)-1], nil
+}
+
+// StartRebase replay commits of the current branch, and update the branch to the result.
+// progress and merge messages are written to out. if the rebase stops for conflicts or an edit command,
+// the state is kept in .git/rebase-merge, and it is resumed by ContinueRebase or SkipRebase.
+// an error is returned for conflicts.
+func StartRebase(repo *GitRepository, out io.Writer, opts RebaseOptions) error {
+	if repo.Bare {
+		return fmt.Errorf("Cannot rebase in bare repository")
+	}
+	if InRebase(repo) {
+		return fmt.Errorf("It seems that there is already a %s directory, and\n"+
+			"I wonder if you are in the middle of another rebase.\n"+
+			"Try 'mygit rebase (--continue | --abort | --skip)'.", rebaseDir)
+	}
+	if err := checkCleanWorktree(repo, "rebase"); err != nil {
+		return err
+	}
+	upstream, err := ResolveCommit(repo, opts.Upstream)
+	if err != nil {
+		return fmt.Errorf("invalid upstream '%s'", opts.Upstream)
+	}
+	onto, ontoName := upstream, opts.Upstream
+	if opts.Onto != "" {
+		if onto, err = ResolveCommit(repo, opts.Onto); err != nil {
+			return fmt.Errorf("Does not point to a valid commit '%s'", opts.Onto)
+		}
+		ontoName = opts.Onto
+	}
+	if opts.Branch != "" {
+		if err := switchBranch(repo, opts.Branch); err != nil {
+			return err
+		}
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	headName, _ := CurrentBranch(repo)
+
+	if !opts.Interactive {
+		upToDate, err := isRebasedOnto(repo, upstream, onto, head)
+		if err != nil {
+			return err
+		}
+		if upToDate {
+			name := "HEAD"
+			if headName != "" {
+				name = ShortRefName(headName)
+			}
+			fmt.Fprintf(out, "Current branch %s is up to date.\n", name)
+			return nil
+		}
+	}
+
+	commits, err := rebaseCommits(repo, upstream, head)
+	if err != nil {
+		return err
+	}
+	var steps []*RebaseStep
+	for _, sha := range commits {
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return err
+		}
+		steps = append(steps, &RebaseStep{Command: "pick", Commit: sha, Arg: commit.Subject()})
+	}
+	if opts.Autosquash {
+		steps = autosquashSteps(steps)
+	}
+
+	if err := os.MkdirAll(repo.RepoPath(rebaseDir), repoDirPerm()); err != nil {
+		return err
+	}
+	if headName == "" {
+		headName = "detached HEAD"
+	}
+	state := map[string]string{"head-name": headName, "onto": onto, "orig-head": head}
+	if opts.Interactive {
+		state["interactive"] = ""
+	}
+	for name, content := range state {
+		if err := writeRebaseFile(repo, name, content+"\n"); err != nil {
+			return err
+		}
+	}
+	if err := writeRefFile(repo, "ORIG_HEAD", []byte(head+"\n")); err != nil {
+		return err
+	}
+	if opts.Interactive {
+		if steps, err = editRebaseTodo(repo, steps, upstream, head, onto); err != nil {
+			os.RemoveAll(repo.RepoPath(rebaseDir))
+			return err
+		}
+	}
+	if err := writeRebaseFile(repo, "git-rebase-todo", formatRebaseTodo(steps, false)); err != nil {
+		return err
+	}
+	if err := checkoutCommit(repo, onto); err != nil {
+		return err
+	}
+	if err := detachHead(repo, onto, "rebase (start): checkout "+ontoName); err != nil {
+		return err
+	}
+	return runRebase(repo, out)
+}
+
+// editRebaseTodo let the user edit the todo list with the sequence editor.
+// an empty list aborts the rebase.
+func editRebaseTodo(repo *GitRepository, steps []*RebaseStep, upstream, head, onto string) ([]*RebaseStep, error) {
+	file := rebasePath(repo, "git-rebase-todo")
+	plural := "s"
+	if len(steps) == 1 {
+		plural = ""
+	}
+	todo := formatRebaseTodo(steps, true) + fmt.Sprintf("\n# Rebase %s..%s onto %s (%d command%s)\n#",
+		shortSha(upstream), shortSha(head), shortSha(onto), len(steps), plural) + rebaseTodoHelp
+	if err := ioutil.WriteFile(file, []byte(todo), 0644); err != nil {
+		return nil, err
+	}
+	editor, err := SequenceEditor(repo)
+	if err != nil {
+		return nil, err
+	}
+	if err := LaunchEditor(repo, editor, file); err != nil {
+		return nil, err
+	}
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	steps, err = ParseRebaseTodo(repo, string(data))
+	if err != nil {
+		return nil, err
+	}
+	if len(steps) == 0 {
+		return nil, fmt.Errorf("Nothing to do")
+	}
+	for _, s := range steps {
+		if s.Command == "drop" || s.Command == "exec" {
+			continue
+		}
+		if s.isSquash() {
+			return nil, fmt.Errorf("cannot '%s' without a previous commit", s.Command)
+		}
+		break
+	}
+	return steps, nil
+}
+
+// checkCleanWorktree return an error if the index or worktree has changes from HEAD.
+func checkCleanWorktree(repo *GitRepository, action string) error {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	if len(index.Conflicts()) == 0 {
+		changes, err := WorktreeChanges(repo, index)
+		if err != nil {
+			return err
+		}
+		if len(changes) == 0 {
+			tree, err := WriteIndexTree(repo, index)
+			if err != nil {
+				return err
+			}
+			head, _ := ResolveRef(repo, "HEAD")
+			headTree, err := CommitTree(repo, head)
+			if err != nil {
+				return err
+			}
+			if tree == headTree {
+				return nil
+			}
+			return fmt.Errorf("cannot %s: Your index contains uncommitted changes.\nPlease commit or stash them.", action)
+		}
+	}
+	return fmt.Errorf("cannot %s: You have unstaged changes.\nPlease commit or stash them.", action)
+}
+
+// isRebasedOnto return true if head is already based on onto, and upstream forks there.
+func isRebasedOnto(repo *GitRepository, upstream, onto, head string) (bool, error) {
+	for _, other := range []string{onto, upstream} {
+		bases, err := MergeBases(repo, other, head)
+		if err != nil {
+			return false, err
+		}
+		if len(bases) != 1 || bases[0] != onto {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// reachableCommits return commits reachable from sha.
+func reachableCommits(repo *GitRepository, sha string) (map[string]bool, error) {
+	graph := loadCommitGraph(repo)
+	seen := map[string]bool{sha: true}
+	queue := []string{sha}
+	for len(queue) > 0 {
+		node, err := readCommitNode(repo, graph, queue[0])
+		if err != nil {
+			return nil, err
+		}
+		queue = queue[1:]
+		for _, parent := range node.parents {
+			if !seen[parent] {
+				seen[parent] = true
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return seen, nil
+}
+
+// commitsBetween return commits reachable from head but not from base, parents before children.
+func commitsBetween(repo *GitRepository, base, head string) ([]string, error) {
+	excluded, err := reachableCommits(repo, base)
+	if err != nil {
+		return nil, err
+	}
+	graph := loadCommitGraph(repo)
+	var commits []string
+	visited := map[string]bool{}
+	type frame struct {
+		sha     string
+		parents []string
+	}
+	var stack []*frame
+	push := func(sha string) error {
+		visited[sha] = true
+		node, err := readCommitNode(repo, graph, sha)
+		if err != nil {
+			return err
+		}
+		stack = append(stack, &frame{sha: sha, parents: node.parents})
+		return nil
+	}
+	if excluded[head] {
+		return nil, nil
+	}
+	if err := push(head); err != nil {
+		return nil, err
+	}
+	for len(stack) > 0 {
+		top := stack[len(stack)-1]
+		if len(top.parents) == 0 {
+			commits = append(commits, top.sha)
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		parent := top.parents[0]
+		top.parents = top.parents[1:]
+		if !visited[parent] && !excluded[parent] {
+			if err := push(parent); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return commits, nil
+}
+
+// rebaseCommits return non-merge commits from upstream to head which should be replayed, oldest first.
+// commits whose changes are already in upstream are omitted.
+func rebaseCommits(repo *GitRepository, upstream, head string) ([]string, error) {
+	commits, err := commitsBetween(repo, upstream, head)
+	if err != nil || len(commits) == 0 {
+		return nil, err
+	}
+	upstreamCommits, err := commitsBetween(repo, head, upstream)
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]bool{}
+	for _, sha := range upstreamCommits {
+		id, err := patchID(repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		if id != "" {
+			applied[id] = true
+		}
+	}
+	var picks []string
+	for _, sha := range commits {
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		if len(commit.Parents) > 1 {
+			continue
+		}
+		if len(applied) > 0 {
+			id, err := patchID(repo, sha)
+			if err != nil {
+				return nil, err
+			}
+			if applied[id] {
+				continue
+			}
+		}
+		picks = append(picks, sha)
+	}
+	return picks, nil
+}
+
+// patchID return a hash of the changes of the commit, which ignores whitespaces and blob hashes.
+// merge commits have no patch id.
+func patchID(repo *GitRepository, sha string) (string, error) {
+	commit, err := ReadCommit(repo, sha)
+	if err != nil || len(commit.Parents) > 1 {
+		return "", err
+	}
+	parentTree := ""
+	if len(commit.Parents) == 1 {
+		if parentTree, err = CommitTree(repo, commit.Parents[0]); err != nil {
+			return "", err
+		}
+	}
+	changes, err := DiffTrees(repo, parentTree, commit.Tree)
+	if err != nil {
+		return "", err
+	}
+	var patch bytes.Buffer
+	if err := WritePatch(repo, &patch, changes); err != nil {
+		return "", err
+	}
+	h := sha1.New()
+	for _, line := range strings.SplitAfter(patch.String(), "\n") {
+		if strings.HasPrefix(line, "index ") {
+			continue
+		}
+		h.Write([]byte(strings.Map(func(r rune) rune {
+			if unicode.IsSpace(r) {
+				return -1
+			}
+			return r
+		}, line)))
+	}
+	return fmt.Sprintf("%x", h.Sum(nil)), nil
+}
+
+// autosquashSteps move commits whose subjects start with "fixup! " or "squash! " after the commits they fix,
+// and change their commands. targets are found by the subject, the hash, or the prefix of the subject.
+func autosquashSteps(steps []*RebaseStep) []*RebaseStep {
+	root := make([]int, len(steps))
+	followers := map[int][]int{}
+	for i, s := range steps {
+		root[i] = i
+		if s.Command != "pick" {
+			continue
+		}
+		command, target := "", ""
+		for _, c := range []string{"fixup", "squash"} {
+			if strings.HasPrefix(s.Arg, c+"! ") {
+				command, target = c, strings.TrimSpace(s.Arg[len(c)+2:])
+			}
+		}
+		if command == "" {
+			continue
+		}
+		if j := findAutosquashTarget(steps[:i], target); j >= 0 {
+			s.Command = command
+			root[i] = root[j]
+			followers[root[j]] = append(followers[root[j]], i)
+		}
+	}
+	var result []*RebaseStep
+	for i, s := range steps {
+		if root[i] != i {
+			continue
+		}
+		result = append(result, s)
+		for _, f := range followers[i] {
+			result = append(result, steps[f])
+		}
+	}
+	return result
+}
+
+func findAutosquashTarget(steps []*RebaseStep, target string) int {
+	matches := []func(s *RebaseStep) bool{
+		func(s *RebaseStep) bool { return s.Arg == target },
+		func(s *RebaseStep) bool {
+			return len(target) >= 4 && isHex(target) && strings.HasPrefix(s.Commit, target)
+		},
+		func(s *RebaseStep) bool { return strings.HasPrefix(s.Arg, target) },
+	}
+	for _, match := range matches {
+		for j, s := range steps {
+			if s.Command != "exec" && match(s) {
+				return j
+			}
+		}
+	}
+	return -1
+}
+
+// runRebase run steps in the todo list until it is empty or a step stops.
+func runRebase(repo *GitRepository, out io.Writer) error {
+	for {
+		steps, err := readRebaseTodo(repo)
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			return finishRebase(repo, out)
+		}
+		// the step is moved to done first, so that resuming starts from the next step
+		done, err := os.OpenFile(rebasePath(repo, "done"), os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		_, err = done.WriteString(steps[0].String() + "\n")
+		done.Close()
+		if err != nil {
+			return err
+		}
+		if err := writeRebaseFile(repo, "git-rebase-todo", formatRebaseTodo(steps[1:], false)); err != nil {
+			return err
+		}
+		var next *RebaseStep
+		if len(steps) > 1 {
+			next = steps[1]
+		}
+		stopped, err := runRebaseStep(repo, out, steps[0], next)
+		if err != nil || stopped {
+			return err
+		}
+	}
+}
+
+// runRebaseStep run a step, and return true if the rebase stops there for an edit command.
+func runRebaseStep(repo *GitRepository, out io.Writer, step, next *RebaseStep) (bool, error) {
+	switch step.Command {
+	case "drop":
+		return false, nil
+	case "exec":
+		fmt.Fprintf(out, "Executing: %s\n", step.Arg)
+		cmd := exec.Command("sh", "-c", step.Arg)
+		cmd.Dir = repo.Worktree
+		cmd.Stdin = os.Stdin
+		cmd.Stdout = os.Stdout
+		cmd.Stderr = os.Stderr
+		if err := cmd.Run(); err != nil {
+			return false, fmt.Errorf("execution failed: %s\nYou can fix the problem, and then run\n\n  mygit rebase --continue", step.Arg)
+		}
+		return false, nil
+	}
+
+	commit, err := ReadCommit(repo, step.Commit)
+	if err != nil {
+		return false, err
+	}
+	if len(commit.Parents) > 1 {
+		return false, fmt.Errorf("commit %s is a merge but merges can not be replayed", step.Commit)
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return false, err
+	}
+	if (step.Command == "pick" || step.Command == "edit") && len(commit.Parents) == 1 && commit.Parents[0] == head {
+		// the commit is already on HEAD, so it is reused as it is
+		if err := checkoutCommit(repo, step.Commit); err != nil {
+			return false, err
+		}
+		if err := UpdateRef(repo, "HEAD", step.Commit, fmt.Sprintf("rebase (%s): %s", step.Command, commit.Subject())); err != nil {
+			return false, err
+		}
+		if err := removeRebaseFiles(repo, "message-squash", "current-fixups"); err != nil {
+			return false, err
+		}
+	} else {
+		if err := writeRebaseFile(repo, "stopped-sha", step.Commit+"\n"); err != nil {
+			return false, err
+		}
+		result, err := pickCommit(repo, head, step.Commit, commit)
+		if err != nil {
+			return false, err
+		}
+		for _, m := range result.Messages {
+			fmt.Fprintln(out, m)
+		}
+		if !result.Clean() {
+			return false, fmt.Errorf("could not apply %s... %s\n"+
+				"Resolve all conflicts manually, mark them as resolved with\n"+
+				"\"mygit add <conflicted_files>\", then run \"mygit rebase --continue\".\n"+
+				"You can instead skip this commit: run \"mygit rebase --skip\".\n"+
+				"To abort and get back to the state before \"mygit rebase\", run \"mygit rebase --abort\".",
+				shortSha(step.Commit), commit.Subject())
+		}
+		tree, err := WriteIndexTree(repo, result.Index)
+		if err != nil {
+			return false, err
+		}
+		if err := commitRebaseStep(repo, step, commit, tree, next); err != nil {
+			return false, err
+		}
+		if err := removeRebaseFiles(repo, "stopped-sha"); err != nil {
+			return false, err
+		}
+	}
+	if step.Command != "edit" {
+		return false, nil
+	}
+
+	head, err = ResolveRef(repo, "HEAD")
+	if err != nil {
+		return false, err
+	}
+	if err := writeRebaseFile(repo, "amend", head+"\n"); err != nil {
+		return false, err
+	}
+	fmt.Fprintf(out, "Stopped at %s...  %s\n"+
+		"You can amend the commit now, with\n\n  git commit --amend \n\n"+
+		"Once you are satisfied with your changes, run\n\n  mygit rebase --continue\n", shortSha(step.Commit), commit.Subject())
+	return true, nil
+}
+
+// pickCommit merge changes of the commit into head, and update the index and worktree with the result.
+func pickCommit(repo *GitRepository, head, sha string, commit *GitCommit) (*MergeResult, error) {
+	parentTree := ""
+	if len(commit.Parents) > 0 {
+		var err error
+		if parentTree, err = CommitTree(repo, commit.Parents[0]); err != nil {
+			return nil, err
+		}
+	}
+	headTree, err := CommitTree(repo, head)
+	if err != nil {
+		return nil, err
+	}
+	label := fmt.Sprintf("%s (%s)", shortSha(sha), commit.Subject())
+	return applyMerge(repo, parentTree, headTree, commit.Tree, MergeOptions{
+		OursLabel:   "HEAD",
+		BaseLabel:   "parent of " + label,
+		TheirsLabel: label,
+	})
+}
+
+// commitRebaseStep commit tree on HEAD as the result of the step. squash and fixup amend HEAD.
+// picked commits which become empty are dropped.
+func commitRebaseStep(repo *GitRepository, step *RebaseStep, commit *GitCommit, tree string, next *RebaseStep) error {
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	headCommit, err := ReadCommit(repo, head)
+	if err != nil {
+		return err
+	}
+	parents, author, message := []string{head}, commit.Author, commit.Message
+	if step.isSquash() {
+		parents, author = headCommit.Parents, headCommit.Author
+		if message, err = squashMessage(repo, step, commit, headCommit, next); err != nil {
+			return err
+		}
+	} else {
+		if err := removeRebaseFiles(repo, "message-squash", "current-fixups"); err != nil {
+			return err
+		}
+		parentTree := ""
+		if len(commit.Parents) > 0 {
+			if parentTree, err = CommitTree(repo, commit.Parents[0]); err != nil {
+				return err
+			}
+		}
+		if tree == headCommit.Tree && parentTree != commit.Tree {
+			return nil
+		}
+		if step.Command == "reword" {
+			if message, err = EditCommitMessage(repo, message); err != nil {
+				return err
+			}
+		}
+	}
+	sha, err := NewCommitAs(repo, tree, parents, author, message)
+	if err != nil {
+		return err
+	}
+	subject := strings.SplitN(strings.TrimLeft(message, "\n"), "\n", 2)[0]
+	return UpdateRef(repo, "HEAD", sha, fmt.Sprintf("rebase (%s): %s", step.Command, subject))
+}
+
+// squashMessage add the message of the commit to the message of the squash chain, and return the message
+// of the melded commit. the user edits the message at the end of a chain which has a squash command.
+func squashMessage(repo *GitRepository, step *RebaseStep, commit, headCommit *GitCommit, next *RebaseStep) (string, error) {
+	message := readRebaseFile(repo, "message-squash")
+	fixups := readRebaseFile(repo, "current-fixups")
+	if message == "" {
+		message = "# This is a combination of 2 commits.\n# This is the 1st commit message:\n\n" + headCommit.Message
+		fixups = ""
+	}
+	if fixups != "" {
+		fixups += "\n"
+	}
+	fixups += step.Command + " " + step.Commit
+	n := strings.Count(fixups, "\n") + 2
+	lines := strings.SplitN(message, "\n", 2)
+	message = fmt.Sprintf("# This is a combination of %d commits.\n%s", n, lines[1])
+	message = strings.TrimRight(message, "\n") + "\n"
+	if step.Command == "squash" {
+		message += fmt.Sprintf("\n# This is the commit message #%d:\n\n%s", n, commit.Message)
+	} else {
+		message += fmt.Sprintf("\n# The commit message #%d will be skipped:\n\n", n)
+		for _, line := range strings.Split(strings.TrimRight(commit.Message, "\n"), "\n") {
+			message += strings.TrimRight("# "+line, " ") + "\n"
+		}
+	}
+
+	if next.isSquash() {
+		if err := writeRebaseFile(repo, "message-squash", message); err != nil {
+			return "", err
+		}
+		if err := writeRebaseFile(repo, "current-fixups", fixups+"\n"); err != nil {
+			return "", err
+		}
+		return CleanupMessage(message, true), nil
+	}
+	if err := removeRebaseFiles(repo, "message-squash", "current-fixups"); err != nil {
+		return "", err
+	}
+	for _, line := range strings.Split(fixups, "\n") {
+		if strings.HasPrefix(line, "squash ") {
+			return EditCommitMessage(repo, message)
+		}
+	}
+	return CleanupMessage(message, true), nil
+}
+
+// ContinueRebase commit the resolved conflicts or amend changes of the stopped commit, and resume the rebase.
+func ContinueRebase(repo *GitRepository, out io.Writer) error {
+	if !InRebase(repo) {
+		return ErrNoRebase
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	if len(index.Conflicts()) > 0 {
+		return fmt.Errorf("You must edit all merge conflicts and then\nmark them as resolved using mygit add")
+	}
+	changes, err := WorktreeChanges(repo, index)
+	if err != nil {
+		return err
+	}
+	if len(changes) > 0 {
+		return fmt.Errorf("cannot continue: You have unstaged changes.\nPlease commit or stash them.")
+	}
+	tree, err := WriteIndexTree(repo, index)
+	if err != nil {
+		return err
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+
+	if amend := readRebaseFile(repo, "amend"); amend != "" {
+		// staged changes at an edit stop are amended to the commit, unless the user already committed
+		headCommit, err := ReadCommit(repo, head)
+		if err != nil {
+			return err
+		}
+		if amend == head && tree != headCommit.Tree {
+			sha, err := NewCommitAs(repo, tree, headCommit.Parents, headCommit.Author, headCommit.Message)
+			if err != nil {
+				return err
+			}
+			if err := UpdateRef(repo, "HEAD", sha, "commit (amend): "+headCommit.Subject()); err != nil {
+				return err
+			}
+		}
+	} else if stopped := readRebaseFile(repo, "stopped-sha"); stopped != "" {
+		step, err := lastRebaseStep(repo)
+		if err != nil {
+			return err
+		}
+		commit, err := ReadCommit(repo, stopped)
+		if err != nil {
+			return err
+		}
+		steps, err := readRebaseTodo(repo)
+		if err != nil {
+			return err
+		}
+		var next *RebaseStep
+		if len(steps) > 0 {
+			next = steps[0]
+		}
+		if err := commitRebaseStep(repo, step, commit, tree, next); err != nil {
+			return err
+		}
+	}
+	if err := removeRebaseFiles(repo, "amend", "stopped-sha"); err != nil {
+		return err
+	}
+	return runRebase(repo, out)
+}
+
+// SkipRebase discard the changes of the stopped commit, and resume the rebase.
+func SkipRebase(repo *GitRepository, out io.Writer) error {
+	if !InRebase(repo) {
+		return ErrNoRebase
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	if err := resetHard(repo, head); err != nil {
+		return err
+	}
+	steps, err := readRebaseTodo(repo)
+	if err != nil {
+		return err
+	}
+	if len(steps) == 0 || !steps[0].isSquash() {
+		if err := removeRebaseFiles(repo, "message-squash", "current-fixups"); err != nil {
+			return err
+		}
+	}
+	if err := removeRebaseFiles(repo, "amend", "stopped-sha"); err != nil {
+		return err
+	}
+	return runRebase(repo, out)
+}
+
+// AbortRebase restore the branch and worktree to the state before the rebase.
+func AbortRebase(repo *GitRepository) error {
+	if !InRebase(repo) {
+		return ErrNoRebase
+	}
+	origHead := readRebaseFile(repo, "orig-head")
+	headName := readRebaseFile(repo, "head-name")
+	if err := resetHard(repo, origHead); err != nil {
+		return err
+	}
+	if strings.HasPrefix(headName, "refs/") {
+		if err := SetSymbolicRef(repo, "HEAD", headName, "rebase (abort): returning to "+headName); err != nil {
+			return err
+		}
+	} else if err := UpdateRef(repo, "HEAD", origHead, "rebase (abort): returning to "+origHead); err != nil {
+		return err
+	}
+	return os.RemoveAll(repo.RepoPath(rebaseDir))
+}
+
+// finishRebase update the rebased branch to HEAD, check it out, and remove the state.
+func finishRebase(repo *GitRepository, out io.Writer) error {
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	headName := readRebaseFile(repo, "head-name")
+	onto := readRebaseFile(repo, "onto")
+	if strings.HasPrefix(headName, "refs/") {
+		if err := UpdateRef(repo, headName, head, fmt.Sprintf("rebase (finish): %s onto %s", headName, onto)); err != nil {
+			return err
+		}
+		if err := SetSymbolicRef(repo, "HEAD", headName, "rebase (finish): returning to "+headName); err != nil {
+			return err
+		}
+	}
+	if err := os.RemoveAll(repo.RepoPath(rebaseDir)); err != nil {
+		return err
+	}
+	fmt.Fprintf(out, "Successfully rebased and updated %s.\n", headName)
+	return nil
+}
+
+// detachHead point HEAD to the commit directly.
+func detachHead(repo *GitRepository, sha, msg string) error {
+	old, _ := ResolveRef(repo, "HEAD")
+	if err := writeRefFile(repo, "HEAD", []byte(sha+"\n")); err != nil {
+		return err
+	}
+	return logRefUpdate(repo, "HEAD", old, sha, msg)
+}
+
+// switchBranch check out the branch and point HEAD to it.
+func switchBranch(repo *GitRepository, name string) error {
+	ref := BranchRef(name)
+	sha, err := ResolveRef(repo, ref)
+	if err != nil {
+		return fmt.Errorf("invalid reference: %s", name)
+	}
+	if err := checkoutCommit(repo, sha); err != nil {
+		return err
+	}
+	from := "HEAD"
+	if current, err := CurrentBranch(repo); err == nil && current != "" {
+		from = ShortRefName(current)
+	} else if head, err := ResolveRef(repo, "HEAD"); err == nil {
+		from = head
+	}
+	return SetSymbolicRef(repo, "HEAD", ref, fmt.Sprintf("checkout: moving from %s to %s", from, name))
+}
+
+// checkoutCommit update the index and worktree to the tree of the commit, keeping local changes.
+func checkoutCommit(repo *GitRepository, sha string) error {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	tree, err := CommitTree(repo, sha)
+	if err != nil {
+		return err
+	}
+	target, err := IndexFromTree(repo, tree)
+	if err != nil {
+		return err
+	}
+	if err := CheckWorktreeOverwrite(repo, index, target, "checkout"); err != nil {
+		return err
+	}
+	return CheckoutIndex(repo, index, target, CheckoutOptions{})
+}
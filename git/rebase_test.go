@@ -0,0 +1,157 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// commitTestFiles commit files on HEAD, and check them out.
+func commitTestFiles(t *testing.T, repo *GitRepository, message string, files map[string]string) string {
+	var entries []*GitTreeEntry
+	for name, content := range files {
+		sha, err := WriteObject(repo, NewGitBlob([]byte(content)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, &GitTreeEntry{Mode: ModeBlob, Path: name, Sha: sha})
+	}
+	tree, err := writeTreeFiles(repo, entries)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var parents []string
+	if head, err := ResolveRef(repo, "HEAD"); err == nil {
+		parents = append(parents, head)
+	}
+	sha, err := NewCommit(repo, tree, parents, message+"\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := checkoutCommit(repo, sha); err != nil {
+		t.Fatal(err)
+	}
+	if err := UpdateRef(repo, "HEAD", sha, "commit: "+message); err != nil {
+		t.Fatal(err)
+	}
+	return sha
+}
+
+func setTestIdent(t *testing.T) func() {
+	for _, name := range []string{"AUTHOR", "COMMITTER"} {
+		os.Setenv("GIT_"+name+"_NAME", "mygit")
+		os.Setenv("GIT_"+name+"_EMAIL", "mygit@example.com")
+	}
+	return func() {
+		for _, name := range []string{"AUTHOR", "COMMITTER"} {
+			os.Unsetenv("GIT_" + name + "_NAME")
+			os.Unsetenv("GIT_" + name + "_EMAIL")
+		}
+	}
+}
+
+func TestParseRebaseTodo(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	sha := writeTestCommit(t, repo, "first")
+
+	steps, err := ParseRebaseTodo(repo, "# comment\npick "+sha[:7]+" first\n\nf "+sha+"\nx make test\nd "+sha+" first\n")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, len(steps))
+	assert.Equal(t, &RebaseStep{Command: "pick", Commit: sha, Arg: "first"}, steps[0])
+	assert.Equal(t, &RebaseStep{Command: "fixup", Commit: sha}, steps[1])
+	assert.Equal(t, &RebaseStep{Command: "exec", Arg: "make test"}, steps[2])
+	assert.Equal(t, "drop "+sha+" first", steps[3].String())
+
+	_, err = ParseRebaseTodo(repo, "merge "+sha)
+	assert.EqualError(t, err, "invalid line 1: merge "+sha)
+	_, err = ParseRebaseTodo(repo, "pick 0000000")
+	assert.Error(t, err)
+}
+
+func TestAutosquashSteps(t *testing.T) {
+	steps := []*RebaseStep{
+		{Command: "pick", Commit: "1111", Arg: "add feature"},
+		{Command: "pick", Commit: "2222", Arg: "fix typo"},
+		{Command: "pick", Commit: "3333", Arg: "squash! add feature"},
+		{Command: "pick", Commit: "4444", Arg: "fixup! fix"},
+		{Command: "pick", Commit: "5555", Arg: "fixup! squash! add feature"},
+		{Command: "pick", Commit: "6666", Arg: "fixup! unknown"},
+	}
+	var got []string
+	for _, s := range autosquashSteps(steps) {
+		got = append(got, s.Command+" "+s.Commit)
+	}
+	assert.Equal(t, []string{"pick 1111", "squash 3333", "fixup 5555", "pick 2222", "fixup 4444", "pick 6666"}, got)
+}
+
+func TestRebase(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	base := commitTestFiles(t, repo, "base", map[string]string{"a": "a\n", "b": "b\n"})
+	assert.NoError(t, CreateBranch(repo, "topic", base, base, false))
+	upstream := commitTestFiles(t, repo, "upstream", map[string]string{"a": "upstream\n", "b": "b\n"})
+	assert.NoError(t, switchBranch(repo, "topic"))
+	commitTestFiles(t, repo, "topic a", map[string]string{"a": "topic\n", "b": "b\n"})
+	orig := commitTestFiles(t, repo, "topic b", map[string]string{"a": "topic\n", "b": "topic\n"})
+
+	var out bytes.Buffer
+	err := StartRebase(repo, &out, RebaseOptions{Upstream: "master"})
+	assert.Error(t, err)
+	assert.Contains(t, out.String(), "CONFLICT (content): Merge conflict in a")
+	assert.True(t, InRebase(repo))
+	head, _ := ResolveRef(repo, "HEAD")
+	assert.Equal(t, upstream, head)
+	assert.Error(t, ContinueRebase(repo, &out))
+
+	// resolve the conflict
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "a"), []byte("resolved\n"), 0644))
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	sha, err := WriteObject(repo, NewGitBlob([]byte("resolved\n")))
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(repo.Worktree, "a"))
+	assert.NoError(t, err)
+	resolved := &GitIndex{Entries: []*IndexEntry{NewIndexEntry(info, "a", sha), index.Entry("b")}}
+	assert.NoError(t, WriteIndex(repo, resolved))
+
+	out.Reset()
+	assert.NoError(t, ContinueRebase(repo, &out))
+	assert.Equal(t, "Successfully rebased and updated refs/heads/topic.\n", out.String())
+	assert.False(t, InRebase(repo))
+	branch, _ := CurrentBranch(repo)
+	assert.Equal(t, "refs/heads/topic", branch)
+	head, _ = ResolveRef(repo, "HEAD")
+	commit, err := ReadCommit(repo, head)
+	assert.NoError(t, err)
+	assert.Equal(t, "topic b\n", commit.Message)
+	parent, err := ReadCommit(repo, commit.Parents[0])
+	assert.NoError(t, err)
+	assert.Equal(t, "topic a\n", parent.Message)
+	assert.Equal(t, []string{upstream}, parent.Parents)
+	data, err := ioutil.ReadFile(filepath.Join(repo.Worktree, "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, "topic\n", string(data))
+
+	// abort restores the original branch
+	assert.NoError(t, UpdateRef(repo, "HEAD", orig, "reset"))
+	assert.NoError(t, resetHard(repo, orig))
+	assert.Error(t, StartRebase(repo, &out, RebaseOptions{Upstream: "master"}))
+	assert.NoError(t, AbortRebase(repo))
+	head, _ = ResolveRef(repo, "HEAD")
+	assert.Equal(t, orig, head)
+	assert.False(t, InRebase(repo))
+	assert.Equal(t, ErrNoRebase, SkipRebase(repo, &out))
+}
+
+func TestCleanupMessage(t *testing.T) {
+	assert.Equal(t, "subject\n\nbody\n", CleanupMessage("\n\nsubject  \n\n\n# comment\nbody\n\n", true))
+	assert.Equal(t, "# not comment\n", CleanupMessage("# not comment", false))
+	assert.Equal(t, "", CleanupMessage("# only comment\n\n", true))
+}
@@ -0,0 +1,218 @@
+package git
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ReceivePackOptions is options of ReceivePack.
+type ReceivePackOptions struct {
+	// StatelessRPC handle a request without advertisement, which is used by smart HTTP.
+	StatelessRPC bool
+	// AdvertiseRefs write only the advertisement.
+	AdvertiseRefs bool
+}
+
+// receivedCommand is a ref update command received by receive-pack.
+// status is "ok" or reason of rejection.
+type receivedCommand struct {
+	RefUpdateCommand
+	status string
+}
+
+// ReceivePack receive a packfile and ref update commands from a client which pushes,
+// then report the result of each update.
+// receive.denyNonFastForwards, receive.denyDeletes and receive.denyCurrentBranch config are honored.
+func ReceivePack(repo *GitRepository, r io.Reader, w io.Writer, opts ReceivePackOptions) error {
+	if !opts.StatelessRPC {
+		refs, err := ListRefs(repo, "refs/")
+		if err != nil {
+			return err
+		}
+		var advertised []*RemoteRef
+		for _, ref := range refs {
+			if ref.Sha != "" && !ref.IsSymbolic() {
+				advertised = append(advertised, &RemoteRef{Name: ref.Name, Sha: ref.Sha})
+			}
+		}
+		caps := Capabilities{"report-status", "delete-refs", "side-band-64k", "quiet", "ofs-delta", "agent=" + agent}
+		if err := writeRefAdvertisement(w, advertised, caps); err != nil {
+			return err
+		}
+	}
+	if opts.AdvertiseRefs {
+		return nil
+	}
+
+	br := bufio.NewReader(r)
+	cmds, caps, err := readReceiveCommands(newPktLineReader(br))
+	if err != nil || len(cmds) == 0 {
+		return err
+	}
+
+	unpackErr := receivePackfile(repo, br, cmds)
+	if unpackErr == nil {
+		if err := updateReceivedRefs(repo, cmds); err != nil {
+			return err
+		}
+	} else {
+		for _, c := range cmds {
+			c.status = "unpacker error"
+		}
+	}
+
+	if !caps.Has("report-status") {
+		return unpackErr
+	}
+	var report bytes.Buffer
+	if unpackErr != nil {
+		writePktLine(&report, "unpack %s", unpackErr)
+	} else {
+		writePktLine(&report, "unpack ok")
+	}
+	for _, c := range cmds {
+		if c.status == "ok" {
+			writePktLine(&report, "ok %s", c.Name)
+		} else {
+			writePktLine(&report, "ng %s %s", c.Name, c.status)
+		}
+	}
+	writeFlush(&report)
+
+	if caps.Has("side-band-64k") {
+		if _, err := newSidebandWriter(w, sidebandData, maxPktPayload).Write(report.Bytes()); err != nil {
+			return err
+		}
+		if err := writeFlush(w); err != nil {
+			return err
+		}
+	} else if _, err := w.Write(report.Bytes()); err != nil {
+		return err
+	}
+	return unpackErr
+}
+
+// readReceiveCommands read "<old> <new> <ref>" lines. capabilities follow NUL of the first line.
+func readReceiveCommands(pkt *pktLineReader) ([]*receivedCommand, Capabilities, error) {
+	var cmds []*receivedCommand
+	var caps Capabilities
+	for {
+		line, ok, err := pkt.readLine()
+		if err == io.EOF && len(cmds) == 0 {
+			// client disconnected after the advertisement
+			return nil, nil, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		if !ok {
+			return cmds, caps, nil
+		}
+		if strings.HasPrefix(line, "shallow ") {
+			continue
+		}
+		if nul := strings.IndexByte(line, 0); nul >= 0 {
+			caps = strings.Fields(line[nul+1:])
+			line = line[:nul]
+		}
+		fields := strings.Fields(line)
+		if len(fields) != 3 || !isHexSha(fields[0]) || !isHexSha(fields[1]) {
+			return nil, nil, fmt.Errorf("protocol error: expected old/new/ref, got '%s'", line)
+		}
+		cmds = append(cmds, &receivedCommand{RefUpdateCommand: RefUpdateCommand{Old: fields[0], New: fields[1], Name: fields[2]}})
+	}
+}
+
+// receivePackfile index packfile which follows commands. no packfile is sent if all commands are deletes.
+func receivePackfile(repo *GitRepository, r io.Reader, cmds []*receivedCommand) error {
+	for _, c := range cmds {
+		if c.New != zeroSha {
+			_, err := IndexPack(repo, r, true)
+			return err
+		}
+	}
+	return nil
+}
+
+// updateReceivedRefs check and apply each command, and set its status.
+func updateReceivedRefs(repo *GitRepository, cmds []*receivedCommand) error {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return err
+	}
+	denyNonFastForwards, err := cfg.GetBool("receive.denyNonFastForwards", false)
+	if err != nil {
+		return err
+	}
+	denyDeletes, err := cfg.GetBool("receive.denyDeletes", false)
+	if err != nil {
+		return err
+	}
+	current := ""
+	if !repo.Bare {
+		current, _ = CurrentBranch(repo)
+	}
+
+	for _, c := range cmds {
+		c.status = checkReceivedCommand(repo, cfg, c, current, denyNonFastForwards, denyDeletes)
+		if c.status != "" {
+			continue
+		}
+		c.status = "ok"
+		if c.New == zeroSha {
+			if err := DeleteRef(repo, c.Name); err != nil && !errors.Is(err, ErrRefNotFound) {
+				c.status = "failed to delete"
+			}
+			continue
+		}
+		if err := UpdateRef(repo, c.Name, c.New, "push"); err != nil {
+			c.status = "failed to update ref"
+		}
+	}
+	return nil
+}
+
+// checkReceivedCommand return reason to reject the command, or empty string.
+func checkReceivedCommand(repo *GitRepository, cfg *ConfigSet, c *receivedCommand, current string, denyNonFastForwards, denyDeletes bool) string {
+	if !strings.HasPrefix(c.Name, "refs/") || !IsValidRefName(c.Name) {
+		return "funny refname"
+	}
+	if c.Name == current {
+		deny := cfg.GetString("receive.denyCurrentBranch", "refuse")
+		switch strings.ToLower(deny) {
+		case "ignore", "warn", "false":
+		default:
+			if c.New == zeroSha {
+				return "deletion of the current branch prohibited"
+			}
+			return "branch is currently checked out"
+		}
+	}
+	if c.New == zeroSha && denyDeletes && strings.HasPrefix(c.Name, branchPrefix) {
+		return "deletion prohibited"
+	}
+
+	old, err := ResolveRef(repo, c.Name)
+	if err != nil {
+		old = zeroSha
+	}
+	if old != c.Old && !(c.New == zeroSha && old == zeroSha) {
+		return "failed to lock"
+	}
+	if c.New == zeroSha {
+		return ""
+	}
+	if !HasObject(repo, c.New) {
+		return "missing necessary objects"
+	}
+	if denyNonFastForwards && old != zeroSha {
+		if ok, err := IsAncestor(repo, old, c.New); err != nil || !ok {
+			return "non-fast-forward"
+		}
+	}
+	return ""
+}
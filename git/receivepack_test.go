@@ -0,0 +1,71 @@
+package git
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReceivePack(t *testing.T) {
+	remote, err := InitRepository(newTempDir(t), InitOptions{Bare: true})
+	assert.NoError(t, err)
+	defer os.RemoveAll(remote.GitDir)
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+
+	pushed, err := Push(repo, remote.GitDir, []string{"master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	sha, _ := ResolveRef(remote, "refs/heads/master")
+	assert.Equal(t, second, sha)
+	assert.True(t, HasObject(remote, first))
+
+	// non-fast-forward is rejected by remote if receive.denyNonFastForwards is set
+	cfg, err := ReadConfig(remote)
+	assert.NoError(t, err)
+	cfg.Set("receive", "", "denyNonFastForwards", "true")
+	assert.NoError(t, WriteConfig(remote, cfg))
+	pushed, err = Push(repo, remote.GitDir, []string{"+" + first + ":refs/heads/master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushRemoteRejected, pushed[0].Status)
+	assert.Equal(t, "non-fast-forward", pushed[0].Reason)
+
+	pushed, err = Push(repo, remote.GitDir, []string{"master:topic"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	pushed, err = Push(repo, remote.GitDir, []string{":topic"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+	_, err = ResolveRef(remote, "refs/heads/topic")
+	assert.Error(t, err)
+}
+
+func TestReceivePackCurrentBranch(t *testing.T) {
+	remote := newTestRepo(t)
+	defer os.RemoveAll(remote.Worktree)
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", first, ""))
+
+	pushed, err := Push(repo, remote.Worktree, []string{"master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushRemoteRejected, pushed[0].Status)
+	assert.Equal(t, "branch is currently checked out", pushed[0].Reason)
+
+	pushed, err = Push(repo, remote.Worktree, []string{"master:other"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+
+	cfg, err := ReadConfig(remote)
+	assert.NoError(t, err)
+	cfg.Set("receive", "", "denyCurrentBranch", "ignore")
+	assert.NoError(t, WriteConfig(remote, cfg))
+	pushed, err = Push(repo, remote.Worktree, []string{"master"}, PushOptions{})
+	assert.NoError(t, err)
+	assert.Equal(t, PushOK, pushed[0].Status)
+}
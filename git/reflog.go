@@ -0,0 +1,288 @@
+package git
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// zeroSha is used for not existing object in reflog.
+const zeroSha = "0000000000000000000000000000000000000000"
+
+// ReflogEntry is an entry of reflog.
+// Committer is who updated the ref and when.
+type ReflogEntry struct {
+	Old       string
+	New       string
+	Committer GitUser
+	Message   string
+}
+
+func (e *ReflogEntry) String() string {
+	return fmt.Sprintf("%s %s %s\t%s\n", e.Old, e.New, e.Committer.String(), e.Message)
+}
+
+func reflogPath(repo *GitRepository, name string) string {
+	return repo.RepoPath(filepath.Join("logs", name))
+}
+
+// HasReflog return true if ref has reflog.
+func HasReflog(repo *GitRepository, name string) bool {
+	_, err := os.Stat(reflogPath(repo, name))
+	return err == nil
+}
+
+// ReadReflog return reflog entries of ref. oldest entry comes first.
+func ReadReflog(repo *GitRepository, name string) ([]*ReflogEntry, error) {
+	data, err := ioutil.ReadFile(reflogPath(repo, name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	var entries []*ReflogEntry
+	for _, line := range strings.Split(string(data), "\n") {
+		if len(line) < 83 {
+			continue
+		}
+		entry := &ReflogEntry{Old: line[:40], New: line[41:81]}
+		rest := line[82:]
+		if tab := strings.IndexByte(rest, '\t'); tab >= 0 {
+			entry.Message = rest[tab+1:]
+			rest = rest[:tab]
+		}
+		entry.Committer = ParseGitUser(rest)
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// WriteReflog replace reflog of ref with entries.
+func WriteReflog(repo *GitRepository, name string, entries []*ReflogEntry) error {
+	var b bytes.Buffer
+	for _, e := range entries {
+		b.WriteString(e.String())
+	}
+	path := reflogPath(repo, name)
+	if err := os.MkdirAll(filepath.Dir(path), repoDirPerm()); err != nil {
+		return err
+	}
+	return writeLockedFile(path, b.Bytes())
+}
+
+// AppendReflog append an entry to reflog of ref.
+func AppendReflog(repo *GitRepository, name, oldSha, newSha, msg string) error {
+	committer, err := CommitterIdent(repo)
+	if err != nil {
+		return err
+	}
+	if oldSha == "" {
+		oldSha = zeroSha
+	}
+	if newSha == "" {
+		newSha = zeroSha
+	}
+	entry := &ReflogEntry{
+		Old:       oldSha,
+		New:       newSha,
+		Committer: committer,
+		Message:   strings.TrimSpace(strings.ReplaceAll(msg, "\n", " ")),
+	}
+
+	path := reflogPath(repo, name)
+	if err := os.MkdirAll(filepath.Dir(path), repoDirPerm()); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_APPEND, repoFilePerm())
+	if err != nil {
+		return err
+	}
+	if _, err := f.WriteString(entry.String()); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// shouldLogRef decide whether update of ref is recorded.
+// ref which already has reflog is always recorded, otherwise it depends on core.logAllRefUpdates.
+func shouldLogRef(repo *GitRepository, name string) bool {
+	if HasReflog(repo, name) {
+		return true
+	}
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return false
+	}
+	value, ok := cfg.Get("core.logallrefupdates")
+	if !ok {
+		return !repo.Bare && isDefaultLoggedRef(name)
+	}
+	if strings.ToLower(value) == "always" {
+		return true
+	}
+	enabled, _ := ParseConfigBool(value)
+	return enabled && isDefaultLoggedRef(name)
+}
+
+func isDefaultLoggedRef(name string) bool {
+	if name == "HEAD" {
+		return true
+	}
+	for _, prefix := range []string{"refs/heads/", "refs/remotes/", "refs/notes/"} {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// logRefUpdate record ref update if reflog of the ref is enabled.
+func logRefUpdate(repo *GitRepository, name, oldSha, newSha, msg string) error {
+	if !shouldLogRef(repo, name) {
+		return nil
+	}
+	return AppendReflog(repo, name, oldSha, newSha, msg)
+}
+
+// ReflogEntryAt return n-th entry from the newest. (ref@{n})
+func ReflogEntryAt(repo *GitRepository, name string, n int) (*ReflogEntry, error) {
+	entries, err := ReadReflog(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return nil, fmt.Errorf("reflog for '%s' is empty", name)
+	}
+	if n < 0 || n >= len(entries) {
+		return nil, fmt.Errorf("log for '%s' only has %d entries", ShortRefName(name), len(entries))
+	}
+	return entries[len(entries)-1-n], nil
+}
+
+// ReflogValueAt return object which ref pointed at the time. (ref@{date})
+// if the time is older than reflog, the oldest known value is returned.
+func ReflogValueAt(repo *GitRepository, name string, t time.Time) (string, error) {
+	entries, err := ReadReflog(repo, name)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("log for '%s' is empty", ShortRefName(name))
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		when, err := entries[i].Committer.When()
+		if err != nil {
+			continue
+		}
+		if !when.After(t) {
+			return entries[i].New, nil
+		}
+	}
+	oldest := entries[0]
+	if oldest.Old != zeroSha {
+		return oldest.Old, nil
+	}
+	return oldest.New, nil
+}
+
+// DeleteReflogEntries remove entries of the indexes counted from the newest.
+func DeleteReflogEntries(repo *GitRepository, name string, indexes ...int) error {
+	entries, err := ReadReflog(repo, name)
+	if err != nil {
+		return err
+	}
+	remove := map[int]bool{}
+	for _, n := range indexes {
+		if n < 0 || n >= len(entries) {
+			return fmt.Errorf("reflog entry %s@{%d} not found", name, n)
+		}
+		remove[len(entries)-1-n] = true
+	}
+	var kept []*ReflogEntry
+	for i, e := range entries {
+		if !remove[i] {
+			kept = append(kept, e)
+		}
+	}
+	return WriteReflog(repo, name, kept)
+}
+
+// ParseExpiry parse expiry date like gc.reflogExpire and gc.pruneExpire.
+// "never" and "false" return zero time which expires nothing, and "now" and "all" expire everything.
+func ParseExpiry(value string, now time.Time) (time.Time, error) {
+	switch value {
+	case "never", "false":
+		return time.Time{}, nil
+	case "all", "now":
+		return now.Add(time.Second), nil
+	}
+	return ParseDate(value, now)
+}
+
+// ExpireReflog remove entries older than expire, and entries older than expireUnreachable
+// whose object is not reachable from the current value of ref.
+// return number of removed entries.
+func ExpireReflog(repo *GitRepository, name string, expire, expireUnreachable time.Time, dryRun bool) (int, error) {
+	entries, err := ReadReflog(repo, name)
+	if err != nil {
+		return 0, err
+	}
+	tip, _ := ResolveRef(repo, name)
+
+	var kept []*ReflogEntry
+	for _, e := range entries {
+		when, err := e.Committer.When()
+		if err != nil {
+			kept = append(kept, e)
+			continue
+		}
+		if when.Before(expire) {
+			continue
+		}
+		if when.Before(expireUnreachable) {
+			reachable := false
+			if tip != "" && e.New != zeroSha {
+				reachable, _ = IsAncestor(repo, e.New, tip)
+			}
+			if !reachable {
+				continue
+			}
+		}
+		kept = append(kept, e)
+	}
+	removed := len(entries) - len(kept)
+	if dryRun || removed == 0 {
+		return removed, nil
+	}
+	return removed, WriteReflog(repo, name, kept)
+}
+
+// ListReflogs return names of refs which have reflog.
+func ListReflogs(repo *GitRepository) ([]string, error) {
+	var names []string
+	root := repo.RepoPath("logs")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		names = append(names, filepath.ToSlash(rel))
+		return nil
+	})
+	return names, err
+}
@@ -0,0 +1,115 @@
+package git
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRefWritesReflog(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	os.Setenv("GIT_COMMITTER_NAME", "mygit")
+	os.Setenv("GIT_COMMITTER_EMAIL", "mygit@example.com")
+	defer os.Unsetenv("GIT_COMMITTER_NAME")
+	defer os.Unsetenv("GIT_COMMITTER_EMAIL")
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+
+	assert.NoError(t, UpdateRef(repo, "HEAD", first, "commit (initial): first"))
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, "commit: second"))
+	assert.NoError(t, UpdateRef(repo, "refs/tags/v1", second, "tag"))
+
+	entries, err := ReadReflog(repo, "refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(entries))
+	assert.Equal(t, zeroSha, entries[0].Old)
+	assert.Equal(t, first, entries[1].Old)
+	assert.Equal(t, second, entries[1].New)
+	assert.Equal(t, "mygit", entries[1].Committer.Name)
+	assert.Equal(t, "commit: second", entries[1].Message)
+
+	// HEAD follows the current branch
+	head, err := ReadReflog(repo, "HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(head))
+
+	// tags are not logged by default
+	assert.False(t, HasReflog(repo, "refs/tags/v1"))
+
+	got, err := ResolveRevision(repo, "master@{1}")
+	assert.NoError(t, err)
+	assert.Equal(t, first, got)
+	got, err = ResolveRevision(repo, "HEAD@{0}~1")
+	assert.NoError(t, err)
+	assert.Equal(t, first, got)
+	got, err = ResolveRevision(repo, "@{1}")
+	assert.NoError(t, err)
+	assert.Equal(t, first, got)
+	got, err = ResolveRevision(repo, "master@{now}")
+	assert.NoError(t, err)
+	assert.Equal(t, second, got)
+	_, err = ResolveRevision(repo, "master@{2}")
+	assert.Error(t, err)
+
+	assert.NoError(t, DeleteReflogEntries(repo, "refs/heads/master", 0))
+	got, err = ResolveRevision(repo, "master@{0}")
+	assert.NoError(t, err)
+	assert.Equal(t, first, got)
+}
+
+func TestExpireReflog(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	side := writeTestCommit(t, repo, "side", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+
+	user := func(sec string) GitUser {
+		return GitUser{Name: "mygit", Email: "mygit@example.com", Time: sec + " +0000"}
+	}
+	entries := []*ReflogEntry{
+		{Old: zeroSha, New: first, Committer: user("1000"), Message: "old"},
+		{Old: first, New: side, Committer: user("2000"), Message: "unreachable"},
+		{Old: side, New: second, Committer: user("3000"), Message: "reachable"},
+	}
+	assert.NoError(t, WriteReflog(repo, "refs/heads/master", entries))
+
+	removed, err := ExpireReflog(repo, "refs/heads/master", time.Unix(1500, 0), time.Unix(4000, 0), false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, removed)
+	got, err := ReadReflog(repo, "refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(got))
+	assert.Equal(t, "reachable", got[0].Message)
+}
+
+func TestParseDate(t *testing.T) {
+	now := time.Date(2020, 3, 10, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		in   string
+		want time.Time
+	}{
+		{"1600000000 +0900", time.Unix(1600000000, 0)},
+		{"@1600000000", time.Unix(1600000000, 0)},
+		{"2020-01-02", time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)},
+		{"2020-01-02T03:04:05Z", time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)},
+		{"now", now},
+		{"yesterday", now.AddDate(0, 0, -1)},
+		{"2.weeks.ago", now.Add(-14 * 24 * time.Hour)},
+		{"1 month 3 hours ago", now.AddDate(0, -1, 0).Add(-3 * time.Hour)},
+		{"3 days", now.AddDate(0, 0, -3)},
+	}
+	for _, tt := range tests {
+		got, err := ParseDate(tt.in, now)
+		assert.NoError(t, err, tt.in)
+		assert.True(t, tt.want.Equal(got), tt.in)
+	}
+	for _, bad := range []string{"", "tomorrow-ish", "3 fortnights ago", "3 +09", "ago"} {
+		_, err := ParseDate(bad, now)
+		assert.Error(t, err, bad)
+	}
+}
@@ -0,0 +1,353 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// ErrRefNotFound is returned when a reference does not exist.
+var ErrRefNotFound = errors.New("ref not found")
+
+// maxSymrefDepth is a limit of following symbolic references.
+const maxSymrefDepth = 5
+
+// GitRef is a named reference.
+// Target is name of referent if ref is symbolic ref, otherwise empty.
+type GitRef struct {
+	Name   string
+	Sha    string
+	Target string
+}
+
+// IsSymbolic return true if ref points another ref.
+func (r *GitRef) IsSymbolic() bool {
+	return r.Target != ""
+}
+
+// ReadRef read ref file without following symbolic ref.
+// refs which have no loose file are looked up in packed-refs.
+func ReadRef(repo *GitRepository, name string) (*GitRef, error) {
+	data, err := ioutil.ReadFile(repo.RepoPath(name))
+	if err != nil {
+		if os.IsNotExist(err) {
+			ref, err := findPackedRef(repo, name)
+			if err != nil {
+				return nil, err
+			}
+			if ref != nil {
+				return ref, nil
+			}
+			return nil, fmt.Errorf("%w: %s", ErrRefNotFound, name)
+		}
+		return nil, err
+	}
+	content := strings.TrimSpace(string(data))
+	if strings.HasPrefix(content, "ref: ") {
+		return &GitRef{Name: name, Target: strings.TrimSpace(content[5:])}, nil
+	}
+	if !isHexSha(content) {
+		return nil, fmt.Errorf("Invalid ref %s: %q", name, content)
+	}
+	return &GitRef{Name: name, Sha: content}, nil
+}
+
+// ResolveRef return object hash which ref points.
+// symbolic refs are followed.
+func ResolveRef(repo *GitRepository, name string) (string, error) {
+	name, err := derefName(repo, name)
+	if err != nil {
+		return "", err
+	}
+	ref, err := ReadRef(repo, name)
+	if err != nil {
+		return "", err
+	}
+	return ref.Sha, nil
+}
+
+// derefName return the name of the ref which is finally pointed by symbolic ref.
+// the returned ref may not exist. (e.g. HEAD of empty repository)
+func derefName(repo *GitRepository, name string) (string, error) {
+	for i := 0; i < maxSymrefDepth; i++ {
+		ref, err := ReadRef(repo, name)
+		if errors.Is(err, ErrRefNotFound) {
+			return name, nil
+		}
+		if err != nil {
+			return "", err
+		}
+		if !ref.IsSymbolic() {
+			return name, nil
+		}
+		name = ref.Target
+	}
+	return "", fmt.Errorf("Symbolic ref nested too deeply: %s", name)
+}
+
+// UpdateRef set ref to sha, and record the update to reflog with msg.
+// if ref is symbolic ref, its referent is updated and both are recorded.
+// HEAD is also recorded when the current branch is updated.
+func UpdateRef(repo *GitRepository, name, sha, msg string) error {
+	if !isHexSha(sha) {
+		return fmt.Errorf("Invalid object name: %s", sha)
+	}
+	target, err := derefName(repo, name)
+	if err != nil {
+		return err
+	}
+	oldSha, _ := ResolveRef(repo, target)
+	if err := writeRefFile(repo, target, []byte(sha+"\n")); err != nil {
+		return err
+	}
+	if err := logRefUpdate(repo, target, oldSha, sha, msg); err != nil {
+		return err
+	}
+	if target != name {
+		return logRefUpdate(repo, name, oldSha, sha, msg)
+	}
+	if current, err := CurrentBranch(repo); err == nil && current == target && name != "HEAD" {
+		return logRefUpdate(repo, "HEAD", oldSha, sha, msg)
+	}
+	return nil
+}
+
+// SetSymbolicRef make name to point target ref.
+// the change is recorded to reflog of name if msg is not empty.
+func SetSymbolicRef(repo *GitRepository, name, target, msg string) error {
+	oldSha, _ := ResolveRef(repo, name)
+	if err := writeRefFile(repo, name, []byte("ref: "+target+"\n")); err != nil {
+		return err
+	}
+	if msg == "" {
+		return nil
+	}
+	newSha, _ := ResolveRef(repo, target)
+	return logRefUpdate(repo, name, oldSha, newSha, msg)
+}
+
+// DeleteRef remove ref and its reflog.
+// if ref is symbolic ref, symbolic ref itself is removed.
+func DeleteRef(repo *GitRepository, name string) error {
+	if err := removeRefFile(repo, name); err != nil {
+		return err
+	}
+	logPath := repo.RepoPath(filepath.Join("logs", name))
+	if err := os.Remove(logPath); err == nil {
+		removeEmptyDirs(filepath.Dir(logPath), repo.RepoPath("logs"))
+	}
+	return nil
+}
+
+// RenameRef rename ref oldName to newName.
+// Reflog of the ref is moved too.
+func RenameRef(repo *GitRepository, oldName, newName string) error {
+	sha, err := ResolveRef(repo, oldName)
+	if err != nil {
+		return err
+	}
+	if _, err := ReadRef(repo, newName); err == nil {
+		return fmt.Errorf("Ref already exists: %s", newName)
+	}
+
+	oldLog := repo.RepoPath(filepath.Join("logs", oldName))
+	if _, err := os.Stat(oldLog); err == nil {
+		newLog := repo.RepoPath(filepath.Join("logs", newName))
+		if err := os.MkdirAll(filepath.Dir(newLog), repoDirPerm()); err != nil {
+			return err
+		}
+		if err := os.Rename(oldLog, newLog); err != nil {
+			return err
+		}
+		removeEmptyDirs(filepath.Dir(oldLog), repo.RepoPath("logs"))
+	}
+
+	if err := removeRefFile(repo, oldName); err != nil {
+		return err
+	}
+	if err := writeRefFile(repo, newName, []byte(sha+"\n")); err != nil {
+		return err
+	}
+	return logRefUpdate(repo, newName, sha, sha, fmt.Sprintf("Branch: renamed %s to %s", oldName, newName))
+}
+
+// removeRefFile remove loose file of ref and its entry in packed-refs.
+func removeRefFile(repo *GitRepository, name string) error {
+	path := repo.RepoPath(name)
+	loose := true
+	if err := os.Remove(path); err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		loose = false
+	}
+	packed, err := deletePackedRef(repo, name)
+	if err != nil {
+		return err
+	}
+	if !loose && !packed {
+		return fmt.Errorf("%w: %s", ErrRefNotFound, name)
+	}
+	if loose {
+		removeEmptyDirs(filepath.Dir(path), repo.RepoPath("refs"))
+	}
+	return nil
+}
+
+// ListRefs return refs whose name start with prefix. result is sorted by name.
+// symbolic refs under prefix are resolved. loose refs take precedence over packed-refs.
+func ListRefs(repo *GitRepository, prefix string) ([]*GitRef, error) {
+	var refs []*GitRef
+	loose := map[string]bool{}
+	root := repo.RepoPath("refs")
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			if os.IsNotExist(err) {
+				return nil
+			}
+			return err
+		}
+		if info.IsDir() || strings.HasSuffix(path, ".lock") {
+			return nil
+		}
+		rel, err := filepath.Rel(repo.GitDir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(rel)
+		if !strings.HasPrefix(name, prefix) {
+			return nil
+		}
+		ref, err := ReadRef(repo, name)
+		if err != nil {
+			return err
+		}
+		if ref.IsSymbolic() {
+			sha, err := ResolveRef(repo, name)
+			if err != nil && !errors.Is(err, ErrRefNotFound) {
+				return err
+			}
+			ref.Sha = sha
+		}
+		refs = append(refs, ref)
+		loose[name] = true
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	packed, err := readPackedRefs(repo)
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range packed {
+		if strings.HasPrefix(ref.Name, prefix) && !loose[ref.Name] {
+			refs = append(refs, ref)
+		}
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Name < refs[j].Name })
+	return refs, nil
+}
+
+// CurrentBranch return full ref name which HEAD points. ex) "refs/heads/master"
+// return empty string if HEAD is detached.
+func CurrentBranch(repo *GitRepository) (string, error) {
+	head, err := ReadRef(repo, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	return head.Target, nil
+}
+
+// ShortRefName strip well known prefix from ref name.
+func ShortRefName(name string) string {
+	for _, prefix := range []string{"refs/heads/", "refs/tags/", "refs/remotes/", "refs/"} {
+		if strings.HasPrefix(name, prefix) {
+			return name[len(prefix):]
+		}
+	}
+	return name
+}
+
+// IsValidRefName check name follows rules of git check-ref-format.
+func IsValidRefName(name string) bool {
+	if name == "" || name == "@" || strings.HasPrefix(name, "/") || strings.HasSuffix(name, "/") || strings.HasSuffix(name, ".") {
+		return false
+	}
+	if strings.Contains(name, "..") || strings.Contains(name, "@{") || strings.Contains(name, "//") {
+		return false
+	}
+	for _, r := range name {
+		if r < 0x20 || r == 0x7f || strings.ContainsRune(" ~^:?*[\\", r) {
+			return false
+		}
+	}
+	for _, component := range strings.Split(name, "/") {
+		if strings.HasPrefix(component, ".") || strings.HasSuffix(component, ".lock") {
+			return false
+		}
+	}
+	return true
+}
+
+// writeRefFile write ref file through lock file.
+func writeRefFile(repo *GitRepository, name string, data []byte) error {
+	path := repo.RepoPath(name)
+	if err := os.MkdirAll(filepath.Dir(path), repoDirPerm()); err != nil {
+		return err
+	}
+	return writeLockedFile(path, data)
+}
+
+// writeLockedFile write data to "<path>.lock" and rename it to path.
+// it fails if the lock file already exists.
+func writeLockedFile(path string, data []byte) error {
+	lockPath := path + ".lock"
+	f, err := os.OpenFile(lockPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, repoFilePerm())
+	if err != nil {
+		if os.IsExist(err) {
+			return fmt.Errorf("Unable to lock %s: lock file exists", path)
+		}
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(lockPath)
+		return err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(lockPath)
+		return err
+	}
+	return os.Rename(lockPath, path)
+}
+
+// removeEmptyDirs remove empty directories from dir to stop(exclusive).
+func removeEmptyDirs(dir, stop string) {
+	for dir != stop && strings.HasPrefix(dir, stop) {
+		if err := os.Remove(dir); err != nil {
+			return
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+func isHexSha(s string) bool {
+	if len(s) != 40 {
+		return false
+	}
+	return isHex(s)
+}
+
+func isHex(s string) bool {
+	for _, c := range s {
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return false
+		}
+	}
+	return true
+}
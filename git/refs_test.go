@@ -0,0 +1,81 @@
+package git
+
+import (
+	"errors"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUpdateRef(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	sha := writeTestCommit(t, repo, "first")
+
+	// HEAD points unborn master, so master is created.
+	err := UpdateRef(repo, "HEAD", sha, "test")
+	assert.NoError(t, err)
+	got, err := ResolveRef(repo, "refs/heads/master")
+	assert.NoError(t, err)
+	assert.Equal(t, sha, got)
+
+	head, err := ReadRef(repo, "HEAD")
+	assert.NoError(t, err)
+	assert.True(t, head.IsSymbolic())
+	assert.Equal(t, "refs/heads/master", head.Target)
+
+	err = UpdateRef(repo, "refs/heads/topic", "invalid", "test")
+	assert.Error(t, err)
+}
+
+func TestDeleteAndRenameRef(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	sha := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "refs/heads/feature/a", sha, "test"))
+	assert.NoError(t, repo.SaveRepoFile("logs/refs/heads/feature/a", []byte("log\n")))
+
+	err := RenameRef(repo, "refs/heads/feature/a", "refs/heads/b")
+	assert.NoError(t, err)
+	_, err = ReadRef(repo, "refs/heads/feature/a")
+	assert.True(t, errors.Is(err, ErrRefNotFound))
+	_, err = os.Stat(repo.RepoPath("refs/heads/feature"))
+	assert.True(t, os.IsNotExist(err))
+	assert.FileExists(t, repo.RepoPath("logs/refs/heads/b"))
+
+	err = DeleteRef(repo, "refs/heads/b")
+	assert.NoError(t, err)
+	_, err = os.Stat(repo.RepoPath("refs/heads/b"))
+	assert.True(t, os.IsNotExist(err))
+	_, err = os.Stat(repo.RepoPath("logs/refs/heads/b"))
+	assert.True(t, os.IsNotExist(err))
+	assert.True(t, errors.Is(DeleteRef(repo, "refs/heads/b"), ErrRefNotFound))
+}
+
+func TestListRefs(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	sha := writeTestCommit(t, repo, "first")
+	for _, name := range []string{"refs/heads/b", "refs/heads/a", "refs/tags/v1"} {
+		assert.NoError(t, UpdateRef(repo, name, sha, "test"))
+	}
+
+	refs, err := ListRefs(repo, "refs/heads/")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(refs))
+	assert.Equal(t, "refs/heads/a", refs[0].Name)
+	assert.Equal(t, "refs/heads/b", refs[1].Name)
+	assert.Equal(t, sha, refs[1].Sha)
+}
+
+func TestIsValidRefName(t *testing.T) {
+	valid := []string{"refs/heads/master", "refs/heads/feature/x", "refs/tags/v1.0"}
+	invalid := []string{"", "refs/heads/a..b", "refs/heads/a b", "refs/heads/.hidden", "refs/heads/x.lock", "refs/heads/a/", "refs/heads/a@{1}", "refs/heads/a^"}
+	for _, name := range valid {
+		assert.True(t, IsValidRefName(name), name)
+	}
+	for _, name := range invalid {
+		assert.False(t, IsValidRefName(name), name)
+	}
+}
@@ -0,0 +1,163 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Refspec is a mapping between remote refs and local refs. ex) "+refs/heads/*:refs/remotes/origin/*"
+// Src and Dst may contain one "*" which matches any string.
+// Negative refspec "^<src>" excludes refs matched by other refspecs.
+type Refspec struct {
+	Src      string
+	Dst      string
+	Force    bool
+	Negative bool
+}
+
+// ParseRefspec parse "[+]<src>[:<dst>]" or "^<src>".
+func ParseRefspec(spec string) (*Refspec, error) {
+	r := &Refspec{}
+	s := spec
+	if strings.HasPrefix(s, "^") {
+		r.Negative = true
+		s = s[1:]
+	} else if strings.HasPrefix(s, "+") {
+		r.Force = true
+		s = s[1:]
+	}
+	r.Src = s
+	if colon := strings.IndexByte(s, ':'); colon >= 0 {
+		r.Src, r.Dst = s[:colon], s[colon+1:]
+		if r.Negative {
+			return nil, fmt.Errorf("Negative refspec '%s' must not have destination", spec)
+		}
+	}
+
+	srcStars, dstStars := strings.Count(r.Src, "*"), strings.Count(r.Dst, "*")
+	if srcStars > 1 || dstStars > 1 || (r.Dst != "" && srcStars != dstStars) {
+		return nil, fmt.Errorf("Invalid refspec '%s'", spec)
+	}
+	if r.Src == "" && (r.Negative || r.Dst == "") {
+		return nil, fmt.Errorf("Invalid refspec '%s'", spec)
+	}
+	for _, name := range []string{r.Src, r.Dst} {
+		if name != "" && !IsValidRefName(strings.Replace(name, "*", "x", 1)) {
+			return nil, fmt.Errorf("Invalid refspec '%s'", spec)
+		}
+	}
+	return r, nil
+}
+
+// ParseRefspecs parse all specs.
+func ParseRefspecs(specs []string) ([]*Refspec, error) {
+	var refspecs []*Refspec
+	for _, spec := range specs {
+		r, err := ParseRefspec(spec)
+		if err != nil {
+			return nil, err
+		}
+		refspecs = append(refspecs, r)
+	}
+	return refspecs, nil
+}
+
+// String return refspec in "[+]<src>:<dst>" form.
+func (r *Refspec) String() string {
+	switch {
+	case r.Negative:
+		return "^" + r.Src
+	case r.Dst == "":
+		return r.prefix() + r.Src
+	}
+	return r.prefix() + r.Src + ":" + r.Dst
+}
+
+func (r *Refspec) prefix() string {
+	if r.Force {
+		return "+"
+	}
+	return ""
+}
+
+// IsPattern return true if the refspec has "*".
+func (r *Refspec) IsPattern() bool {
+	return strings.Contains(r.Src, "*")
+}
+
+// MatchSrc return true if ref is matched by the source side.
+func (r *Refspec) MatchSrc(ref string) bool {
+	_, ok := matchRefPattern(r.Src, ref)
+	return ok
+}
+
+// MapSrc return destination of ref. ok is false if ref is not matched by the source side.
+// destination is empty if the refspec has no destination.
+func (r *Refspec) MapSrc(ref string) (string, bool) {
+	star, ok := matchRefPattern(r.Src, ref)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(r.Dst, "*", star, 1), true
+}
+
+// MapDst return source of local ref, reverse of MapSrc.
+func (r *Refspec) MapDst(ref string) (string, bool) {
+	if r.Dst == "" || r.Negative {
+		return "", false
+	}
+	star, ok := matchRefPattern(r.Dst, ref)
+	if !ok {
+		return "", false
+	}
+	return strings.Replace(r.Src, "*", star, 1), true
+}
+
+// matchRefPattern match ref with pattern which may contain "*", and return the string "*" matched.
+// pattern without "*" matches the full name or the name without "refs/heads/", "refs/tags/" etc.
+func matchRefPattern(pattern, ref string) (string, bool) {
+	star := strings.IndexByte(pattern, '*')
+	if star < 0 {
+		if pattern == ref {
+			return "", true
+		}
+		for _, prefix := range []string{"refs/", "refs/tags/", "refs/heads/", "refs/remotes/"} {
+			if prefix+pattern == ref {
+				return "", true
+			}
+		}
+		return "", false
+	}
+	prefix, suffix := pattern[:star], pattern[star+1:]
+	if len(ref) < len(prefix)+len(suffix) || !strings.HasPrefix(ref, prefix) || !strings.HasSuffix(ref, suffix) {
+		return "", false
+	}
+	return ref[len(prefix) : len(ref)-len(suffix)], true
+}
+
+// excludedByRefspecs return true if ref is matched by a negative refspec.
+func excludedByRefspecs(refspecs []*Refspec, ref string) bool {
+	for _, r := range refspecs {
+		if r.Negative && r.MatchSrc(ref) {
+			return true
+		}
+	}
+	return false
+}
+
+// MapRef return the first refspec matching remote ref and its destination.
+// nil is returned if no refspec matches or ref is excluded by negative refspecs.
+func MapRef(refspecs []*Refspec, ref string) (*Refspec, string) {
+	if excludedByRefspecs(refspecs, ref) {
+		return nil, ""
+	}
+	for _, r := range refspecs {
+		if r.Negative {
+			continue
+		}
+		if dst, ok := r.MapSrc(ref); ok {
+			return r, dst
+		}
+	}
+	return nil, ""
+}
@@ -0,0 +1,57 @@
+package git
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRefspec(t *testing.T) {
+	r, err := ParseRefspec("+refs/heads/*:refs/remotes/origin/*")
+	assert.NoError(t, err)
+	assert.Equal(t, &Refspec{Src: "refs/heads/*", Dst: "refs/remotes/origin/*", Force: true}, r)
+	assert.True(t, r.IsPattern())
+	assert.Equal(t, "+refs/heads/*:refs/remotes/origin/*", r.String())
+
+	r, err = ParseRefspec("^refs/heads/wip/*")
+	assert.NoError(t, err)
+	assert.True(t, r.Negative)
+	assert.Equal(t, "^refs/heads/wip/*", r.String())
+
+	r, err = ParseRefspec("master")
+	assert.NoError(t, err)
+	assert.Equal(t, &Refspec{Src: "master"}, r)
+
+	for _, spec := range []string{"", "refs/heads/*:refs/remotes/origin/x", "refs/*/*:refs/x/*/*", "^refs/heads/x:refs/y", "bad..name", ":"} {
+		_, err := ParseRefspec(spec)
+		assert.Error(t, err, spec)
+	}
+}
+
+func TestMapRef(t *testing.T) {
+	refspecs, err := ParseRefspecs([]string{"+refs/heads/*:refs/remotes/origin/*", "^refs/heads/wip/*", "refs/tags/v1:refs/tags/v1"})
+	assert.NoError(t, err)
+
+	r, dst := MapRef(refspecs, "refs/heads/topic/a")
+	assert.Equal(t, refspecs[0], r)
+	assert.Equal(t, "refs/remotes/origin/topic/a", dst)
+	r, _ = MapRef(refspecs, "refs/heads/wip/a")
+	assert.Nil(t, r)
+	_, dst = MapRef(refspecs, "refs/tags/v1")
+	assert.Equal(t, "refs/tags/v1", dst)
+	r, _ = MapRef(refspecs, "refs/tags/v2")
+	assert.Nil(t, r)
+
+	src, ok := refspecs[0].MapDst("refs/remotes/origin/master")
+	assert.True(t, ok)
+	assert.Equal(t, "refs/heads/master", src)
+	_, ok = refspecs[0].MapDst("refs/remotes/upstream/master")
+	assert.False(t, ok)
+
+	// short name matches full ref name
+	r, err = ParseRefspec("master:refs/heads/copy")
+	assert.NoError(t, err)
+	dst, ok = r.MapSrc("refs/heads/master")
+	assert.True(t, ok)
+	assert.Equal(t, "refs/heads/copy", dst)
+}
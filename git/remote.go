@@ -0,0 +1,281 @@
+package git
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Remote is a remote repository configured by [remote "<name>"] section.
+type Remote struct {
+	Name    string
+	URL     string
+	PushURL string
+	Fetch   []*Refspec
+}
+
+// DefaultFetchRefspec return refspec which maps branches of remote to remote-tracking branches.
+func DefaultFetchRefspec(name string) string {
+	return "+refs/heads/*:refs/remotes/" + name + "/*"
+}
+
+// GetRemote return configured remote.
+func GetRemote(repo *GitRepository, name string) (*Remote, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	return remoteFromConfig(cfg, name)
+}
+
+func remoteFromConfig(cfg *ConfigSet, name string) (*Remote, error) {
+	url, ok := cfg.Get("remote." + name + ".url")
+	if !ok {
+		return nil, fmt.Errorf("No such remote '%s'", name)
+	}
+	fetch, err := ParseRefspecs(cfg.GetAll("remote." + name + ".fetch"))
+	if err != nil {
+		return nil, err
+	}
+	return &Remote{
+		Name:    name,
+		URL:     url,
+		PushURL: cfg.GetString("remote."+name+".pushurl", ""),
+		Fetch:   fetch,
+	}, nil
+}
+
+// ListRemotes return remotes in order of config.
+func ListRemotes(repo *GitRepository) ([]*Remote, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	var remotes []*Remote
+	for _, name := range cfg.Subsections("remote") {
+		if _, ok := cfg.Get("remote." + name + ".url"); !ok {
+			continue
+		}
+		remote, err := remoteFromConfig(cfg, name)
+		if err != nil {
+			return nil, err
+		}
+		remotes = append(remotes, remote)
+	}
+	return remotes, nil
+}
+
+// IsValidRemoteName return true if name can be used for remote.
+func IsValidRemoteName(name string) bool {
+	return name != "" && !strings.Contains(name, "*") && IsValidRefName("refs/remotes/"+name+"/HEAD")
+}
+
+// AddRemote add remote with the default fetch refspec.
+func AddRemote(repo *GitRepository, name, url string) error {
+	if !IsValidRemoteName(name) {
+		return fmt.Errorf("'%s' is not a valid remote name", name)
+	}
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Get("remote", name, "url"); ok {
+		return fmt.Errorf("remote %s already exists.", name)
+	}
+	cfg.Set("remote", name, "url", url)
+	cfg.Add("remote", name, "fetch", DefaultFetchRefspec(name))
+	return WriteConfig(repo, cfg)
+}
+
+// SetRemoteURL change URL of remote. push URL is changed if push is true.
+func SetRemoteURL(repo *GitRepository, name, url string, push bool) error {
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Get("remote", name, "url"); !ok {
+		return fmt.Errorf("No such remote '%s'", name)
+	}
+	key := "url"
+	if push {
+		key = "pushurl"
+	}
+	cfg.Set("remote", name, key, url)
+	return WriteConfig(repo, cfg)
+}
+
+// RemoveRemote remove remote, its remote-tracking refs and upstream config of branches tracking it.
+func RemoveRemote(repo *GitRepository, name string) error {
+	remote, err := GetRemote(repo, name)
+	if err != nil {
+		return err
+	}
+	refs, err := ListRefs(repo, "refs/")
+	if err != nil {
+		return err
+	}
+	for _, ref := range refs {
+		if isTrackingRef(remote.Fetch, ref.Name) {
+			if err := DeleteRef(repo, ref.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	cfg.RemoveSection("remote", name)
+	for _, s := range cfg.Sections {
+		if s.Name != "branch" {
+			continue
+		}
+		if remote, ok := cfg.Get("branch", s.Subsection, "remote"); ok && remote == name {
+			cfg.Unset("branch", s.Subsection, "remote")
+			cfg.Unset("branch", s.Subsection, "merge")
+		}
+	}
+	return WriteConfig(repo, cfg)
+}
+
+// RenameRemote rename remote. the default fetch refspec, remote-tracking refs
+// and upstream config of branches are changed to the new name.
+func RenameRemote(repo *GitRepository, oldName, newName string) error {
+	if !IsValidRemoteName(newName) {
+		return fmt.Errorf("'%s' is not a valid remote name", newName)
+	}
+	cfg, err := ReadConfig(repo)
+	if err != nil {
+		return err
+	}
+	if _, ok := cfg.Get("remote", oldName, "url"); !ok {
+		return fmt.Errorf("No such remote '%s'", oldName)
+	}
+	if _, ok := cfg.Get("remote", newName, "url"); ok {
+		return fmt.Errorf("remote %s already exists.", newName)
+	}
+
+	oldPrefix, newPrefix := "refs/remotes/"+oldName+"/", "refs/remotes/"+newName+"/"
+	specs := cfg.GetAll("remote", oldName, "fetch")
+	cfg.Unset("remote", oldName, "fetch")
+	cfg.RenameSection("remote", oldName, newName)
+	for _, spec := range specs {
+		if spec == DefaultFetchRefspec(oldName) {
+			spec = DefaultFetchRefspec(newName)
+		}
+		cfg.Add("remote", newName, "fetch", spec)
+	}
+	for _, s := range cfg.Sections {
+		if s.Name != "branch" {
+			continue
+		}
+		if remote, ok := cfg.Get("branch", s.Subsection, "remote"); ok && remote == oldName {
+			cfg.Set("branch", s.Subsection, "remote", newName)
+		}
+	}
+	if err := WriteConfig(repo, cfg); err != nil {
+		return err
+	}
+
+	refs, err := ListRefs(repo, oldPrefix)
+	if err != nil {
+		return err
+	}
+	// symbolic refs are renamed after the refs they point to
+	msg := fmt.Sprintf("remote: renamed %s to %s", oldPrefix, newPrefix)
+	var symbolic []*GitRef
+	for _, ref := range refs {
+		if ref.IsSymbolic() {
+			symbolic = append(symbolic, ref)
+			continue
+		}
+		if err := RenameRef(repo, ref.Name, newPrefix+strings.TrimPrefix(ref.Name, oldPrefix)); err != nil {
+			return err
+		}
+	}
+	for _, ref := range symbolic {
+		target := ref.Target
+		if strings.HasPrefix(target, oldPrefix) {
+			target = newPrefix + strings.TrimPrefix(target, oldPrefix)
+		}
+		if err := DeleteRef(repo, ref.Name); err != nil {
+			return err
+		}
+		if err := SetSymbolicRef(repo, newPrefix+strings.TrimPrefix(ref.Name, oldPrefix), target, msg); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isTrackingRef return true if local ref is a destination of refspecs.
+func isTrackingRef(refspecs []*Refspec, ref string) bool {
+	for _, r := range refspecs {
+		if _, ok := r.MapDst(ref); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// staleTrackingRefs return local refs which are destination of pattern refspecs,
+// but whose source no longer exists on remote.
+func staleTrackingRefs(repo *GitRepository, refspecs []*Refspec, adv *RefAdvertisement) ([]*GitRef, error) {
+	remoteRefs := map[string]bool{}
+	for _, ref := range adv.Refs {
+		remoteRefs[ref.Name] = true
+	}
+	refs, err := ListRefs(repo, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	var stale []*GitRef
+	for _, ref := range refs {
+		if ref.IsSymbolic() {
+			continue
+		}
+		for _, r := range refspecs {
+			if !r.IsPattern() {
+				continue
+			}
+			if src, ok := r.MapDst(ref.Name); ok {
+				if !remoteRefs[src] && !excludedByRefspecs(refspecs, src) {
+					stale = append(stale, ref)
+				}
+				break
+			}
+		}
+	}
+	return stale, nil
+}
+
+// PruneRemote delete remote-tracking refs whose branch is deleted on remote.
+// return stale refs, which are not deleted if dryRun is true.
+func PruneRemote(repo *GitRepository, name string, dryRun bool) ([]*GitRef, error) {
+	remote, err := GetRemote(repo, name)
+	if err != nil {
+		return nil, err
+	}
+	transport, err := newTransport(repo, remote.URL, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer transport.Close()
+	adv, err := transport.FetchRefs()
+	if err != nil {
+		return nil, err
+	}
+	stale, err := staleTrackingRefs(repo, remote.Fetch, adv)
+	if err != nil {
+		return nil, err
+	}
+	if dryRun {
+		return stale, nil
+	}
+	for _, ref := range stale {
+		if err := DeleteRef(repo, ref.Name); err != nil {
+			return nil, err
+		}
+	}
+	return stale, nil
+}
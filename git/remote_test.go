@@ -0,0 +1,124 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoteConfig(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", first, ""))
+
+	assert.NoError(t, AddRemote(repo, "origin", "https://example.com/repo.git"))
+	assert.Error(t, AddRemote(repo, "origin", "https://example.com/other.git"))
+	assert.Error(t, AddRemote(repo, "bad name", "https://example.com/other.git"))
+	assert.NoError(t, AddRemote(repo, "upstream", "https://example.com/upstream.git"))
+	assert.NoError(t, SetRemoteURL(repo, "upstream", "ssh://example.com/upstream.git", true))
+	assert.Error(t, SetRemoteURL(repo, "missing", "ssh://example.com/upstream.git", false))
+
+	remotes, err := ListRemotes(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(remotes))
+	assert.Equal(t, "origin", remotes[0].Name)
+	assert.Equal(t, "+refs/heads/*:refs/remotes/origin/*", remotes[0].Fetch[0].String())
+	assert.Equal(t, "https://example.com/upstream.git", remotes[1].URL)
+	assert.Equal(t, "ssh://example.com/upstream.git", remotes[1].PushURL)
+
+	// rename moves remote-tracking refs and upstream of branches
+	assert.NoError(t, UpdateRef(repo, "refs/remotes/origin/master", first, ""))
+	assert.NoError(t, SetSymbolicRef(repo, "refs/remotes/origin/HEAD", "refs/remotes/origin/master", ""))
+	assert.NoError(t, SetUpstream(repo, "master", "origin/master"))
+	assert.Error(t, RenameRemote(repo, "origin", "upstream"))
+	assert.NoError(t, RenameRemote(repo, "origin", "main"))
+	remote, err := GetRemote(repo, "main")
+	assert.NoError(t, err)
+	assert.Equal(t, "+refs/heads/*:refs/remotes/main/*", remote.Fetch[0].String())
+	_, err = GetRemote(repo, "origin")
+	assert.Error(t, err)
+	sha, _ := ResolveRef(repo, "refs/remotes/main/HEAD")
+	assert.Equal(t, first, sha)
+	_, err = ReadRef(repo, "refs/remotes/origin/master")
+	assert.Error(t, err)
+	upstream, err := Upstream(repo, "master")
+	assert.NoError(t, err)
+	assert.Equal(t, "refs/remotes/main/master", upstream)
+
+	// remove deletes remote-tracking refs and upstream of branches
+	assert.NoError(t, RemoveRemote(repo, "main"))
+	refs, err := ListRefs(repo, "refs/remotes/")
+	assert.NoError(t, err)
+	assert.Empty(t, refs)
+	_, err = Upstream(repo, "master")
+	assert.Error(t, err)
+	assert.Error(t, RemoveRemote(repo, "main"))
+}
+
+func TestFetchRefspec(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	first := writeTestCommit(t, src, "first")
+	second := writeTestCommit(t, src, "second", first)
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", first, ""))
+	assert.NoError(t, UpdateRef(src, "refs/heads/topic", second, ""))
+	assert.NoError(t, UpdateRef(src, "refs/heads/wip/x", second, ""))
+
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	assert.NoError(t, AddRemote(repo, "origin", src.Worktree))
+	cfg, err := ReadConfig(repo)
+	assert.NoError(t, err)
+	cfg.Add("remote", "origin", "fetch", "^refs/heads/wip/*")
+	assert.NoError(t, WriteConfig(repo, cfg))
+
+	_, err = Fetch(repo, "origin", FetchOptions{})
+	assert.NoError(t, err)
+	refs, err := ListRefs(repo, "refs/remotes/")
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(refs))
+	assert.Equal(t, "refs/remotes/origin/master", refs[0].Name)
+	assert.Equal(t, "refs/remotes/origin/topic", refs[1].Name)
+
+	// explicit refspec without "+" rejects non-fast-forward
+	updates, err := Fetch(repo, "origin", FetchOptions{Refspecs: []string{"topic:refs/heads/copy"}})
+	assert.NoError(t, err)
+	assert.True(t, updates[0].IsNew())
+	sha, _ := ResolveRef(repo, "refs/heads/copy")
+	assert.Equal(t, second, sha)
+	updates, err = Fetch(repo, "origin", FetchOptions{Refspecs: []string{"master:copy"}})
+	assert.NoError(t, err)
+	assert.True(t, updates[0].Rejected)
+	sha, _ = ResolveRef(repo, "refs/heads/copy")
+	assert.Equal(t, second, sha)
+	_, err = Fetch(repo, "origin", FetchOptions{Refspecs: []string{"missing"}})
+	assert.Error(t, err)
+
+	// refspec without destination is recorded only to FETCH_HEAD
+	updates, err = Fetch(repo, "origin", FetchOptions{Refspecs: []string{"topic"}})
+	assert.NoError(t, err)
+	assert.Equal(t, "", updates[0].Local)
+	fetchHead, err := ioutil.ReadFile(repo.RepoPath("FETCH_HEAD"))
+	assert.NoError(t, err)
+	assert.Equal(t, second+"\t\tbranch 'topic' of "+src.Worktree+"\n", string(fetchHead))
+
+	// prune deletes remote-tracking refs of deleted branches
+	assert.NoError(t, DeleteRef(src, "refs/heads/topic"))
+	updates, err = Fetch(repo, "origin", FetchOptions{})
+	assert.NoError(t, err)
+	_, err = ResolveRef(repo, "refs/remotes/origin/topic")
+	assert.NoError(t, err)
+	stale, err := PruneRemote(repo, "origin", true)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(stale))
+	updates, err = Fetch(repo, "origin", FetchOptions{Prune: true})
+	assert.NoError(t, err)
+	pruned := updates[len(updates)-1]
+	assert.True(t, pruned.IsPruned())
+	assert.Equal(t, "refs/remotes/origin/topic", pruned.Local)
+	_, err = ResolveRef(repo, "refs/remotes/origin/topic")
+	assert.Error(t, err)
+}
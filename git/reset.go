@@ -0,0 +1,307 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+)
+
+// ResetMode is how reset updates the index and worktree.
+type ResetMode int
+
+const (
+	// ResetMixed resets the index but not the worktree.
+	ResetMixed ResetMode = iota
+	// ResetSoft only moves HEAD.
+	ResetSoft
+	// ResetHard resets the index and worktree, discarding local changes.
+	ResetHard
+	// ResetMerge resets the index and updates files which differ between HEAD and the commit,
+	// keeping local changes of other files. unmerged entries are reset.
+	ResetMerge
+	// ResetKeep is like ResetMerge, but refuses to run in the middle of a merge.
+	ResetKeep
+)
+
+func (m ResetMode) String() string {
+	return [...]string{"mixed", "soft", "hard", "merge", "keep"}[m]
+}
+
+// Reset point HEAD, or the branch which HEAD points, to the commit of rev, and update the index
+// and worktree according to mode. the previous HEAD is recorded to ORIG_HEAD,
+// and the state of merge, cherry-pick or revert in progress is removed.
+func Reset(repo *GitRepository, rev string, mode ResetMode) error {
+	if repo.Bare && mode != ResetSoft {
+		return fmt.Errorf("%s reset is not allowed in a bare repository", mode)
+	}
+	target, err := resolveResetTarget(repo, rev)
+	if err != nil {
+		return err
+	}
+	tree, err := CommitTree(repo, target)
+	if err != nil {
+		return err
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	head, headErr := ResolveRef(repo, "HEAD")
+	headTree := ""
+	if headErr == nil {
+		if headTree, err = CommitTree(repo, head); err != nil {
+			return err
+		}
+	}
+
+	switch mode {
+	case ResetSoft:
+		if len(index.Conflicts()) > 0 {
+			return fmt.Errorf("Cannot do a soft reset in the middle of a merge.")
+		}
+	case ResetMixed:
+		files, err := IndexFromTree(repo, tree)
+		if err != nil {
+			return err
+		}
+		if err := WriteIndex(repo, keepIndexStat(index, files)); err != nil {
+			return err
+		}
+	case ResetHard:
+		if err := checkoutTreeForce(repo, index, tree); err != nil {
+			return err
+		}
+	case ResetMerge, ResetKeep:
+		if mode == ResetKeep && len(index.Conflicts()) > 0 {
+			return fmt.Errorf("Cannot do a keep reset in the middle of a merge.")
+		}
+		if err := resetMerge(repo, index, headTree, tree); err != nil {
+			return fmt.Errorf("%v\nCould not reset index file to revision '%s'.", err, rev)
+		}
+	}
+
+	if target == "" {
+		return nil
+	}
+	if headErr == nil {
+		if err := writeRefFile(repo, "ORIG_HEAD", []byte(head+"\n")); err != nil {
+			return err
+		}
+	}
+	if err := UpdateRef(repo, "HEAD", target, "reset: moving to "+rev); err != nil {
+		return err
+	}
+	if mode == ResetSoft {
+		return nil
+	}
+	return removeMergeState(repo)
+}
+
+// resolveResetTarget return the commit of rev. HEAD of a branch which has no commits yet is empty.
+func resolveResetTarget(repo *GitRepository, rev string) (string, error) {
+	sha, err := ResolveCommit(repo, rev)
+	if err == nil {
+		return sha, nil
+	}
+	if rev == "HEAD" {
+		if _, err := ResolveRef(repo, "HEAD"); err != nil {
+			return "", nil
+		}
+	}
+	return "", fmt.Errorf("Failed to resolve '%s' as a valid revision.", rev)
+}
+
+// ResetPaths reset index entries matching pathspecs to the tree of rev. HEAD and the worktree are not changed.
+func ResetPaths(repo *GitRepository, rev string, pathspecs []string) error {
+	target, err := resolveResetTarget(repo, rev)
+	if err != nil {
+		return err
+	}
+	tree, err := CommitTree(repo, target)
+	if err != nil {
+		return err
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	files, err := IndexFromTree(repo, tree)
+	if err != nil {
+		return err
+	}
+	reset := &GitIndex{}
+	for _, e := range index.Entries {
+		if !MatchPathspec(pathspecs, e.FilePath) {
+			reset.Entries = append(reset.Entries, e)
+		}
+	}
+	for _, e := range files.Entries {
+		if MatchPathspec(pathspecs, e.FilePath) {
+			if old := index.Entry(e.FilePath); old != nil && old.ObjectID == e.ObjectID && canonicalMode(old.Mode) == canonicalMode(e.Mode) {
+				e = old
+			}
+			reset.Entries = append(reset.Entries, e)
+		}
+	}
+	SortIndex(reset)
+	return WriteIndex(repo, reset)
+}
+
+// keepIndexStat return target whose entries identical to ones of index keep their stat information,
+// so that unchanged files are not reported as modified.
+func keepIndexStat(index, target *GitIndex) *GitIndex {
+	kept := &GitIndex{}
+	for _, e := range target.Entries {
+		if old := index.Entry(e.FilePath); old != nil && old.ObjectID == e.ObjectID && canonicalMode(old.Mode) == canonicalMode(e.Mode) {
+			e = old
+		}
+		kept.Entries = append(kept.Entries, e)
+	}
+	return kept
+}
+
+// resetHard update the index and worktree to the tree of the commit, discarding local changes.
+func resetHard(repo *GitRepository, sha string) error {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	tree, err := CommitTree(repo, sha)
+	if err != nil {
+		return err
+	}
+	return checkoutTreeForce(repo, index, tree)
+}
+
+func checkoutTreeForce(repo *GitRepository, index *GitIndex, tree string) error {
+	target, err := IndexFromTree(repo, tree)
+	if err != nil {
+		return err
+	}
+	return CheckoutIndex(repo, index, target, CheckoutOptions{Force: true})
+}
+
+// resetMerge reset the index to tree, and update files which differ between headTree and tree.
+// an error is returned if such files have local changes. other files keep local changes in worktree.
+func resetMerge(repo *GitRepository, index *GitIndex, headTree, tree string) error {
+	heads, err := treeFileMap(repo, headTree)
+	if err != nil {
+		return err
+	}
+	targets, err := treeFileMap(repo, tree)
+	if err != nil {
+		return err
+	}
+	entries := map[string]*IndexEntry{}
+	conflicted := map[string]bool{}
+	names := map[string]bool{}
+	for _, e := range index.Entries {
+		names[e.FilePath] = true
+		if e.Stage() == 0 {
+			entries[e.FilePath] = e
+		} else {
+			conflicted[e.FilePath] = true
+		}
+	}
+	for name := range heads {
+		names[name] = true
+	}
+	for name := range targets {
+		names[name] = true
+	}
+	var sorted []string
+	for name := range names {
+		sorted = append(sorted, name)
+	}
+	sort.Strings(sorted)
+
+	// check all files before updating anything
+	var updates []string
+	for _, name := range sorted {
+		h, tg, e := heads[name], targets[name], entries[name]
+		if conflicted[name] {
+			updates = append(updates, name)
+			continue
+		}
+		if sameTreeEntry(h, tg) {
+			continue
+		}
+		if e == nil && h != nil || e != nil && (h == nil || e.ObjectID != h.Sha || canonicalMode(e.Mode) != canonicalMode(h.Mode)) {
+			return fmt.Errorf("Entry '%s' would be overwritten by merge. Cannot merge.", name)
+		}
+		if e != nil {
+			modified, err := IsEntryModified(repo, e)
+			if err != nil {
+				return err
+			}
+			if modified {
+				return fmt.Errorf("Entry '%s' not uptodate. Cannot merge.", name)
+			}
+		} else if _, err := os.Lstat(worktreeFile(repo, name)); err == nil {
+			return fmt.Errorf("Untracked working tree file '%s' would be overwritten by merge.", name)
+		}
+		updates = append(updates, name)
+	}
+
+	reset := &GitIndex{}
+	for _, name := range sorted {
+		if tg := targets[name]; tg != nil {
+			e := newIndexEntryFromTree(name, tg, 0)
+			if old := entries[name]; old != nil && old.ObjectID == e.ObjectID && canonicalMode(old.Mode) == canonicalMode(e.Mode) {
+				e = old
+			}
+			entries[name] = e
+			reset.Entries = append(reset.Entries, e)
+		} else {
+			delete(entries, name)
+		}
+	}
+	for _, name := range updates {
+		e, ok := entries[name]
+		if !ok {
+			file := worktreeFile(repo, name)
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return err
+			}
+			removeEmptyDirs(filepath.Dir(file), repo.Worktree)
+			continue
+		}
+		written, err := checkoutEntry(repo, e, nil)
+		if err != nil {
+			return err
+		}
+		*e = *written
+	}
+	return WriteIndex(repo, reset)
+}
+
+// treeFileMap return files of the tree by their paths.
+func treeFileMap(repo *GitRepository, tree string) (map[string]*GitTreeEntry, error) {
+	files, err := ReadTreeFiles(repo, tree)
+	if err != nil {
+		return nil, err
+	}
+	m := map[string]*GitTreeEntry{}
+	for _, f := range files {
+		m[f.Path] = f
+	}
+	return m, nil
+}
+
+func sameTreeEntry(a, b *GitTreeEntry) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Sha == b.Sha && canonicalMode(a.Mode) == canonicalMode(b.Mode)
+}
+
+// removeMergeState remove files which describe a merge, cherry-pick or revert in progress.
+func removeMergeState(repo *GitRepository) error {
+	for _, name := range []string{"MERGE_HEAD", "MERGE_MODE", "MERGE_MSG", "SQUASH_MSG", "CHERRY_PICK_HEAD", "REVERT_HEAD"} {
+		if err := os.Remove(repo.RepoPath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
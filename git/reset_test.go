@@ -0,0 +1,103 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReset(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	first := commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "b": "b\n"})
+	second := commitTestFiles(t, repo, "second", map[string]string{"a": "a2\n", "b": "b\n", "c": "c\n"})
+
+	// soft only moves HEAD
+	assert.NoError(t, Reset(repo, first, ResetSoft))
+	head, _ := ResolveRef(repo, "refs/heads/master")
+	assert.Equal(t, first, head)
+	orig, _ := ResolveRef(repo, "ORIG_HEAD")
+	assert.Equal(t, second, orig)
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.NotNil(t, index.Entry("c"))
+
+	// mixed resets the index, but not the worktree
+	assert.NoError(t, Reset(repo, "HEAD", ResetMixed))
+	index, err = ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.Nil(t, index.Entry("c"))
+	assert.FileExists(t, filepath.Join(repo.Worktree, "c"))
+	changes, err := WorktreeChanges(repo, index)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(changes))
+	assert.Equal(t, "a", changes[0].Path)
+
+	// hard resets the worktree too
+	assert.NoError(t, Reset(repo, second, ResetHard))
+	data, err := ioutil.ReadFile(filepath.Join(repo.Worktree, "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a2\n", string(data))
+
+	assert.EqualError(t, Reset(repo, "nothing", ResetHard), "Failed to resolve 'nothing' as a valid revision.")
+}
+
+func TestResetKeep(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	first := commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "b": "b\n"})
+	commitTestFiles(t, repo, "second", map[string]string{"a": "a2\n", "b": "b\n", "c": "c\n"})
+
+	// local changes of a file which differs between the commits prevent the reset
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "a"), []byte("local\n"), 0644))
+	assert.EqualError(t, Reset(repo, first, ResetKeep),
+		"Entry 'a' not uptodate. Cannot merge.\nCould not reset index file to revision '"+first+"'.")
+
+	// local changes of other files are kept
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "a"), []byte("a2\n"), 0644))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "b"), []byte("local\n"), 0644))
+	assert.NoError(t, Reset(repo, first, ResetKeep))
+	data, err := ioutil.ReadFile(filepath.Join(repo.Worktree, "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "a\n", string(data))
+	data, err = ioutil.ReadFile(filepath.Join(repo.Worktree, "b"))
+	assert.NoError(t, err)
+	assert.Equal(t, "local\n", string(data))
+	_, err = os.Stat(filepath.Join(repo.Worktree, "c"))
+	assert.True(t, os.IsNotExist(err))
+	head, _ := ResolveRef(repo, "HEAD")
+	assert.Equal(t, first, head)
+}
+
+func TestResetPaths(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	head := commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "b": "b\n"})
+	sha, err := WriteObject(repo, NewGitBlob([]byte("staged\n")))
+	assert.NoError(t, err)
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	for _, e := range index.Entries {
+		e.ObjectID = sha
+	}
+	index.Entries = append(index.Entries, &IndexEntry{FilePath: "new", ObjectID: sha, Mode: ModeBlob})
+	assert.NoError(t, WriteIndex(repo, index))
+
+	assert.NoError(t, ResetPaths(repo, "HEAD", []string{"a", "new"}))
+	index, err = ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.Nil(t, index.Entry("new"))
+	assert.NotEqual(t, sha, index.Entry("a").ObjectID)
+	assert.Equal(t, sha, index.Entry("b").ObjectID)
+	after, _ := ResolveRef(repo, "HEAD")
+	assert.Equal(t, head, after)
+}
@@ -0,0 +1,371 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// refSearchRules is list of format to find ref from short name.
+var refSearchRules = []string{
+	"%s",
+	"refs/%s",
+	"refs/tags/%s",
+	"refs/heads/%s",
+	"refs/remotes/%s",
+	"refs/remotes/%s/HEAD",
+}
+
+// ResolveRevision return object hash which revision means.
+// supported syntax is
+//
+//	<sha1>, <abbreviated sha1>, <refname>, @,
+//	<refname>@{<n>}, <refname>@{<date>}, @{<n>}, @{-<n>}, <branch>@{upstream},
+//	<rev>^<n>, <rev>~<n>, <rev>^{<type>}, <rev>^{},
+//	<rev>:<path>, :<path>, :<n>:<path>
+func ResolveRevision(repo *GitRepository, rev string) (string, error) {
+	if i := revisionPathSeparator(rev); i >= 0 {
+		return resolveRevisionPath(repo, rev[:i], rev[i+1:])
+	}
+	end := revisionBaseEnd(rev)
+	sha, err := resolveRevisionBase(repo, rev[:end])
+	if err != nil {
+		return "", err
+	}
+
+	rest := rev[end:]
+	for len(rest) > 0 {
+		op := rest[0]
+		rest = rest[1:]
+
+		if op == '^' && strings.HasPrefix(rest, "{") {
+			close := strings.IndexByte(rest, '}')
+			if close < 0 {
+				return "", fmt.Errorf("Invalid revision: %s", rev)
+			}
+			sha, err = PeelObject(repo, sha, rest[1:close])
+			if err != nil {
+				return "", err
+			}
+			rest = rest[close+1:]
+			continue
+		}
+
+		digits := 0
+		for digits < len(rest) && '0' <= rest[digits] && rest[digits] <= '9' {
+			digits++
+		}
+		n := 1
+		if digits > 0 {
+			n, _ = strconv.Atoi(rest[:digits])
+		}
+		rest = rest[digits:]
+
+		switch op {
+		case '^':
+			sha, err = nthParent(repo, sha, n)
+		case '~':
+			for i := 0; i < n && err == nil; i++ {
+				sha, err = nthParent(repo, sha, 1)
+			}
+		}
+		if err != nil {
+			return "", fmt.Errorf("Invalid revision: %s: %w", rev, err)
+		}
+	}
+	return sha, nil
+}
+
+// ResolveCommit return commit hash which revision means.
+func ResolveCommit(repo *GitRepository, rev string) (string, error) {
+	sha, err := ResolveRevision(repo, rev)
+	if err != nil {
+		return "", err
+	}
+	return PeelObject(repo, sha, "commit")
+}
+
+// DwimRef find full ref name from short name.
+func DwimRef(repo *GitRepository, name string) (string, bool) {
+	if name == "" {
+		return "", false
+	}
+	for _, rule := range refSearchRules {
+		full := fmt.Sprintf(rule, name)
+		if _, err := ResolveRef(repo, full); err == nil {
+			return full, true
+		}
+	}
+	return "", false
+}
+
+// revisionPathSeparator return the index of ":" which separates a tree-ish and a path, or -1.
+func revisionPathSeparator(rev string) int {
+	for i := 0; i < len(rev); i++ {
+		switch {
+		case strings.HasPrefix(rev[i:], "@{"):
+			close := strings.IndexByte(rev[i:], '}')
+			if close < 0 {
+				return -1
+			}
+			i += close
+		case rev[i] == ':':
+			return i
+		}
+	}
+	return -1
+}
+
+// resolveRevisionPath return the object at the path in the tree-ish.
+// empty tree-ish means the index, where the path may be prefixed by the stage like "1:path".
+func resolveRevisionPath(repo *GitRepository, treeish, name string) (string, error) {
+	if treeish == "" {
+		stage := 0
+		if len(name) > 2 && name[1] == ':' && '0' <= name[0] && name[0] <= '3' {
+			stage, name = int(name[0]-'0'), name[2:]
+		}
+		index, err := ReadIndexOrEmpty(repo)
+		if err != nil {
+			return "", err
+		}
+		for _, e := range index.Entries {
+			if e.FilePath == name && e.Stage() == stage {
+				return e.ObjectID, nil
+			}
+		}
+		return "", fmt.Errorf("path '%s' does not exist in the index", name)
+	}
+	sha, err := ResolveRevision(repo, treeish)
+	if err != nil {
+		return "", err
+	}
+	tree, err := PeelObject(repo, sha, "tree")
+	if err != nil {
+		return "", err
+	}
+	if name = strings.Trim(name, "/"); name == "" {
+		return tree, nil
+	}
+	e, err := lookupTreePath(repo, tree, name)
+	if err != nil {
+		return "", err
+	}
+	if e == nil {
+		return "", fmt.Errorf("path '%s' does not exist in '%s'", name, treeish)
+	}
+	return e.Sha, nil
+}
+
+// revisionBaseEnd return end of the ref or object name part of revision.
+func revisionBaseEnd(rev string) int {
+	for i := 0; i < len(rev); i++ {
+		switch {
+		case strings.HasPrefix(rev[i:], "@{"):
+			close := strings.IndexByte(rev[i:], '}')
+			if close < 0 {
+				return len(rev)
+			}
+			i += close
+		case rev[i] == '^' || rev[i] == '~':
+			return i
+		}
+	}
+	return len(rev)
+}
+
+func resolveRevisionBase(repo *GitRepository, base string) (string, error) {
+	if base == "" {
+		return "", fmt.Errorf("Invalid revision: empty name")
+	}
+	if at := strings.Index(base, "@{"); at >= 0 && strings.HasSuffix(base, "}") {
+		return resolveReflogRevision(repo, base[:at], base[at+2:len(base)-1])
+	}
+	if base == "@" {
+		base = "HEAD"
+	}
+	if isHexSha(base) && HasObject(repo, base) {
+		return base, nil
+	}
+	if full, ok := DwimRef(repo, base); ok {
+		return ResolveRef(repo, full)
+	}
+	if len(base) >= 4 && isHex(base) {
+		return ExpandObjectID(repo, base)
+	}
+	return "", fmt.Errorf("Unknown revision: %s", base)
+}
+
+// resolveReflogRevision resolve <name>@{<spec>}.
+func resolveReflogRevision(repo *GitRepository, name, spec string) (string, error) {
+	if strings.HasPrefix(spec, "-") {
+		n, err := strconv.Atoi(spec[1:])
+		if name != "" || err != nil || n <= 0 {
+			return "", fmt.Errorf("Invalid revision: %s@{%s}", name, spec)
+		}
+		previous, err := PreviousCheckout(repo, n)
+		if err != nil {
+			return "", err
+		}
+		return ResolveRevision(repo, previous)
+	}
+
+	// @{<spec>} means the current branch
+	branch := name
+	if branch == "" {
+		current, err := CurrentBranch(repo)
+		if err != nil {
+			return "", err
+		}
+		branch = current
+		if current == "" {
+			branch = "HEAD"
+		}
+	}
+
+	switch strings.ToLower(spec) {
+	case "u", "upstream", "push":
+		upstream, err := Upstream(repo, strings.TrimPrefix(branch, branchPrefix))
+		if err != nil {
+			return "", err
+		}
+		return ResolveRef(repo, upstream)
+	}
+
+	full := branch
+	if !strings.HasPrefix(branch, "refs/") && branch != "HEAD" {
+		var ok bool
+		if full, ok = DwimRef(repo, branch); !ok {
+			return "", fmt.Errorf("Unknown revision: %s", branch)
+		}
+	}
+	if n, err := strconv.Atoi(spec); err == nil {
+		entry, err := ReflogEntryAt(repo, full, n)
+		if err != nil {
+			return "", err
+		}
+		return entry.New, nil
+	}
+	t, err := ParseDate(spec, time.Now())
+	if err != nil {
+		return "", err
+	}
+	return ReflogValueAt(repo, full, t)
+}
+
+// PreviousCheckout return n-th previously checked out branch or commit from HEAD reflog. (@{-n})
+func PreviousCheckout(repo *GitRepository, n int) (string, error) {
+	entries, err := ReadReflog(repo, "HEAD")
+	if err != nil {
+		return "", err
+	}
+	for i := len(entries) - 1; i >= 0; i-- {
+		msg := entries[i].Message
+		if !strings.HasPrefix(msg, "checkout: moving from ") {
+			continue
+		}
+		n--
+		if n == 0 {
+			from := strings.TrimPrefix(msg, "checkout: moving from ")
+			if to := strings.LastIndex(from, " to "); to >= 0 {
+				from = from[:to]
+			}
+			return from, nil
+		}
+	}
+	return "", fmt.Errorf("no previous checkout found")
+}
+
+// PeelObject follow object until the object type become objType.
+// commit is peeled to its tree. empty objType means any non-tag object.
+func PeelObject(repo *GitRepository, sha, objType string) (string, error) {
+	for {
+		obj, err := ReadObject(repo, sha)
+		if err != nil {
+			return "", err
+		}
+		t := string(obj.Type())
+		if t == objType || (objType == "" || objType == "object") && t != "tag" {
+			return sha, nil
+		}
+		switch o := obj.(type) {
+		case *GitTag:
+			sha = o.Object
+		case *GitCommit:
+			if objType != "tree" {
+				return "", fmt.Errorf("%s is a commit, not a %s", sha, objType)
+			}
+			sha = o.Tree
+		default:
+			return "", fmt.Errorf("%s is a %s, not a %s", sha, t, objType)
+		}
+	}
+}
+
+func nthParent(repo *GitRepository, sha string, n int) (string, error) {
+	sha, err := PeelObject(repo, sha, "commit")
+	if err != nil {
+		return "", err
+	}
+	if n == 0 {
+		return sha, nil
+	}
+	commit, err := ReadCommit(repo, sha)
+	if err != nil {
+		return "", err
+	}
+	if len(commit.Parents) < n {
+		return "", fmt.Errorf("commit %s has no parent %d", sha, n)
+	}
+	return commit.Parents[n-1], nil
+}
+
+// HasObject return true if object exists in repository.
+func HasObject(repo *GitRepository, sha string) bool {
+	if len(sha) < 3 {
+		return false
+	}
+	if _, err := os.Stat(repo.RepoPath(objectPath(sha))); err == nil {
+		return true
+	}
+	return isHexSha(sha) && hasPackedObject(repo, sha)
+}
+
+// ExpandObjectID return full object hash which begin with prefix.
+func ExpandObjectID(repo *GitRepository, prefix string) (string, error) {
+	if len(prefix) < 4 {
+		return "", fmt.Errorf("hash prefix must be 4 or more charcters.")
+	}
+	files, err := ioutil.ReadDir(repo.RepoPath("objects/" + prefix[:2]))
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	found := map[string]bool{}
+	for _, f := range files {
+		if strings.HasPrefix(f.Name(), prefix[2:]) {
+			found[prefix[:2]+f.Name()] = true
+		}
+	}
+	indexes, err := listPackIndexes(repo)
+	if err != nil {
+		return "", err
+	}
+	for _, idx := range indexes {
+		for _, sha := range idx.withPrefix(prefix) {
+			found[sha] = true
+		}
+	}
+	if len(found) > 1 {
+		return "", fmt.Errorf("Short object ID %s is ambiguous", prefix)
+	}
+	for sha := range found {
+		return sha, nil
+	}
+	return "", fmt.Errorf("Object not found. %s", prefix)
+}
+
+func objectPath(sha string) string {
+	return "objects/" + sha[:2] + "/" + sha[2:]
+}
@@ -0,0 +1,70 @@
+package git
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolveRevision(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	side := writeTestCommit(t, repo, "side", first)
+	merge := writeTestCommit(t, repo, "merge", second, side)
+	assert.NoError(t, UpdateRef(repo, "HEAD", merge, "test"))
+	assert.NoError(t, UpdateRef(repo, "refs/tags/v1", second, "test"))
+
+	commit, err := ReadCommit(repo, first)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		rev  string
+		want string
+	}{
+		{"HEAD", merge},
+		{"@", merge},
+		{"master", merge},
+		{"refs/heads/master", merge},
+		{"v1", second},
+		{merge, merge},
+		{side[:7], side},
+		{"HEAD^", second},
+		{"HEAD^2", side},
+		{"HEAD^0", merge},
+		{"HEAD~2", first},
+		{"HEAD^2~1", first},
+		{"master~1^{commit}", second},
+		{"HEAD~2^{tree}", commit.Tree},
+	}
+	for _, tt := range tests {
+		got, err := ResolveRevision(repo, tt.rev)
+		assert.NoError(t, err, tt.rev)
+		assert.Equal(t, tt.want, got, tt.rev)
+	}
+
+	for _, rev := range []string{"nothing", "HEAD~3", "HEAD^3", ""} {
+		_, err := ResolveRevision(repo, rev)
+		assert.Error(t, err, rev)
+	}
+}
+
+func TestIsAncestor(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	side := writeTestCommit(t, repo, "side", first)
+
+	ok, err := IsAncestor(repo, first, second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = IsAncestor(repo, second, second)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	ok, err = IsAncestor(repo, side, second)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+}
@@ -0,0 +1,151 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// RemoveOptions is options of RemoveFiles.
+type RemoveOptions struct {
+	// Cached removes only index entries, keeping files in worktree.
+	Cached bool
+	// Recursive allows a pathspec to match files under a directory.
+	Recursive bool
+	// Force skips the check of local modifications.
+	Force bool
+	// DryRun reports files to be removed without removing them.
+	DryRun bool
+	// IgnoreUnmatch does not fail when a pathspec matches no files.
+	IgnoreUnmatch bool
+}
+
+// RemoveFiles remove index entries matching pathspecs, and their files in worktree unless opts.Cached.
+// files whose contents would be lost are refused unless opts.Force. removed paths are returned.
+func RemoveFiles(repo *GitRepository, pathspecs []string, opts RemoveOptions) ([]string, error) {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+	removed := map[string]bool{}
+	for _, spec := range pathspecs {
+		matched := false
+		for _, e := range index.Entries {
+			if !matchPathspec(spec, e.FilePath) {
+				continue
+			}
+			matched = true
+			if !opts.Recursive && e.FilePath != strings.TrimSuffix(spec, "/") && !strings.ContainsAny(spec, "*?[") {
+				return nil, fmt.Errorf("not removing '%s' recursively without -r", strings.TrimSuffix(spec, "/"))
+			}
+			removed[e.FilePath] = true
+		}
+		if !matched && !opts.IgnoreUnmatch {
+			return nil, fmt.Errorf("pathspec '%s' did not match any files", spec)
+		}
+	}
+	var paths []string
+	for name := range removed {
+		paths = append(paths, name)
+	}
+	sort.Strings(paths)
+
+	if !opts.Force {
+		if err := checkRemoveFiles(repo, index, paths, opts.Cached); err != nil {
+			return nil, err
+		}
+	}
+	if opts.DryRun {
+		return paths, nil
+	}
+
+	kept := &GitIndex{}
+	for _, e := range index.Entries {
+		if !removed[e.FilePath] {
+			kept.Entries = append(kept.Entries, e)
+		}
+	}
+	if err := WriteIndex(repo, kept); err != nil {
+		return nil, err
+	}
+	if !opts.Cached {
+		for _, name := range paths {
+			file := worktreeFile(repo, name)
+			if err := os.RemoveAll(file); err != nil {
+				return nil, err
+			}
+			removeEmptyDirs(filepath.Dir(file), repo.Worktree)
+		}
+	}
+	return paths, nil
+}
+
+// checkRemoveFiles return an error if removing the files loses contents which are neither in HEAD nor in worktree.
+// without cached, local modifications in worktree are refused too.
+func checkRemoveFiles(repo *GitRepository, index *GitIndex, paths []string, cached bool) error {
+	headTree := ""
+	if head, err := ResolveRef(repo, "HEAD"); err == nil {
+		if headTree, err = CommitTree(repo, head); err != nil {
+			return err
+		}
+	}
+	heads, err := treeFileMap(repo, headTree)
+	if err != nil {
+		return err
+	}
+	var both, staged, local []string
+	for _, name := range paths {
+		e := index.Entry(name)
+		if e == nil {
+			// unmerged entries are removed without checks
+			continue
+		}
+		h := heads[name]
+		isStaged := h == nil || h.Sha != e.ObjectID || canonicalMode(h.Mode) != canonicalMode(e.Mode)
+		isLocal := false
+		if _, err := os.Lstat(worktreeFile(repo, name)); err == nil {
+			if isLocal, err = IsEntryModified(repo, e); err != nil {
+				return err
+			}
+		}
+		switch {
+		case isStaged && isLocal:
+			both = append(both, name)
+		case cached:
+		case isStaged:
+			staged = append(staged, name)
+		case isLocal:
+			local = append(local, name)
+		}
+	}
+	var msgs []string
+	if len(both) > 0 {
+		msgs = append(msgs, removeFilesError(both, "has staged content different from both the\nfile and the HEAD", "have staged content different\nfrom both the file and the HEAD", "use -f to force removal"))
+	}
+	if len(staged) > 0 {
+		msgs = append(msgs, removeFilesError(staged, "has changes staged in the index", "have changes staged in the index", "use --cached to keep the file, or -f to force removal"))
+	}
+	if len(local) > 0 {
+		msgs = append(msgs, removeFilesError(local, "has local modifications", "have local modifications", "use --cached to keep the file, or -f to force removal"))
+	}
+	if len(msgs) > 0 {
+		return fmt.Errorf("%s", strings.Join(msgs, "\n"))
+	}
+	return nil
+}
+
+func removeFilesError(paths []string, single, plural, hint string) string {
+	var b strings.Builder
+	if len(paths) == 1 {
+		fmt.Fprintf(&b, "the following file %s:\n", single)
+	} else {
+		fmt.Fprintf(&b, "the following files %s:\n", plural)
+	}
+	for _, name := range paths {
+		fmt.Fprintf(&b, "    %s\n", name)
+	}
+	fmt.Fprintf(&b, "(%s)", hint)
+	return b.String()
+}
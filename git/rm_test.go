@@ -0,0 +1,46 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRemoveFiles(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	commitTestFiles(t, repo, "first", map[string]string{"a": "a\n", "b": "b\n", "d/c": "c\n", "d/e": "e\n"})
+
+	_, err := RemoveFiles(repo, []string{"d"}, RemoveOptions{})
+	assert.EqualError(t, err, "not removing 'd' recursively without -r")
+	_, err = RemoveFiles(repo, []string{"nothing"}, RemoveOptions{})
+	assert.EqualError(t, err, "pathspec 'nothing' did not match any files")
+
+	// local modifications are refused unless forced or cached
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "a"), []byte("local\n"), 0644))
+	_, err = RemoveFiles(repo, []string{"a"}, RemoveOptions{})
+	assert.EqualError(t, err, "the following file has local modifications:\n    a\n(use --cached to keep the file, or -f to force removal)")
+	removed, err := RemoveFiles(repo, []string{"a"}, RemoveOptions{Cached: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"a"}, removed)
+	assert.FileExists(t, filepath.Join(repo.Worktree, "a"))
+
+	removed, err = RemoveFiles(repo, []string{"d"}, RemoveOptions{Recursive: true, DryRun: true})
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"d/c", "d/e"}, removed)
+	assert.FileExists(t, filepath.Join(repo.Worktree, "d", "c"))
+	_, err = RemoveFiles(repo, []string{"d"}, RemoveOptions{Recursive: true})
+	assert.NoError(t, err)
+	_, err = os.Stat(filepath.Join(repo.Worktree, "d"))
+	assert.True(t, os.IsNotExist(err))
+
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(index.Entries))
+	assert.Equal(t, "b", index.Entries[0].FilePath)
+}
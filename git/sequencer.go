@@ -0,0 +1,538 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// sequencerDir is the directory which keeps the state of cherry-pick and revert across processes.
+const sequencerDir = "sequencer"
+
+// ErrNoSequencer is returned when --continue, --skip or --abort is run without cherry-pick or revert in progress.
+var ErrNoSequencer = errors.New("no cherry-pick or revert in progress")
+
+// SequencerOptions is options of cherry-pick and revert.
+// NoCommit applies changes to the index and worktree without committing,
+// RecordOrigin appends "(cherry picked from commit ...)" to messages,
+// and Mainline is the parent number which merge commits are compared with.
+type SequencerOptions struct {
+	Revert       bool
+	NoCommit     bool
+	RecordOrigin bool
+	Mainline     int
+}
+
+func (o SequencerOptions) action() string {
+	if o.Revert {
+		return "revert"
+	}
+	return "cherry-pick"
+}
+
+func sequencerPath(repo *GitRepository, name string) string {
+	return repo.RepoPath(filepath.Join(sequencerDir, name))
+}
+
+// InSequencer return true if a cherry-pick or revert is in progress.
+func InSequencer(repo *GitRepository) bool {
+	info, err := os.Stat(repo.RepoPath(sequencerDir))
+	return err == nil && info.IsDir()
+}
+
+// SequencerCommits return commits given by revisions or "A..B" ranges in the order they are applied.
+// ranges are picked from older commits, and reverted from newer ones.
+func SequencerCommits(repo *GitRepository, revs []string, revert bool) ([]string, error) {
+	var commits []string
+	for _, rev := range revs {
+		if i := strings.Index(rev, ".."); i >= 0 {
+			from, to := rev[:i], rev[i+2:]
+			if from == "" {
+				from = "HEAD"
+			}
+			if to == "" {
+				to = "HEAD"
+			}
+			base, err := ResolveCommit(repo, from)
+			if err != nil {
+				return nil, fmt.Errorf("bad revision '%s'", rev)
+			}
+			tip, err := ResolveCommit(repo, to)
+			if err != nil {
+				return nil, fmt.Errorf("bad revision '%s'", rev)
+			}
+			shas, err := commitsBetween(repo, base, tip)
+			if err != nil {
+				return nil, err
+			}
+			if revert {
+				for l, r := 0, len(shas)-1; l < r; l, r = l+1, r-1 {
+					shas[l], shas[r] = shas[r], shas[l]
+				}
+			}
+			commits = append(commits, shas...)
+			continue
+		}
+		sha, err := ResolveCommit(repo, rev)
+		if err != nil {
+			return nil, fmt.Errorf("bad revision '%s'", rev)
+		}
+		commits = append(commits, sha)
+	}
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("empty commit set passed")
+	}
+	return commits, nil
+}
+
+// StartSequencer cherry-pick or revert commits on HEAD one by one. messages are written to out.
+// if a commit conflicts, the state is kept in .git/sequencer and an error is returned.
+// the operation is resumed by ContinueSequencer or SkipSequencer, or cancelled by AbortSequencer.
+func StartSequencer(repo *GitRepository, out io.Writer, commits []string, opts SequencerOptions) error {
+	if repo.Bare {
+		return fmt.Errorf("Cannot %s in bare repository", opts.action())
+	}
+	if InSequencer(repo) {
+		return fmt.Errorf("a cherry-pick or revert is already in progress\n"+
+			"try \"mygit %s (--continue | --skip | --abort)\"", opts.action())
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	if !opts.NoCommit {
+		if err := checkCleanIndex(repo, head, opts.action()); err != nil {
+			return err
+		}
+	}
+	var steps []*RebaseStep
+	for _, sha := range commits {
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return err
+		}
+		if _, err := sequencerParent(sha, commit, opts.Mainline); err != nil {
+			return err
+		}
+		command := "pick"
+		if opts.Revert {
+			command = "revert"
+		}
+		steps = append(steps, &RebaseStep{Command: command, Commit: sha, Arg: commit.Subject()})
+	}
+	if err := os.MkdirAll(repo.RepoPath(sequencerDir), repoDirPerm()); err != nil {
+		return err
+	}
+	if err := ioutil.WriteFile(sequencerPath(repo, "head"), []byte(head+"\n"), 0644); err != nil {
+		return err
+	}
+	if err := writeSequencerOptions(repo, opts); err != nil {
+		return err
+	}
+	if err := writeSequencerTodo(repo, steps); err != nil {
+		return err
+	}
+	return runSequencer(repo, out, opts)
+}
+
+// checkCleanIndex return an error if the index has changes from the commit.
+func checkCleanIndex(repo *GitRepository, head, action string) error {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	if len(index.Conflicts()) == 0 {
+		tree, err := WriteIndexTree(repo, index)
+		if err != nil {
+			return err
+		}
+		headTree, err := CommitTree(repo, head)
+		if err != nil {
+			return err
+		}
+		if tree == headTree {
+			return nil
+		}
+	}
+	return fmt.Errorf("your local changes would be overwritten by %s.\ncommit your changes or stash them to proceed.", action)
+}
+
+func writeSequencerOptions(repo *GitRepository, opts SequencerOptions) error {
+	var b strings.Builder
+	b.WriteString("[options]\n")
+	if opts.NoCommit {
+		b.WriteString("\tno-commit = true\n")
+	}
+	if opts.RecordOrigin {
+		b.WriteString("\trecord-origin = true\n")
+	}
+	if opts.Mainline > 0 {
+		fmt.Fprintf(&b, "\tmainline = %d\n", opts.Mainline)
+	}
+	return ioutil.WriteFile(sequencerPath(repo, "opts"), []byte(b.String()), 0644)
+}
+
+func readSequencerOptions(repo *GitRepository) (SequencerOptions, error) {
+	opts := SequencerOptions{}
+	cfg, err := LoadConfigFile(repo, sequencerPath(repo, "opts"), ScopeLocal)
+	if err != nil {
+		return opts, err
+	}
+	if opts.NoCommit, err = cfg.GetBool("options.no-commit", false); err != nil {
+		return opts, err
+	}
+	if opts.RecordOrigin, err = cfg.GetBool("options.record-origin", false); err != nil {
+		return opts, err
+	}
+	mainline, err := cfg.GetInt("options.mainline", 0)
+	opts.Mainline = int(mainline)
+	return opts, err
+}
+
+// readSequencerTodo return the remaining steps. the first one is the current step.
+func readSequencerTodo(repo *GitRepository) ([]*RebaseStep, error) {
+	data, err := ioutil.ReadFile(sequencerPath(repo, "todo"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	var steps []*RebaseStep
+	for i, line := range strings.Split(string(data), "\n") {
+		fields := strings.SplitN(strings.TrimSpace(line), " ", 3)
+		if fields[0] == "" || strings.HasPrefix(fields[0], "#") {
+			continue
+		}
+		if len(fields) < 2 || fields[0] != "pick" && fields[0] != "revert" || !isHexSha(fields[1]) {
+			return nil, fmt.Errorf("invalid line %d: %s", i+1, line)
+		}
+		step := &RebaseStep{Command: fields[0], Commit: fields[1]}
+		if len(fields) == 3 {
+			step.Arg = fields[2]
+		}
+		steps = append(steps, step)
+	}
+	return steps, nil
+}
+
+func writeSequencerTodo(repo *GitRepository, steps []*RebaseStep) error {
+	return ioutil.WriteFile(sequencerPath(repo, "todo"), []byte(formatRebaseTodo(steps, false)), 0644)
+}
+
+// runSequencer apply steps in the todo list until it is empty or a step conflicts.
+func runSequencer(repo *GitRepository, out io.Writer, opts SequencerOptions) error {
+	for {
+		steps, err := readSequencerTodo(repo)
+		if err != nil {
+			return err
+		}
+		if len(steps) == 0 {
+			return os.RemoveAll(repo.RepoPath(sequencerDir))
+		}
+		if err := applySequencerStep(repo, out, steps[0], opts); err != nil {
+			return err
+		}
+		if err := writeSequencerTodo(repo, steps[1:]); err != nil {
+			return err
+		}
+	}
+}
+
+// applySequencerStep cherry-pick or revert the commit of the step, and commit the result unless NoCommit.
+func applySequencerStep(repo *GitRepository, out io.Writer, step *RebaseStep, opts SequencerOptions) error {
+	commit, err := ReadCommit(repo, step.Commit)
+	if err != nil {
+		return err
+	}
+	parent, err := sequencerParent(step.Commit, commit, opts.Mainline)
+	if err != nil {
+		return err
+	}
+	parentTree, err := CommitTree(repo, parent)
+	if err != nil {
+		return err
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return err
+	}
+	if len(index.Conflicts()) > 0 {
+		return fmt.Errorf("%s is not possible because you have unmerged files.", stepAction(step))
+	}
+	oursTree, err := WriteIndexTree(repo, index)
+	if err != nil {
+		return err
+	}
+
+	label := fmt.Sprintf("%s (%s)", shortSha(step.Commit), commit.Subject())
+	message := commit.Message
+	var result *MergeResult
+	if step.Command == "revert" {
+		message = fmt.Sprintf("Revert \"%s\"\n\nThis reverts commit %s", commit.Subject(), step.Commit)
+		if len(commit.Parents) > 1 {
+			message += fmt.Sprintf(", reversing\nchanges made to %s", parent)
+		}
+		message += ".\n"
+		result, err = applyMerge(repo, commit.Tree, oursTree, parentTree, MergeOptions{
+			OursLabel:   "HEAD",
+			BaseLabel:   label,
+			TheirsLabel: "parent of " + label,
+		})
+	} else {
+		if opts.RecordOrigin {
+			message = strings.TrimRight(message, "\n") + "\n\n(cherry picked from commit " + step.Commit + ")\n"
+		}
+		result, err = applyMerge(repo, parentTree, oursTree, commit.Tree, MergeOptions{
+			OursLabel:   "HEAD",
+			BaseLabel:   "parent of " + label,
+			TheirsLabel: label,
+		})
+	}
+	if err != nil {
+		return err
+	}
+	for _, m := range result.Messages {
+		fmt.Fprintln(out, m)
+	}
+
+	if !result.Clean() {
+		merge := message + "\n# Conflicts:\n"
+		for _, name := range result.Index.Conflicts() {
+			merge += "#\t" + name + "\n"
+		}
+		if err := ioutil.WriteFile(repo.RepoPath("MERGE_MSG"), []byte(merge), 0644); err != nil {
+			return err
+		}
+		if !opts.NoCommit {
+			if err := writeRefFile(repo, sequencerHeadRef(step), []byte(step.Commit+"\n")); err != nil {
+				return err
+			}
+		}
+		verb := "apply"
+		if step.Command == "revert" {
+			verb = "revert"
+		}
+		return fmt.Errorf("could not %s %s... %s\n"+
+			"after resolving the conflicts, mark the corrected paths\n"+
+			"with 'mygit add <paths>' and run 'mygit %s --continue'",
+			verb, shortSha(step.Commit), commit.Subject(), stepAction(step))
+	}
+	if opts.NoCommit {
+		return nil
+	}
+	tree, err := WriteIndexTree(repo, result.Index)
+	if err != nil {
+		return err
+	}
+	return commitSequencerStep(repo, out, step, commit, tree, message)
+}
+
+// stepAction return the name of the command which runs the step.
+func stepAction(step *RebaseStep) string {
+	if step.Command == "revert" {
+		return "revert"
+	}
+	return "cherry-pick"
+}
+
+// sequencerParent return the parent which changes of the commit are compared with.
+// merge commits need the mainline parent number.
+func sequencerParent(sha string, commit *GitCommit, mainline int) (string, error) {
+	switch {
+	case len(commit.Parents) > 1 && mainline == 0:
+		return "", fmt.Errorf("commit %s is a merge but no -m option was given.", sha)
+	case len(commit.Parents) > 1 && mainline > len(commit.Parents):
+		return "", fmt.Errorf("commit %s does not have parent %d", sha, mainline)
+	case len(commit.Parents) > 1:
+		return commit.Parents[mainline-1], nil
+	case mainline > 0:
+		return "", fmt.Errorf("mainline was specified but commit %s is not a merge.", sha)
+	case len(commit.Parents) == 1:
+		return commit.Parents[0], nil
+	}
+	return "", nil
+}
+
+// sequencerHeadRef return the name of the ref which points the commit being applied during conflicts.
+func sequencerHeadRef(step *RebaseStep) string {
+	if step.Command == "revert" {
+		return "REVERT_HEAD"
+	}
+	return "CHERRY_PICK_HEAD"
+}
+
+// commitSequencerStep commit tree on HEAD. cherry-picked commits keep their authors.
+func commitSequencerStep(repo *GitRepository, out io.Writer, step *RebaseStep, commit *GitCommit, tree, message string) error {
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	headTree, err := CommitTree(repo, head)
+	if err != nil {
+		return err
+	}
+	action := stepAction(step)
+	if tree == headTree {
+		return fmt.Errorf("The previous %s is now empty, possibly due to conflict resolution.\n"+
+			"use 'mygit %s --skip' to skip this commit.", action, action)
+	}
+	author := commit.Author
+	if step.Command == "revert" {
+		if author, err = AuthorIdent(repo); err != nil {
+			return err
+		}
+	}
+	sha, err := NewCommitAs(repo, tree, []string{head}, author, message)
+	if err != nil {
+		return err
+	}
+	subject := strings.SplitN(message, "\n", 2)[0]
+	if err := UpdateRef(repo, "HEAD", sha, action+": "+subject); err != nil {
+		return err
+	}
+	if err := removeSequencerMergeState(repo); err != nil {
+		return err
+	}
+	return WriteCommitSummary(repo, out, sha, step.Command == "pick")
+}
+
+// removeSequencerMergeState remove files which describe the conflicted step.
+func removeSequencerMergeState(repo *GitRepository) error {
+	for _, name := range []string{"CHERRY_PICK_HEAD", "REVERT_HEAD", "MERGE_MSG"} {
+		if err := os.Remove(repo.RepoPath(name)); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+	return nil
+}
+
+// ContinueSequencer commit the resolved conflicts of the current step with the message in MERGE_MSG,
+// and apply the remaining steps.
+func ContinueSequencer(repo *GitRepository, out io.Writer) error {
+	if !InSequencer(repo) {
+		return ErrNoSequencer
+	}
+	opts, err := readSequencerOptions(repo)
+	if err != nil {
+		return err
+	}
+	steps, err := readSequencerTodo(repo)
+	if err != nil {
+		return err
+	}
+	if len(steps) > 0 {
+		step := steps[0]
+		index, err := ReadIndexOrEmpty(repo)
+		if err != nil {
+			return err
+		}
+		if len(index.Conflicts()) > 0 {
+			return fmt.Errorf("Committing is not possible because you have unmerged files.\n" +
+				"Fix them up in the work tree, and then use 'mygit add <file>' as appropriate to mark resolution.")
+		}
+		if _, err := ResolveRef(repo, sequencerHeadRef(step)); err == nil {
+			tree, err := WriteIndexTree(repo, index)
+			if err != nil {
+				return err
+			}
+			commit, err := ReadCommit(repo, step.Commit)
+			if err != nil {
+				return err
+			}
+			data, err := ioutil.ReadFile(repo.RepoPath("MERGE_MSG"))
+			if err != nil {
+				return err
+			}
+			message := CleanupMessage(string(data), true)
+			if message == "" {
+				return fmt.Errorf("Aborting commit due to empty commit message.")
+			}
+			if err := commitSequencerStep(repo, out, step, commit, tree, message); err != nil {
+				return err
+			}
+		} else if err := removeSequencerMergeState(repo); err != nil {
+			return err
+		}
+		if err := writeSequencerTodo(repo, steps[1:]); err != nil {
+			return err
+		}
+	}
+	return runSequencer(repo, out, opts)
+}
+
+// SkipSequencer discard the changes of the current step, and apply the remaining steps.
+func SkipSequencer(repo *GitRepository, out io.Writer) error {
+	if !InSequencer(repo) {
+		return ErrNoSequencer
+	}
+	opts, err := readSequencerOptions(repo)
+	if err != nil {
+		return err
+	}
+	steps, err := readSequencerTodo(repo)
+	if err != nil {
+		return err
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return err
+	}
+	if err := resetHard(repo, head); err != nil {
+		return err
+	}
+	if err := removeSequencerMergeState(repo); err != nil {
+		return err
+	}
+	if len(steps) > 0 {
+		if err := writeSequencerTodo(repo, steps[1:]); err != nil {
+			return err
+		}
+	}
+	return runSequencer(repo, out, opts)
+}
+
+// AbortSequencer restore HEAD, the index and worktree to the state before the cherry-pick or revert.
+func AbortSequencer(repo *GitRepository) error {
+	if !InSequencer(repo) {
+		return ErrNoSequencer
+	}
+	data, err := ioutil.ReadFile(sequencerPath(repo, "head"))
+	if err != nil {
+		return err
+	}
+	orig := strings.TrimSpace(string(data))
+	if err := resetHard(repo, orig); err != nil {
+		return err
+	}
+	if head, _ := ResolveRef(repo, "HEAD"); head != orig {
+		if err := UpdateRef(repo, "HEAD", orig, "reset: moving to "+orig); err != nil {
+			return err
+		}
+	}
+	if err := removeSequencerMergeState(repo); err != nil {
+		return err
+	}
+	return os.RemoveAll(repo.RepoPath(sequencerDir))
+}
+
+// applyMerge merge changes from base to theirs into ours, and update the index and worktree with the result.
+// conflicted files are written with conflict markers.
+func applyMerge(repo *GitRepository, base, ours, theirs string, opts MergeOptions) (*MergeResult, error) {
+	result, err := MergeTrees(repo, base, ours, theirs, opts)
+	if err != nil {
+		return nil, err
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckWorktreeOverwrite(repo, index, result.Index, "merge"); err != nil {
+		return nil, err
+	}
+	if err := CheckoutIndex(repo, index, result.Index, CheckoutOptions{Contents: result.Contents}); err != nil {
+		return nil, err
+	}
+	return result, nil
+}
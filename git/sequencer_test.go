@@ -0,0 +1,116 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCherryPick(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	base := commitTestFiles(t, repo, "base", map[string]string{"a": "a\n"})
+	assert.NoError(t, CreateBranch(repo, "topic", base, base, false))
+	assert.NoError(t, switchBranch(repo, "topic"))
+	one := commitTestFiles(t, repo, "one", map[string]string{"a": "a\n", "b": "b\n"})
+	commitTestFiles(t, repo, "two", map[string]string{"a": "a\n", "b": "b\n", "c": "c\n"})
+	assert.NoError(t, switchBranch(repo, "master"))
+
+	commits, err := SequencerCommits(repo, []string{"master..topic"}, false)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(commits))
+	assert.Equal(t, one, commits[0])
+	reverted, err := SequencerCommits(repo, []string{"master..topic"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{commits[1], commits[0]}, reverted)
+
+	var out bytes.Buffer
+	assert.NoError(t, StartSequencer(repo, &out, commits, SequencerOptions{RecordOrigin: true}))
+	assert.Contains(t, out.String(), "] one\n")
+	assert.False(t, InSequencer(repo))
+	head, _ := ResolveRef(repo, "HEAD")
+	commit, err := ReadCommit(repo, head)
+	assert.NoError(t, err)
+	assert.Equal(t, "two\n\n(cherry picked from commit "+commits[1]+")\n", commit.Message)
+	assert.FileExists(t, filepath.Join(repo.Worktree, "c"))
+
+	out.Reset()
+	assert.NoError(t, StartSequencer(repo, &out, []string{head}, SequencerOptions{Revert: true}))
+	head, _ = ResolveRef(repo, "HEAD")
+	commit, err = ReadCommit(repo, head)
+	assert.NoError(t, err)
+	assert.Equal(t, "Revert \"two\"\n\nThis reverts commit "+commit.Parents[0]+".\n", commit.Message)
+	_, err = os.Stat(filepath.Join(repo.Worktree, "c"))
+	assert.True(t, os.IsNotExist(err))
+
+	// a merge commit needs the mainline
+	merge, err := NewCommit(repo, commit.Tree, []string{base, head}, "merge\n")
+	assert.NoError(t, err)
+	assert.EqualError(t, StartSequencer(repo, &out, []string{merge}, SequencerOptions{}),
+		"commit "+merge+" is a merge but no -m option was given.")
+	assert.False(t, InSequencer(repo))
+	assert.Equal(t, ErrNoSequencer, AbortSequencer(repo))
+	assert.NoError(t, StartSequencer(repo, &out, []string{merge}, SequencerOptions{Revert: true, NoCommit: true, Mainline: 1}))
+	index, err := ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.Nil(t, index.Entry("b"))
+	assert.NotNil(t, index.Entry("a"))
+	after, _ := ResolveRef(repo, "HEAD")
+	assert.Equal(t, head, after)
+}
+
+func TestCherryPickConflict(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	base := commitTestFiles(t, repo, "base", map[string]string{"a": "a\n"})
+	assert.NoError(t, CreateBranch(repo, "topic", base, base, false))
+	assert.NoError(t, switchBranch(repo, "topic"))
+	topic := commitTestFiles(t, repo, "topic", map[string]string{"a": "topic\n"})
+	assert.NoError(t, switchBranch(repo, "master"))
+	orig := commitTestFiles(t, repo, "master", map[string]string{"a": "master\n"})
+
+	var out bytes.Buffer
+	err := StartSequencer(repo, &out, []string{topic}, SequencerOptions{})
+	assert.Error(t, err)
+	assert.True(t, InSequencer(repo))
+	pickHead, err := ResolveRef(repo, "CHERRY_PICK_HEAD")
+	assert.NoError(t, err)
+	assert.Equal(t, topic, pickHead)
+	msg, err := ioutil.ReadFile(repo.RepoPath("MERGE_MSG"))
+	assert.NoError(t, err)
+	assert.Equal(t, "topic\n\n# Conflicts:\n#\ta\n", string(msg))
+	assert.Error(t, ContinueSequencer(repo, &out))
+
+	// abort restores the state before cherry-pick
+	assert.NoError(t, AbortSequencer(repo))
+	assert.False(t, InSequencer(repo))
+	data, err := ioutil.ReadFile(filepath.Join(repo.Worktree, "a"))
+	assert.NoError(t, err)
+	assert.Equal(t, "master\n", string(data))
+	_, err = ResolveRef(repo, "CHERRY_PICK_HEAD")
+	assert.Error(t, err)
+
+	// resolve and continue
+	assert.Error(t, StartSequencer(repo, &out, []string{topic}, SequencerOptions{}))
+	assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, "a"), []byte("resolved\n"), 0644))
+	sha, err := WriteObject(repo, NewGitBlob([]byte("resolved\n")))
+	assert.NoError(t, err)
+	info, err := os.Stat(filepath.Join(repo.Worktree, "a"))
+	assert.NoError(t, err)
+	assert.NoError(t, WriteIndex(repo, &GitIndex{Entries: []*IndexEntry{NewIndexEntry(info, "a", sha)}}))
+	assert.NoError(t, ContinueSequencer(repo, &out))
+	assert.False(t, InSequencer(repo))
+	head, _ := ResolveRef(repo, "HEAD")
+	commit, err := ReadCommit(repo, head)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{orig}, commit.Parents)
+	assert.Equal(t, "topic\n", commit.Message)
+}
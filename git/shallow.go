@@ -0,0 +1,207 @@
+package git
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"sort"
+	"strings"
+)
+
+// infiniteDepth is the depth which client sends to unshallow the repository.
+const infiniteDepth = 2147483647
+
+// ReadShallow return commits recorded in .git/shallow. their parents do not exist in the repository.
+func ReadShallow(repo *GitRepository) ([]string, error) {
+	data, err := ioutil.ReadFile(repo.RepoPath("shallow"))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var shas []string
+	for _, line := range strings.Split(string(data), "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			shas = append(shas, line)
+		}
+	}
+	return shas, nil
+}
+
+// WriteShallow write .git/shallow. the file is removed if shas is empty.
+func WriteShallow(repo *GitRepository, shas []string) error {
+	repo.shallow = nil
+	if len(shas) == 0 {
+		if err := os.Remove(repo.RepoPath("shallow")); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	sorted := append([]string(nil), shas...)
+	sort.Strings(sorted)
+	var b bytes.Buffer
+	for _, sha := range sorted {
+		b.WriteString(sha + "\n")
+	}
+	return writeLockedFile(repo.RepoPath("shallow"), b.Bytes())
+}
+
+// IsShallowRepository return true if history of the repository is truncated.
+func IsShallowRepository(repo *GitRepository) bool {
+	_, err := os.Stat(repo.RepoPath("shallow"))
+	return err == nil
+}
+
+// isShallowCommit return true if sha is recorded in .git/shallow. the file is read once per repository.
+func isShallowCommit(repo *GitRepository, sha string) bool {
+	if repo.shallow == nil {
+		repo.shallow = map[string]bool{}
+		shas, _ := ReadShallow(repo)
+		for _, s := range shas {
+			repo.shallow[s] = true
+		}
+	}
+	return repo.shallow[sha]
+}
+
+// updateShallow add new shallow commits and remove unshallowed commits in .git/shallow.
+func updateShallow(repo *GitRepository, info ShallowInfo) error {
+	if len(info.Shallow) == 0 && len(info.Unshallow) == 0 {
+		return nil
+	}
+	current, err := ReadShallow(repo)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	for _, sha := range append(current, info.Shallow...) {
+		set[sha] = true
+	}
+	for _, sha := range info.Unshallow {
+		delete(set, sha)
+	}
+	var shas []string
+	for sha := range set {
+		shas = append(shas, sha)
+	}
+	return WriteShallow(repo, shas)
+}
+
+// shallowRequest is a request of upload-pack to make history of the client shallow.
+// clientShallow are shallow commits of the client.
+type shallowRequest struct {
+	clientShallow []string
+	depth         int
+	since         int64
+	not           []string
+}
+
+func (s *shallowRequest) deepen() bool {
+	return s.depth > 0 || s.since > 0 || len(s.not) > 0
+}
+
+// computeShallow return new shallow boundary of the client which fetches wants.
+// commits within depth from wants, not older than since and not reachable from not are sent,
+// and commits whose parents are not sent become shallow.
+// client's shallow commits whose parents will be sent are returned as unshallow.
+// boundary is the set of commits whose parents are not sent.
+func computeShallow(repo *GitRepository, wants []string, req *shallowRequest) (info *ShallowInfo, boundary map[string]bool, err error) {
+	excluded := map[string]bool{}
+	for _, name := range req.not {
+		full, ok := DwimRef(repo, name)
+		if !ok {
+			continue
+		}
+		sha, err := ResolveRef(repo, full)
+		if err != nil {
+			continue
+		}
+		if err := markCommits(repo, sha, excluded); err != nil {
+			return nil, nil, err
+		}
+	}
+	clientShallow := map[string]bool{}
+	for _, sha := range req.clientShallow {
+		clientShallow[sha] = true
+	}
+
+	info, boundary = &ShallowInfo{}, map[string]bool{}
+	depth := map[string]int{}
+	var queue []string
+	for _, want := range wants {
+		if objType, _, err := ReadObjectData(repo, want); err != nil || objType != "commit" {
+			continue
+		}
+		if _, ok := depth[want]; !ok {
+			depth[want] = 1
+			queue = append(queue, want)
+		}
+	}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return nil, nil, err
+		}
+		if len(commit.Parents) == 0 {
+			continue
+		}
+		shallow := req.depth > 0 && depth[sha] >= req.depth
+		for _, parent := range commit.Parents {
+			if excluded[parent] || (req.since > 0 && commitTime(repo, parent) < req.since) {
+				shallow = true
+			}
+		}
+		if shallow {
+			boundary[sha] = true
+			if !clientShallow[sha] {
+				info.Shallow = append(info.Shallow, sha)
+			}
+			continue
+		}
+		if clientShallow[sha] {
+			info.Unshallow = append(info.Unshallow, sha)
+		}
+		for _, parent := range commit.Parents {
+			if _, ok := depth[parent]; !ok {
+				depth[parent] = depth[sha] + 1
+				queue = append(queue, parent)
+			}
+		}
+	}
+	return info, boundary, nil
+}
+
+// markCommits add commits reachable from sha to set.
+func markCommits(repo *GitRepository, sha string, set map[string]bool) error {
+	queue := []string{sha}
+	for len(queue) > 0 {
+		sha := queue[0]
+		queue = queue[1:]
+		if set[sha] {
+			continue
+		}
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return err
+		}
+		set[sha] = true
+		queue = append(queue, commit.Parents...)
+	}
+	return nil
+}
+
+// commitTime return committer time of the commit in unix time, or 0 if unknown.
+func commitTime(repo *GitRepository, sha string) int64 {
+	commit, err := ReadCommit(repo, sha)
+	if err != nil {
+		return 0
+	}
+	t, err := commit.Committer.When()
+	if err != nil {
+		return 0
+	}
+	return t.Unix()
+}
@@ -0,0 +1,156 @@
+package git
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShallowClone(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	var parents []string
+	for i := 0; i < 5; i++ {
+		parents = []string{writeTestCommit(t, src, fmt.Sprint(i), parents...)}
+	}
+	tip := parents[0]
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", tip, ""))
+
+	for _, version := range []int{0, 2} {
+		t.Run(fmt.Sprintf("version %d", version), func(t *testing.T) {
+			dir := filepath.Join(newTempDir(t), "clone")
+			defer os.RemoveAll(filepath.Dir(dir))
+			repo, err := Clone(src.Worktree, dir, CloneOptions{ShallowOptions: ShallowOptions{Depth: 2}})
+			assert.NoError(t, err)
+			if err != nil {
+				return
+			}
+			cfg, err := ReadConfig(repo)
+			assert.NoError(t, err)
+			cfg.Set("protocol", "", "version", fmt.Sprint(version))
+			assert.NoError(t, WriteConfig(repo, cfg))
+
+			tipCommit, err := ReadCommit(repo, tip)
+			assert.NoError(t, err)
+			parent := tipCommit.Parents[0]
+			shallow, err := ReadShallow(repo)
+			assert.NoError(t, err)
+			assert.Equal(t, []string{parent}, shallow)
+			commit, err := ReadCommit(repo, parent)
+			assert.NoError(t, err)
+			assert.Empty(t, commit.Parents)
+
+			// deepen by one commit
+			_, err = Fetch(repo, "origin", FetchOptions{ShallowOptions: ShallowOptions{Depth: 3}})
+			assert.NoError(t, err)
+			shallow, _ = ReadShallow(repo)
+			assert.Equal(t, 1, len(shallow))
+			assert.NotEqual(t, parent, shallow[0])
+			assert.True(t, HasObject(repo, shallow[0]))
+
+			_, err = Fetch(repo, "origin", FetchOptions{Unshallow: true})
+			assert.NoError(t, err)
+			assert.False(t, IsShallowRepository(repo))
+			_, err = Fetch(repo, "origin", FetchOptions{Unshallow: true})
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestShallowSince(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	tree, err := WriteObject(src, &GitTree{})
+	assert.NoError(t, err)
+	var parents []string
+	for i := 1; i <= 3; i++ {
+		user := GitUser{Name: "mygit", Email: "mygit@example.com", Time: fmt.Sprintf("%d +0000", i*1000)}
+		sha, err := WriteObject(src, &GitCommit{Tree: tree, Parents: parents, Author: user, Committer: user, Message: "commit\n"})
+		assert.NoError(t, err)
+		parents = []string{sha}
+	}
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", parents[0], ""))
+
+	dir := filepath.Join(newTempDir(t), "clone")
+	defer os.RemoveAll(filepath.Dir(dir))
+	repo, err := Clone(src.Worktree, dir, CloneOptions{ShallowOptions: ShallowOptions{ShallowSince: time.Unix(1500, 0)}})
+	assert.NoError(t, err)
+	count := 0
+	for sha := parents[0]; sha != ""; count++ {
+		commit, err := ReadCommit(repo, sha)
+		assert.NoError(t, err)
+		sha = ""
+		if len(commit.Parents) > 0 {
+			sha = commit.Parents[0]
+		}
+	}
+	assert.Equal(t, 2, count)
+}
+
+func TestPartialClone(t *testing.T) {
+	src := newTestRepo(t)
+	defer os.RemoveAll(src.Worktree)
+	oldBlob, err := WriteObject(src, &GitBlob{Data: []byte("old\n")})
+	assert.NoError(t, err)
+	newBlob, err := WriteObject(src, &GitBlob{Data: []byte("new\n")})
+	assert.NoError(t, err)
+	user := GitUser{Name: "mygit", Email: "mygit@example.com", Time: "1600000000 +0000"}
+	var parents []string
+	for _, blob := range []string{oldBlob, newBlob} {
+		tree, err := WriteObject(src, &GitTree{Entries: []*GitTreeEntry{{Mode: ModeBlob, Path: "file.txt", Sha: blob}}})
+		assert.NoError(t, err)
+		sha, err := WriteObject(src, &GitCommit{Tree: tree, Parents: parents, Author: user, Committer: user, Message: "commit\n"})
+		assert.NoError(t, err)
+		parents = []string{sha}
+	}
+	assert.NoError(t, UpdateRef(src, "refs/heads/master", parents[0], ""))
+
+	dir := filepath.Join(newTempDir(t), "clone")
+	defer os.RemoveAll(filepath.Dir(dir))
+	cfg, err := ReadConfig(src)
+	assert.NoError(t, err)
+	cfg.Set("uploadpack", "", "allowFilter", "true")
+	// missing blobs are fetched by their hashes
+	cfg.Set("uploadpack", "", "allowAnySHA1InWant", "true")
+	assert.NoError(t, WriteConfig(src, cfg))
+	repo, err := Clone(src.Worktree, dir, CloneOptions{Filter: "blob:none"})
+	assert.NoError(t, err)
+	if err != nil {
+		return
+	}
+	assert.True(t, IsPartialClone(repo))
+	// blobs of HEAD are fetched for checkout
+	assert.True(t, HasObject(repo, newBlob))
+	assert.False(t, HasObject(repo, oldBlob))
+	_, data, err := ReadObjectData(repo, oldBlob)
+	assert.NoError(t, err)
+	assert.Equal(t, "old\n", string(data))
+	assert.True(t, HasObject(repo, oldBlob))
+}
+
+func TestParseObjectFilter(t *testing.T) {
+	tests := []struct {
+		spec      string
+		blobLimit int64
+		treeDepth int
+	}{
+		{"blob:none", 0, -1},
+		{"blob:limit=10", 10, -1},
+		{"blob:limit=2k", 2048, -1},
+		{"tree:0", -1, 0},
+	}
+	for _, tt := range tests {
+		f, err := ParseObjectFilter(tt.spec)
+		assert.NoError(t, err)
+		assert.Equal(t, tt.blobLimit, f.BlobLimit, tt.spec)
+		assert.Equal(t, tt.treeDepth, f.TreeDepth, tt.spec)
+	}
+	for _, spec := range []string{"blob:limit=", "blob:limit=x", "tree:-1", "sparse:oid=x"} {
+		_, err := ParseObjectFilter(spec)
+		assert.Error(t, err, spec)
+	}
+}
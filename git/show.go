@@ -0,0 +1,132 @@
+package git
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ShowOptions is options of ShowObjects.
+type ShowOptions struct {
+	// Format is the format of commits. nil means medium.
+	Format *PrettyFormat
+	// NoPatch suppresses patches of commits.
+	NoPatch bool
+	// Stat shows the diffstat of commits instead of patches.
+	Stat bool
+}
+
+// shower writes objects like git show, remembering whether something has been shown for separators.
+type shower struct {
+	repo  *GitRepository
+	w     io.Writer
+	opts  ShowOptions
+	shown bool
+	// commits are shown only once even if they are named several times
+	seen map[string]bool
+}
+
+// ShowObjects write objects named by revs like git show.
+// commits are shown with their patches against the first parent, annotated tags with their targets,
+// trees as the list of their entries and blobs as their contents.
+func ShowObjects(repo *GitRepository, w io.Writer, revs []string, opts ShowOptions) error {
+	if opts.Format == nil {
+		opts.Format, _ = ParsePrettyFormat("")
+	}
+	s := &shower{repo: repo, w: w, opts: opts, seen: map[string]bool{}}
+	for _, rev := range revs {
+		sha, err := ResolveRevision(repo, rev)
+		if err != nil {
+			return err
+		}
+		if err := s.show(rev, sha); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *shower) show(name, sha string) error {
+	obj, err := ReadObject(s.repo, sha)
+	if err != nil {
+		return err
+	}
+	switch o := obj.(type) {
+	case *GitBlob:
+		_, err := s.w.Write(o.Data)
+		return err
+	case *GitTree:
+		s.separate()
+		fmt.Fprintf(s.w, "tree %s\n\n", name)
+		for _, e := range o.Entries {
+			if e.IsTree() {
+				fmt.Fprintf(s.w, "%s/\n", e.Path)
+			} else {
+				fmt.Fprintf(s.w, "%s\n", e.Path)
+			}
+		}
+		return nil
+	case *GitTag:
+		s.separate()
+		fmt.Fprintf(s.w, "tag %s\n", o.Tag)
+		if o.Tagger.Name != "" || o.Tagger.Email != "" {
+			fmt.Fprintf(s.w, "Tagger: %s <%s>\n", o.Tagger.Name, o.Tagger.Email)
+			fmt.Fprintf(s.w, "Date:   %s\n", formatIdentDate(o.Tagger, defaultDateLayout))
+		}
+		fmt.Fprintf(s.w, "\n%s", o.Message)
+		return s.show(o.Object, o.Object)
+	case *GitCommit:
+		return s.showCommit(sha, o)
+	}
+	return fmt.Errorf("unknown object type %s", obj.Type())
+}
+
+// separate write a blank line between objects, and mark that an object is shown.
+func (s *shower) separate() {
+	if s.shown {
+		fmt.Fprintln(s.w)
+	}
+	s.shown = true
+}
+
+func (s *shower) showCommit(sha string, commit *GitCommit) error {
+	if s.seen[sha] {
+		return nil
+	}
+	s.seen[sha] = true
+	if s.opts.Format.Separated() {
+		s.separate()
+	}
+	s.shown = true
+	text := s.opts.Format.FormatCommit(sha, commit)
+	fmt.Fprint(s.w, text)
+	// merges have no patch since they are not against a single parent
+	if s.opts.NoPatch || len(commit.Parents) > 1 {
+		return nil
+	}
+	parentTree := ""
+	if len(commit.Parents) == 1 {
+		var err error
+		if parentTree, err = CommitTree(s.repo, commit.Parents[0]); err != nil {
+			return err
+		}
+	}
+	changes, err := DiffTrees(s.repo, parentTree, commit.Tree)
+	if err != nil || len(changes) == 0 {
+		return err
+	}
+	if text != "" && !strings.HasSuffix(text, "\n") {
+		fmt.Fprintln(s.w)
+	}
+	if s.opts.Format.BlankBeforePatch() {
+		fmt.Fprintln(s.w)
+	}
+	if s.opts.Stat {
+		stats, err := DiffStats(s.repo, changes)
+		if err != nil {
+			return err
+		}
+		return WriteDiffStat(s.w, stats)
+	}
+	return WritePatch(s.repo, s.w, changes)
+}
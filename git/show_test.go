@@ -0,0 +1,54 @@
+package git
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestShowObjects(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	defer setTestIdent(t)()
+
+	first := commitTestFiles(t, repo, "first", map[string]string{"a": "one\n", "d/b": "two\n"})
+	second := commitTestFiles(t, repo, "second", map[string]string{"a": "one\nthree\n", "d/b": "two\n"})
+	tagger, err := CommitterIdent(repo)
+	assert.NoError(t, err)
+	tag, err := WriteObject(repo, &GitTag{Object: first, ObjType: "commit", Tag: "v1", Tagger: tagger, Message: "release\n"})
+	assert.NoError(t, err)
+	assert.NoError(t, UpdateRef(repo, "refs/tags/v1", tag, ""))
+
+	show := func(opts ShowOptions, revs ...string) string {
+		var b bytes.Buffer
+		assert.NoError(t, ShowObjects(repo, &b, revs, opts))
+		return b.String()
+	}
+	oneline, err := ParsePrettyFormat("oneline")
+	assert.NoError(t, err)
+	oneline.AbbrevCommit = true
+	assert.Equal(t, shortSha(second)+" second\ndiff --git a/a b/a\nindex 5626abf..4c7442b 100644\n--- a/a\n+++ b/a\n@@ -1 +1,2 @@\n one\n+three\n",
+		show(ShowOptions{Format: oneline}, "HEAD"))
+
+	// commits are separated by blank lines and shown only once
+	out := show(ShowOptions{NoPatch: true}, "HEAD", second, "HEAD~1")
+	assert.Equal(t, 2, strings.Count(out, "commit "))
+	assert.Contains(t, out, "    second\n\ncommit "+first+"\n")
+
+	// annotated tags are followed by the tagged object
+	out = show(ShowOptions{NoPatch: true}, "v1")
+	assert.True(t, strings.HasPrefix(out, "tag v1\nTagger: mygit <mygit@example.com>\nDate:   "))
+	assert.Contains(t, out, "\n\nrelease\n\ncommit "+first+"\n")
+
+	// trees are listed and blobs are shown as they are
+	assert.Equal(t, "tree HEAD:\n\na\nd/\n", show(ShowOptions{}, "HEAD:"))
+	assert.Equal(t, "one\nthree\n", show(ShowOptions{}, "HEAD:a"))
+	assert.Equal(t, "two\n", show(ShowOptions{}, "v1:d/b"))
+	assert.Equal(t, "one\n", show(ShowOptions{}, second+"~:a"))
+
+	var b bytes.Buffer
+	assert.EqualError(t, ShowObjects(repo, &b, []string{"HEAD:nope"}, ShowOptions{}), "path 'nope' does not exist in 'HEAD'")
+}
@@ -0,0 +1,578 @@
+package git
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// stashRef is the ref of the latest stash. older stashes are kept in its reflog.
+const stashRef = "refs/stash"
+
+// ErrNoLocalChanges is returned when there is nothing to stash.
+var ErrNoLocalChanges = errors.New("No local changes to save")
+
+// StashOptions is options of stash push.
+// IncludeUntracked stashes untracked files, and All stashes ignored files too.
+// KeepIndex leaves changes in the index, and Pathspecs limit stashed files.
+type StashOptions struct {
+	Message          string
+	KeepIndex        bool
+	IncludeUntracked bool
+	All              bool
+	Pathspecs        []string
+}
+
+// Stash is a stash entry. a stash commit has the HEAD commit, the commit of the index,
+// and optionally the commit of untracked files as parents. its tree is the state of worktree.
+type Stash struct {
+	Sha       string
+	Base      string
+	Index     string
+	Untracked string
+	Commit    *GitCommit
+}
+
+// ReadStash read a stash commit.
+func ReadStash(repo *GitRepository, sha string) (*Stash, error) {
+	commit, err := ReadCommit(repo, sha)
+	if err != nil || len(commit.Parents) < 2 || len(commit.Parents) > 3 {
+		return nil, fmt.Errorf("'%s' is not a stash-like commit", sha)
+	}
+	s := &Stash{Sha: sha, Base: commit.Parents[0], Index: commit.Parents[1], Commit: commit}
+	if len(commit.Parents) == 3 {
+		s.Untracked = commit.Parents[2]
+	}
+	return s, nil
+}
+
+// stashBaseMessage return "<branch>: <short hash> <subject>" of HEAD, which is used in messages of stash commits.
+func stashBaseMessage(repo *GitRepository, head string) (string, string, error) {
+	commit, err := ReadCommit(repo, head)
+	if err != nil {
+		return "", "", err
+	}
+	branch, _ := CurrentBranch(repo)
+	if branch == "" {
+		branch = "(no branch)"
+	}
+	branch = strings.TrimPrefix(branch, branchPrefix)
+	return branch, fmt.Sprintf("%s: %s %s", branch, shortSha(head), commit.Subject()), nil
+}
+
+// CreateStash make a stash commit of local changes without updating refs and worktree.
+// ErrNoLocalChanges is returned if there are no changes.
+func CreateStash(repo *GitRepository, opts StashOptions) (string, error) {
+	if repo.Bare {
+		return "", fmt.Errorf("this operation must be run in a work tree")
+	}
+	head, err := ResolveRef(repo, "HEAD")
+	if err != nil {
+		return "", fmt.Errorf("You do not have the initial commit yet")
+	}
+	headTree, err := CommitTree(repo, head)
+	if err != nil {
+		return "", err
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return "", err
+	}
+	if conflicts := index.Conflicts(); len(conflicts) > 0 {
+		return "", fmt.Errorf("%s: needs merge\nCannot save the current index state", conflicts[0])
+	}
+	untracked, err := stashUntrackedFiles(repo, index, opts)
+	if err != nil {
+		return "", err
+	}
+	if len(opts.Pathspecs) > 0 {
+		var known []string
+		for _, e := range index.Entries {
+			known = append(known, e.FilePath)
+		}
+		if unmatched := UnmatchedPathspecs(opts.Pathspecs, append(known, untracked...)); len(unmatched) > 0 {
+			return "", fmt.Errorf("pathspec '%s' did not match any file(s) known to git\nDid you forget to 'git add'?", unmatched[0])
+		}
+	}
+
+	indexTree, err := WriteIndexTree(repo, index)
+	if err != nil {
+		return "", err
+	}
+	var files []*GitTreeEntry
+	for _, e := range index.Entries {
+		f := &GitTreeEntry{Mode: canonicalMode(e.Mode), Path: e.FilePath, Sha: e.ObjectID}
+		if MatchPathspec(opts.Pathspecs, e.FilePath) {
+			modified, err := IsEntryModified(repo, e)
+			if err != nil {
+				return "", err
+			}
+			if modified {
+				if f.Sha, f.Mode, err = HashWorktreeFile(repo, e.FilePath, true); err != nil {
+					if os.IsNotExist(err) || isNotDir(err) {
+						continue
+					}
+					return "", err
+				}
+			}
+		}
+		files = append(files, f)
+	}
+	worktreeTree, err := writeTreeFiles(repo, files)
+	if err != nil {
+		return "", err
+	}
+
+	// changes limited by pathspecs are compared with HEAD only in the paths
+	changed := worktreeTree != headTree
+	if len(opts.Pathspecs) > 0 {
+		diffs, err := DiffTrees(repo, headTree, worktreeTree)
+		if err != nil {
+			return "", err
+		}
+		changed = false
+		for _, d := range diffs {
+			changed = changed || MatchPathspec(opts.Pathspecs, d.Path)
+		}
+	}
+	if !changed && len(untracked) == 0 {
+		return "", ErrNoLocalChanges
+	}
+
+	branch, base, err := stashBaseMessage(repo, head)
+	if err != nil {
+		return "", err
+	}
+	indexCommit, err := NewCommit(repo, indexTree, []string{head}, "index on "+base+"\n")
+	if err != nil {
+		return "", err
+	}
+	parents := []string{head, indexCommit}
+	if len(untracked) > 0 {
+		var files []*GitTreeEntry
+		for _, name := range untracked {
+			sha, mode, err := HashWorktreeFile(repo, name, true)
+			if err != nil {
+				return "", err
+			}
+			files = append(files, &GitTreeEntry{Mode: mode, Path: name, Sha: sha})
+		}
+		untrackedTree, err := writeTreeFiles(repo, files)
+		if err != nil {
+			return "", err
+		}
+		untrackedCommit, err := NewCommit(repo, untrackedTree, nil, "untracked files on "+base+"\n")
+		if err != nil {
+			return "", err
+		}
+		parents = append(parents, untrackedCommit)
+	}
+	message := "WIP on " + base
+	if opts.Message != "" {
+		message = fmt.Sprintf("On %s: %s", branch, opts.Message)
+	}
+	return NewCommit(repo, worktreeTree, parents, message)
+}
+
+// stashUntrackedFiles return untracked files to be stashed, which are ignored files too with All option.
+func stashUntrackedFiles(repo *GitRepository, index *GitIndex, opts StashOptions) ([]string, error) {
+	if !opts.IncludeUntracked && !opts.All {
+		return nil, nil
+	}
+	ignore, err := NewIgnoreMatcher(repo, nil, true)
+	if err != nil {
+		return nil, err
+	}
+	files, err := ListUntracked(repo, index, ignore)
+	if err != nil {
+		return nil, err
+	}
+	var names []string
+	for _, f := range files {
+		if f.Dir || f.Ignored && !opts.All || !MatchPathspec(opts.Pathspecs, f.Path) {
+			continue
+		}
+		names = append(names, f.Path)
+	}
+	return names, nil
+}
+
+// StashChanges return changes recorded in the stash from the commit where it was made.
+// files in the untracked commit are added to changes if untracked is true, or are only changes if onlyUntracked is true.
+func StashChanges(repo *GitRepository, stash *Stash, untracked, onlyUntracked bool) ([]*TreeChange, error) {
+	var changes []*TreeChange
+	if !onlyUntracked {
+		baseTree, err := CommitTree(repo, stash.Base)
+		if err != nil {
+			return nil, err
+		}
+		if changes, err = DiffTrees(repo, baseTree, stash.Commit.Tree); err != nil {
+			return nil, err
+		}
+	}
+	if (untracked || onlyUntracked) && stash.Untracked != "" {
+		untrackedTree, err := CommitTree(repo, stash.Untracked)
+		if err != nil {
+			return nil, err
+		}
+		added, err := DiffTrees(repo, "", untrackedTree)
+		if err != nil {
+			return nil, err
+		}
+		changes = append(changes, added...)
+		sort.Slice(changes, func(i, j int) bool { return changes[i].Path < changes[j].Path })
+	}
+	return changes, nil
+}
+
+// StoreStash record the stash commit to refs/stash and its reflog with message.
+func StoreStash(repo *GitRepository, sha, message string) error {
+	if _, err := ReadStash(repo, sha); err != nil {
+		return err
+	}
+	if !HasReflog(repo, stashRef) {
+		if err := WriteReflog(repo, stashRef, nil); err != nil {
+			return err
+		}
+	}
+	return UpdateRef(repo, stashRef, sha, message)
+}
+
+// PushStash save local changes to a new stash, and revert them from worktree and index.
+// the subject of the stash commit is returned.
+func PushStash(repo *GitRepository, opts StashOptions) (string, error) {
+	sha, err := CreateStash(repo, opts)
+	if err != nil {
+		return "", err
+	}
+	stash, err := ReadStash(repo, sha)
+	if err != nil {
+		return "", err
+	}
+	message := stash.Commit.Subject()
+	if err := StoreStash(repo, sha, message); err != nil {
+		return "", err
+	}
+
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return "", err
+	}
+	baseTree, err := CommitTree(repo, stash.Base)
+	if err != nil {
+		return "", err
+	}
+	target, err := IndexFromTree(repo, baseTree)
+	if err != nil {
+		return "", err
+	}
+	if len(opts.Pathspecs) > 0 {
+		target = mergeIndexPaths(index, target, opts.Pathspecs)
+	}
+	if err := CheckoutIndex(repo, index, target, CheckoutOptions{Force: true, Pathspecs: opts.Pathspecs}); err != nil {
+		return "", err
+	}
+	if len(opts.Pathspecs) == 0 {
+		// the whole worktree is reset like "reset --hard"
+		if err := logRefUpdate(repo, "HEAD", stash.Base, stash.Base, "reset: moving to HEAD"); err != nil {
+			return "", err
+		}
+	}
+	if stash.Untracked != "" {
+		untrackedTree, err := CommitTree(repo, stash.Untracked)
+		if err != nil {
+			return "", err
+		}
+		files, err := ReadTreeFiles(repo, untrackedTree)
+		if err != nil {
+			return "", err
+		}
+		for _, f := range files {
+			file := worktreeFile(repo, f.Path)
+			if err := os.Remove(file); err != nil && !os.IsNotExist(err) {
+				return "", err
+			}
+			removeEmptyDirs(filepath.Dir(file), repo.Worktree)
+		}
+	}
+	if opts.KeepIndex {
+		indexStash, err := CommitTree(repo, stash.Index)
+		if err != nil {
+			return "", err
+		}
+		kept, err := IndexFromTree(repo, indexStash)
+		if err != nil {
+			return "", err
+		}
+		current, err := ReadIndexOrEmpty(repo)
+		if err != nil {
+			return "", err
+		}
+		if len(opts.Pathspecs) > 0 {
+			kept = mergeIndexPaths(current, kept, opts.Pathspecs)
+		}
+		if err := CheckoutIndex(repo, current, kept, CheckoutOptions{Force: true, Pathspecs: opts.Pathspecs}); err != nil {
+			return "", err
+		}
+	}
+	return message, nil
+}
+
+// mergeIndexPaths return index whose entries matching pathspecs are replaced with entries of other.
+func mergeIndexPaths(index, other *GitIndex, pathspecs []string) *GitIndex {
+	merged := &GitIndex{}
+	for _, e := range index.Entries {
+		if !MatchPathspec(pathspecs, e.FilePath) {
+			merged.Entries = append(merged.Entries, e)
+		}
+	}
+	for _, e := range other.Entries {
+		if MatchPathspec(pathspecs, e.FilePath) {
+			merged.Entries = append(merged.Entries, e)
+		}
+	}
+	SortIndex(merged)
+	return merged
+}
+
+// ListStashes return reflog entries of stashes. the newest one, stash@{0}, comes first.
+func ListStashes(repo *GitRepository) ([]*ReflogEntry, error) {
+	entries, err := ReadReflog(repo, stashRef)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(entries)-1; i < j; i, j = i+1, j-1 {
+		entries[i], entries[j] = entries[j], entries[i]
+	}
+	return entries, nil
+}
+
+var stashRevRegexp = regexp.MustCompile(`^(?:(?:refs/)?stash)?@\{(\d+)\}$`)
+
+// ParseStashIndex return n of a stash reference such as "stash@{n}" or "n".
+// empty string means the latest stash.
+func ParseStashIndex(rev string) (int, bool) {
+	if rev == "" {
+		return 0, true
+	}
+	if n, err := strconv.Atoi(rev); err == nil && n >= 0 {
+		return n, true
+	}
+	if m := stashRevRegexp.FindStringSubmatch(rev); m != nil {
+		n, _ := strconv.Atoi(m[1])
+		return n, true
+	}
+	return 0, false
+}
+
+// ResolveStash return the stash commit of a stash reference, or any stash-like commit.
+func ResolveStash(repo *GitRepository, rev string) (*Stash, error) {
+	if n, ok := ParseStashIndex(rev); ok {
+		entries, err := ListStashes(repo)
+		if err != nil {
+			return nil, err
+		}
+		if len(entries) == 0 {
+			return nil, fmt.Errorf("No stash entries found.")
+		}
+		if n >= len(entries) {
+			return nil, fmt.Errorf("stash@{%d} is not a valid reference", n)
+		}
+		return ReadStash(repo, entries[n].New)
+	}
+	sha, err := ResolveCommit(repo, rev)
+	if err != nil {
+		return nil, fmt.Errorf("%s is not a valid reference", rev)
+	}
+	return ReadStash(repo, sha)
+}
+
+// DropStash remove the n-th stash, and return its commit.
+// refs/stash points the next newest stash after that, or is removed if no stashes remain.
+func DropStash(repo *GitRepository, n int) (string, error) {
+	entries, err := ReadReflog(repo, stashRef)
+	if err != nil {
+		return "", err
+	}
+	if len(entries) == 0 {
+		return "", fmt.Errorf("No stash entries found.")
+	}
+	if n < 0 || n >= len(entries) {
+		return "", fmt.Errorf("stash@{%d} is not a valid reference", n)
+	}
+	i := len(entries) - 1 - n
+	dropped := entries[i].New
+	entries = append(entries[:i], entries[i+1:]...)
+	if len(entries) == 0 {
+		return dropped, ClearStash(repo)
+	}
+	// the old value of the entry after the dropped one is rewritten to keep the chain
+	if i < len(entries) {
+		entries[i].Old = zeroSha
+		if i > 0 {
+			entries[i].Old = entries[i-1].New
+		}
+	}
+	if err := WriteReflog(repo, stashRef, entries); err != nil {
+		return "", err
+	}
+	return dropped, writeRefFile(repo, stashRef, []byte(entries[len(entries)-1].New+"\n"))
+}
+
+// ClearStash remove all stashes.
+func ClearStash(repo *GitRepository) error {
+	if err := DeleteRef(repo, stashRef); err != nil && !errors.Is(err, ErrRefNotFound) {
+		return err
+	}
+	if err := os.Remove(reflogPath(repo, stashRef)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+// ApplyStash merge changes of the stash into worktree. changes in the index of the stash are also
+// restored to the index if restoreIndex is true, otherwise only newly added files are added to the index.
+// the returned result has messages of the merge, and an error is returned with the result if it conflicts.
+func ApplyStash(repo *GitRepository, stash *Stash, restoreIndex bool) (*MergeResult, error) {
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+	if len(index.Conflicts()) > 0 {
+		return nil, fmt.Errorf("Cannot apply a stash in the middle of a merge")
+	}
+	currentTree, err := WriteIndexTree(repo, index)
+	if err != nil {
+		return nil, err
+	}
+	baseTree, err := CommitTree(repo, stash.Base)
+	if err != nil {
+		return nil, err
+	}
+	indexTree, err := CommitTree(repo, stash.Index)
+	if err != nil {
+		return nil, err
+	}
+
+	restoredTree := currentTree
+	if restoreIndex && indexTree != baseTree {
+		restored, err := MergeTrees(repo, baseTree, currentTree, indexTree, MergeOptions{})
+		if err != nil {
+			return nil, err
+		}
+		if !restored.Clean() {
+			return nil, fmt.Errorf("Conflicts in index. Try without --index.")
+		}
+		if restoredTree, err = WriteIndexTree(repo, restored.Index); err != nil {
+			return nil, err
+		}
+	}
+
+	var untracked []*GitTreeEntry
+	if stash.Untracked != "" {
+		untrackedTree, err := CommitTree(repo, stash.Untracked)
+		if err != nil {
+			return nil, err
+		}
+		if untracked, err = ReadTreeFiles(repo, untrackedTree); err != nil {
+			return nil, err
+		}
+		for _, f := range untracked {
+			if _, err := os.Lstat(worktreeFile(repo, f.Path)); err == nil {
+				return nil, fmt.Errorf("%s already exists, no checkout\ncould not restore untracked files from stash", f.Path)
+			}
+		}
+	}
+
+	result, err := MergeTrees(repo, baseTree, currentTree, stash.Commit.Tree, MergeOptions{
+		OursLabel:   "Updated upstream",
+		BaseLabel:   "Stash base",
+		TheirsLabel: "Stashed changes",
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckWorktreeOverwrite(repo, index, result.Index, "merge"); err != nil {
+		return nil, err
+	}
+	if err := CheckoutIndex(repo, index, result.Index, CheckoutOptions{Contents: result.Contents}); err != nil {
+		return nil, err
+	}
+	for _, f := range untracked {
+		_, data, err := ReadObjectData(repo, f.Sha)
+		if err != nil {
+			return nil, err
+		}
+		if err := writeWorktreeFile(repo, f.Path, f.Mode, data); err != nil {
+			return nil, err
+		}
+	}
+	if !result.Clean() {
+		return result, fmt.Errorf("conflicts in stash")
+	}
+
+	// the index is reset to the state before applying or restored one, keeping files added by the stash
+	merged, err := ReadIndex(repo)
+	if err != nil {
+		return nil, err
+	}
+	target, err := IndexFromTree(repo, restoredTree)
+	if err != nil {
+		return nil, err
+	}
+	final := &GitIndex{}
+	for _, e := range target.Entries {
+		if m := merged.Entry(e.FilePath); m != nil && m.ObjectID == e.ObjectID {
+			e = m
+		}
+		final.Entries = append(final.Entries, e)
+	}
+	for _, m := range merged.Entries {
+		if target.Entry(m.FilePath) == nil && index.Entry(m.FilePath) == nil {
+			final.Entries = append(final.Entries, m)
+		}
+	}
+	SortIndex(final)
+	return result, WriteIndex(repo, final)
+}
+
+// StashBranch create a branch at the commit where the stash was made, check it out,
+// and apply the stash with its index.
+func StashBranch(repo *GitRepository, name string, stash *Stash) (*MergeResult, error) {
+	if err := CreateBranch(repo, name, stash.Base, stash.Base, false); err != nil {
+		return nil, err
+	}
+	index, err := ReadIndexOrEmpty(repo)
+	if err != nil {
+		return nil, err
+	}
+	baseTree, err := CommitTree(repo, stash.Base)
+	if err != nil {
+		return nil, err
+	}
+	target, err := IndexFromTree(repo, baseTree)
+	if err != nil {
+		return nil, err
+	}
+	if err := CheckWorktreeOverwrite(repo, index, target, "checkout"); err != nil {
+		return nil, err
+	}
+	if err := CheckoutIndex(repo, index, target, CheckoutOptions{}); err != nil {
+		return nil, err
+	}
+	from := "HEAD"
+	if current, err := CurrentBranch(repo); err == nil && current != "" {
+		from = strings.TrimPrefix(current, branchPrefix)
+	} else if sha, err := ResolveRef(repo, "HEAD"); err == nil {
+		from = sha
+	}
+	if err := SetSymbolicRef(repo, "HEAD", BranchRef(name), fmt.Sprintf("checkout: moving from %s to %s", from, name)); err != nil {
+		return nil, err
+	}
+	return ApplyStash(repo, stash, true)
+}
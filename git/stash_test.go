@@ -0,0 +1,93 @@
+package git
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStash(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	for _, name := range []string{"AUTHOR", "COMMITTER"} {
+		os.Setenv("GIT_"+name+"_NAME", "mygit")
+		os.Setenv("GIT_"+name+"_EMAIL", "mygit@example.com")
+		defer os.Unsetenv("GIT_" + name + "_NAME")
+		defer os.Unsetenv("GIT_" + name + "_EMAIL")
+	}
+	readFile := func(name string) string {
+		data, err := ioutil.ReadFile(filepath.Join(repo.Worktree, name))
+		assert.NoError(t, err)
+		return string(data)
+	}
+	writeFile := func(name, content string) {
+		assert.NoError(t, ioutil.WriteFile(filepath.Join(repo.Worktree, name), []byte(content), 0644))
+	}
+
+	// commit a.txt and check it out
+	blob, err := WriteObject(repo, NewGitBlob([]byte("a\n")))
+	assert.NoError(t, err)
+	tree, err := writeTreeFiles(repo, []*GitTreeEntry{{Mode: ModeBlob, Path: "a.txt", Sha: blob}})
+	assert.NoError(t, err)
+	index, err := IndexFromTree(repo, tree)
+	assert.NoError(t, err)
+	assert.NoError(t, CheckoutIndex(repo, &GitIndex{}, index, CheckoutOptions{}))
+	head, err := NewCommit(repo, tree, nil, "initial\n")
+	assert.NoError(t, err)
+	assert.NoError(t, UpdateRef(repo, "HEAD", head, "commit (initial): initial"))
+
+	_, err = PushStash(repo, StashOptions{})
+	assert.Equal(t, ErrNoLocalChanges, err)
+
+	writeFile("a.txt", "changed\n")
+	writeFile("u.txt", "untracked\n")
+	subject, err := PushStash(repo, StashOptions{IncludeUntracked: true})
+	assert.NoError(t, err)
+	assert.Equal(t, "WIP on master: "+head[:7]+" initial", subject)
+	assert.Equal(t, "a\n", readFile("a.txt"))
+	_, err = os.Stat(filepath.Join(repo.Worktree, "u.txt"))
+	assert.True(t, os.IsNotExist(err))
+
+	stash, err := ResolveStash(repo, "stash@{0}")
+	assert.NoError(t, err)
+	assert.Equal(t, head, stash.Base)
+	assert.NotEqual(t, "", stash.Untracked)
+	index, err = ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, blob, index.Entry("a.txt").ObjectID)
+
+	writeFile("a.txt", "second\n")
+	_, err = PushStash(repo, StashOptions{Message: "second"})
+	assert.NoError(t, err)
+	stashes, err := ListStashes(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, len(stashes))
+	assert.Equal(t, "On master: second", stashes[0].Message)
+
+	// apply the older stash after dropping the newer one
+	_, err = DropStash(repo, 0)
+	assert.NoError(t, err)
+	stash, err = ResolveStash(repo, "")
+	assert.NoError(t, err)
+	result, err := ApplyStash(repo, stash, false)
+	assert.NoError(t, err)
+	assert.True(t, result.Clean())
+	assert.Equal(t, "changed\n", readFile("a.txt"))
+	assert.Equal(t, "untracked\n", readFile("u.txt"))
+	// changes are not staged
+	index, err = ReadIndex(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, blob, index.Entry("a.txt").ObjectID)
+	assert.Nil(t, index.Entry("u.txt"))
+
+	_, err = DropStash(repo, 0)
+	assert.NoError(t, err)
+	stashes, err = ListStashes(repo)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, len(stashes))
+	_, err = ResolveStash(repo, "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,680 @@
+package git
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// UploadPackOptions is options of UploadPack.
+type UploadPackOptions struct {
+	// Version is protocol version requested by client. version 2 is used if it is 2.
+	Version int
+	// StatelessRPC handle one request without advertisement, which is used by smart HTTP.
+	StatelessRPC bool
+	// AdvertiseRefs write only the advertisement.
+	AdvertiseRefs bool
+}
+
+// UploadPack serve objects of repo to a client which fetches or clones.
+// the client reads from w and writes to r. it returns when the client finishes requests.
+// shallow clients are supported, and filters of partial clone are allowed if uploadpack.allowFilter is set.
+// clients can want only advertised objects unless uploadpack.allowReachableSHA1InWant or allowAnySHA1InWant is set.
+func UploadPack(repo *GitRepository, r io.Reader, w io.Writer, opts UploadPackOptions) error {
+	policy, err := loadUploadPolicy(repo)
+	if err != nil {
+		return err
+	}
+
+	pkt := newPktLineReader(r)
+	if opts.Version == 2 {
+		if !opts.StatelessRPC {
+			if err := writeCapabilitiesV2(w, policy.allowFilter); err != nil {
+				return err
+			}
+		}
+		if opts.AdvertiseRefs {
+			return nil
+		}
+		return serveUploadPackV2(repo, pkt, w, opts.StatelessRPC, policy)
+	}
+
+	if !opts.StatelessRPC {
+		refs, err := advertisedRefs(repo)
+		if err != nil {
+			return err
+		}
+		caps := Capabilities{"side-band", "side-band-64k", "ofs-delta", "shallow", "deepen-since", "deepen-not", "no-progress", "include-tag"}
+		if policy.allowFilter {
+			caps = append(caps, "filter")
+		}
+		if policy.allowTip {
+			caps = append(caps, "allow-tip-sha1-in-want")
+		}
+		if policy.allowReachable {
+			caps = append(caps, "allow-reachable-sha1-in-want")
+		}
+		if head := findRemoteRef(refs, "HEAD"); head != nil && head.Target != "" {
+			caps = append(caps, "symref=HEAD:"+head.Target)
+		}
+		caps = append(caps, "agent="+agent)
+		if err := writeRefAdvertisement(w, refs, caps); err != nil {
+			return err
+		}
+	}
+	if opts.AdvertiseRefs {
+		return nil
+	}
+	return serveUploadPackV0(repo, pkt, w, opts.StatelessRPC, policy)
+}
+
+// uploadPolicy is what clients are allowed to request, which is given by uploadpack.* configs.
+type uploadPolicy struct {
+	// allowFilter allows filters of partial clone.
+	allowFilter bool
+	// allowTip allows wants of any ref tip. all refs are advertised, so it only changes the capabilities.
+	allowTip bool
+	// allowReachable allows wants of objects reachable from refs.
+	allowReachable bool
+	// allowAny allows wants of any object.
+	allowAny bool
+	// tips are objects of advertised refs and peeled tags, which are read at the first want.
+	tips map[string]bool
+	// reachable is objects reachable from tips, which are walked at the first want out of tips.
+	reachable map[string]bool
+}
+
+func loadUploadPolicy(repo *GitRepository) (*uploadPolicy, error) {
+	cfg, err := LoadConfig(repo)
+	if err != nil {
+		return nil, err
+	}
+	p := &uploadPolicy{}
+	for key, value := range map[string]*bool{
+		"uploadpack.allowFilter":              &p.allowFilter,
+		"uploadpack.allowTipSHA1InWant":       &p.allowTip,
+		"uploadpack.allowReachableSHA1InWant": &p.allowReachable,
+		"uploadpack.allowAnySHA1InWant":       &p.allowAny,
+	} {
+		if *value, err = cfg.GetBool(key, false); err != nil {
+			return nil, err
+		}
+	}
+	return p, nil
+}
+
+// checkWant return error if the client is not allowed to want the object.
+func (p *uploadPolicy) checkWant(repo *GitRepository, sha string) error {
+	errNotOurRef := fmt.Errorf("upload-pack: not our ref %s", sha)
+	if !isHexSha(sha) || !HasObject(repo, sha) {
+		return errNotOurRef
+	}
+	if p.allowAny {
+		return nil
+	}
+	if p.tips == nil {
+		refs, err := advertisedRefs(repo)
+		if err != nil {
+			return err
+		}
+		p.tips = map[string]bool{}
+		for _, ref := range refs {
+			for _, tip := range []string{ref.Sha, ref.Peeled} {
+				if tip != "" {
+					p.tips[tip] = true
+				}
+			}
+		}
+	}
+	if p.tips[sha] {
+		return nil
+	}
+	if !p.allowReachable {
+		return errNotOurRef
+	}
+	if p.reachable == nil {
+		var tips []string
+		for tip := range p.tips {
+			tips = append(tips, tip)
+		}
+		objects, err := listObjects(repo, tips, nil, objectWalk{skipMissing: true})
+		if err != nil {
+			return err
+		}
+		p.reachable = map[string]bool{}
+		for _, object := range objects {
+			p.reachable[object] = true
+		}
+	}
+	if !p.reachable[sha] {
+		return errNotOurRef
+	}
+	return nil
+}
+
+// advertisedRefs return HEAD and all refs with peeled objects of tags.
+// unborn HEAD has Target and empty Sha.
+func advertisedRefs(repo *GitRepository) ([]*RemoteRef, error) {
+	var refs []*RemoteRef
+	head, err := ReadRef(repo, "HEAD")
+	if err != nil {
+		return nil, err
+	}
+	sha, _ := ResolveRef(repo, "HEAD")
+	refs = append(refs, &RemoteRef{Name: "HEAD", Sha: sha, Target: head.Target})
+
+	local, err := ListRefs(repo, "refs/")
+	if err != nil {
+		return nil, err
+	}
+	for _, ref := range local {
+		if ref.Sha == "" {
+			continue
+		}
+		refs = append(refs, &RemoteRef{Name: ref.Name, Sha: ref.Sha, Target: ref.Target, Peeled: peelTag(repo, ref.Sha)})
+	}
+	return refs, nil
+}
+
+// peelTag return the object which annotated tag points. return empty string if sha is not a tag.
+func peelTag(repo *GitRepository, sha string) string {
+	peeled := ""
+	for {
+		objType, data, err := ReadObjectData(repo, sha)
+		if err != nil || objType != "tag" {
+			return peeled
+		}
+		headers, _ := parseObjectHeaders(data)
+		sha = ""
+		for _, h := range headers {
+			if h.Key == "object" {
+				sha = h.Value
+			}
+		}
+		if sha == "" {
+			return peeled
+		}
+		peeled = sha
+	}
+}
+
+func findRemoteRef(refs []*RemoteRef, name string) *RemoteRef {
+	for _, ref := range refs {
+		if ref.Name == name {
+			return ref
+		}
+	}
+	return nil
+}
+
+// writeRefAdvertisement write refs and capabilities in protocol version 0.
+// refs without object (unborn HEAD) are not written.
+func writeRefAdvertisement(w io.Writer, refs []*RemoteRef, caps Capabilities) error {
+	bw := bufio.NewWriter(w)
+	first := true
+	for _, ref := range refs {
+		if ref.Sha == "" {
+			continue
+		}
+		if first {
+			writePktData(bw, []byte(fmt.Sprintf("%s %s\x00%s\n", ref.Sha, ref.Name, strings.Join(caps, " "))))
+			first = false
+		} else {
+			writePktLine(bw, "%s %s", ref.Sha, ref.Name)
+		}
+		if ref.Peeled != "" {
+			writePktLine(bw, "%s %s^{}", ref.Peeled, ref.Name)
+		}
+	}
+	if first {
+		writePktData(bw, []byte(fmt.Sprintf("%s capabilities^{}\x00%s\n", zeroSha, strings.Join(caps, " "))))
+	}
+	writeFlush(bw)
+	return bw.Flush()
+}
+
+// uploadRequest is a request of objects parsed by upload-pack.
+type uploadRequest struct {
+	wants   []string
+	common  []string
+	caps    Capabilities
+	done    bool
+	shallow shallowRequest
+	filter  *ObjectFilter
+	// boundary is commits whose parents are not sent.
+	boundary map[string]bool
+	// unshallowParents is parents of client's shallow commits which are unshallowed.
+	// they are sent even if the client has their children.
+	unshallowParents []string
+	// includeTag sends annotated tags whose targets are sent. it is a capability in protocol version 0.
+	includeTag bool
+}
+
+// parseShallowLine parse shallow, deepen and filter lines. return false for other lines.
+func (req *uploadRequest) parseShallowLine(repo *GitRepository, line string, allowFilter bool) (bool, error) {
+	fields := strings.SplitN(line, " ", 2)
+	if len(fields) != 2 {
+		return false, nil
+	}
+	switch fields[0] {
+	case "shallow":
+		if !isHexSha(fields[1]) {
+			return true, fmt.Errorf("upload-pack: invalid shallow line: %s", line)
+		}
+		req.shallow.clientShallow = append(req.shallow.clientShallow, fields[1])
+	case "deepen":
+		depth, err := strconv.Atoi(fields[1])
+		if err != nil || depth <= 0 {
+			return true, fmt.Errorf("upload-pack: invalid deepen: %s", line)
+		}
+		req.shallow.depth = depth
+	case "deepen-since":
+		since, err := strconv.ParseInt(fields[1], 10, 64)
+		if err != nil {
+			return true, fmt.Errorf("upload-pack: invalid deepen-since: %s", line)
+		}
+		req.shallow.since = since
+	case "deepen-not":
+		req.shallow.not = append(req.shallow.not, fields[1])
+	case "filter":
+		if !allowFilter {
+			return true, fmt.Errorf("upload-pack: filtering capability not negotiated")
+		}
+		filter, err := ParseObjectFilter(fields[1])
+		if err != nil {
+			return true, err
+		}
+		req.filter = filter
+	default:
+		return false, nil
+	}
+	return true, nil
+}
+
+// computeShallow decide the shallow boundary of the client. commits whose parents are not sent
+// are client's shallow commits and new shallow commits if the request deepens.
+func (req *uploadRequest) computeShallow(repo *GitRepository) (*ShallowInfo, error) {
+	info := &ShallowInfo{}
+	req.boundary = map[string]bool{}
+	if req.shallow.deepen() {
+		var err error
+		if info, req.boundary, err = computeShallow(repo, req.wants, &req.shallow); err != nil {
+			return nil, err
+		}
+	}
+	unshallow := map[string]bool{}
+	for _, sha := range info.Unshallow {
+		unshallow[sha] = true
+		commit, err := ReadCommit(repo, sha)
+		if err != nil {
+			return nil, err
+		}
+		req.unshallowParents = append(req.unshallowParents, commit.Parents...)
+	}
+	for _, sha := range req.shallow.clientShallow {
+		if !unshallow[sha] {
+			req.boundary[sha] = true
+		}
+	}
+	return info, nil
+}
+
+// writeShallowInfo write shallow and unshallow lines.
+func writeShallowInfo(w io.Writer, info *ShallowInfo) {
+	for _, sha := range info.Shallow {
+		writePktLine(w, "shallow %s", sha)
+	}
+	for _, sha := range info.Unshallow {
+		writePktLine(w, "unshallow %s", sha)
+	}
+}
+
+// addHave record have line and return true if the object is common for the first time.
+func (req *uploadRequest) addHave(repo *GitRepository, sha string) bool {
+	if !HasObject(repo, sha) {
+		return false
+	}
+	for _, c := range req.common {
+		if c == sha {
+			return false
+		}
+	}
+	req.common = append(req.common, sha)
+	return true
+}
+
+// serveUploadPackV0 negotiate common objects and send packfile.
+// multi_ack is not supported, so only the first common object is acknowledged.
+// shallow info is sent after wants if the client requests deepen.
+// a stateless request ends at flush unless it has "done".
+func serveUploadPackV0(repo *GitRepository, pkt *pktLineReader, w io.Writer, stateless bool, policy *uploadPolicy) error {
+	req := &uploadRequest{}
+	for {
+		line, ok, err := pkt.readLine()
+		if err == io.EOF && len(req.wants) == 0 {
+			// client disconnected after the advertisement
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if !ok {
+			break
+		}
+		if parsed, err := req.parseShallowLine(repo, line, policy.allowFilter); parsed {
+			if err != nil {
+				return writeUploadPackError(w, err)
+			}
+			continue
+		}
+		fields := strings.Fields(line)
+		if len(fields) < 2 || fields[0] != "want" {
+			return writeUploadPackError(w, fmt.Errorf("upload-pack: protocol error, expected to get want, not '%s'", line))
+		}
+		if len(req.wants) == 0 {
+			req.caps = fields[2:]
+			req.includeTag = req.caps.Has("include-tag")
+		}
+		if err := policy.checkWant(repo, fields[1]); err != nil {
+			return writeUploadPackError(w, err)
+		}
+		req.wants = append(req.wants, fields[1])
+	}
+	if len(req.wants) == 0 {
+		return nil
+	}
+	info, err := req.computeShallow(repo)
+	if err != nil {
+		return writeUploadPackError(w, err)
+	}
+	if req.shallow.deepen() {
+		writeShallowInfo(w, info)
+		writeFlush(w)
+	}
+
+	for !req.done {
+		line, ok, err := pkt.readLine()
+		if err != nil {
+			return err
+		}
+		switch {
+		case !ok:
+			if len(req.common) == 0 {
+				writePktLine(w, "NAK")
+			}
+			if stateless {
+				return nil
+			}
+		case strings.HasPrefix(line, "have "):
+			if req.addHave(repo, line[5:]) && len(req.common) == 1 {
+				writePktLine(w, "ACK %s", line[5:])
+			}
+		case line == "done":
+			req.done = true
+		default:
+			return writeUploadPackError(w, fmt.Errorf("upload-pack: protocol error, expected to get have or done, not '%s'", line))
+		}
+	}
+	if len(req.common) == 0 {
+		writePktLine(w, "NAK")
+	}
+
+	switch {
+	case req.caps.Has("side-band-64k"):
+		return sendUploadPack(repo, newSidebandWriter(w, sidebandData, maxPktPayload), req, w)
+	case req.caps.Has("side-band"):
+		return sendUploadPack(repo, newSidebandWriter(w, sidebandData, 996), req, w)
+	}
+	return sendUploadPack(repo, w, req, nil)
+}
+
+// sendUploadPack write packfile of objects which client wants but does not have.
+// flush packet is written to sideband after the packfile.
+func sendUploadPack(repo *GitRepository, w io.Writer, req *uploadRequest, sideband io.Writer) error {
+	haveBoundary := map[string]bool{}
+	for _, sha := range req.shallow.clientShallow {
+		haveBoundary[sha] = true
+	}
+	walk := objectWalk{boundary: req.boundary, haveBoundary: haveBoundary, filter: req.filter}
+	wants := append(append([]string(nil), req.wants...), req.unshallowParents...)
+	objects, err := listObjects(repo, wants, req.common, walk)
+	if err != nil {
+		return err
+	}
+	if req.includeTag {
+		if objects, err = includeTags(repo, objects); err != nil {
+			return err
+		}
+	}
+	bw := bufio.NewWriterSize(w, maxPktPayload-1)
+	if err := WritePack(repo, bw, objects); err != nil {
+		return err
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	if sideband != nil {
+		return writeFlush(sideband)
+	}
+	return nil
+}
+
+// includeTags add annotated tags pointing objects to be sent, and tags between them and the objects.
+func includeTags(repo *GitRepository, objects []string) ([]string, error) {
+	sent := map[string]bool{}
+	for _, sha := range objects {
+		sent[sha] = true
+	}
+	tags, err := ListRefs(repo, "refs/tags/")
+	if err != nil {
+		return nil, err
+	}
+	for _, tag := range tags {
+		peeled := peelTag(repo, tag.Sha)
+		if tag.Sha == "" || sent[tag.Sha] || peeled == "" || !sent[peeled] {
+			continue
+		}
+		for sha := tag.Sha; sha != peeled && !sent[sha]; {
+			obj, err := ReadObject(repo, sha)
+			if err != nil {
+				return nil, err
+			}
+			sent[sha] = true
+			objects = append(objects, sha)
+			sha = obj.(*GitTag).Object
+		}
+	}
+	return objects, nil
+}
+
+// writeUploadPackError tell the error to client, and return it.
+func writeUploadPackError(w io.Writer, err error) error {
+	writePktLine(w, "ERR %s", err)
+	return err
+}
+
+// writeCapabilitiesV2 write capability advertisement of protocol version 2.
+func writeCapabilitiesV2(w io.Writer, allowFilter bool) error {
+	bw := bufio.NewWriter(w)
+	writePktLine(bw, "version 2")
+	writePktLine(bw, "agent=%s", agent)
+	writePktLine(bw, "ls-refs=unborn")
+	if allowFilter {
+		writePktLine(bw, "fetch=shallow filter")
+	} else {
+		writePktLine(bw, "fetch=shallow")
+	}
+	writePktLine(bw, "object-format=sha1")
+	writeFlush(bw)
+	return bw.Flush()
+}
+
+// readCommandV2 read a command request of protocol version 2.
+// return empty command if the client closed the connection.
+func readCommandV2(pkt *pktLineReader) (string, []string, error) {
+	command := ""
+	for {
+		kind, data, err := pkt.read()
+		if err == io.EOF && command == "" {
+			return "", nil, nil
+		}
+		if err != nil {
+			return "", nil, err
+		}
+		switch kind {
+		case pktFlush:
+			if command == "" {
+				// flush between commands
+				continue
+			}
+			return command, nil, nil
+		case pktDelim:
+			args, err := pkt.readLines()
+			return command, args, err
+		case pktData:
+			line := strings.TrimSuffix(string(data), "\n")
+			if strings.HasPrefix(line, "command=") {
+				command = line[8:]
+			}
+			// capabilities of client such as agent are ignored
+		}
+	}
+}
+
+// serveUploadPackV2 handle commands of protocol version 2 until the client closes the connection.
+// only one command is handled if stateless is true.
+func serveUploadPackV2(repo *GitRepository, pkt *pktLineReader, w io.Writer, stateless bool, policy *uploadPolicy) error {
+	for {
+		command, args, err := readCommandV2(pkt)
+		if err != nil {
+			return err
+		}
+		switch command {
+		case "":
+			return nil
+		case "ls-refs":
+			err = serveLsRefs(repo, args, w)
+		case "fetch":
+			err = serveFetchV2(repo, args, w, policy)
+		default:
+			err = writeUploadPackError(w, fmt.Errorf("invalid command '%s'", command))
+		}
+		if err != nil || stateless {
+			return err
+		}
+	}
+}
+
+// serveLsRefs write refs which match ref-prefix arguments.
+func serveLsRefs(repo *GitRepository, args []string, w io.Writer) error {
+	var prefixes []string
+	var symrefs, peel, unborn bool
+	for _, arg := range args {
+		switch {
+		case arg == "symrefs":
+			symrefs = true
+		case arg == "peel":
+			peel = true
+		case arg == "unborn":
+			unborn = true
+		case strings.HasPrefix(arg, "ref-prefix "):
+			prefixes = append(prefixes, arg[11:])
+		}
+	}
+	refs, err := advertisedRefs(repo)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, ref := range refs {
+		if !matchRefPrefix(ref.Name, prefixes) {
+			continue
+		}
+		line := ref.Sha + " " + ref.Name
+		if ref.Sha == "" {
+			if !unborn {
+				continue
+			}
+			line = "unborn " + ref.Name
+		}
+		if symrefs && ref.Target != "" {
+			line += " symref-target:" + ref.Target
+		}
+		if peel && ref.Peeled != "" {
+			line += " peeled:" + ref.Peeled
+		}
+		writePktLine(bw, "%s", line)
+	}
+	writeFlush(bw)
+	return bw.Flush()
+}
+
+func matchRefPrefix(name string, prefixes []string) bool {
+	if len(prefixes) == 0 {
+		return true
+	}
+	for _, prefix := range prefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveFetchV2 send packfile for wants. acknowledgments section is sent if the client
+// did not say "done", and the server is always ready to send packfile.
+// shallow-info section is sent if the client requests deepen.
+func serveFetchV2(repo *GitRepository, args []string, w io.Writer, policy *uploadPolicy) error {
+	req := &uploadRequest{}
+	for _, arg := range args {
+		if parsed, err := req.parseShallowLine(repo, arg, policy.allowFilter); parsed {
+			if err != nil {
+				return writeUploadPackError(w, err)
+			}
+			continue
+		}
+		switch {
+		case strings.HasPrefix(arg, "want "):
+			if err := policy.checkWant(repo, arg[5:]); err != nil {
+				return writeUploadPackError(w, err)
+			}
+			req.wants = append(req.wants, arg[5:])
+		case strings.HasPrefix(arg, "have "):
+			req.addHave(repo, arg[5:])
+		case arg == "done":
+			req.done = true
+		case arg == "include-tag":
+			req.includeTag = true
+		case arg == "ofs-delta", arg == "thin-pack", arg == "no-progress", arg == "deepen-relative":
+			// packfile has no delta, so these do not change it
+		default:
+			return writeUploadPackError(w, fmt.Errorf("unexpected line: '%s'", arg))
+		}
+	}
+
+	if !req.done {
+		writePktLine(w, "acknowledgments")
+		for _, sha := range req.common {
+			writePktLine(w, "ACK %s", sha)
+		}
+		if len(req.common) == 0 {
+			writePktLine(w, "NAK")
+		}
+		writePktLine(w, "ready")
+		writeDelim(w)
+	}
+	info, err := req.computeShallow(repo)
+	if err != nil {
+		return writeUploadPackError(w, err)
+	}
+	if req.shallow.deepen() {
+		writePktLine(w, "shallow-info")
+		writeShallowInfo(w, info)
+		writeDelim(w)
+	}
+	writePktLine(w, "packfile")
+	return sendUploadPack(repo, newSidebandWriter(w, sidebandData, maxPktPayload), req, w)
+}
@@ -0,0 +1,201 @@
+package git
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestUploadPackStateless(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+
+	var out bytes.Buffer
+	assert.NoError(t, UploadPack(repo, strings.NewReader(""), &out, UploadPackOptions{AdvertiseRefs: true}))
+	adv, err := parseAdvertisement(newPktLineReader(&out))
+	assert.NoError(t, err)
+	adv.applySymrefs()
+	assert.Equal(t, "refs/heads/master", adv.Head())
+	assert.Equal(t, second, adv.Ref("refs/heads/master").Sha)
+
+	// negotiation round without done is answered by ACK of the first common commit
+	var req bytes.Buffer
+	writePktLine(&req, "want %s side-band-64k", second)
+	writeFlush(&req)
+	writePktLine(&req, "have %s", strings.Repeat("0", 39)+"1")
+	writePktLine(&req, "have %s", first)
+	writeFlush(&req)
+	out.Reset()
+	assert.NoError(t, UploadPack(repo, &req, &out, UploadPackOptions{StatelessRPC: true}))
+	line, _, err := newPktLineReader(&out).readLine()
+	assert.NoError(t, err)
+	assert.Equal(t, "ACK "+first, line)
+
+	req.Reset()
+	writePktLine(&req, "want %s side-band-64k", second)
+	writeFlush(&req)
+	writePktLine(&req, "have %s", first)
+	writePktLine(&req, "done")
+	out.Reset()
+	assert.NoError(t, UploadPack(repo, &req, &out, UploadPackOptions{StatelessRPC: true}))
+	pack, err := readUploadPackResponse(newPktLineReader(&out), true, nil, nil)
+	assert.NoError(t, err)
+	data, err := ioutil.ReadAll(pack)
+	assert.NoError(t, err)
+	objects, err := parsePack(data)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, len(objects))
+	assert.Equal(t, second, objects[0].sha)
+
+	// unknown object is refused
+	req.Reset()
+	writePktLine(&req, "want %s", strings.Repeat("a", 40))
+	writeFlush(&req)
+	out.Reset()
+	assert.Error(t, UploadPack(repo, &req, &out, UploadPackOptions{StatelessRPC: true}))
+	_, _, err = newPktLineReader(&out).readLine()
+	assert.EqualError(t, err, "remote error: upload-pack: not our ref "+strings.Repeat("a", 40))
+}
+
+func TestUploadPackWantPolicy(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	second := writeTestCommit(t, repo, "second", first)
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", second, ""))
+	unreachable := writeTestCommit(t, repo, "unreachable")
+
+	want := func(sha string) error {
+		var req, out bytes.Buffer
+		writePktLine(&req, "want %s", sha)
+		writeFlush(&req)
+		writePktLine(&req, "done")
+		return UploadPack(repo, &req, &out, UploadPackOptions{StatelessRPC: true})
+	}
+	setConfig := func(key string) {
+		cfg, err := ReadConfig(repo)
+		assert.NoError(t, err)
+		cfg.Set("uploadpack", "", key, "true")
+		assert.NoError(t, WriteConfig(repo, cfg))
+	}
+
+	// only advertised objects are allowed by default
+	assert.NoError(t, want(second))
+	assert.EqualError(t, want(first), "upload-pack: not our ref "+first)
+	assert.EqualError(t, want(unreachable), "upload-pack: not our ref "+unreachable)
+
+	setConfig("allowReachableSHA1InWant")
+	assert.NoError(t, want(first))
+	assert.EqualError(t, want(unreachable), "upload-pack: not our ref "+unreachable)
+
+	setConfig("allowAnySHA1InWant")
+	assert.NoError(t, want(unreachable))
+}
+
+func TestUploadPackLsRefs(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	assert.NoError(t, UpdateRef(repo, "refs/heads/topic", first, ""))
+	assert.NoError(t, UpdateRef(repo, "refs/tags/v1", first, ""))
+
+	var req, out bytes.Buffer
+	writePktLine(&req, "command=ls-refs")
+	writeDelim(&req)
+	writePktLine(&req, "symrefs")
+	writePktLine(&req, "unborn")
+	writePktLine(&req, "ref-prefix HEAD")
+	writePktLine(&req, "ref-prefix refs/heads/")
+	writeFlush(&req)
+	assert.NoError(t, UploadPack(repo, &req, &out, UploadPackOptions{Version: 2}))
+
+	pkt := newPktLineReader(&out)
+	adv, err := parseAdvertisement(pkt)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, adv.Version)
+	assert.True(t, adv.Capabilities.Has("ls-refs"))
+	refs, err := parseLsRefs(pkt)
+	assert.NoError(t, err)
+	assert.Equal(t, []*RemoteRef{
+		{Name: "HEAD", Target: "refs/heads/master"},
+		{Name: "refs/heads/topic", Sha: first},
+	}, refs)
+}
+
+func TestUploadPackIncludeTag(t *testing.T) {
+	repo := newTestRepo(t)
+	defer os.RemoveAll(repo.Worktree)
+	first := writeTestCommit(t, repo, "first")
+	other := writeTestCommit(t, repo, "other")
+	assert.NoError(t, UpdateRef(repo, "refs/heads/master", first, ""))
+	assert.NoError(t, UpdateRef(repo, "refs/heads/other", other, ""))
+	tagger, err := CommitterIdent(repo)
+	assert.NoError(t, err)
+	v1, err := WriteObject(repo, &GitTag{Object: first, ObjType: "commit", Tag: "v1", Tagger: tagger, Message: "v1\n"})
+	assert.NoError(t, err)
+	nested, err := WriteObject(repo, &GitTag{Object: v1, ObjType: "tag", Tag: "nested", Tagger: tagger, Message: "nested\n"})
+	assert.NoError(t, err)
+	v2, err := WriteObject(repo, &GitTag{Object: other, ObjType: "commit", Tag: "v2", Tagger: tagger, Message: "v2\n"})
+	assert.NoError(t, err)
+	assert.NoError(t, UpdateRef(repo, "refs/tags/nested", nested, ""))
+	assert.NoError(t, UpdateRef(repo, "refs/tags/v2", v2, ""))
+
+	shas := func(pack io.Reader) []string {
+		data, err := ioutil.ReadAll(pack)
+		assert.NoError(t, err)
+		objects, err := parsePack(data)
+		assert.NoError(t, err)
+		var shas []string
+		for _, o := range objects {
+			shas = append(shas, o.sha)
+		}
+		return shas
+	}
+
+	// tags of sent commits are sent with include-tag, and only with it
+	for _, includeTag := range []bool{false, true} {
+		var req, out bytes.Buffer
+		if includeTag {
+			writePktLine(&req, "want %s include-tag", first)
+		} else {
+			writePktLine(&req, "want %s", first)
+		}
+		writeFlush(&req)
+		writePktLine(&req, "done")
+		assert.NoError(t, UploadPack(repo, &req, &out, UploadPackOptions{StatelessRPC: true}))
+		pack, err := readUploadPackResponse(newPktLineReader(&out), false, nil, nil)
+		assert.NoError(t, err)
+		got := shas(pack)
+		if includeTag {
+			assert.Contains(t, got, v1)
+			assert.Contains(t, got, nested)
+		} else {
+			assert.NotContains(t, got, v1)
+			assert.NotContains(t, got, nested)
+		}
+		assert.NotContains(t, got, v2)
+	}
+
+	var req, out bytes.Buffer
+	writePktLine(&req, "command=fetch")
+	writeDelim(&req)
+	writePktLine(&req, "want %s", first)
+	writePktLine(&req, "include-tag")
+	writePktLine(&req, "done")
+	writeFlush(&req)
+	assert.NoError(t, UploadPack(repo, &req, &out, UploadPackOptions{Version: 2, StatelessRPC: true}))
+	pack, err := readFetchResponseV2(newPktLineReader(&out), nil, nil)
+	assert.NoError(t, err)
+	got := shas(pack)
+	assert.Contains(t, got, v1)
+	assert.Contains(t, got, nested)
+	assert.NotContains(t, got, v2)
+}
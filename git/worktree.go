@@ -0,0 +1,398 @@
+package git
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// worktreeFile return the path of the file in worktree.
+func worktreeFile(repo *GitRepository, name string) string {
+	return filepath.Join(repo.Worktree, filepath.FromSlash(name))
+}
+
+// nestedRepoHead return the commit which HEAD of the repository in dir points.
+// false is returned if dir is not a repository.
+func nestedRepoHead(dir string) (string, bool) {
+	gitDir := filepath.Join(dir, ".git")
+	if info, err := os.Stat(gitDir); err != nil {
+		return "", false
+	} else if !info.IsDir() {
+		if gitDir, err = ReadGitFile(gitDir); err != nil {
+			return "", false
+		}
+	}
+	if !IsGitDir(gitDir) {
+		return "", false
+	}
+	repo, err := openGitDir(gitDir)
+	if err != nil {
+		return "", true
+	}
+	sha, _ := ResolveRef(repo, "HEAD")
+	return sha, true
+}
+
+// HashWorktreeFile return hash and mode of the file in worktree.
+// the blob is written to the object database if write is true.
+// a nested repository is hashed as a gitlink to its HEAD.
+func HashWorktreeFile(repo *GitRepository, name string, write bool) (string, os.FileMode, error) {
+	file := worktreeFile(repo, name)
+	info, err := os.Lstat(file)
+	if err != nil {
+		return "", 0, err
+	}
+	var data []byte
+	var mode os.FileMode
+	switch {
+	case info.Mode()&os.ModeSymlink != 0:
+		target, err := os.Readlink(file)
+		if err != nil {
+			return "", 0, err
+		}
+		data, mode = []byte(target), ModeSymlink
+	case info.IsDir():
+		if sha, ok := nestedRepoHead(file); ok && sha != "" {
+			return sha, ModeGitlink, nil
+		}
+		return "", 0, fmt.Errorf("%s is a directory", name)
+	default:
+		if data, err = ioutil.ReadFile(file); err != nil {
+			return "", 0, err
+		}
+		mode = ModeBlob
+		if info.Mode()&0111 != 0 {
+			mode = ModeExecutable
+		}
+	}
+	blob := NewGitBlob(data)
+	if write {
+		sha, err := WriteObject(repo, blob)
+		return sha, mode, err
+	}
+	sha, _ := HashObject(blob)
+	return sha, mode, nil
+}
+
+// IsEntryModified return true if the file in worktree differs from the index entry.
+// a deleted file is also modified. content is hashed only when stat information differs.
+func IsEntryModified(repo *GitRepository, entry *IndexEntry) (bool, error) {
+	info, err := os.Lstat(worktreeFile(repo, entry.FilePath))
+	if err != nil {
+		if os.IsNotExist(err) || isNotDir(err) {
+			return true, nil
+		}
+		return false, err
+	}
+	if entry.Mode&modeTypeMask == ModeGitlink {
+		if !info.IsDir() {
+			return true, nil
+		}
+		sha, ok := nestedRepoHead(worktreeFile(repo, entry.FilePath))
+		return ok && sha != "" && sha != entry.ObjectID, nil
+	}
+	stat := NewIndexEntry(info, entry.FilePath, "")
+	if canonicalMode(stat.Mode) != canonicalMode(entry.Mode) {
+		return true, nil
+	}
+	if entry.Mtime != 0 && stat.Mtime == entry.Mtime && stat.FileSize == entry.FileSize {
+		return false, nil
+	}
+	sha, _, err := HashWorktreeFile(repo, entry.FilePath, false)
+	if err != nil {
+		return false, err
+	}
+	return sha != entry.ObjectID, nil
+}
+
+// isNotDir return true if err is caused by a file in the leading directories of the path.
+func isNotDir(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "not a directory")
+}
+
+// WorktreeChange is a tracked file whose worktree content differs from the index.
+type WorktreeChange struct {
+	Path    string
+	Deleted bool
+}
+
+// WorktreeChanges return files whose worktree content differs from their entries of stage 0.
+func WorktreeChanges(repo *GitRepository, index *GitIndex) ([]*WorktreeChange, error) {
+	var changes []*WorktreeChange
+	for _, e := range index.Entries {
+		if e.Stage() != 0 {
+			continue
+		}
+		modified, err := IsEntryModified(repo, e)
+		if err != nil {
+			return nil, err
+		}
+		if !modified {
+			continue
+		}
+		_, err = os.Lstat(worktreeFile(repo, e.FilePath))
+		changes = append(changes, &WorktreeChange{Path: e.FilePath, Deleted: err != nil})
+	}
+	return changes, nil
+}
+
+// UntrackedFile is a file in worktree which is not in the index.
+// Dir is true for a nested repository or an empty directory.
+// Ignored is true if it is matched by ignore rules, including rules of its leading directories.
+type UntrackedFile struct {
+	Path    string
+	Dir     bool
+	Ignored bool
+}
+
+// ListUntracked return files in worktree which are not in the index, sorted by path.
+// nested repositories are not walked. ignore may be nil, then nothing is ignored.
+func ListUntracked(repo *GitRepository, index *GitIndex, ignore *IgnoreMatcher) ([]*UntrackedFile, error) {
+	tracked := map[string]bool{}
+	trackedDirs := map[string]bool{}
+	for _, e := range index.Entries {
+		tracked[e.FilePath] = true
+		for dir := path.Dir(e.FilePath); dir != "."; dir = path.Dir(dir) {
+			trackedDirs[dir] = true
+		}
+	}
+	var files []*UntrackedFile
+	err := listUntracked(repo, "", false, tracked, trackedDirs, ignore, &files)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Path < files[j].Path })
+	return files, nil
+}
+
+func listUntracked(repo *GitRepository, dir string, ignored bool, tracked, trackedDirs map[string]bool, ignore *IgnoreMatcher, files *[]*UntrackedFile) error {
+	infos, err := ioutil.ReadDir(worktreeFile(repo, dir))
+	if err != nil {
+		return err
+	}
+	if len(infos) == 0 && dir != "" && !trackedDirs[dir] {
+		*files = append(*files, &UntrackedFile{Path: dir, Dir: true, Ignored: ignored})
+	}
+	for _, info := range infos {
+		if info.Name() == ".git" {
+			continue
+		}
+		name := path.Join(dir, info.Name())
+		if tracked[name] {
+			continue
+		}
+		isDir := info.IsDir()
+		fileIgnored := ignored || (ignore != nil && ignore.Match(name, isDir))
+		if !isDir {
+			*files = append(*files, &UntrackedFile{Path: name, Ignored: fileIgnored})
+			continue
+		}
+		if !trackedDirs[name] {
+			if _, ok := nestedRepoHead(worktreeFile(repo, name)); ok {
+				*files = append(*files, &UntrackedFile{Path: name, Dir: true, Ignored: fileIgnored})
+				continue
+			}
+		}
+		if err := listUntracked(repo, name, fileIgnored, tracked, trackedDirs, ignore, files); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CheckoutOptions is options of CheckoutIndex.
+// Force overwrites local modifications of files which are the same between indexes,
+// which is limited to files matching Pathspecs if they are given.
+// Contents are written to worktree instead of blobs, which is used for conflicted files.
+type CheckoutOptions struct {
+	Force     bool
+	Pathspecs []string
+	Contents  map[string][]byte
+}
+
+// CheckoutIndex update worktree from the current index to index, and write index.
+// files which are removed from the index are removed from worktree,
+// and files which are changed are written. other files are left untouched.
+func CheckoutIndex(repo *GitRepository, current, index *GitIndex, opts CheckoutOptions) error {
+	if repo.Bare {
+		return fmt.Errorf("Cannot checkout in bare repository")
+	}
+	olds := map[string]*IndexEntry{}
+	for _, e := range current.Entries {
+		if old, ok := olds[e.FilePath]; !ok || old.Stage() != 0 {
+			olds[e.FilePath] = e
+		}
+	}
+	news := map[string]bool{}
+	for _, e := range index.Entries {
+		news[e.FilePath] = true
+	}
+	for name := range olds {
+		if news[name] {
+			continue
+		}
+		file := worktreeFile(repo, name)
+		if info, err := os.Lstat(file); err == nil && !info.IsDir() {
+			if err := os.Remove(file); err != nil {
+				return err
+			}
+		}
+		removeEmptyDirs(filepath.Dir(file), repo.Worktree)
+	}
+
+	written := map[string]bool{}
+	var entries []*IndexEntry
+	for _, e := range index.Entries {
+		if e.Stage() != 0 {
+			if content, ok := opts.Contents[e.FilePath]; ok && !written[e.FilePath] && e.Stage() > 1 {
+				written[e.FilePath] = true
+				if err := writeWorktreeFile(repo, e.FilePath, e.Mode, content); err != nil {
+					return err
+				}
+			}
+			entries = append(entries, e)
+			continue
+		}
+		old := olds[e.FilePath]
+		if old != nil && old.Stage() == 0 && old.ObjectID == e.ObjectID && canonicalMode(old.Mode) == canonicalMode(e.Mode) {
+			modified := false
+			if opts.Force && MatchPathspec(opts.Pathspecs, e.FilePath) {
+				var err error
+				if modified, err = IsEntryModified(repo, old); err != nil {
+					return err
+				}
+			}
+			if !modified {
+				entries = append(entries, old)
+				continue
+			}
+		}
+		ie, err := checkoutEntry(repo, e, opts.Contents)
+		if err != nil {
+			return err
+		}
+		entries = append(entries, ie)
+	}
+	newIndex := &GitIndex{Entries: entries}
+	SortIndex(newIndex)
+	return WriteIndex(repo, newIndex)
+}
+
+// checkoutEntry write the file of the entry to worktree, and return the entry with stat information.
+func checkoutEntry(repo *GitRepository, e *IndexEntry, contents map[string][]byte) (*IndexEntry, error) {
+	file := worktreeFile(repo, e.FilePath)
+	if info, err := os.Lstat(file); err == nil && info.IsDir() && e.Mode&modeTypeMask != ModeGitlink {
+		if err := os.RemoveAll(file); err != nil {
+			return nil, err
+		}
+	}
+	var err error
+	if content, ok := contents[e.FilePath]; ok {
+		err = writeWorktreeFile(repo, e.FilePath, e.Mode, content)
+	} else if e.Mode&modeTypeMask == ModeGitlink {
+		err = os.MkdirAll(file, repoDirPerm())
+	} else {
+		err = checkoutFile(repo, &GitTreeEntry{Mode: e.Mode, Path: e.FilePath, Sha: e.ObjectID}, file)
+	}
+	if err != nil {
+		return nil, err
+	}
+	info, err := os.Lstat(file)
+	if err != nil {
+		return nil, err
+	}
+	ie := NewIndexEntry(info, e.FilePath, e.ObjectID)
+	ie.Mode = canonicalMode(e.Mode)
+	ie.Flags = e.Flags
+	return ie, nil
+}
+
+// writeWorktreeFile write content to the file in worktree.
+func writeWorktreeFile(repo *GitRepository, name string, mode os.FileMode, content []byte) error {
+	file := worktreeFile(repo, name)
+	if err := os.MkdirAll(filepath.Dir(file), repoDirPerm()); err != nil {
+		return err
+	}
+	os.Remove(file)
+	if mode&modeTypeMask == ModeSymlink {
+		return os.Symlink(string(content), file)
+	}
+	perm := os.FileMode(0644)
+	if mode&0111 != 0 {
+		perm = 0755
+	}
+	return ioutil.WriteFile(file, content, perm)
+}
+
+// CheckWorktreeOverwrite return an error if updating worktree from the current index to index
+// loses local modifications of tracked files or untracked files. action is used in the error message.
+func CheckWorktreeOverwrite(repo *GitRepository, current, index *GitIndex, action string) error {
+	olds := map[string]*IndexEntry{}
+	for _, e := range current.Entries {
+		olds[e.FilePath] = e
+	}
+	news := map[string]*IndexEntry{}
+	conflicted := map[string]bool{}
+	for _, e := range index.Entries {
+		if e.Stage() == 0 {
+			news[e.FilePath] = e
+		} else {
+			conflicted[e.FilePath] = true
+		}
+	}
+	names := map[string]bool{}
+	for name := range olds {
+		names[name] = true
+	}
+	for name := range news {
+		names[name] = true
+	}
+	for name := range conflicted {
+		names[name] = true
+	}
+
+	var modified, untracked []string
+	for name := range names {
+		old, e := olds[name], news[name]
+		if old == nil {
+			sha, _, err := HashWorktreeFile(repo, name, false)
+			if err == nil && (e == nil || sha != e.ObjectID) {
+				untracked = append(untracked, name)
+			}
+			continue
+		}
+		if old.Stage() != 0 {
+			continue
+		}
+		if e != nil && old.ObjectID == e.ObjectID && canonicalMode(old.Mode) == canonicalMode(e.Mode) {
+			continue
+		}
+		changed, err := IsEntryModified(repo, old)
+		if err != nil {
+			return err
+		}
+		if !changed {
+			continue
+		}
+		// a deleted file is not lost by removing it
+		if _, err := os.Lstat(worktreeFile(repo, name)); err != nil && e == nil && !conflicted[name] {
+			continue
+		}
+		modified = append(modified, name)
+	}
+	if len(modified) > 0 {
+		sort.Strings(modified)
+		return fmt.Errorf("Your local changes to the following files would be overwritten by %s:\n\t%s\nPlease commit your changes or stash them before you %s.",
+			action, strings.Join(modified, "\n\t"), action)
+	}
+	if len(untracked) > 0 {
+		sort.Strings(untracked)
+		return fmt.Errorf("The following untracked working tree files would be overwritten by %s:\n\t%s\nPlease move or remove them before you %s.",
+			action, strings.Join(untracked, "\n\t"), action)
+	}
+	return nil
+}